@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+)
+
+// Config is the adapter's configuration (see package config for the tags).
+// Hot settings are read from settings.Current() per request, except the log
+// level and the budgets, which applySettings in main sets on reload.
+type Config struct {
+	Port     string `config:"port" env:"PORT"`
+	GinMode  string `config:"gin_mode" env:"GIN_MODE"`
+	LogLevel string `config:"log_level,hot" env:"LOG_LEVEL"`
+
+	Server server.Config `config:"server"`
+	Ollama OllamaConfig  `config:"ollama"`
+	Health health.Config `config:"health"`
+	Budget budget.Config `config:"budget,hot"` // Time budgets of incoming requests
+	MTLS   mtls.Config   `config:"mtls"`       // Mutual TLS towards the coordinator
+}
+
+// OllamaConfig locates Ollama and controls generations
+type OllamaConfig struct {
+	URL             string        `config:"url" env:"OLLAMA_API_URL"`
+	DefaultModel    string        `config:"default_model,hot" env:"OLLAMA_ANONYMIZE_MODEL"`     // Used when a request names no model
+	GenerateTimeout time.Duration `config:"generate_timeout,hot" env:"OLLAMA_GENERATE_TIMEOUT"` // Keep below the coordinator's timeout
+	ExpectedLatency time.Duration `config:"expected_latency,hot" env:"OLLAMA_EXPECTED_LATENCY"` // Assumed generation time of models not measured yet; 0 admits them whatever their budget
+}
+
+// defaultConfig returns the settings used when neither the file nor the
+// environment sets them
+func defaultConfig() Config {
+	return Config{
+		Port:     "8084", // Default port for Ollama adapter
+		GinMode:  "debug",
+		LogLevel: "info",
+		Server:   server.DefaultConfig(),
+		Ollama: OllamaConfig{
+			URL:             "http://host.docker.internal:11434", // Default for compose environment
+			DefaultModel:    "mistral:7b",
+			GenerateTimeout: 55 * time.Second,
+			ExpectedLatency: 5 * time.Second,
+		},
+		Health: health.DefaultConfig(3 * time.Second), // Heartbeat plus two model listings
+		Budget: budget.DefaultConfig(),
+		MTLS:   mtls.DefaultConfig([]string{"ai-coordinator"}, nil),
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	if _, ok := logging.ParseLevel(c.LogLevel); !ok {
+		errs = append(errs, fmt.Errorf("log_level: unsupported level %q (expected debug, info, warn or error)", c.LogLevel))
+	}
+	errs = append(errs, c.Server.Validate())
+	if u, err := url.Parse(c.Ollama.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("ollama.url: expected an absolute URL such as http://ollama:11434, got %q", c.Ollama.URL))
+	}
+	if c.Ollama.DefaultModel == "" {
+		errs = append(errs, errors.New("ollama.default_model: required (OLLAMA_ANONYMIZE_MODEL)"))
+	}
+	if c.Ollama.GenerateTimeout <= 0 {
+		errs = append(errs, errors.New("ollama.generate_timeout: must be positive"))
+	}
+	if c.Ollama.ExpectedLatency < 0 {
+		errs = append(errs, errors.New("ollama.expected_latency: must not be negative"))
+	}
+	errs = append(errs, c.Health.Validate(), c.Budget.Validate(), c.MTLS.Validate())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+)
+
+// latencyWeight is the weight of the newest generation in a model's moving
+// average: recent enough to follow a model being reloaded or the host
+// getting busier, smooth enough that one slow generation does not turn
+// callers away
+const latencyWeight = 0.2
+
+// latencies holds the expected generation time of every model that has
+// completed a generation
+var latencies = &latencyEstimates{byModel: make(map[string]time.Duration)}
+
+// latencyEstimates tracks a moving average of the generation time per model.
+// Only successful generations are observed, so only models that exist on the
+// Ollama server get an entry.
+type latencyEstimates struct {
+	mu      sync.Mutex
+	byModel map[string]time.Duration
+}
+
+// observe adds a successful generation of model that took d
+func (e *latencyEstimates) observe(model string, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	avg, ok := e.byModel[model]
+	if !ok {
+		e.byModel[model] = d
+		return
+	}
+	e.byModel[model] = avg + time.Duration(latencyWeight*float64(d-avg))
+}
+
+// expected returns how long a generation of model is expected to take, or
+// fallback if none has been observed yet
+func (e *latencyEstimates) expected(model string, fallback time.Duration) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if avg, ok := e.byModel[model]; ok {
+		return avg
+	}
+	return fallback
+}
+
+// checkBudget refuses a generation with model when ctx's deadline leaves less
+// time than the model is expected to need. Such a generation would most
+// likely be cut off by the deadline after occupying Ollama for nothing.
+func checkBudget(ctx context.Context, model string) *apierror.Error {
+	left, ok := budget.Remaining(ctx)
+	if !ok {
+		return nil
+	}
+	expected := latencies.expected(model, settings.Current().Ollama.ExpectedLatency)
+	if left >= expected {
+		return nil
+	}
+	return apierror.DeadlineExceeded(fmt.Sprintf("Model '%s' usually needs %dms, but only %dms of the request's time budget are left", model, expected.Milliseconds(), max(left.Milliseconds(), 0)))
+}
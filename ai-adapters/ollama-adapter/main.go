@@ -2,23 +2,41 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
 	"github.com/gin-gonic/gin"
 	"github.com/ollama/ollama/api" // Import the official Ollama API library
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Configuration
 var (
-	ollamaHost         string // e.g., "http://ollama:11434"
-	defaultOllamaModel string
-	ollamaClient       *api.Client // Use the official client
+	settings     *config.Manager[Config]
+	ollamaClient *api.Client // Use the official client
 )
 
 // Request structure for this adapter's endpoint
@@ -30,65 +48,125 @@ type AdapterAnonymizeRequest struct {
 // Response structure for this adapter's endpoint
 type AdapterAnonymizeResponse struct {
 	AnonymizedText string `json:"anonymized_text"`
-	ModelUsed      string `json:"model_used"` // Return the actual model used
+	ModelUsed      string `json:"model_used"`     // Return the actual model used
+	PromptVersion  string `json:"prompt_version"` // Prompt template that produced the output
+}
+
+// AdapterStreamChunk is one line of the newline-delimited JSON stream returned
+// by /anonymize/stream. The last line has Done set (or Error on failure).
+type AdapterStreamChunk struct {
+	Token     string          `json:"token,omitempty"`
+	Done      bool            `json:"done,omitempty"`
+	ModelUsed string          `json:"model_used,omitempty"`
+	Error     *apierror.Error `json:"error,omitempty"`
 }
 
+// modelNotFoundPattern matches Ollama's error for a model that is not pulled,
+// e.g. `model "foo" not found, try pulling it first`. The client library only
+// exposes it as a plain error string.
+var modelNotFoundPattern = regexp.MustCompile(`(?i)model ["'][^"']*["'] not found`)
+
 // main function: Entry point of the service
+func init() {
+	servicekit.SetName("ollama-adapter") // Reported in error envelopes, logs and spans
+}
+
 func main() {
-	// --- Configuration ---
-	ollamaHost = os.Getenv("OLLAMA_API_URL") // Expecting URL like http://ollama:11434
-	if ollamaHost == "" {
-		ollamaHost = "http://host.docker.internal:11434" // Default for compose environment
-		log.Printf("Warning: OLLAMA_API_URL not set, defaulting to %s", ollamaHost)
+	logging.Setup()
+
+	// --- Tracing ---
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(ctx)
+	}()
 
-	defaultOllamaModel = os.Getenv("OLLAMA_ANONYMIZE_MODEL")
-	if defaultOllamaModel == "" {
-		defaultOllamaModel = "mistral:7b" // Default model if not specified
-		log.Printf("Warning: OLLAMA_ANONYMIZE_MODEL not set, defaulting to %s", defaultOllamaModel)
+	// --- Configuration ---
+	settings, err = config.NewManager(os.Getenv(config.FileEnv), defaultConfig())
+	if err != nil {
+		logging.Fatal("Failed to load configuration", "error", err)
 	}
+	cfg := settings.Current()
+	ollamaHost := cfg.Ollama.URL // e.g., "http://ollama:11434"
+
+	// The Ollama settings are read per request; only the log level and the
+	// budgets need applying on reload
+	budgets := budget.NewPolicy(cfg.Budget)
+	applySettings := func(cfg *Config) {
+		level, _ := logging.ParseLevel(cfg.LogLevel)
+		logging.SetLevel(level)
+		budgets.SetConfig(cfg.Budget)
+	}
+	applySettings(cfg)
+	settings.OnReload(applySettings)
 
 	// --- Initialize Ollama Client ---
-	var err error
 	ollamaClient, err = newOllamaClient(ollamaHost)
 	if err != nil {
-		log.Fatalf("Failed to create Ollama client: %v", err)
+		logging.Fatal("Failed to create Ollama client", "error", err)
 	}
 	// Test connection during startup (optional but recommended)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := ollamaClient.Heartbeat(ctx); err != nil {
-		log.Printf("Warning: Could not connect to Ollama at %s during startup: %v", ollamaHost, err)
+		slog.Warn("Could not connect to Ollama during startup", "ollama_host", ollamaHost, "error", err)
 		// Depending on requirements, you might choose to exit here if connection is critical
 	} else {
-		log.Printf("Successfully connected to Ollama at %s during startup", ollamaHost)
+		slog.Info("Connected to Ollama during startup", "ollama_host", ollamaHost)
 	}
 	// ------------------------------
 
-	// --- Gin Setup ---
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode == "" {
-		ginMode = gin.DebugMode
+	// --- HTTP Server ---
+	serverConfig := cfg.Server
+	serverConfig.Addr = ":" + cfg.Port
+	httpServer := server.New(serverConfig)
+
+	// --- Mutual TLS ---
+	// The coordinator's calls are served over mTLS when enabled; certs is nil otherwise
+	certs, err := mtls.Load(cfg.MTLS)
+	if err != nil {
+		logging.Fatal("Failed to load the mTLS certificates", "error", err)
+	}
+	if certs != nil {
+		httpServer.UseTLS(certs.ServerConfig())
 	}
-	gin.SetMode(ginMode)
-	router := gin.Default() // Includes logger and recovery middleware
 
-	// --- Routes ---
-	router.GET("/health", healthCheckHandler)
-	router.POST("/anonymize", anonymizeTextHandler) // Endpoint for AI Coordinator to call
+	// --- Gin Setup ---
+	gin.SetMode(cfg.GinMode)
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), budgets.Middleware())
 
-	// --- Start Server ---
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8084" // Default port for Ollama adapter
+	// --- Health Checks ---
+	readiness, deepHealth := newHealthCheckers(cfg.Health)
+
+	// --- Routes ---
+	router.GET("/health", httpServer.FailWhileDraining(), healthCheckHandler)
+	router.GET("/livez", health.LiveHandler(serviceName))
+	router.GET("/readyz", httpServer.FailWhileDraining(), readiness.Handler())
+	router.GET("/health/deep", deepHealth.Handler())
+	router.GET("/metrics", metrics.Handler())                              // Prometheus scrape endpoint
+	router.POST("/anonymize", certs.RequireClient(), anonymizeTextHandler) // Endpoint for AI Coordinator to call
+	router.POST("/anonymize/stream", certs.RequireClient(), anonymizeTextStreamHandler)
+	// Configuration in effect, secrets redacted; only served to callers with a
+	// client certificate, so not at all without mTLS
+	if certs != nil {
+		router.GET("/config", certs.RequireClient(), settings.Handler())
 	}
-	serverAddr := fmt.Sprintf(":%s", port)
 
-	log.Printf("Ollama Adapter Service starting on port %s", port)
-	log.Printf("--> Targeting Ollama API at: %s", ollamaHost)
-	log.Printf("--> Default Ollama Model: %s", defaultOllamaModel)
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start Ollama Adapter Service: %v", err)
+	// --- Start Server ---
+	slog.Info("Ollama Adapter Service starting", "port", cfg.Port, "ollama_host", ollamaHost, "default_model", cfg.Ollama.DefaultModel, "mtls", cfg.MTLS.Enabled, "shutdown_grace_period", serverConfig.GracePeriod.String())
+	// On SIGINT or SIGTERM, generations still running after the grace period
+	// are cancelled and answered with shutting_down (see ollamaError)
+	ctx, stop := server.NotifyContext()
+	defer stop()
+	go settings.Watch(ctx, config.WatchInterval) // Reload on SIGHUP or when the file changes
+	go certs.Watch(ctx, mtls.WatchInterval)      // Reload rotated certificates
+	if err := httpServer.Serve(ctx, router); err != nil {
+		logging.Fatal("Ollama Adapter Service stopped", "error", err)
 	}
 }
 
@@ -100,12 +178,81 @@ func newOllamaClient(host string) (*api.Client, error) {
 		return nil, fmt.Errorf("invalid Ollama API URL '%s': %w", host, err)
 	}
 
-	// Create the client using the parsed URL parts
-	// You can customize the underlying http.Client if needed (timeouts, transport, etc.)
-	client := api.NewClient(parsedURL, http.DefaultClient)
+	// Create the client using the parsed URL parts. Calls to Ollama get client
+	// spans; timeouts come from the contexts passed to each call.
+	client := api.NewClient(parsedURL, &http.Client{Transport: metrics.Transport("ollama", telemetry.Transport(nil))})
 	return client, nil
 }
 
+// serviceName identifies the service in health reports
+const serviceName = "Ollama Adapter Service"
+
+// newHealthCheckers builds the readiness check, Ollama's heartbeat, and the
+// deep check, which also looks at the default model
+func newHealthCheckers(cfg health.Config) (readiness, deep *health.Checker) {
+	readiness = health.NewChecker(serviceName, cfg.Timeout, cfg.CacheTTL)
+	readiness.Add("ollama", true, func(ctx context.Context) (*health.Report, error) {
+		return nil, ollamaClient.Heartbeat(ctx)
+	})
+	deep = health.NewChecker(serviceName, cfg.DeepTimeout, cfg.CacheTTL)
+	deep.Add("ollama", true, probeOllamaModels)
+	return readiness, deep
+}
+
+// probeOllamaModels checks Ollama's heartbeat and reports whether the default
+// model is pulled (requests without a model fail if not) and loaded into
+// memory (the first request waits for it to load if not)
+func probeOllamaModels(ctx context.Context) (*health.Report, error) {
+	if err := ollamaClient.Heartbeat(ctx); err != nil {
+		return nil, err
+	}
+	model := settings.Current().Ollama.DefaultModel
+	details := map[string]any{"default_model": model}
+	report := &health.Report{Service: "Ollama", Details: details}
+
+	pulled, err := ollamaClient.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("listing models: %w", err)
+	}
+	var pulledNames []string
+	for _, m := range pulled.Models {
+		pulledNames = append(pulledNames, m.Name)
+	}
+	running, err := ollamaClient.ListRunning(ctx)
+	if err != nil {
+		return report, fmt.Errorf("listing loaded models: %w", err)
+	}
+	var runningNames []string
+	for _, m := range running.Models {
+		runningNames = append(runningNames, m.Name)
+	}
+
+	isPulled := hasModel(pulledNames, model)
+	details["model_pulled"] = isPulled
+	details["model_loaded"] = hasModel(runningNames, model)
+	if !isPulled {
+		return report, fmt.Errorf("default model %q is not pulled", model)
+	}
+	return report, nil
+}
+
+// hasModel reports whether names contains model. A name without a tag means
+// the latest tag, as in Ollama.
+func hasModel(names []string, model string) bool {
+	withTag := func(name string) string {
+		if !strings.Contains(name, ":") {
+			return name + ":latest"
+		}
+		return name
+	}
+	for _, name := range names {
+		if withTag(name) == withTag(model) {
+			return true
+		}
+	}
+	return false
+}
+
 // healthCheckHandler checks the connectivity to the configured Ollama instance.
 func healthCheckHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second) // Use request context with timeout
@@ -113,7 +260,7 @@ func healthCheckHandler(c *gin.Context) {
 
 	err := ollamaClient.Heartbeat(ctx)
 	if err != nil {
-		log.Printf("Health check failed: Could not connect to Ollama at %s: %v", ollamaHost, err)
+		slog.WarnContext(c.Request.Context(), "Health check failed: could not connect to Ollama", "ollama_host", settings.Current().Ollama.URL, "error", err)
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":             "Unavailable",
 			"service":            "Ollama Adapter Service",
@@ -125,7 +272,7 @@ func healthCheckHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":             "OK",
 		"service":            "Ollama Adapter Service",
-		"default_model":      defaultOllamaModel,
+		"default_model":      settings.Current().Ollama.DefaultModel,
 		"ollama_host_status": "Reachable",
 	})
 }
@@ -134,25 +281,31 @@ func healthCheckHandler(c *gin.Context) {
 func anonymizeTextHandler(c *gin.Context) {
 	var req AdapterAnonymizeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Ollama Adapter: Error binding JSON for /anonymize: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		slog.InfoContext(c.Request.Context(), "Invalid anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
 		return
 	}
 
 	// Determine model to use: request override or default
 	modelToUse := req.Model
 	if modelToUse == "" {
-		modelToUse = defaultOllamaModel
+		modelToUse = settings.Current().Ollama.DefaultModel
+	}
+
+	if apiErr := checkBudget(c.Request.Context(), modelToUse); apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
 	}
 
 	// --- Call Ollama using Go Client ---
-	log.Printf("Ollama Adapter: Requesting anonymization from model '%s'", modelToUse)
+	slog.DebugContext(c.Request.Context(), "Requesting anonymization", "model", modelToUse)
 	// Pass the request context down to the Ollama call
 	anonymizedText, err := callOllamaAnonymize(c.Request.Context(), req.Text, modelToUse)
 	if err != nil {
-		log.Printf("Ollama Adapter: Error calling Ollama model '%s': %v", modelToUse, err)
-		// Return a server error if the call failed
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to anonymize via Ollama model %s: %v", modelToUse, err)})
+		// The mapped error, since Ollama's error messages may echo the prompt
+		apiErr := ollamaError(c.Request.Context(), err, modelToUse)
+		slog.WarnContext(c.Request.Context(), "Ollama generation failed", "model", modelToUse, "error", apiErr)
+		apierror.Respond(c, apiErr)
 		return
 	}
 	// -----------------------------------
@@ -161,13 +314,121 @@ func anonymizeTextHandler(c *gin.Context) {
 	resp := AdapterAnonymizeResponse{
 		AnonymizedText: anonymizedText,
 		ModelUsed:      modelToUse, // Report which model was actually used
+		PromptVersion:  anonymizePromptVersion,
 	}
 	c.JSON(http.StatusOK, resp)
 }
 
-// callOllamaAnonymize constructs the prompt and calls the Ollama generate endpoint
-// using the official Ollama client library. (Corrected)
-func callOllamaAnonymize(ctx context.Context, textToAnonymize string, modelName string) (string, error) {
+// ollamaError maps a failed Generate call to the error returned to the coordinator.
+// ctx is the context the call ran with.
+func ollamaError(ctx context.Context, err error, model string) *apierror.Error {
+	var statusErr api.StatusError
+	switch {
+	case errors.Is(context.Cause(ctx), server.ErrShutdown):
+		return apierror.New(http.StatusServiceUnavailable, apierror.CodeShuttingDown, fmt.Sprintf("Generation with model '%s' was cancelled because the adapter is shutting down", model))
+	case modelNotFoundPattern.MatchString(err.Error()),
+		errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return apierror.New(http.StatusNotFound, apierror.CodeModelNotFound, fmt.Sprintf("Model '%s' is not available on the Ollama server", model))
+	case errors.As(err, &statusErr) && statusErr.StatusCode < http.StatusInternalServerError:
+		return apierror.InvalidRequest(fmt.Sprintf("Ollama rejected the request for model '%s'", model))
+	}
+
+	// Connection failures and timeouts surface as *url.Error or context errors;
+	// anything else is an error message reported by Ollama itself
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return apierror.FromTransport(err, "Ollama")
+	}
+	return apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, fmt.Sprintf("Ollama failed to run model '%s'", model))
+}
+
+// anonymizePromptVersion identifies the prompt template built by
+// newAnonymizeRequest. Bump it whenever the system or user prompt changes so
+// traces show which template produced an output, and so the anonymizer's
+// result cache stops reusing outputs of the previous template.
+const anonymizePromptVersion = "anonymize-v1"
+
+var tracer = otel.Tracer("privacypilot-ollama-adapter")
+
+// generation traces and measures one Ollama Generate call. Only metadata is
+// recorded; prompts and generated text never are.
+type generation struct {
+	ctx   context.Context
+	model string
+	mode  string
+	start time.Time
+	span  trace.Span
+}
+
+// startGeneration starts the span around a Generate call
+func startGeneration(ctx context.Context, model string, stream bool) (context.Context, *generation) {
+	mode := modeSync
+	if stream {
+		mode = modeStream
+	}
+	ctx, span := tracer.Start(ctx, "ollama.generate", trace.WithAttributes(
+		attribute.String("gen_ai.system", "ollama"),
+		attribute.String("gen_ai.operation.name", "generate"),
+		attribute.String("gen_ai.request.model", model),
+		attribute.String("privacypilot.prompt.version", anonymizePromptVersion),
+		attribute.Bool("privacypilot.stream", stream),
+	))
+	return ctx, &generation{ctx: ctx, model: model, mode: mode, start: time.Now(), span: span}
+}
+
+// finish records the outcome, latency and Ollama's metrics from the final
+// response (if any), then ends the span
+func (g *generation) finish(final *api.GenerateResponse, err error) {
+	if final != nil && final.Done {
+		g.span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", final.PromptEvalCount),
+			attribute.Int("gen_ai.usage.output_tokens", final.EvalCount),
+		)
+		if final.DoneReason != "" {
+			g.span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{final.DoneReason}))
+		}
+	}
+
+	outcome, model := outcomeSuccess, g.model
+	if err == nil {
+		latencies.observe(g.model, time.Since(g.start))
+	} else {
+		outcome = ollamaError(g.ctx, err, g.model).Code
+		// The error code, not the error text, which could echo model output
+		g.span.SetStatus(codes.Error, outcome)
+		if outcome == apierror.CodeModelNotFound {
+			model = unknownModel
+		}
+	}
+	observeGeneration(model, g.mode, outcome, time.Since(g.start), final)
+	g.span.End()
+}
+
+// placeholderPattern matches the placeholders the prompt asks the model to use, e.g. [EMAIL]
+var placeholderPattern = regexp.MustCompile(`\[([A-Z][A-Z_]*)\]`)
+
+// knownEntityTypes are the placeholders named in the prompt. Any others the
+// model invents are counted as OTHER so they cannot grow the metric labels.
+var knownEntityTypes = map[string]bool{
+	"NAME": true, "EMAIL": true, "PHONE": true, "ADDRESS": true, "CREDIT_CARD": true, "SSN": true,
+}
+
+// countEntities counts the placeholders in anonymized text by entity type
+func countEntities(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		entityType := m[1]
+		if !knownEntityTypes[entityType] {
+			entityType = "OTHER"
+		}
+		counts[entityType]++
+	}
+	return counts
+}
+
+// newAnonymizeRequest builds the Ollama generate request (system prompt, user
+// prompt and options) used for anonymization, streaming or not
+func newAnonymizeRequest(textToAnonymize string, modelName string, stream bool) *api.GenerateRequest {
 	// Define the system prompt instructing the model on its task
 	systemPrompt := "You are an expert text anonymizer. Your task is to identify and replace Personal Identifiable Information (PII) in the provided text with placeholders like [NAME], [EMAIL], [PHONE], [ADDRESS], [CREDIT_CARD], [SSN], etc. Only output the anonymized text, without any introductory phrases, explanations, or markdown formatting. Preserve the original structure and non-sensitive parts of the text."
 
@@ -175,16 +436,21 @@ func callOllamaAnonymize(ctx context.Context, textToAnonymize string, modelName
 	prompt := fmt.Sprintf("Anonymize the following text:\n\n\"%s\"", textToAnonymize)
 
 	// Prepare the request for the Ollama API client
-	ollamaReq := api.GenerateRequest{
+	return &api.GenerateRequest{
 		Model:  modelName,
 		Prompt: prompt,
 		System: systemPrompt,
-		Stream: new(bool), // Pointer to false for non-streaming response
+		Stream: &stream,
 		Options: map[string]interface{}{
 			"temperature": 0.2, // Adjust model parameters as needed (lower temp for less creativity)
 		},
 	}
-	*ollamaReq.Stream = false // Explicitly set stream to false
+}
+
+// callOllamaAnonymize constructs the prompt and calls the Ollama generate endpoint
+// using the official Ollama client library. (Corrected)
+func callOllamaAnonymize(ctx context.Context, textToAnonymize string, modelName string) (string, error) {
+	ollamaReq := newAnonymizeRequest(textToAnonymize, modelName, false) // Non-streaming response
 
 	var responseBuilder strings.Builder
 	var lastResponse *api.GenerateResponse // Keep track of the final response object
@@ -196,17 +462,19 @@ func callOllamaAnonymize(ctx context.Context, textToAnonymize string, modelName
 		// Store the latest (likely only) response object for metadata access
 		lastResponse = &resp
 		if resp.Done {
-			log.Println("Ollama Adapter: Received 'done' signal from Ollama.")
+			slog.DebugContext(ctx, "Received done signal from Ollama")
 		}
 		return nil // Return nil to indicate successful processing of this response part
 	}
 
-	// Add a timeout specifically for the Generate call, slightly less than the adapter's HTTP timeout
-	generateCtx, cancel := context.WithTimeout(ctx, 55*time.Second)
+	// Add a timeout specifically for the Generate call, slightly less than the coordinator's
+	generateCtx, cancel := context.WithTimeout(ctx, settings.Current().Ollama.GenerateTimeout)
 	defer cancel()
 
 	// Execute the generate request
-	err := ollamaClient.Generate(generateCtx, &ollamaReq, responseFunc)
+	generateCtx, gen := startGeneration(generateCtx, modelName, false)
+	err := ollamaClient.Generate(generateCtx, ollamaReq, responseFunc)
+	gen.finish(lastResponse, err)
 	if err != nil {
 		// This catches errors like connection issues, model not found on Ollama server, timeouts, etc.
 		return "", fmt.Errorf("ollama client generate call failed for model '%s': %w", modelName, err)
@@ -229,9 +497,84 @@ func callOllamaAnonymize(ctx context.Context, textToAnonymize string, modelName
 
 	if anonymizedResult == "" {
 		// Log a warning if the model returned nothing, might indicate prompt issues or model limitations
-		log.Printf("Warning: Ollama model '%s' returned an empty response string.", modelName)
+		slog.WarnContext(ctx, "Ollama model returned an empty response", "model", modelName)
 	}
 
-	log.Printf("Ollama Adapter: Successfully received response from model '%s'.", modelName)
+	observeEntities(modelName, countEntities(anonymizedResult))
+	slog.DebugContext(ctx, "Received response from Ollama", "model", modelName)
 	return anonymizedResult, nil
 }
+
+// anonymizeTextStreamHandler streams generated tokens to the caller as
+// newline-delimited JSON (AdapterStreamChunk) while Ollama produces them.
+func anonymizeTextStreamHandler(c *gin.Context) {
+	var req AdapterAnonymizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid streaming anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	modelToUse := req.Model
+	if modelToUse == "" {
+		modelToUse = settings.Current().Ollama.DefaultModel
+	}
+
+	if apiErr := checkBudget(c.Request.Context(), modelToUse); apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Streaming anonymization", "model", modelToUse)
+
+	// The stream is only started with the first chunk, so failures that happen
+	// before any output (e.g. an unknown model) get a proper error status
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	writeChunk := func(chunk AdapterStreamChunk) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(chunk); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	// The request context is cancelled when the caller goes away, which stops generation
+	generateCtx, cancel := context.WithTimeout(c.Request.Context(), settings.Current().Ollama.GenerateTimeout)
+	defer cancel()
+
+	generateCtx, gen := startGeneration(generateCtx, modelToUse, true)
+	var final *api.GenerateResponse
+	var output strings.Builder // Only used to count entities once the stream is complete
+	err := ollamaClient.Generate(generateCtx, newAnonymizeRequest(req.Text, modelToUse, true), func(resp api.GenerateResponse) error {
+		if resp.Done {
+			final = &resp
+		}
+		if resp.Response == "" {
+			return nil
+		}
+		output.WriteString(resp.Response)
+		return writeChunk(AdapterStreamChunk{Token: resp.Response})
+	})
+	gen.finish(final, err)
+	if err != nil {
+		apiErr := ollamaError(generateCtx, err, modelToUse)
+		slog.WarnContext(c.Request.Context(), "Ollama streaming generation failed", "model", modelToUse, "error", apiErr)
+		if !started {
+			apierror.Respond(c, apiErr)
+			return
+		}
+		_ = writeChunk(AdapterStreamChunk{Error: apiErr})
+		return
+	}
+
+	observeEntities(modelToUse, countEntities(output.String()))
+	_ = writeChunk(AdapterStreamChunk{Done: true, ModelUsed: modelToUse})
+	slog.DebugContext(c.Request.Context(), "Finished streaming response", "model", modelToUse)
+}
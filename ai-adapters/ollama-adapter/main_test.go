@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanRecorder records the spans of all tests. The adapter's tracer stays
+// bound to the first provider installed globally, so there is only one.
+var spanRecorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+}
+
+// recordSpans returns a function listing the spans ended since it was called
+func recordSpans() func() []sdktrace.ReadOnlySpan {
+	before := len(spanRecorder.Ended())
+	return func() []sdktrace.ReadOnlySpan {
+		return spanRecorder.Ended()[before:]
+	}
+}
+
+// --- Fake Ollama Setup ---
+
+// fakeGeneration is what the fake Ollama answers a generate request with
+type fakeGeneration struct {
+	tokens  []string // Streamed one per line, or joined when not streaming
+	status  int      // Non-zero fails the request with this status and failure as the error
+	failure string   // With status zero, sent as an error line after the tokens
+}
+
+// setupFakeOllama serves Ollama's heartbeat and generate API. The generate
+// requests received are appended to received.
+func setupFakeOllama(t *testing.T, gen fakeGeneration, received *[]api.GenerateRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.URL.Path == "/" {
+			return
+		}
+		assert.Equal(t, "/api/generate", r.URL.Path)
+		var req api.GenerateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if received != nil {
+			*received = append(*received, req)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		if gen.status != 0 {
+			w.WriteHeader(gen.status)
+			_ = encoder.Encode(map[string]string{"error": gen.failure})
+			return
+		}
+		stream := req.Stream == nil || *req.Stream
+		if stream {
+			for _, token := range gen.tokens {
+				_ = encoder.Encode(api.GenerateResponse{Model: req.Model, Response: token})
+				w.(http.Flusher).Flush()
+			}
+		}
+		if gen.failure != "" {
+			_ = encoder.Encode(map[string]string{"error": gen.failure})
+			return
+		}
+		final := api.GenerateResponse{Model: req.Model, Done: true, DoneReason: "stop"}
+		final.PromptEvalCount, final.EvalCount, final.LoadDuration = 42, len(gen.tokens), 3*time.Millisecond
+		if !stream {
+			final.Response = strings.Join(gen.tokens, "")
+		}
+		_ = encoder.Encode(final)
+	}))
+}
+
+// setupAdapterRouter points the adapter at ollamaURL and registers its routes
+func setupAdapterRouter(t *testing.T, ollamaURL string) *gin.Engine {
+	cfg := defaultConfig()
+	cfg.Ollama.URL = ollamaURL
+	var err error
+	settings, err = config.NewManager("", cfg)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	ollamaClient, err = newOllamaClient(ollamaURL)
+	if err != nil {
+		t.Fatalf("Failed to create Ollama client: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), budget.NewPolicy(budget.DefaultConfig()).Middleware())
+	router.GET("/health", healthCheckHandler)
+	router.GET("/metrics", metrics.Handler())
+	router.POST("/anonymize", anonymizeTextHandler)
+	router.POST("/anonymize/stream", anonymizeTextStreamHandler)
+	return router
+}
+
+func postJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// readChunks decodes a newline-delimited JSON stream
+func readChunks(t *testing.T, body []byte) []AdapterStreamChunk {
+	t.Helper()
+	var chunks []AdapterStreamChunk
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var chunk AdapterStreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			t.Fatalf("Invalid stream line %q: %v", scanner.Text(), err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func decodeAPIError(t *testing.T, rr *httptest.ResponseRecorder) *apierror.Error {
+	t.Helper()
+	var envelope apierror.Envelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("Expected an error envelope, got %q", rr.Body.String())
+	}
+	return envelope.Error
+}
+
+// --- Tests ---
+
+func TestHealthCheck_ReportsOllama(t *testing.T) {
+	fake := setupFakeOllama(t, fakeGeneration{}, nil)
+	router := setupAdapterRouter(t, fake.URL)
+
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"ollama_host_status":"Reachable"`)
+
+	fake.Close()
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestAnonymize_ReturnsTheGeneratedText(t *testing.T) {
+	var received []api.GenerateRequest
+	fake := setupFakeOllama(t, fakeGeneration{tokens: []string{"  Call [NAME]", " at [PHONE] "}}, &received)
+	defer fake.Close()
+	router := setupAdapterRouter(t, fake.URL)
+
+	rr := postJSON(router, "/anonymize", `{"text": "Call Bob at 555-0100", "model": "llama3:8b"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp AdapterAnonymizeResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, AdapterAnonymizeResponse{AnonymizedText: "Call [NAME] at [PHONE]", ModelUsed: "llama3:8b", PromptVersion: anonymizePromptVersion}, resp)
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "llama3:8b", received[0].Model)
+		assert.False(t, *received[0].Stream)
+		assert.Contains(t, received[0].Prompt, "Call Bob at 555-0100")
+		assert.NotEmpty(t, received[0].System)
+	}
+
+	// Without a model the default is used
+	rr = postJSON(router, "/anonymize", `{"text": "Call Bob"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, defaultConfig().Ollama.DefaultModel, received[len(received)-1].Model)
+}
+
+func TestAnonymizeStream_RelaysTokens(t *testing.T) {
+	var received []api.GenerateRequest
+	fake := setupFakeOllama(t, fakeGeneration{tokens: []string{"Call ", "", "[NAME]", " at ", "[PHONE]"}}, &received)
+	defer fake.Close()
+	router := setupAdapterRouter(t, fake.URL)
+
+	rr := postJSON(router, "/anonymize/stream", `{"text": "Call Bob at 555-0100", "model": "llama3:8b"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	assert.Equal(t, []AdapterStreamChunk{
+		{Token: "Call "},
+		{Token: "[NAME]"}, // Empty responses are not relayed
+		{Token: " at "},
+		{Token: "[PHONE]"},
+		{Done: true, ModelUsed: "llama3:8b"},
+	}, readChunks(t, rr.Body.Bytes()))
+	if assert.Len(t, received, 1) {
+		assert.True(t, *received[0].Stream)
+	}
+}
+
+func TestAnonymizeStream_Errors(t *testing.T) {
+	// A failure before any output is answered with its status
+	fake := setupFakeOllama(t, fakeGeneration{status: http.StatusNotFound, failure: `model "nope" not found, try pulling it first`}, nil)
+	router := setupAdapterRouter(t, fake.URL)
+	rr := postJSON(router, "/anonymize/stream", `{"text": "Call Bob", "model": "nope"}`)
+	fake.Close()
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeModelNotFound, apiErr.Code)
+	assert.Equal(t, servicekit.Name(), apiErr.Service)
+
+	// Once streaming, a failure ends the stream with an error chunk
+	fake = setupFakeOllama(t, fakeGeneration{tokens: []string{"Call "}, failure: "out of memory"}, nil)
+	defer fake.Close()
+	router = setupAdapterRouter(t, fake.URL)
+	rr = postJSON(router, "/anonymize/stream", `{"text": "Call Bob"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	chunks := readChunks(t, rr.Body.Bytes())
+	if assert.Len(t, chunks, 2) {
+		assert.Equal(t, "Call ", chunks[0].Token)
+		if assert.NotNil(t, chunks[1].Error) {
+			assert.Equal(t, apierror.CodeUpstreamError, chunks[1].Error.Code)
+		}
+	}
+
+	// Malformed requests never reach Ollama
+	rr = postJSON(router, "/anonymize/stream", `{"model": "llama3"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, apierror.CodeInvalidRequest, decodeAPIError(t, rr).Code)
+}
+
+func TestOllamaError_MapsToEnvelopes(t *testing.T) {
+	shuttingDown, cancel := context.WithCancelCause(context.Background())
+	cancel(server.ErrShutdown)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		status int
+		code   string
+	}{
+		{"shutdown", shuttingDown, context.Canceled, http.StatusServiceUnavailable, apierror.CodeShuttingDown},
+		{"model not pulled", context.Background(), errors.New(`model "nope" not found, try pulling it first`), http.StatusNotFound, apierror.CodeModelNotFound},
+		{"not found status", context.Background(), api.StatusError{StatusCode: http.StatusNotFound}, http.StatusNotFound, apierror.CodeModelNotFound},
+		{"rejected", context.Background(), api.StatusError{StatusCode: http.StatusBadRequest, ErrorMessage: "invalid options"}, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"unreachable", context.Background(), &url.Error{Op: "Post", URL: "http://ollama:11434/api/generate", Err: errors.New("connection refused")}, http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable},
+		{"timed out", context.Background(), fmt.Errorf("generate: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, apierror.CodeUpstreamTimeout},
+		{"model failure", context.Background(), errors.New("out of memory"), http.StatusBadGateway, apierror.CodeUpstreamError},
+		{"server error status", context.Background(), api.StatusError{StatusCode: http.StatusInternalServerError}, http.StatusBadGateway, apierror.CodeUpstreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := ollamaError(tt.ctx, tt.err, "llama3")
+			assert.Equal(t, tt.status, apiErr.Status)
+			assert.Equal(t, tt.code, apiErr.Code)
+			assert.Equal(t, servicekit.Name(), apiErr.Service)
+			assert.NotContains(t, apiErr.Message, tt.err.Error(), "Ollama's error text is not passed on")
+		})
+	}
+}
+
+func TestGeneration_SpanHasMetadataButNoText(t *testing.T) {
+	ended := recordSpans()
+	const text = "Call Bob Smith at bob.smith@example.com"
+	const anonymized = "Call [NAME] at [EMAIL]"
+	fake := setupFakeOllama(t, fakeGeneration{tokens: []string{"Call [NAME]", " at [EMAIL]"}}, nil)
+	defer fake.Close()
+	router := setupAdapterRouter(t, fake.URL)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/anonymize", `{"text": "`+text+`", "model": "span-model"}`).Code)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/anonymize/stream", `{"text": "`+text+`", "model": "span-model"}`).Code)
+
+	// The requests and the calls to Ollama get spans of their own
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range ended() {
+		if span.Name() == "ollama.generate" {
+			spans = append(spans, span)
+		}
+	}
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	for i, span := range spans {
+		attrs := map[string]any{}
+		for _, kv := range span.Attributes() {
+			attrs[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		assert.Equal(t, "span-model", attrs["gen_ai.request.model"])
+		assert.Equal(t, anonymizePromptVersion, attrs["privacypilot.prompt.version"])
+		assert.Equal(t, i == 1, attrs["privacypilot.stream"])
+		assert.Equal(t, int64(42), attrs["gen_ai.usage.input_tokens"])
+		assert.Equal(t, int64(2), attrs["gen_ai.usage.output_tokens"])
+		assert.Equal(t, []string{"stop"}, attrs["gen_ai.response.finish_reasons"])
+
+		recorded := fmt.Sprint(span.Attributes(), span.Events(), span.Status())
+		for _, fragment := range []string{"Bob", "bob.smith@example.com", anonymized, "[NAME]"} {
+			assert.NotContains(t, recorded, fragment, "Text recorded on the span")
+		}
+	}
+}
+
+func TestGeneration_MetricsAreRecorded(t *testing.T) {
+	fake := setupFakeOllama(t, fakeGeneration{tokens: []string{"[NAME] and [NAME] at [EMAIL], [BADGE_ID]"}}, nil)
+	router := setupAdapterRouter(t, fake.URL)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/anonymize", `{"text": "x", "model": "metrics-model"}`).Code)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/anonymize/stream", `{"text": "x", "model": "metrics-model"}`).Code)
+	fake.Close()
+	fake = setupFakeOllama(t, fakeGeneration{status: http.StatusNotFound, failure: `model "metrics-missing" not found, try pulling it first`}, nil)
+	defer fake.Close()
+	router = setupAdapterRouter(t, fake.URL)
+	assert.Equal(t, http.StatusNotFound, postJSON(router, "/anonymize", `{"text": "x", "model": "metrics-missing"}`).Code)
+
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	body := rr.Body.String()
+
+	// Entities counted by type over both generations; invented placeholders are OTHER
+	assert.Contains(t, body, `privacypilot_anonymized_entities_total{entity_type="NAME",model="metrics-model"} 4`)
+	assert.Contains(t, body, `privacypilot_anonymized_entities_total{entity_type="EMAIL",model="metrics-model"} 2`)
+	assert.Contains(t, body, `privacypilot_anonymized_entities_total{entity_type="OTHER",model="metrics-model"} 2`)
+	assert.NotContains(t, body, "BADGE_ID")
+
+	assert.Contains(t, body, `privacypilot_ollama_generation_duration_seconds_count{mode="sync",model="metrics-model",outcome="success"} 1`)
+	assert.Contains(t, body, `privacypilot_ollama_generation_duration_seconds_count{mode="stream",model="metrics-model",outcome="success"} 1`)
+	assert.Contains(t, body, `privacypilot_ollama_prompt_eval_tokens_total{model="metrics-model"} 84`)
+	assert.Contains(t, body, `privacypilot_ollama_eval_tokens_total{model="metrics-model"} 2`)
+	assert.Contains(t, body, `privacypilot_ollama_load_duration_seconds_count{model="metrics-model"} 2`)
+	// Model names Ollama does not know come from callers and are not used as labels
+	assert.Contains(t, body, `privacypilot_ollama_generation_duration_seconds_count{mode="sync",model="unknown",outcome="model_not_found"} 1`)
+	assert.NotContains(t, body, "metrics-missing")
+}
+
+func TestBudget_RefusesGenerationsThatCannotFinish(t *testing.T) {
+	fake := setupFakeOllama(t, fakeGeneration{tokens: []string{"ok"}}, nil)
+	defer fake.Close()
+	router := setupAdapterRouter(t, fake.URL)
+
+	// Nothing measured yet for this model, so the configured expectation applies
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", strings.NewReader(`{"text": "x", "model": "budget-model"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(budget.Header, "1000")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Equal(t, apierror.CodeDeadlineExceeded, decodeAPIError(t, rr).Code)
+}
+
+// --- Logging Tests ---
+
+// logCanary is fake PII that must never reach the logs, spans or error bodies
+const logCanary = "Jane CANARY-7f3a9c Doe, jane.canary@example.com, +1 555 0199"
+
+// canaryFragments are the parts of logCanary looked for
+var canaryFragments = []string{"CANARY-7f3a9c", "jane.canary@example.com", "555 0199", "Jane"}
+
+// captureLogs sends the default logger to a buffer at debug level until the
+// test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestLogging_CanaryPIINeverLogged(t *testing.T) {
+	logs := captureLogs(t)
+	ended := recordSpans()
+
+	// Ollama echoes the prompt, and fails with it in the message when it contains "fail"
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			return // Heartbeat
+		}
+		var req api.GenerateRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		assert.Contains(t, req.Prompt, "CANARY-7f3a9c", "Fake: the canary should reach Ollama")
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		switch {
+		case strings.Contains(req.Prompt, "fail before"):
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(map[string]string{"error": "cannot process: " + req.Prompt})
+		case strings.Contains(req.Prompt, "fail"):
+			_ = encoder.Encode(api.GenerateResponse{Model: req.Model, Response: req.Prompt})
+			_ = encoder.Encode(map[string]string{"error": "cannot process: " + req.Prompt})
+		default:
+			_ = encoder.Encode(api.GenerateResponse{Model: req.Model, Response: req.Prompt, Done: true, DoneReason: "stop"})
+		}
+	}))
+	defer fake.Close()
+	router := setupAdapterRouter(t, fake.URL)
+	router.GET("/panic", func(c *gin.Context) { panic("processing " + logCanary) })
+
+	canary, _ := json.Marshal(logCanary)
+	failing, _ := json.Marshal(logCanary + " fail")
+	failingEarly, _ := json.Marshal(logCanary + " fail before")
+	query := "?q=" + url.QueryEscape(logCanary)
+	var errorBodies strings.Builder
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodGet, "/health" + query, ""},
+		{http.MethodGet, "/metrics" + query, ""},
+		{http.MethodGet, "/panic" + query, ""},
+		{http.MethodGet, "/no/such/" + url.PathEscape(logCanary), ""},
+		{http.MethodPost, "/anonymize" + query, fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s}`, failingEarly)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s, "model": 42}`, canary)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s`, canary)},
+		{http.MethodPost, "/anonymize/stream" + query, fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/anonymize/stream", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/anonymize/stream", fmt.Sprintf(`{"text": %s}`, failingEarly)},
+		{http.MethodPost, "/anonymize/stream", fmt.Sprintf(`{"text": %s, "model": 42}`, canary)},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code >= http.StatusBadRequest {
+			errorBodies.WriteString(rr.Body.String())
+		} else if strings.HasPrefix(r.path, "/anonymize/stream") {
+			for _, chunk := range readChunks(t, rr.Body.Bytes()) {
+				if chunk.Error != nil {
+					encoded, _ := json.Marshal(chunk.Error)
+					errorBodies.Write(encoded)
+				}
+			}
+		}
+	}
+
+	output := logs.String()
+	assert.Contains(t, output, `"route":"/anonymize/stream"`)
+	var spans strings.Builder
+	for _, span := range ended() {
+		fmt.Fprint(&spans, span.Name(), span.Attributes(), span.Events(), span.Status())
+	}
+	assert.Contains(t, spans.String(), "ollama.generate")
+	assert.Contains(t, errorBodies.String(), apierror.CodeUpstreamError)
+	for _, fragment := range canaryFragments {
+		assert.NotContains(t, output, fragment, "Canary PII leaked into the logs")
+		assert.NotContains(t, spans.String(), fragment, "Canary PII leaked into the spans")
+		assert.NotContains(t, errorBodies.String(), fragment, "Canary PII leaked into an error body")
+	}
+
+	// Every record is JSON with the service field and, once routed, the request ID
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(line), &record), "Log line is not JSON: %s", line) {
+			continue
+		}
+		assert.Equal(t, servicekit.Name(), record["service"])
+		if record["msg"] == "Request handled" {
+			assert.NotEmpty(t, record["request_id"], "Access log record without request_id: %s", line)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+
+	"github.com/ollama/ollama/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Label values for observeGeneration
+const (
+	modeSync   = "sync"
+	modeStream = "stream"
+
+	outcomeSuccess = "success" // Otherwise the outcome is the error code
+
+	// unknownModel replaces model names Ollama does not know, which come from callers
+	unknownModel = "unknown"
+)
+
+var (
+	generationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "ollama_generation_duration_seconds",
+		Help:      "Wall time of Ollama generate calls, by model, mode (sync or stream) and outcome (success or error code).",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 45, 60, 90, 120},
+	}, []string{"model", "mode", "outcome"})
+
+	loadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "ollama_load_duration_seconds",
+		Help:      "Time Ollama spent loading the model for a generation, by model.",
+		Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"model"})
+
+	promptEvalTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "ollama_prompt_eval_tokens_total",
+		Help:      "Prompt tokens evaluated by Ollama, by model.",
+	}, []string{"model"})
+
+	evalTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "ollama_eval_tokens_total",
+		Help:      "Tokens generated by Ollama, by model.",
+	}, []string{"model"})
+
+	anonymizedEntities = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "anonymized_entities_total",
+		Help:      "Entities replaced by placeholders in anonymized output, by model and entity type.",
+	}, []string{"model", "entity_type"})
+)
+
+// observeGeneration records a finished generate call. final is the last
+// response received (carrying Ollama's metrics), or nil if there was none.
+func observeGeneration(model, mode, outcome string, elapsed time.Duration, final *api.GenerateResponse) {
+	generationDuration.WithLabelValues(model, mode, outcome).Observe(elapsed.Seconds())
+	if final == nil || !final.Done {
+		return
+	}
+	loadDuration.WithLabelValues(model).Observe(final.LoadDuration.Seconds())
+	promptEvalTokens.WithLabelValues(model).Add(float64(final.PromptEvalCount))
+	evalTokens.WithLabelValues(model).Add(float64(final.EvalCount))
+}
+
+// observeEntities records the entity types found in one anonymized output
+func observeEntities(model string, counts map[string]int) {
+	for entityType, n := range counts {
+		anonymizedEntities.WithLabelValues(model, entityType).Add(float64(n))
+	}
+}
@@ -0,0 +1,41 @@
+package ppclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxBatchItems is the gateway's default limit on items per batch
+const MaxBatchItems = 1000
+
+// AnonymizeBatch anonymizes many records in one call. Failures of single
+// items are reported in their results and do not fail the call.
+func (c *Client) AnonymizeBatch(ctx context.Context, req BatchRequest) (*BatchResponse, error) {
+	var resp BatchResponse
+	if err := c.postJSON(ctx, "/api/v1/anonymize/batch", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AnonymizeAll anonymizes any number of records, sending them in batches of
+// at most batchSize (MaxBatchItems if 0) one after another. Results are in
+// the order of items. On an error the results of the batches that completed
+// are returned with it.
+func (c *Client) AnonymizeAll(ctx context.Context, items []BatchItem, batchSize int) (*BatchResponse, error) {
+	if batchSize <= 0 {
+		batchSize = MaxBatchItems
+	}
+	all := &BatchResponse{Results: make([]BatchResult, 0, len(items))}
+	for start := 0; start < len(items); start += batchSize {
+		end := min(start+batchSize, len(items))
+		resp, err := c.AnonymizeBatch(ctx, BatchRequest{Items: items[start:end]})
+		if err != nil {
+			return all, fmt.Errorf("ppclient: batch of items %d to %d: %w", start+1, end, err)
+		}
+		all.Results = append(all.Results, resp.Results...)
+		all.Succeeded += resp.Succeeded
+		all.Failed += resp.Failed
+	}
+	return all, nil
+}
@@ -0,0 +1,268 @@
+// Package ppclient is the Go client for the PrivacyPilot API gateway.
+//
+//	client := ppclient.New("http://localhost:8080", ppclient.WithAPIKey(key))
+//	resp, err := client.Anonymize(ctx, ppclient.AnonymizeRequest{Text: "My name is Agent Smith."})
+//	if ppclient.IsCode(err, ppclient.CodeModelNotFound) {
+//		// ...
+//	}
+//
+// Calls that fail with a retryable error (429, 502, 503, 504, or the gateway
+// being unreachable) are retried with exponential backoff, honouring
+// Retry-After. Every call carries an Idempotency-Key that is reused by its
+// retries, so a retried request whose first attempt did reach the gateway is
+// answered from the stored response instead of running twice.
+//
+// The time left before the context's deadline, if it has one, is sent as the
+// request's time budget, so the gateway and the services behind it give up
+// on the request when the caller does.
+//
+// Package ppclienttest provides a fake gateway for unit tests.
+package ppclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is sent in the User-Agent header
+const Version = "0.1.0"
+
+// Request headers understood by the gateway
+const (
+	headerAPIKey         = "X-API-Key"
+	headerRequestID      = "X-Request-ID"
+	headerIdempotencyKey = "Idempotency-Key"
+	headerRequestBudget  = "X-Request-Budget-Ms"
+)
+
+// Client calls the gateway. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	userAgent  string
+	retry      RetryPolicy
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey authenticates calls with an API key (X-API-Key). The gateway
+// applies rate limits and quotas to the tenant the key is configured for.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient replaces the HTTP client, e.g. to add TLS settings or
+// instrumentation. Prefer contexts over http.Client.Timeout for deadlines:
+// a client timeout also cuts streams short.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetry replaces DefaultRetryPolicy. Use NoRetry to disable retries.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// WithUserAgent prefixes the User-Agent header with the caller's product
+func WithUserAgent(product string) Option {
+	return func(c *Client) { c.userAgent = product + " " + c.userAgent }
+}
+
+// New creates a client for the gateway at baseURL (e.g. "https://gateway.example.com")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		userAgent:  "ppclient-go/" + Version,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey makes calls made with ctx use key instead of a generated
+// Idempotency-Key, e.g. to resume a call after the caller restarted. Keys are
+// scoped to the API key and must not be reused for other requests.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+func idempotencyKey(ctx context.Context) (string, error) {
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		return key, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ppclient: generating an idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Anonymize replaces personal data in a text
+func (c *Client) Anonymize(ctx context.Context, req AnonymizeRequest) (*AnonymizeResponse, error) {
+	var resp AnonymizeResponse
+	if err := c.postJSON(ctx, "/api/v1/anonymize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Deanonymize puts the original values back into a text from a reversible
+// anonymization, using the anonymization's DeanonymizeToken
+func (c *Client) Deanonymize(ctx context.Context, req DeanonymizeRequest) (*DeanonymizeResponse, error) {
+	var resp DeanonymizeResponse
+	if err := c.postJSON(ctx, "/api/v1/deanonymize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Moderate checks a text or image against the moderation policy
+func (c *Client) Moderate(ctx context.Context, req ModerateRequest) (*ModerateResponse, error) {
+	var resp ModerateResponse
+	if err := c.postJSON(ctx, "/api/v1/moderate", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// postJSON posts body to path and decodes a 2xx response into out
+func (c *Client) postJSON(ctx context.Context, path string, body, out any) error {
+	resp, err := c.post(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ppclient: decoding response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// post sends body to path, retrying per the client's policy, and returns the
+// first 2xx response. The caller closes its body.
+func (c *Client) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("ppclient: encoding request: %w", err)
+	}
+	key, err := idempotencyKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, http.MethodPost, path, payload, key)
+}
+
+// get fetches path, retrying per the client's policy, and decodes a 2xx
+// response into out
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	resp, err := c.send(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ppclient: decoding response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// send makes a request, retrying per the client's policy, and returns the
+// first 2xx response. The caller closes its body.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, key string) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, method, path, payload, key)
+		if err == nil {
+			return resp, nil
+		}
+		wait, retry := c.retry.next(attempt, err)
+		if !retry || ctx.Err() != nil {
+			return nil, err
+		}
+		if sleep(ctx, wait) != nil {
+			return nil, err // The last failure says more than the cancellation
+		}
+	}
+}
+
+// attempt makes one request. Non-2xx responses are returned as *Error.
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, key string) (*http.Response, error) {
+	resp, err := c.do(ctx, method, path, payload, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		apiErr := errorFromResponse(resp)
+		_, _ = io.Copy(io.Discard, resp.Body) // Let the connection be reused
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends one request with the client's headers. A nil payload sends no
+// body and an empty key no Idempotency-Key.
+func (c *Client) do(ctx context.Context, method, path string, payload []byte, key string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("ppclient: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if key != "" {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(headerAPIKey, c.apiKey)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(headerRequestBudget, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &transportError{err: err}
+	}
+	return resp, nil
+}
+
+// transportError is a failure to get a response from the gateway
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return "ppclient: " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryable reports whether err is worth retrying. The caller's own
+// cancellation and deadline are never retried.
+func retryable(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+	var tErr *transportError
+	return errors.As(err, &tErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// anonymize runs "ppctl anonymize"
+func (c *cli) anonymize(ctx context.Context, args []string) int {
+	flags := c.newFlags("anonymize", "FILE|DIR|GLOB ... | -",
+		"Anonymizes each file through the gateway, several at a time. Directories are\n"+
+			"processed recursively. Each run records the files it processed, with SHA-256\n"+
+			"hashes of their original and anonymized content, in a manifest.\n"+
+			"A single - anonymizes stdin to stdout. With -reversible, deanonymize can\n"+
+			"put the original values back later, even into edited files.")
+	outDir := flags.String("o", "", "write the anonymized files to this directory, keeping their layout")
+	inPlace := flags.Bool("in-place", false, "replace the files with their anonymized text")
+	originals := flags.String("originals", "", "with -in-place, keep copies of the originals in this directory so restore can copy them back")
+	manifestPath := flags.String("manifest", "", "manifest file (default "+manifestName+" in the output directory, or in the current one with -in-place)")
+	model := flags.String("model", "", "model to use instead of the gateway's default")
+	cache := flags.String("cache", "", "how the result cache is used: refresh or bypass")
+	parallel := flags.Int("parallel", 4, "number of files uploaded at the same time")
+	reversible := flags.Bool("reversible", false, "keep the gateway's deanonymize token of each file in the manifest (on stderr for stdin)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		return c.usageError(flags, "no files given")
+	}
+	req := ppclient.AnonymizeRequest{Model: *model, Cache: ppclient.CacheMode(*cache), Reversible: *reversible}
+	if req.Cache != ppclient.CacheDefault && req.Cache != ppclient.CacheRefresh && req.Cache != ppclient.CacheBypass {
+		return c.usageError(flags, "-cache must be refresh or bypass")
+	}
+	if *parallel < 1 {
+		return c.usageError(flags, "-parallel must be at least 1")
+	}
+
+	inputs, err := expandInputs(flags.Args())
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	if len(inputs) == 1 && inputs[0].path == stdinName {
+		if *outDir != "" || *inPlace {
+			return c.usageError(flags, "stdin is always written to stdout")
+		}
+		return c.anonymizeStdin(ctx, req)
+	}
+	for _, in := range inputs {
+		if in.path == stdinName {
+			return c.usageError(flags, "- cannot be combined with files")
+		}
+	}
+	if (*outDir != "") == *inPlace {
+		return c.usageError(flags, "give exactly one of -o and -in-place")
+	}
+	if *originals != "" && !*inPlace {
+		return c.usageError(flags, "-originals only applies to -in-place; with -o the sources stay untouched")
+	}
+
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*outDir, manifestName)
+	}
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	manifestDir, err := filepath.Abs(filepath.Dir(*manifestPath))
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	m.Gateway = c.gateway
+	if *originals != "" {
+		m.Originals = relTo(manifestDir, *originals)
+	}
+
+	inputs = skipOutputDir(inputs, *outDir)
+	outputs := make([]string, len(inputs))
+	sources := make(map[string]string, len(inputs))
+	for i, in := range inputs {
+		outputs[i] = in.path
+		if *outDir != "" {
+			outputs[i] = filepath.Join(*outDir, in.rel)
+		}
+		if other, ok := sources[outputs[i]]; ok {
+			c.errorf("%s and %s would both be written to %s", other, in.path, outputs[i])
+			return exitFailed
+		}
+		sources[outputs[i]] = in.path
+	}
+	previous := make(map[string]manifestEntry, len(m.Files))
+	for _, e := range m.Files {
+		previous[e.Output] = e
+	}
+
+	entries := make([]manifestEntry, len(inputs))
+	processed := make([]bool, len(inputs))
+	prog := newProgress(c.stderr, "anonymized", len(inputs), c.quiet)
+	forEach(ctx, len(inputs), *parallel, func(i int) {
+		output := relTo(manifestDir, outputs[i])
+		var last *manifestEntry
+		if e, ok := previous[output]; ok && *inPlace && e.Error == "" {
+			last = &e
+		}
+		entry, err := c.anonymizeFile(ctx, inputs[i].path, outputs[i], req, *originals, last)
+		if err != nil {
+			entry.Error = describe(err)
+			entry.AnonymizedSHA256 = ""
+		}
+		entry.Source = relTo(manifestDir, inputs[i].path)
+		entry.Output = output
+		entries[i], processed[i] = entry, true
+		prog.finished(inputs[i].path, entry.Bytes, err)
+	})
+	prog.close()
+
+	var done []manifestEntry
+	failed := 0
+	for i, entry := range entries {
+		if !processed[i] {
+			continue
+		}
+		done = append(done, entry)
+		if entry.Error != "" {
+			failed++
+		}
+	}
+	m.merge(done)
+	if err := m.write(*manifestPath); err != nil {
+		c.errorf("writing the manifest: %v", err)
+		return exitFailed
+	}
+	switch {
+	case len(done) < len(inputs):
+		c.errorf("interrupted, %d files were not processed", len(inputs)-len(done))
+		return exitFailed
+	case failed > 0:
+		return exitFailed
+	}
+	return exitOK
+}
+
+// anonymizeFile anonymizes source into output. With in-place output, a file
+// whose content is what last recorded as the anonymized text is left alone,
+// so running twice never loses the original.
+func (c *cli) anonymizeFile(ctx context.Context, source, output string, req ppclient.AnonymizeRequest, originals string, last *manifestEntry) (manifestEntry, error) {
+	entry := manifestEntry{Model: req.Model, ProcessedAt: time.Now().UTC()}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return entry, err
+	}
+	entry.Bytes = len(data)
+	entry.OriginalSHA256 = sha256Hex(data)
+	if last != nil && last.AnonymizedSHA256 == entry.OriginalSHA256 {
+		return *last, nil
+	}
+	if !utf8.Valid(data) {
+		return entry, errors.New("not UTF-8 text")
+	}
+
+	anonymized := data
+	if len(bytes.TrimSpace(data)) > 0 { // Blank files have nothing to anonymize, and the gateway rejects empty text
+		callCtx, cancel := c.call(ctx)
+		req.Text = string(data)
+		resp, err := c.client.Anonymize(callCtx, req)
+		cancel()
+		if err != nil {
+			return entry, err
+		}
+		anonymized = []byte(resp.AnonymizedText)
+		entry.Cached = resp.Cached
+		entry.DeanonymizeToken = resp.DeanonymizeToken
+	}
+
+	if originals != "" {
+		if err := writeFileAtomic(filepath.Join(originals, entry.OriginalSHA256), data, 0o600); err != nil {
+			return entry, fmt.Errorf("keeping the original: %w", err)
+		}
+	}
+	if err := writeFileAtomic(output, anonymized, fileMode(source)); err != nil {
+		return entry, err
+	}
+	entry.AnonymizedSHA256 = sha256Hex(anonymized)
+	return entry, nil
+}
+
+// anonymizeStdin anonymizes stdin to stdout
+func (c *cli) anonymizeStdin(ctx context.Context, req ppclient.AnonymizeRequest) int {
+	data, err := c.readInput(input{path: stdinName})
+	if err != nil {
+		c.errorf("reading stdin: %v", err)
+		return exitFailed
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		_, _ = c.stdout.Write(data)
+		return exitOK
+	}
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	req.Text = string(data)
+	resp, err := c.client.Anonymize(callCtx, req)
+	if err != nil {
+		c.errorf("%s", describe(err))
+		return exitFailed
+	}
+	fmt.Fprint(c.stdout, resp.AnonymizedText)
+	if resp.DeanonymizeToken != "" {
+		fmt.Fprintf(c.stderr, "deanonymize token: %s\n", resp.DeanonymizeToken)
+	}
+	return exitOK
+}
+
+// skipOutputDir drops inputs inside the output directory, e.g. the results of
+// an earlier run into a directory below the one being anonymized
+func skipOutputDir(inputs []input, outDir string) []input {
+	if outDir == "" {
+		return inputs
+	}
+	out, err := filepath.Abs(outDir)
+	if err != nil {
+		return inputs
+	}
+	kept := inputs[:0]
+	for _, in := range inputs {
+		abs, err := filepath.Abs(in.path)
+		if err == nil && strings.HasPrefix(abs, out+string(filepath.Separator)) {
+			continue
+		}
+		kept = append(kept, in)
+	}
+	return kept
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// deanonymize runs "ppctl deanonymize". Unlike restore it calls the gateway,
+// which puts the original values back using the token each file was
+// anonymized with, so edits made since are kept.
+func (c *cli) deanonymize(ctx context.Context, args []string) int {
+	flags := c.newFlags("deanonymize", "[FILE ...] | -",
+		"Puts the original values back into files anonymized with -reversible,\n"+
+			"through the gateway and with the deanonymize tokens recorded in the\n"+
+			"manifest. Files may have been edited since; the placeholders left in them\n"+
+			"are restored. The API key must belong to the caller that anonymized them.\n"+
+			"Without arguments every file in the manifest is deanonymized.\n"+
+			"A single - deanonymizes stdin to stdout with -token.")
+	manifestPath := flags.String("manifest", manifestName, "manifest of the anonymize run")
+	token := flags.String("token", "", "deanonymize token printed by anonymize -reversible, for stdin")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 1 && flags.Arg(0) == stdinName {
+		if *token == "" {
+			return c.usageError(flags, "stdin needs -token")
+		}
+		return c.deanonymizeStdin(ctx, *token)
+	}
+	if *token != "" {
+		return c.usageError(flags, "-token only applies to stdin; files use the tokens in the manifest")
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	if len(m.Files) == 0 {
+		c.errorf("no files are recorded in %s", *manifestPath)
+		return exitFailed
+	}
+	manifestDir, err := filepath.Abs(filepath.Dir(*manifestPath))
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+
+	wanted := map[string]bool{}
+	for _, arg := range flags.Args() {
+		wanted[relTo(manifestDir, arg)] = true
+	}
+	deanonymized, failed := 0, 0
+	for _, e := range m.Files {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(wanted) > 0 && !wanted[e.Output] {
+			continue
+		}
+		delete(wanted, e.Output)
+		if e.Error != "" {
+			continue // Never written
+		}
+		output := resolve(manifestDir, e.Output)
+		if err := c.deanonymizeFile(ctx, e, output); err != nil {
+			c.errorf("%s: %s", output, describe(err))
+			failed++
+			continue
+		}
+		deanonymized++
+	}
+	for path := range wanted {
+		c.errorf("%s: not recorded in %s", resolve(manifestDir, path), *manifestPath)
+		failed++
+	}
+
+	if !c.quiet {
+		fmt.Fprintf(c.stderr, "deanonymized %d files", deanonymized)
+		if failed > 0 {
+			fmt.Fprintf(c.stderr, ", %d failed", failed)
+		}
+		fmt.Fprintln(c.stderr)
+	}
+	if failed > 0 || ctx.Err() != nil {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// deanonymizeFile restores the original values of entry e in output
+func (c *cli) deanonymizeFile(ctx context.Context, e manifestEntry, output string) error {
+	current, err := os.ReadFile(output)
+	if err != nil {
+		return err
+	}
+	if sha256Hex(current) == e.OriginalSHA256 {
+		return nil // Already deanonymized, or nothing was replaced
+	}
+	if e.DeanonymizeToken == "" {
+		return errors.New("not anonymized with -reversible (use restore to copy the original back)")
+	}
+	if len(bytes.TrimSpace(current)) == 0 {
+		return nil // Nothing left to restore, and the gateway rejects empty text
+	}
+
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	resp, err := c.client.Deanonymize(callCtx, ppclient.DeanonymizeRequest{Text: string(current), Token: e.DeanonymizeToken})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(output, []byte(resp.Text), fileMode(output))
+}
+
+// deanonymizeStdin deanonymizes stdin to stdout
+func (c *cli) deanonymizeStdin(ctx context.Context, token string) int {
+	data, err := c.readInput(input{path: stdinName})
+	if err != nil {
+		c.errorf("reading stdin: %v", err)
+		return exitFailed
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		_, _ = c.stdout.Write(data)
+		return exitOK
+	}
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	resp, err := c.client.Deanonymize(callCtx, ppclient.DeanonymizeRequest{Text: string(data), Token: token})
+	if err != nil {
+		c.errorf("%s", describe(err))
+		return exitFailed
+	}
+	fmt.Fprint(c.stdout, resp.Text)
+	return exitOK
+}
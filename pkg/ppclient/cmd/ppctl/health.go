@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// health runs "ppctl health"
+func (c *cli) health(ctx context.Context, args []string) int {
+	flags := c.newFlags("health", "",
+		"Checks that the gateway and the services it needs are ready. -deep checks the\n"+
+			"whole topology down to the models and needs an admin API key.\n"+
+			"Exits with status 1 if the gateway is unavailable.")
+	deep := flags.Bool("deep", false, "check every service behind the gateway")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	check := c.client.Ready
+	if *deep {
+		check = c.client.DeepHealth
+	}
+	report, err := check(callCtx)
+	if err != nil {
+		c.errorf("%s", describe(err))
+		return exitFailed
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		name := report.Service
+		if name == "" {
+			name = c.gateway
+		}
+		printReport(c, name, report, 0)
+	}
+	if report.Status == ppclient.HealthUnavailable {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// printReport prints a report and its checks as an indented tree
+func printReport(c *cli, name string, report *ppclient.HealthReport, depth int) {
+	line := fmt.Sprintf("%s%s  %s  %dms", strings.Repeat("  ", depth), name, report.Status, report.LatencyMS)
+	if report.Status != ppclient.HealthOK && !report.Required && depth > 0 {
+		line += "  (optional)"
+	}
+	if report.Error != "" {
+		line += "  " + report.Error
+	}
+	fmt.Fprintln(c.stdout, line)
+
+	names := make([]string, 0, len(report.Checks))
+	for n := range report.Checks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		printReport(c, n, report.Checks[n], depth+1)
+	}
+}
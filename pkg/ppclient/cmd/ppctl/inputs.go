@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stdinName is the argument that reads from stdin
+const stdinName = "-"
+
+// input is a file to process
+type input struct {
+	path string // stdinName for stdin
+	rel  string // Path below the output directory: relative to the directory argument it was found in, otherwise the base name
+}
+
+// expandInputs resolves file, directory and glob arguments into files.
+// Directories are walked recursively, skipping hidden files and directories
+// (e.g. .git, or ppctl's own originals). Globs are expanded here too, so they
+// work when quoted or on shells that do not expand them.
+func expandInputs(args []string) ([]input, error) {
+	var inputs []input
+	seen := map[string]bool{}
+	add := func(path, rel string) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			inputs = append(inputs, input{path: path, rel: rel})
+		}
+	}
+
+	for _, arg := range args {
+		if arg == stdinName {
+			if seen[stdinName] {
+				return nil, errors.New("stdin given more than once")
+			}
+			seen[stdinName] = true
+			inputs = append(inputs, input{path: stdinName})
+			continue
+		}
+
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no files match", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+			err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if file != path && strings.HasPrefix(d.Name(), ".") {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !d.Type().IsRegular() || d.Name() == manifestName {
+					return nil
+				}
+				rel, err := filepath.Rel(path, file)
+				if err != nil {
+					return err
+				}
+				add(file, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no files to process")
+	}
+	return inputs, nil
+}
+
+// readInput reads a file, or stdin
+func (c *cli) readInput(in input) ([]byte, error) {
+	if in.path == stdinName {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(in.path)
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so an interrupted run never leaves half a file behind
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileMode returns the permissions of path, or 0644 if it cannot be read
+func fileMode(path string) fs.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0o644
+}
+
+// forEach calls fn for 0..n-1 on up to parallel goroutines. Once ctx is done
+// no further calls are started.
+func forEach(ctx context.Context, n, parallel int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(parallel, 1), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// historyName is the file in ppctl's home that remembers submitted jobs. The
+// gateway looks jobs up by ID only, so ppctl keeps its own list.
+const historyName = "jobs.json"
+
+// maxHistory bounds the job history; the gateway forgets finished jobs after
+// a day anyway
+const maxHistory = 200
+
+// historyEntry is a job submitted by ppctl
+type historyEntry struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Source      string    `json:"source"` // File the input was read from
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+const jobsUsage = `Usage: ppctl jobs <command> [flags] [arguments]
+
+Commands:
+  submit  queue a file as an anonymize or moderate job
+  list    show the jobs submitted from this machine and their status
+  watch   wait for jobs to finish, printing their status changes
+  get     print the result of a finished job (alias: fetch)
+`
+
+// jobs runs "ppctl jobs"
+func (c *cli) jobs(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, jobsUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "submit":
+		return c.jobsSubmit(ctx, args[1:])
+	case "list":
+		return c.jobsList(ctx, args[1:])
+	case "watch":
+		return c.jobsWatch(ctx, args[1:])
+	case "get", "fetch":
+		return c.jobsGet(ctx, args[1:])
+	}
+	fmt.Fprintf(c.stderr, "ppctl: unknown jobs command %q\n\n%s", args[0], jobsUsage)
+	return exitUsage
+}
+
+func (c *cli) jobsSubmit(ctx context.Context, args []string) int {
+	flags := c.newFlags("jobs submit", "FILE | -",
+		"Queues the text of a file as a job and prints its ID. The job keeps running\n"+
+			"on the gateway; follow it with \"ppctl jobs watch\".")
+	jobType := flags.String("type", ppclient.JobTypeAnonymize, "job type: anonymize or moderate")
+	model := flags.String("model", "", "model to use for anonymize jobs")
+	callback := flags.String("callback", "", "URL that receives a signed webhook when the job finishes")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		return c.usageError(flags, "give one file")
+	}
+
+	in := input{path: flags.Arg(0)}
+	data, err := c.readInput(in)
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	req := ppclient.JobRequest{Type: *jobType, CallbackURL: *callback}
+	switch *jobType {
+	case ppclient.JobTypeAnonymize:
+		req.Input = ppclient.AnonymizeRequest{Text: string(data), Model: *model}
+	case ppclient.JobTypeModerate:
+		req.Input = ppclient.ModerateRequest{Text: string(data)}
+	default:
+		return c.usageError(flags, "-type must be anonymize or moderate")
+	}
+
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	job, err := c.client.SubmitJob(callCtx, req)
+	if err != nil {
+		c.errorf("%s", describe(err))
+		return exitFailed
+	}
+	source := in.path
+	if source != stdinName {
+		source, _ = filepath.Abs(source)
+	}
+	if err := c.remember(historyEntry{ID: job.ID, Type: job.Type, Source: source, SubmittedAt: job.CreatedAt}); err != nil {
+		c.errorf("the job was queued but not added to the history: %v", err)
+	}
+	fmt.Fprintln(c.stdout, job.ID)
+	return exitOK
+}
+
+func (c *cli) jobsList(ctx context.Context, args []string) int {
+	flags := c.newFlags("jobs list", "", "Shows the jobs submitted from this machine, newest first, with their\ncurrent status. Jobs the gateway no longer knows are shown as expired.")
+	asJSON := flags.Bool("json", false, "print one JSON object per job")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	history, err := c.history()
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+
+	jobs := make([]*ppclient.Job, len(history))
+	errs := make([]error, len(history))
+	forEach(ctx, len(history), 8, func(i int) {
+		callCtx, cancel := c.call(ctx)
+		defer cancel()
+		jobs[i], errs[i] = c.client.GetJob(callCtx, history[len(history)-1-i].ID)
+	})
+
+	code := exitOK
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	if !*asJSON {
+		fmt.Fprintln(tw, "ID\tTYPE\tSTATUS\tSUBMITTED\tSOURCE")
+	}
+	enc := json.NewEncoder(c.stdout)
+	for i, job := range jobs {
+		h := history[len(history)-1-i]
+		status := "expired"
+		switch {
+		case job != nil:
+			status = job.Status
+		case errs[i] == nil:
+			status = "unknown" // Interrupted
+		case !ppclient.IsCode(errs[i], ppclient.CodeNotFound):
+			c.errorf("%s: %s", h.ID, describe(errs[i]))
+			status, code = "unknown", exitFailed
+		}
+		if *asJSON {
+			_ = enc.Encode(struct {
+				historyEntry
+				Status string `json:"status"`
+			}{h, status})
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", h.ID, h.Type, status, h.SubmittedAt.Local().Format(time.DateTime), h.Source)
+	}
+	_ = tw.Flush()
+	return code
+}
+
+func (c *cli) jobsWatch(ctx context.Context, args []string) int {
+	flags := c.newFlags("jobs watch", "[ID ...]", "Waits for jobs to finish and prints each status change. Without IDs it\nwatches every job in the history. Exits with status 1 if a job failed.")
+	interval := flags.Duration("interval", 2*time.Second, "time between polls")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	ids := flags.Args()
+	if len(ids) == 0 {
+		history, err := c.history()
+		if err != nil {
+			c.errorf("%v", err)
+			return exitFailed
+		}
+		for _, h := range history {
+			ids = append(ids, h.ID)
+		}
+	}
+
+	var mu sync.Mutex
+	failed := 0
+	forEach(ctx, len(ids), len(ids), func(i int) {
+		job, err := c.client.WaitJob(ctx, ids[i], *interval, func(job *ppclient.Job) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(c.stdout, "%s  %s  %s\n", time.Now().Format(time.TimeOnly), job.ID, job.Status)
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case len(flags.Args()) == 0 && ppclient.IsCode(err, ppclient.CodeNotFound):
+			// Expired from the history; nothing to watch
+		case err != nil:
+			c.errorf("%s: %s", ids[i], describe(err))
+			failed++
+		case job.Status == ppclient.JobFailed:
+			c.errorf("%s: %s", job.ID, describe(job.Error))
+			failed++
+		}
+	})
+	if ctx.Err() != nil || failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+func (c *cli) jobsGet(ctx context.Context, args []string) int {
+	flags := c.newFlags("jobs get", "ID", "Prints the result of a finished job: the anonymized text of anonymize jobs,\nthe verdict of moderate jobs.")
+	output := flags.String("o", "", "write the result to this file instead of stdout")
+	asJSON := flags.Bool("json", false, "print the whole job as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		return c.usageError(flags, "give one job ID")
+	}
+
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	job, err := c.client.GetJob(callCtx, flags.Arg(0))
+	if err != nil {
+		c.errorf("%s", describe(err))
+		return exitFailed
+	}
+	var out []byte
+	switch {
+	case *asJSON:
+		out, _ = json.MarshalIndent(job, "", "  ")
+		out = append(out, '\n')
+	case job.Status == ppclient.JobFailed:
+		c.errorf("job %s failed: %s", job.ID, describe(job.Error))
+		return exitFailed
+	case !job.Finished():
+		c.errorf("job %s is %s; wait for it with \"ppctl jobs watch %s\"", job.ID, job.Status, job.ID)
+		return exitFailed
+	case job.Type == ppclient.JobTypeAnonymize:
+		var result ppclient.AnonymizeResponse
+		if err := job.DecodeResult(&result); err != nil {
+			c.errorf("%v", err)
+			return exitFailed
+		}
+		out = []byte(result.AnonymizedText)
+	default:
+		var buf json.RawMessage
+		if err := job.DecodeResult(&buf); err != nil {
+			c.errorf("%v", err)
+			return exitFailed
+		}
+		out, _ = json.MarshalIndent(buf, "", "  ")
+		out = append(out, '\n')
+	}
+
+	if *output != "" {
+		if err := writeFileAtomic(*output, out, 0o644); err != nil {
+			c.errorf("%v", err)
+			return exitFailed
+		}
+		return exitOK
+	}
+	_, _ = c.stdout.Write(out)
+	return exitOK
+}
+
+// history returns the submitted jobs, oldest first
+func (c *cli) history() ([]historyEntry, error) {
+	data, err := os.ReadFile(filepath.Join(c.home, historyName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []historyEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("reading the job history: %w", err)
+	}
+	return history, nil
+}
+
+// remember adds a job to the history, dropping the oldest beyond maxHistory
+func (c *cli) remember(entry historyEntry) error {
+	history, err := c.history()
+	if err != nil {
+		return err
+	}
+	history = append(history, entry)
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.home, historyName), append(data, '\n'), 0o600)
+}
@@ -0,0 +1,194 @@
+// Command ppctl works with files through the PrivacyPilot API gateway.
+//
+//	ppctl [global flags] <command> [flags] [arguments]
+//
+// Commands:
+//
+//	anonymize    anonymize files, directories, globs or stdin
+//	restore      restore files anonymized by ppctl from local copies of the originals
+//	deanonymize  restore files anonymized with -reversible through the gateway
+//	moderate     check files against the moderation policy
+//	jobs         submit, list, watch and fetch asynchronous jobs
+//	health       check the gateway and the services behind it
+//
+// The gateway and API key default to $PPCTL_GATEWAY and $PPCTL_API_KEY.
+// ppctl exits with status 1 if any file or call failed, 2 on usage errors
+// and 3 if moderation flagged any content.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// Exit statuses
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitUsage   = 2
+	exitFlagged = 3
+)
+
+const usage = `Usage: ppctl [global flags] <command> [flags] [arguments]
+
+Commands:
+  anonymize    anonymize files, directories, globs or stdin
+  restore      restore files anonymized by ppctl from local copies of the originals
+  deanonymize  restore files anonymized with -reversible through the gateway
+  moderate     check files against the moderation policy
+  jobs         submit, list, watch and fetch asynchronous jobs
+  health       check the gateway and the services behind it
+
+Run "ppctl <command> -h" for the flags of a command.
+
+Global flags:
+`
+
+// cli holds what every command needs
+type cli struct {
+	client  *ppclient.Client
+	gateway string
+	timeout time.Duration // Per gateway call
+	home    string        // Directory of the job history
+	quiet   bool
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run parses the global flags and runs the command, returning the exit status
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ppctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	gateway := flags.String("gateway", envOr("PPCTL_GATEWAY", "http://localhost:8080"), "gateway URL ($PPCTL_GATEWAY)")
+	apiKey := flags.String("api-key", os.Getenv("PPCTL_API_KEY"), "API key ($PPCTL_API_KEY)")
+	timeout := flags.Duration("timeout", 2*time.Minute, "time limit of each gateway call, including retries")
+	quiet := flags.Bool("quiet", false, "do not show progress")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	home, err := ppctlHome()
+	if err != nil {
+		fmt.Fprintf(stderr, "ppctl: %v\n", err)
+		return exitFailed
+	}
+	c := &cli{
+		client:  ppclient.New(*gateway, ppclient.WithAPIKey(*apiKey), ppclient.WithUserAgent("ppctl/"+ppclient.Version)),
+		gateway: *gateway,
+		timeout: *timeout,
+		home:    home,
+		quiet:   *quiet,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "anonymize":
+		return c.anonymize(ctx, commandArgs)
+	case "restore":
+		return c.restore(commandArgs)
+	case "deanonymize":
+		return c.deanonymize(ctx, commandArgs)
+	case "moderate":
+		return c.moderate(ctx, commandArgs)
+	case "jobs":
+		return c.jobs(ctx, commandArgs)
+	case "health":
+		return c.health(ctx, commandArgs)
+	case "help":
+		flags.SetOutput(stdout)
+		flags.Usage()
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "ppctl: unknown command %q\n\n", command)
+	flags.Usage()
+	return exitUsage
+}
+
+// newFlags creates the flag set of a command
+func (c *cli) newFlags(command, arguments, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet("ppctl "+command, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: ppctl %s [flags] %s\n\n%s\n\nFlags:\n", command, arguments, description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// call bounds one gateway call by the -timeout flag
+func (c *cli) call(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// errorf reports an error on stderr
+func (c *cli) errorf(format string, args ...any) {
+	fmt.Fprintf(c.stderr, "ppctl: "+format+"\n", args...)
+}
+
+// usageError reports a usage error and returns exitUsage
+func (c *cli) usageError(flags *flag.FlagSet, format string, args ...any) int {
+	fmt.Fprintf(c.stderr, "ppctl: "+format+"\n\n", args...)
+	flags.Usage()
+	return exitUsage
+}
+
+// describe turns an error into one line. API errors show their code and
+// request ID, which is what support needs to find the request.
+func describe(err error) string {
+	var apiErr *ppclient.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.RequestID != "" {
+			return fmt.Sprintf("%s (%s, request %s)", apiErr.Message, apiErr.Code, apiErr.RequestID)
+		}
+		return fmt.Sprintf("%s (%s)", apiErr.Message, apiErr.Code)
+	}
+	return err.Error()
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// ppctlHome is where ppctl keeps its state: $PPCTL_HOME, or ppctl in the
+// user's configuration directory
+func ppctlHome() (string, error) {
+	if home := os.Getenv("PPCTL_HOME"); home != "" {
+		return home, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no directory for the job history (set PPCTL_HOME): %w", err)
+	}
+	return dir + string(os.PathSeparator) + "ppctl", nil
+}
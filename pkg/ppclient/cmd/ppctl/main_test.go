@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient/ppclienttest"
+)
+
+// newGateway starts a fake gateway that replaces "Jane" with "[NAME]" and
+// flags texts containing "hate"
+func newGateway(t *testing.T) *ppclienttest.Server {
+	t.Helper()
+	srv := ppclienttest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: strings.ReplaceAll(req.Text, "Jane", "[NAME]")}, nil
+	})
+	srv.OnModerate(func(req ppclient.ModerateRequest) (*ppclient.ModerateResponse, error) {
+		if strings.Contains(req.Text, "hate") {
+			return &ppclient.ModerateResponse{Flags: []string{"hate"}, Details: "hateful content"}, nil
+		}
+		return &ppclient.ModerateResponse{IsAcceptable: true, Flags: []string{}}, nil
+	})
+	t.Setenv("PPCTL_HOME", t.TempDir())
+	return srv
+}
+
+// ppctl runs the command against srv and returns its exit status and output
+func ppctl(t *testing.T, srv *ppclienttest.Server, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-gateway", srv.URL}, args...)
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAnonymizeToDirectory(t *testing.T) {
+	srv := newGateway(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"in/a.txt":       "Hello Jane",
+		"in/sub/b.txt":   "Jane again",
+		"in/empty.txt":   "",
+		"in/.git/config": "not an export",
+	})
+	if err := os.WriteFile(filepath.Join(dir, "in", "image.bin"), []byte{0xff, 0xfe, 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+
+	code, _, stderr := ppctl(t, srv, "", "anonymize", "-o", out, "-parallel", "2", filepath.Join(dir, "in"))
+	if code != exitFailed || !strings.Contains(stderr, "image.bin: not UTF-8 text") {
+		t.Fatalf("anonymize with a binary file = %d, stderr %q", code, stderr)
+	}
+	if got := readFile(t, filepath.Join(out, "sub", "b.txt")); got != "[NAME] again" {
+		t.Errorf("out/sub/b.txt = %q", got)
+	}
+	if got := readFile(t, filepath.Join(out, "empty.txt")); got != "" {
+		t.Errorf("out/empty.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(out, ".git")); err == nil {
+		t.Errorf("Hidden directories must be skipped")
+	}
+	if readFile(t, filepath.Join(dir, "in", "a.txt")) != "Hello Jane" {
+		t.Errorf("The source must stay untouched")
+	}
+
+	var m manifest
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(out, manifestName))), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Succeeded != 3 || m.Failed != 1 || len(m.Files) != 4 {
+		t.Fatalf("Manifest = %+v", m)
+	}
+	for _, e := range m.Files {
+		if e.Output != "a.txt" {
+			continue
+		}
+		if e.Source != "../in/a.txt" || e.OriginalSHA256 != sha256Hex([]byte("Hello Jane")) || e.AnonymizedSHA256 != sha256Hex([]byte("Hello [NAME]")) {
+			t.Errorf("Manifest entry for a.txt = %+v", e)
+		}
+	}
+
+	// Restoring an output copies its source back, unless the output was edited
+	writeFiles(t, out, map[string]string{"sub/b.txt": "edited"})
+	code, _, stderr = ppctl(t, srv, "", "restore", "-manifest", filepath.Join(out, manifestName))
+	if code != exitFailed || !strings.Contains(stderr, "changed after it was anonymized") {
+		t.Errorf("restore with an edited output = %d, stderr %q", code, stderr)
+	}
+	if got := readFile(t, filepath.Join(out, "a.txt")); got != "Hello Jane" {
+		t.Errorf("Restored out/a.txt = %q", got)
+	}
+}
+
+func TestAnonymizeInPlace(t *testing.T) {
+	srv := newGateway(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "Hello Jane", "b.log": "Bye Jane"})
+	manifestPath := filepath.Join(dir, manifestName)
+	originals := filepath.Join(dir, ".originals")
+
+	for range 2 { // The second run must leave the anonymized files alone
+		code, _, stderr := ppctl(t, srv, "", "anonymize", "-in-place", "-originals", originals, "-manifest", manifestPath, filepath.Join(dir, "*.txt"))
+		if code != exitOK {
+			t.Fatalf("anonymize -in-place = %d, stderr %q", code, stderr)
+		}
+	}
+	if got := readFile(t, filepath.Join(dir, "a.txt")); got != "Hello [NAME]" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "b.log")); got != "Bye Jane" {
+		t.Errorf("Files outside the glob must stay untouched, b.log = %q", got)
+	}
+	if got := len(srv.Requests()); got != 1 {
+		t.Errorf("Sent %d requests, want 1", got)
+	}
+
+	code, _, stderr := ppctl(t, srv, "", "restore", "-manifest", manifestPath, filepath.Join(dir, "a.txt"))
+	if code != exitOK {
+		t.Fatalf("restore = %d, stderr %q", code, stderr)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.txt")); got != "Hello Jane" {
+		t.Errorf("Restored a.txt = %q", got)
+	}
+
+	code, _, _ = ppctl(t, srv, "", "anonymize", "-o", dir, "-in-place", filepath.Join(dir, "a.txt"))
+	if code != exitUsage {
+		t.Errorf("anonymize with -o and -in-place = %d", code)
+	}
+}
+
+func TestDeanonymize(t *testing.T) {
+	srv := newGateway(t)
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		resp := &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: strings.ReplaceAll(req.Text, "Jane", "[NAME]")}
+		if req.Reversible {
+			resp.AnonymizedText, resp.DeanonymizeToken = strings.ReplaceAll(req.Text, "Jane", "[NAME_1]"), "token-1"
+		}
+		return resp, nil
+	})
+	srv.OnDeanonymize(func(req ppclient.DeanonymizeRequest) (*ppclient.DeanonymizeResponse, error) {
+		if req.Token != "token-1" {
+			return nil, &ppclient.Error{StatusCode: 400, Code: ppclient.CodeInvalidRequest, Message: "Invalid request: deanonymize_token was not issued to this caller or is malformed"}
+		}
+		return &ppclient.DeanonymizeResponse{Text: strings.ReplaceAll(req.Text, "[NAME_1]", "Jane"), Restored: strings.Count(req.Text, "[NAME_1]")}, nil
+	})
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "Hello Jane", "b.txt": "Bye Jane"})
+	manifestPath := filepath.Join(dir, manifestName)
+
+	code, _, stderr := ppctl(t, srv, "", "anonymize", "-in-place", "-reversible", "-manifest", manifestPath, filepath.Join(dir, "a.txt"))
+	if code != exitOK || readFile(t, filepath.Join(dir, "a.txt")) != "Hello [NAME_1]" {
+		t.Fatalf("anonymize -reversible = %d, stderr %q", code, stderr)
+	}
+	code, _, stderr = ppctl(t, srv, "", "anonymize", "-in-place", "-manifest", manifestPath, filepath.Join(dir, "b.txt"))
+	if code != exitOK {
+		t.Fatalf("anonymize = %d, stderr %q", code, stderr)
+	}
+
+	// Edits survive; only the placeholders are replaced
+	writeFiles(t, dir, map[string]string{"a.txt": "Dear [NAME_1], hello again"})
+	code, _, stderr = ppctl(t, srv, "", "deanonymize", "-manifest", manifestPath)
+	if code != exitFailed || !strings.Contains(stderr, "b.txt: not anonymized with -reversible") || !strings.Contains(stderr, "deanonymized 1 files, 1 failed") {
+		t.Errorf("deanonymize with a file that is not reversible = %d, stderr %q", code, stderr)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.txt")); got != "Dear Jane, hello again" {
+		t.Errorf("Deanonymized a.txt = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "b.txt")); got != "Bye [NAME]" {
+		t.Errorf("b.txt must stay untouched, got %q", got)
+	}
+
+	code, stdout, stderr := ppctl(t, srv, "Dear Jane,\n", "anonymize", "-reversible", "-")
+	if code != exitOK || stdout != "Dear [NAME_1],\n" || !strings.Contains(stderr, "deanonymize token: token-1") {
+		t.Errorf("anonymize -reversible - = %d, %q, stderr %q", code, stdout, stderr)
+	}
+	code, stdout, stderr = ppctl(t, srv, stdout, "deanonymize", "-token", "token-1", "-")
+	if code != exitOK || stdout != "Dear Jane,\n" {
+		t.Errorf("deanonymize - = %d, %q, stderr %q", code, stdout, stderr)
+	}
+	code, _, stderr = ppctl(t, srv, "Dear [NAME_1]", "deanonymize", "-token", "token-2", "-")
+	if code != exitFailed || !strings.Contains(stderr, "invalid_request") {
+		t.Errorf("deanonymize with another token = %d, stderr %q", code, stderr)
+	}
+	if code, _, _ := ppctl(t, srv, "Dear [NAME_1]", "deanonymize", "-"); code != exitUsage {
+		t.Errorf("deanonymize - without -token = %d", code)
+	}
+}
+
+func TestAnonymizeStdin(t *testing.T) {
+	srv := newGateway(t)
+	code, stdout, stderr := ppctl(t, srv, "Dear Jane,\n", "anonymize", "-model", "llama3", "-")
+	if code != exitOK || stdout != "Dear [NAME],\n" {
+		t.Errorf("anonymize - = %d, %q, stderr %q", code, stdout, stderr)
+	}
+
+	srv.FailNext(&ppclient.Error{StatusCode: 404, Code: ppclient.CodeModelNotFound, Message: "model 'missing' not found", RequestID: "req-1"})
+	code, _, stderr = ppctl(t, srv, "Dear Jane", "anonymize", "-model", "missing", "-")
+	if code != exitFailed || !strings.Contains(stderr, "model_not_found, request req-1") {
+		t.Errorf("anonymize with a missing model = %d, stderr %q", code, stderr)
+	}
+}
+
+func TestModerate(t *testing.T) {
+	srv := newGateway(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"ok.txt": "Hello", "bad.txt": "I hate this"})
+
+	code, stdout, _ := ppctl(t, srv, "", "moderate", filepath.Join(dir, "ok.txt"), filepath.Join(dir, "bad.txt"))
+	if code != exitFlagged || !strings.Contains(stdout, "ok       "+filepath.Join(dir, "ok.txt")) || !strings.Contains(stdout, "(hate): hateful content") {
+		t.Errorf("moderate = %d, %q", code, stdout)
+	}
+
+	code, stdout, _ = ppctl(t, srv, "Hello", "moderate", "-json", "-")
+	var result moderationResult
+	if code != exitOK || json.Unmarshal([]byte(stdout), &result) != nil || !result.IsAcceptable {
+		t.Errorf("moderate -json - = %d, %q", code, stdout)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	srv := newGateway(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "Hello Jane"})
+
+	code, stdout, stderr := ppctl(t, srv, "", "jobs", "submit", filepath.Join(dir, "a.txt"))
+	if code != exitOK || !strings.HasPrefix(stdout, "job_") {
+		t.Fatalf("jobs submit = %d, %q, stderr %q", code, stdout, stderr)
+	}
+	id := strings.TrimSpace(stdout)
+
+	code, stdout, _ = ppctl(t, srv, "", "jobs", "watch", "-interval", "1ms")
+	if code != exitOK || !strings.Contains(stdout, id+"  succeeded") {
+		t.Errorf("jobs watch = %d, %q", code, stdout)
+	}
+	code, stdout, _ = ppctl(t, srv, "", "jobs", "list")
+	if code != exitOK || !strings.Contains(stdout, id) || !strings.Contains(stdout, "succeeded") || !strings.Contains(stdout, "a.txt") {
+		t.Errorf("jobs list = %d, %q", code, stdout)
+	}
+	code, stdout, _ = ppctl(t, srv, "", "jobs", "fetch", id)
+	if code != exitOK || stdout != "Hello [NAME]" {
+		t.Errorf("jobs fetch = %d, %q", code, stdout)
+	}
+	code, _, stderr = ppctl(t, srv, "", "jobs", "get", "job_unknown")
+	if code != exitFailed || !strings.Contains(stderr, "not_found") {
+		t.Errorf("jobs get of an unknown job = %d, stderr %q", code, stderr)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := newGateway(t)
+	code, stdout, _ := ppctl(t, srv, "", "health")
+	if code != exitOK || !strings.HasPrefix(stdout, "api-gateway  OK") {
+		t.Errorf("health = %d, %q", code, stdout)
+	}
+
+	srv.SetHealth(&ppclient.HealthReport{Status: ppclient.HealthUnavailable, Service: "api-gateway", Checks: map[string]*ppclient.HealthReport{
+		"anonymizer-service": {Status: ppclient.HealthUnavailable, Required: true, Error: "connection refused"},
+	}})
+	code, stdout, _ = ppctl(t, srv, "", "health", "-deep")
+	if code != exitFailed || !strings.Contains(stdout, "\n  anonymizer-service  Unavailable  0ms  connection refused") {
+		t.Errorf("health -deep of a failing gateway = %d, %q", code, stdout)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// manifestName is the default manifest file name. Files with this name are
+// never picked up as inputs.
+const manifestName = "ppctl-manifest.json"
+
+// manifestVersion is bumped on incompatible format changes
+const manifestVersion = 1
+
+// manifest records what an anonymize run did with each file. Paths are
+// relative to the manifest's directory, so the tree can be moved as a whole.
+type manifest struct {
+	Version   int             `json:"version"`
+	Gateway   string          `json:"gateway"`
+	Originals string          `json:"originals,omitempty"` // Directory with copies of the originals, named by their SHA-256
+	UpdatedAt time.Time       `json:"updated_at"`
+	Files     []manifestEntry `json:"files"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+}
+
+// manifestEntry is the outcome for one file. Exactly one of AnonymizedSHA256
+// or Error is set.
+type manifestEntry struct {
+	Source           string    `json:"source"`
+	Output           string    `json:"output"`
+	OriginalSHA256   string    `json:"original_sha256"`
+	AnonymizedSHA256 string    `json:"anonymized_sha256,omitempty"`
+	Bytes            int       `json:"bytes"` // Size of the original
+	Model            string    `json:"model,omitempty"`
+	Cached           bool      `json:"cached,omitempty"`
+	DeanonymizeToken string    `json:"deanonymize_token,omitempty"` // Set by anonymize -reversible
+	Error            string    `json:"error,omitempty"`
+	ProcessedAt      time.Time `json:"processed_at"`
+}
+
+// readManifest loads a manifest. A missing file gives an empty manifest.
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &manifest{Version: manifestVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s is not a ppctl manifest: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("%s has manifest version %d, this ppctl reads version %d", path, m.Version, manifestVersion)
+	}
+	return &m, nil
+}
+
+// merge replaces the entries for the same outputs as entries and adds the rest
+func (m *manifest) merge(entries []manifestEntry) {
+	byOutput := make(map[string]int, len(m.Files))
+	for i, e := range m.Files {
+		byOutput[e.Output] = i
+	}
+	for _, e := range entries {
+		if i, ok := byOutput[e.Output]; ok {
+			m.Files[i] = e
+			continue
+		}
+		byOutput[e.Output] = len(m.Files)
+		m.Files = append(m.Files, e)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Output < m.Files[j].Output })
+
+	m.Succeeded, m.Failed = 0, 0
+	for _, e := range m.Files {
+		if e.Error != "" {
+			m.Failed++
+		} else {
+			m.Succeeded++
+		}
+	}
+}
+
+// write saves the manifest
+func (m *manifest) write(path string) error {
+	m.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+// relTo expresses path relative to the manifest in dir, falling back to an
+// absolute path when there is no relative one (e.g. another drive)
+func relTo(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return abs
+}
+
+// resolve turns a path recorded in the manifest in dir back into a usable one
+func resolve(dir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
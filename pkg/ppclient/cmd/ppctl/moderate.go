@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// moderationResult is one line of "ppctl moderate -json"
+type moderationResult struct {
+	File string `json:"file"`
+	*ppclient.ModerateResponse
+	Error string `json:"error,omitempty"`
+}
+
+// moderate runs "ppctl moderate"
+func (c *cli) moderate(ctx context.Context, args []string) int {
+	flags := c.newFlags("moderate", "FILE|DIR|GLOB ... | -",
+		"Checks each file against the moderation policy, several at a time, and prints\n"+
+			"one verdict per file. Exits with status 3 if any file was flagged.")
+	imageURL := flags.String("image-url", "", "check this image instead of files")
+	asJSON := flags.Bool("json", false, "print one JSON object per file")
+	parallel := flags.Int("parallel", 4, "number of files uploaded at the same time")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *parallel < 1 {
+		return c.usageError(flags, "-parallel must be at least 1")
+	}
+
+	var results []moderationResult
+	if *imageURL != "" {
+		if flags.NArg() > 0 {
+			return c.usageError(flags, "-image-url cannot be combined with files")
+		}
+		callCtx, cancel := c.call(ctx)
+		resp, err := c.client.Moderate(callCtx, ppclient.ModerateRequest{ImageURL: *imageURL})
+		cancel()
+		results = []moderationResult{{File: *imageURL, ModerateResponse: resp}}
+		if err != nil {
+			results[0].Error = describe(err)
+		}
+	} else {
+		if flags.NArg() == 0 {
+			return c.usageError(flags, "no files given")
+		}
+		inputs, err := expandInputs(flags.Args())
+		if err != nil {
+			c.errorf("%v", err)
+			return exitFailed
+		}
+		results = make([]moderationResult, len(inputs))
+		prog := newProgress(c.stderr, "moderated", len(inputs), c.quiet || len(inputs) == 1)
+		forEach(ctx, len(inputs), *parallel, func(i int) {
+			resp, size, err := c.moderateFile(ctx, inputs[i])
+			results[i] = moderationResult{File: inputs[i].path, ModerateResponse: resp}
+			if err != nil {
+				results[i].Error = describe(err)
+			}
+			prog.finished(inputs[i].path, size, err)
+		})
+		prog.close()
+		if ctx.Err() != nil {
+			c.errorf("interrupted")
+			return exitFailed
+		}
+	}
+
+	code := exitOK
+	enc := json.NewEncoder(c.stdout)
+	for _, r := range results {
+		switch {
+		case *asJSON:
+			_ = enc.Encode(r)
+		case r.Error != "":
+			fmt.Fprintf(c.stdout, "error    %s: %s\n", r.File, r.Error)
+		case r.IsAcceptable:
+			fmt.Fprintf(c.stdout, "ok       %s\n", r.File)
+		default:
+			fmt.Fprintf(c.stdout, "flagged  %s (%s): %s\n", r.File, strings.Join(r.Flags, ", "), r.Details)
+		}
+		switch {
+		case r.Error != "":
+			code = exitFailed
+		case !r.IsAcceptable && code == exitOK:
+			code = exitFlagged
+		}
+	}
+	return code
+}
+
+// moderateFile moderates the text of a file, or stdin, and returns its size
+func (c *cli) moderateFile(ctx context.Context, in input) (*ppclient.ModerateResponse, int, error) {
+	data, err := c.readInput(in)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !utf8.Valid(data) {
+		return nil, len(data), errors.New("not UTF-8 text")
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return &ppclient.ModerateResponse{IsAcceptable: true, Flags: []string{}, Details: "empty"}, len(data), nil
+	}
+	callCtx, cancel := c.call(ctx)
+	defer cancel()
+	resp, err := c.client.Moderate(callCtx, ppclient.ModerateRequest{Text: string(data)})
+	return resp, len(data), err
+}
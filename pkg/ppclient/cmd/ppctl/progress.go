@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progress reports how far a run over many files is. On a terminal it keeps
+// one status line up to date; elsewhere (e.g. in CI logs) it only prints the
+// failures and the summary.
+type progress struct {
+	mu     sync.Mutex
+	w      io.Writer
+	live   bool // Redraw the status line
+	quiet  bool // Only failures
+	verb   string
+	total  int
+	done   int
+	failed int
+	bytes  int64
+	start  time.Time
+}
+
+func newProgress(w io.Writer, verb string, total int, quiet bool) *progress {
+	p := &progress{w: w, live: !quiet && isTerminal(w), quiet: quiet, verb: verb, total: total, start: time.Now()}
+	p.draw()
+	return p
+}
+
+// finished records a processed file
+func (p *progress) finished(name string, size int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.bytes += int64(size)
+	if err != nil {
+		p.failed++
+		p.clear()
+		fmt.Fprintf(p.w, "ppctl: %s: %s\n", name, describe(err))
+	}
+	p.draw()
+}
+
+// close ends the status line with a summary
+func (p *progress) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	if p.quiet {
+		return
+	}
+	fmt.Fprintf(p.w, "%s %d of %d files (%s) in %s", p.verb, p.done-p.failed, p.total, formatBytes(p.bytes), time.Since(p.start).Round(100*time.Millisecond))
+	if p.failed > 0 {
+		fmt.Fprintf(p.w, ", %d failed", p.failed)
+	}
+	fmt.Fprintln(p.w)
+}
+
+// draw shows the status line. Caller must hold p.mu.
+func (p *progress) draw() {
+	if !p.live {
+		return
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s: %d/%d files, %s", p.verb, p.done, p.total, formatBytes(p.bytes))
+	if p.failed > 0 {
+		fmt.Fprintf(p.w, ", %d failed", p.failed)
+	}
+}
+
+// clear removes the status line. Caller must hold p.mu.
+func (p *progress) clear() {
+	if p.live {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
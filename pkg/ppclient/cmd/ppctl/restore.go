@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// restore runs "ppctl restore". It never calls the gateway: anonymization
+// cannot be reversed, so files are restored from local copies of the originals.
+func (c *cli) restore(args []string) int {
+	flags := c.newFlags("restore", "[FILE ...]",
+		"Restores files anonymized by ppctl to their original text, locally and\n"+
+			"without calling the gateway. The model's replacements cannot be reversed,\n"+
+			"so the originals are copied back from the sources recorded in the manifest\n"+
+			"or, for files anonymized with -in-place, from the -originals directory.\n"+
+			"Without arguments every file in the manifest is restored.")
+	manifestPath := flags.String("manifest", manifestName, "manifest of the anonymize run")
+	force := flags.Bool("force", false, "restore files even if they were changed after they were anonymized")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+	if len(m.Files) == 0 {
+		c.errorf("no files are recorded in %s", *manifestPath)
+		return exitFailed
+	}
+	manifestDir, err := filepath.Abs(filepath.Dir(*manifestPath))
+	if err != nil {
+		c.errorf("%v", err)
+		return exitFailed
+	}
+
+	wanted := map[string]bool{}
+	for _, arg := range flags.Args() {
+		wanted[relTo(manifestDir, arg)] = true
+	}
+	restored, failed := 0, 0
+	for _, e := range m.Files {
+		if len(wanted) > 0 && !wanted[e.Output] {
+			continue
+		}
+		delete(wanted, e.Output)
+		if e.Error != "" {
+			continue // Never written
+		}
+		output := resolve(manifestDir, e.Output)
+		if err := c.restoreFile(m, manifestDir, e, output, *force); err != nil {
+			c.errorf("%s: %v", output, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	for path := range wanted {
+		c.errorf("%s: not recorded in %s", resolve(manifestDir, path), *manifestPath)
+		failed++
+	}
+
+	if !c.quiet {
+		fmt.Fprintf(c.stderr, "restored %d files", restored)
+		if failed > 0 {
+			fmt.Fprintf(c.stderr, ", %d failed", failed)
+		}
+		fmt.Fprintln(c.stderr)
+	}
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// restoreFile writes the original of entry e back to output
+func (c *cli) restoreFile(m *manifest, manifestDir string, e manifestEntry, output string, force bool) error {
+	current, err := os.ReadFile(output)
+	if err != nil {
+		return err
+	}
+	switch sha256Hex(current) {
+	case e.OriginalSHA256:
+		return nil // Already restored
+	case e.AnonymizedSHA256:
+	default:
+		if !force {
+			return errors.New("changed after it was anonymized (use -force to overwrite it)")
+		}
+	}
+
+	var candidates []string
+	if m.Originals != "" {
+		candidates = append(candidates, filepath.Join(resolve(manifestDir, m.Originals), e.OriginalSHA256))
+	}
+	if e.Source != e.Output {
+		candidates = append(candidates, resolve(manifestDir, e.Source))
+	}
+	for _, candidate := range candidates {
+		original, err := os.ReadFile(candidate)
+		if err != nil || sha256Hex(original) != e.OriginalSHA256 {
+			continue // Missing, or the source changed since
+		}
+		return writeFileAtomic(output, original, fileMode(output))
+	}
+	if e.Source == e.Output && m.Originals == "" {
+		return errors.New("the original was not kept (anonymize -in-place with -originals to keep it)")
+	}
+	return errors.New("the original is no longer available")
+}
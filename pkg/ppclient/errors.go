@@ -0,0 +1,116 @@
+package ppclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Machine-readable error codes returned by the gateway
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeNotFound              = "not_found"
+	CodeModelNotFound         = "model_not_found"
+	CodeUnsupportedTask       = "unsupported_task"
+	CodeRateLimited           = "rate_limited"
+	CodeQuotaExceeded         = "quota_exceeded"
+	CodePayloadTooLarge       = "payload_too_large"
+	CodeQueueFull             = "queue_full"
+	CodeVerificationFailed    = "verification_failed"
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeIdempotencyInProgress = "idempotency_in_progress"
+	CodeUpstreamUnavailable   = "upstream_unavailable"
+	CodeUpstreamTimeout       = "upstream_timeout"
+	CodeCircuitOpen           = "circuit_open"
+	CodeDeadlineExceeded      = "deadline_exceeded"
+	CodeUpstreamError         = "upstream_error"
+	CodeShuttingDown          = "shutting_down"
+	CodeInternal              = "internal_error"
+)
+
+// Error is an error returned by the API:
+//
+//	{"error": {"code": "...", "message": "...", "retryable": false, "request_id": "...", "service": "..."}}
+type Error struct {
+	StatusCode int           `json:"-"` // HTTP status; 0 for errors reported inside a batch or stream
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Retryable  bool          `json:"retryable"`
+	RequestID  string        `json:"request_id,omitempty"`
+	Service    string        `json:"service"` // Service the error originated in
+	RetryAfter time.Duration `json:"-"`       // From the Retry-After header, if any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (%s, status %d)", e.Service, e.Message, e.Code, e.StatusCode)
+}
+
+// IsCode reports whether err is an API error with the given code
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+type envelope struct {
+	Error *Error `json:"error"`
+}
+
+// errorFromResponse decodes a non-2xx response. Bodies that are not an error
+// envelope (e.g. from a proxy in front of the gateway) get a code matching the status.
+func errorFromResponse(resp *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var env envelope
+	var apiErr *Error
+	if err := json.Unmarshal(body, &env); err == nil && env.Error != nil && env.Error.Code != "" {
+		apiErr = env.Error
+	} else {
+		apiErr = &Error{
+			Code:      codeForStatus(resp.StatusCode),
+			Message:   http.StatusText(resp.StatusCode),
+			Retryable: retryableStatus(resp.StatusCode),
+		}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get(headerRequestID)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeUnauthorized
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status == http.StatusServiceUnavailable:
+		return CodeUpstreamUnavailable
+	case status == http.StatusGatewayTimeout:
+		return CodeUpstreamTimeout
+	case status >= 400 && status < 500:
+		return CodeInvalidRequest
+	}
+	return CodeUpstreamError
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
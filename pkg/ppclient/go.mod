@@ -0,0 +1,3 @@
+module github.com/mihaibc/PrivacyPilot/pkg/ppclient
+
+go 1.23.4
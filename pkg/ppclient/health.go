@@ -0,0 +1,68 @@
+package ppclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Health statuses
+const (
+	HealthOK          = "OK"
+	HealthDegraded    = "Degraded"    // An optional dependency is failing
+	HealthUnavailable = "Unavailable" // A required dependency is failing
+)
+
+// HealthReport is the result of a health check. Reports of the services
+// behind the gateway are nested under Checks.
+type HealthReport struct {
+	Status    string                   `json:"status"`
+	Service   string                   `json:"service,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+	Required  bool                     `json:"required,omitempty"`
+	LatencyMS int64                    `json:"latency_ms"`
+	CheckedAt time.Time                `json:"checked_at,omitempty"`
+	Details   map[string]any           `json:"details,omitempty"`
+	Checks    map[string]*HealthReport `json:"checks,omitempty"`
+}
+
+// Ready checks whether the gateway and the services it needs are up
+// (/readyz). An Unavailable gateway is reported in the result, not as an error.
+func (c *Client) Ready(ctx context.Context) (*HealthReport, error) {
+	return c.health(ctx, "/readyz")
+}
+
+// DeepHealth checks the whole topology behind the gateway down to the models
+// (/health/deep). It needs an admin API key.
+func (c *Client) DeepHealth(ctx context.Context) (*HealthReport, error) {
+	return c.health(ctx, "/health/deep")
+}
+
+// health makes a single attempt, since a failing check is an answer rather
+// than an error worth retrying
+func (c *Client) health(ctx context.Context, path string) (*HealthReport, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		apiErr := errorFromResponse(resp)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, apiErr
+	}
+
+	var report HealthReport
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(body, &report); err != nil || report.Status == "" {
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			// e.g. from a proxy in front of the gateway
+			return &HealthReport{Status: HealthUnavailable, Error: http.StatusText(resp.StatusCode)}, nil
+		}
+		return nil, fmt.Errorf("ppclient: response from %s is not a health report", path)
+	}
+	return &report, nil
+}
@@ -0,0 +1,101 @@
+package ppclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Job types accepted by SubmitJob
+const (
+	JobTypeAnonymize = "anonymize"
+	JobTypeModerate  = "moderate"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRequest is the body of POST /api/v1/jobs
+type JobRequest struct {
+	Type        string `json:"type"`
+	Input       any    `json:"input"`                  // AnonymizeRequest or ModerateRequest, matching Type
+	CallbackURL string `json:"callback_url,omitempty"` // Optional: receives a signed webhook on completion
+}
+
+// Job is the state of an asynchronous job. Result is set once it succeeded
+// and Error once it failed.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *Error          `json:"error,omitempty"`
+	CallbackURL string          `json:"callback_url,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"` // Set once the job is finished
+}
+
+// Finished reports whether the job succeeded or failed
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// DecodeResult decodes the result of a succeeded job into out, e.g. an
+// *AnonymizeResponse for an anonymize job
+func (j *Job) DecodeResult(out any) error {
+	if j.Status != JobSucceeded {
+		return errors.New("ppclient: job " + j.ID + " has no result, it is " + j.Status)
+	}
+	return json.Unmarshal(j.Result, out)
+}
+
+// SubmitJob queues a job and returns its initial state
+func (c *Client) SubmitJob(ctx context.Context, req JobRequest) (*Job, error) {
+	var job Job
+	if err := c.postJSON(ctx, "/api/v1/jobs", req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJob returns the current state of a job. Jobs are forgotten some time
+// after they finish (CodeNotFound).
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.get(ctx, "/api/v1/jobs/"+url.PathEscape(id), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitJob polls a job every interval until it is finished or ctx is done.
+// onChange, if not nil, is called with every state whose status differs from
+// the previous one.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration, onChange func(*Job)) (*Job, error) {
+	var status string
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != status && onChange != nil {
+			onChange(job)
+		}
+		status = job.Status
+		if job.Finished() {
+			return job, nil
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ppclient
+
+// CacheMode is how an anonymization uses the anonymizer's result cache
+type CacheMode string
+
+const (
+	CacheDefault CacheMode = ""        // Use a cached result if there is one, otherwise cache the new result
+	CacheRefresh CacheMode = "refresh" // Ignore any cached result and cache the new one
+	CacheBypass  CacheMode = "bypass"  // Neither use nor store a cached result
+)
+
+// AnonymizeRequest is the body of POST /api/v1/anonymize and /api/v1/anonymize/stream
+type AnonymizeRequest struct {
+	Text  string    `json:"text"`
+	Model string    `json:"model,omitempty"` // Optional: model to use instead of the adapter's default
+	Cache CacheMode `json:"cache,omitempty"` // Optional: how the result cache is used
+	// Optional: number the placeholders (e.g. [NAME_1]) and return a DeanonymizeToken.
+	// Streams ignore it.
+	Reversible bool `json:"reversible,omitempty"`
+}
+
+// AnonymizeResponse is the result of an anonymization
+type AnonymizeResponse struct {
+	OriginalText   string `json:"original_text"`
+	AnonymizedText string `json:"anonymized_text"`
+	Cached         bool   `json:"cached"` // Served from the anonymizer's result cache
+	// For reversible requests: the replaced values, encrypted, for Deanonymize.
+	// Only the API key that anonymized (or another key of its tenant) can use it.
+	DeanonymizeToken string `json:"deanonymize_token,omitempty"`
+}
+
+// DeanonymizeRequest is the body of POST /api/v1/deanonymize
+type DeanonymizeRequest struct {
+	Text  string `json:"text"` // Text with the numbered placeholders of a reversible anonymization, edited or not
+	Token string `json:"deanonymize_token"`
+}
+
+// DeanonymizeResponse is the restored text
+type DeanonymizeResponse struct {
+	Text     string `json:"text"`
+	Restored int    `json:"restored"` // Placeholders replaced by their original values
+}
+
+// BatchItem is one record of a batch
+type BatchItem struct {
+	ID   string `json:"id"` // Unique within the batch; results carry it back
+	Text string `json:"text"`
+}
+
+// BatchRequest is the body of POST /api/v1/anonymize/batch
+type BatchRequest struct {
+	Items       []BatchItem `json:"items"`
+	Concurrency int         `json:"concurrency,omitempty"` // Optional: lower the gateway's concurrency for this batch
+}
+
+// BatchResult is the outcome for one batch item. Exactly one of
+// AnonymizedText or Error is set.
+type BatchResult struct {
+	ID             string `json:"id"`
+	AnonymizedText string `json:"anonymized_text,omitempty"`
+	Error          *Error `json:"error,omitempty"`
+}
+
+// BatchResponse holds per-item results in request order
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+// StreamResult is the outcome of a completed stream
+type StreamResult struct {
+	AnonymizedText string `json:"anonymized_text"`
+	ModelUsed      string `json:"model_used"`
+}
+
+// ModerateRequest is the body of POST /api/v1/moderate. Set Text, ImageURL or both.
+type ModerateRequest struct {
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+// ModerateResponse is the moderation verdict
+type ModerateResponse struct {
+	IsAcceptable    bool     `json:"is_acceptable"`
+	Flags           []string `json:"flags"`
+	Details         string   `json:"details"`
+	ConfidenceScore float64  `json:"confidence_score"`
+}
@@ -0,0 +1,341 @@
+package ppclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient/ppclienttest"
+)
+
+func unavailable() *ppclient.Error {
+	return &ppclient.Error{StatusCode: http.StatusServiceUnavailable, Code: ppclient.CodeUpstreamUnavailable, Message: "anonymizer-service is unavailable", Retryable: true}
+}
+
+func TestAnonymizeAndModerate(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.APIKey = "secret"
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		if req.Model == "missing" {
+			return nil, &ppclient.Error{StatusCode: http.StatusNotFound, Code: ppclient.CodeModelNotFound, Message: "model 'missing' not found", Service: "ollama-adapter"}
+		}
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: strings.ReplaceAll(req.Text, "Jane", "[NAME]"), Cached: req.Cache == ppclient.CacheDefault}, nil
+	})
+	client := srv.Client(ppclient.WithUserAgent("billing/2.1"))
+	ctx := context.Background()
+
+	resp, err := client.Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello Jane"})
+	if err != nil {
+		t.Fatalf("Anonymize: %v", err)
+	}
+	if resp.AnonymizedText != "Hello [NAME]" || !resp.Cached {
+		t.Errorf("Anonymize = %+v", resp)
+	}
+	resp, err = client.Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello Jane", Cache: ppclient.CacheBypass})
+	if err != nil || resp.Cached {
+		t.Errorf("Anonymize with cache bypass = %+v, %v", resp, err)
+	}
+
+	_, err = client.Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello Jane", Model: "missing"})
+	var apiErr *ppclient.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Service != "ollama-adapter" || !ppclient.IsCode(err, ppclient.CodeModelNotFound) {
+		t.Errorf("Anonymize with a missing model = %v", err)
+	}
+
+	verdict, err := client.Moderate(ctx, ppclient.ModerateRequest{Text: "Hello"})
+	if err != nil || !verdict.IsAcceptable {
+		t.Errorf("Moderate = %+v, %v", verdict, err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("Got %d requests, want 4 (errors that are not retryable must not be retried)", len(requests))
+	}
+	keys := map[string]bool{}
+	for _, r := range requests {
+		if r.Header.Get("X-API-Key") != "secret" {
+			t.Errorf("%s sent credentials %q", r.Path, r.Header.Get("X-API-Key"))
+		}
+		if ua := r.Header.Get("User-Agent"); !strings.HasPrefix(ua, "billing/2.1 ppclient-go/") {
+			t.Errorf("User-Agent = %q", ua)
+		}
+		keys[r.Header.Get("Idempotency-Key")] = true
+	}
+	if len(keys) != 4 || keys[""] {
+		t.Errorf("Every call needs its own Idempotency-Key, got %v", keys)
+	}
+
+	_, err = srv.Client(ppclient.WithAPIKey("wrong")).Moderate(ctx, ppclient.ModerateRequest{Text: "Hello"})
+	if !ppclient.IsCode(err, ppclient.CodeForbidden) {
+		t.Errorf("Moderate with a wrong key = %v", err)
+	}
+}
+
+func TestDeanonymize(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		if !req.Reversible {
+			return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: "Hello [NAME]"}, nil
+		}
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: "Hello [NAME_1]", DeanonymizeToken: "token-1"}, nil
+	})
+	srv.OnDeanonymize(func(req ppclient.DeanonymizeRequest) (*ppclient.DeanonymizeResponse, error) {
+		if req.Token != "token-1" {
+			return nil, &ppclient.Error{StatusCode: http.StatusBadRequest, Code: ppclient.CodeInvalidRequest, Message: "Invalid request: deanonymize_token was not issued to this caller or is malformed"}
+		}
+		return &ppclient.DeanonymizeResponse{Text: strings.ReplaceAll(req.Text, "[NAME_1]", "Jane"), Restored: strings.Count(req.Text, "[NAME_1]")}, nil
+	})
+	client := srv.Client()
+	ctx := context.Background()
+
+	anonymized, err := client.Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello Jane", Reversible: true})
+	if err != nil || anonymized.DeanonymizeToken != "token-1" {
+		t.Fatalf("Reversible Anonymize = %+v, %v", anonymized, err)
+	}
+	restored, err := client.Deanonymize(ctx, ppclient.DeanonymizeRequest{Text: "Dear [NAME_1], hello [NAME_1]", Token: anonymized.DeanonymizeToken})
+	if err != nil || restored.Text != "Dear Jane, hello Jane" || restored.Restored != 2 {
+		t.Errorf("Deanonymize = %+v, %v", restored, err)
+	}
+	if !strings.Contains(string(srv.Requests()[0].Body), `"reversible":true`) {
+		t.Errorf("Reversible was not sent: %s", srv.Requests()[0].Body)
+	}
+
+	_, err = client.Deanonymize(ctx, ppclient.DeanonymizeRequest{Text: "Hello [NAME_1]", Token: "someone-else"})
+	if !ppclient.IsCode(err, ppclient.CodeInvalidRequest) {
+		t.Errorf("Deanonymize with another token = %v", err)
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+
+	if _, err := client.Moderate(context.Background(), ppclient.ModerateRequest{Text: "Hello"}); err != nil {
+		t.Fatalf("Moderate: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Moderate(ctx, ppclient.ModerateRequest{Text: "Hello"}); err != nil {
+		t.Fatalf("Moderate with a deadline: %v", err)
+	}
+
+	requests := srv.Requests()
+	if budget := requests[0].Header.Get("X-Request-Budget-Ms"); budget != "" {
+		t.Errorf("A call without a deadline sent a budget of %q", budget)
+	}
+	budget, err := strconv.Atoi(requests[1].Header.Get("X-Request-Budget-Ms"))
+	if err != nil || budget <= 4000 || budget > 5000 {
+		t.Errorf("A call with 5s left sent a budget of %q", requests[1].Header.Get("X-Request-Budget-Ms"))
+	}
+}
+
+func TestRetries(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Retryable failures are retried with the same Idempotency-Key
+	srv.FailNext(unavailable(), &ppclient.Error{StatusCode: http.StatusTooManyRequests, Code: ppclient.CodeRateLimited, Retryable: true, RetryAfter: time.Second})
+	start := time.Now()
+	resp, err := srv.Client().Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello"})
+	if err != nil || resp.AnonymizedText != "Hello" {
+		t.Fatalf("Anonymize after two failures = %+v, %v", resp, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After was not honoured, the call took %v", elapsed)
+	}
+	requests := srv.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("Got %d attempts, want 3", len(requests))
+	}
+	for _, r := range requests[1:] {
+		if r.Header.Get("Idempotency-Key") != requests[0].Header.Get("Idempotency-Key") {
+			t.Errorf("Retries must reuse the Idempotency-Key")
+		}
+	}
+
+	// Attempts are bounded, and the last failure is returned
+	srv.FailNext(unavailable(), unavailable(), unavailable())
+	_, err = srv.Client().Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello"})
+	if !ppclient.IsCode(err, ppclient.CodeUpstreamUnavailable) || len(srv.Requests()) != 6 {
+		t.Errorf("Anonymize after exhausting retries = %v after %d requests", err, len(srv.Requests())-3)
+	}
+
+	// A Retry-After beyond MaxRetryAfter ends the call at once
+	srv.FailNext(&ppclient.Error{StatusCode: http.StatusTooManyRequests, Code: ppclient.CodeQuotaExceeded, Retryable: true, RetryAfter: time.Hour})
+	_, err = srv.Client().Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello"})
+	var apiErr *ppclient.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != ppclient.CodeQuotaExceeded || apiErr.RetryAfter != time.Hour || len(srv.Requests()) != 7 {
+		t.Errorf("Anonymize over quota = %v", err)
+	}
+
+	// NoRetry and a caller-chosen key
+	srv.FailNext(unavailable())
+	_, err = srv.Client(ppclient.WithRetry(ppclient.NoRetry)).Anonymize(ppclient.WithIdempotencyKey(ctx, "order-42"), ppclient.AnonymizeRequest{Text: "Hello"})
+	requests = srv.Requests()
+	if err == nil || len(requests) != 8 || requests[7].Header.Get("Idempotency-Key") != "order-42" {
+		t.Errorf("Anonymize without retries = %v after %d requests", err, len(requests))
+	}
+
+	// Cancelling the call stops retrying
+	srv.FailNext(unavailable(), unavailable())
+	slow := srv.Client(ppclient.WithRetry(ppclient.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}))
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = slow.Anonymize(cctx, ppclient.AnonymizeRequest{Text: "Hello"})
+	if !ppclient.IsCode(err, ppclient.CodeUpstreamUnavailable) || len(srv.Requests()) != 9 {
+		t.Errorf("Cancelled Anonymize = %v", err)
+	}
+
+	// An unreachable gateway is retried too
+	srv.Close()
+	_, err = srv.Client().Anonymize(ctx, ppclient.AnonymizeRequest{Text: "Hello"})
+	var apiErr2 *ppclient.Error
+	if err == nil || errors.As(err, &apiErr2) {
+		t.Errorf("Anonymize against a closed server = %v", err)
+	}
+}
+
+func TestAnonymizeAll(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		if req.Text == "bad" {
+			return nil, &ppclient.Error{StatusCode: http.StatusBadGateway, Code: ppclient.CodeUpstreamError, Message: "invalid response from ollama-adapter", Retryable: true}
+		}
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: strings.ToUpper(req.Text)}, nil
+	})
+
+	items := make([]ppclient.BatchItem, 5)
+	for i := range items {
+		items[i] = ppclient.BatchItem{ID: fmt.Sprintf("r%d", i), Text: fmt.Sprintf("text %d", i)}
+	}
+	items[3].Text = "bad"
+	resp, err := srv.Client().AnonymizeAll(context.Background(), items, 2)
+	if err != nil {
+		t.Fatalf("AnonymizeAll: %v", err)
+	}
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("Sent %d batches, want 3", got)
+	}
+	if resp.Succeeded != 4 || resp.Failed != 1 || len(resp.Results) != 5 {
+		t.Fatalf("AnonymizeAll = %+v", resp)
+	}
+	for i, r := range resp.Results {
+		if r.ID != items[i].ID {
+			t.Errorf("Result %d has ID %q, want %q", i, r.ID, items[i].ID)
+		}
+	}
+	if resp.Results[0].AnonymizedText != "TEXT 0" || resp.Results[3].Error == nil || resp.Results[3].Error.Code != ppclient.CodeUpstreamError {
+		t.Errorf("Unexpected results %+v", resp.Results)
+	}
+
+	// A failed batch returns the results gathered before it
+	srv.FailNext(nil, &ppclient.Error{StatusCode: http.StatusBadRequest, Code: ppclient.CodeInvalidRequest, Message: "duplicate item id"})
+	resp, err = srv.Client().AnonymizeAll(context.Background(), items, 2)
+	if !ppclient.IsCode(err, ppclient.CodeInvalidRequest) || len(resp.Results) != 2 {
+		t.Errorf("AnonymizeAll with a failing batch = %d results, %v", len(resp.Results), err)
+	}
+}
+
+func TestAnonymizeStream(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: "My name is [NAME] and I live in [CITY]"}, nil
+	})
+	ctx := context.Background()
+
+	srv.FailNext(unavailable())
+	var tokens []string
+	result, err := srv.Client().AnonymizeStream(ctx, ppclient.AnonymizeRequest{Text: "My name is Jane and I live in Paris", Model: "llama3"}, func(text string) error {
+		tokens = append(tokens, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AnonymizeStream: %v", err)
+	}
+	if len(tokens) < 2 || strings.Join(tokens, "") != result.AnonymizedText || result.ModelUsed != "llama3" {
+		t.Errorf("Streamed %q, result %+v", tokens, result)
+	}
+	if len(srv.Requests()) != 2 {
+		t.Errorf("A failure before the stream started must be retried")
+	}
+
+	stop := errors.New("stop")
+	_, err = srv.Client().AnonymizeStream(ctx, ppclient.AnonymizeRequest{Text: "Hello"}, func(string) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("AnonymizeStream must end with the callback's error, got %v", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: "Hello [NAME]"}, nil
+	})
+	client := srv.Client()
+	ctx := context.Background()
+
+	job, err := client.SubmitJob(ctx, ppclient.JobRequest{Type: ppclient.JobTypeAnonymize, Input: ppclient.AnonymizeRequest{Text: "Hello Jane"}})
+	if err != nil || job.Status != ppclient.JobQueued || job.ID == "" {
+		t.Fatalf("SubmitJob = %+v, %v", job, err)
+	}
+	var seen []string
+	job, err = client.WaitJob(ctx, job.ID, time.Millisecond, func(j *ppclient.Job) { seen = append(seen, j.Status) })
+	if err != nil || !job.Finished() || len(seen) != 1 {
+		t.Fatalf("WaitJob = %+v, %v (saw %v)", job, err, seen)
+	}
+	var result ppclient.AnonymizeResponse
+	if err := job.DecodeResult(&result); err != nil || result.AnonymizedText != "Hello [NAME]" {
+		t.Errorf("DecodeResult = %+v, %v", result, err)
+	}
+
+	// Polls are retried like any other call
+	srv.FailNext(unavailable())
+	if _, err := client.GetJob(ctx, job.ID); err != nil {
+		t.Errorf("GetJob after a failure = %v", err)
+	}
+	if _, err := client.GetJob(ctx, "job_missing"); !ppclient.IsCode(err, ppclient.CodeNotFound) {
+		t.Errorf("GetJob of an unknown job = %v", err)
+	}
+	if _, err := client.SubmitJob(ctx, ppclient.JobRequest{Type: "translate", Input: map[string]string{}}); !ppclient.IsCode(err, ppclient.CodeInvalidRequest) {
+		t.Errorf("SubmitJob of an unknown type = %v", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := ppclienttest.NewServer()
+	defer srv.Close()
+	srv.APIKey = "admin"
+	ctx := context.Background()
+
+	report, err := srv.Client(ppclient.WithAPIKey("")).Ready(ctx)
+	if err != nil || report.Status != ppclient.HealthOK {
+		t.Errorf("Ready = %+v, %v", report, err)
+	}
+
+	srv.SetHealth(&ppclient.HealthReport{Status: ppclient.HealthUnavailable, Checks: map[string]*ppclient.HealthReport{
+		"anonymizer-service": {Status: ppclient.HealthUnavailable, Required: true, Error: "connection refused"},
+	}})
+	report, err = srv.Client().DeepHealth(ctx)
+	if err != nil || report.Status != ppclient.HealthUnavailable || report.Checks["anonymizer-service"].Error != "connection refused" {
+		t.Errorf("DeepHealth of a failing gateway = %+v, %v", report, err)
+	}
+	if len(srv.Requests()) != 2 {
+		t.Errorf("Failing health checks must not be retried")
+	}
+	if _, err := srv.Client(ppclient.WithAPIKey("")).DeepHealth(ctx); !ppclient.IsCode(err, ppclient.CodeUnauthorized) {
+		t.Errorf("DeepHealth without a key = %v", err)
+	}
+}
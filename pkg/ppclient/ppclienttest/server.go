@@ -0,0 +1,438 @@
+// Package ppclienttest provides a fake PrivacyPilot gateway for unit tests of
+// code using ppclient:
+//
+//	srv := ppclienttest.NewServer()
+//	defer srv.Close()
+//	srv.OnAnonymize(func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+//		return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: "Hello [NAME]"}, nil
+//	})
+//	client := srv.Client()
+//
+// The fake speaks the gateway's wire format, including its error envelope,
+// Retry-After and the Server-Sent Events of the streaming route, but runs no
+// models: responses come from the functions set on the server. Jobs run as
+// soon as they are submitted and are reported finished from their first poll.
+package ppclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/ppclient"
+)
+
+// AnonymizeFunc produces the result of an anonymization. Returning a
+// *ppclient.Error sends it as the gateway would; any other error becomes a
+// 500 internal_error.
+type AnonymizeFunc func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error)
+
+// DeanonymizeFunc restores a text, with errors as for AnonymizeFunc
+type DeanonymizeFunc func(req ppclient.DeanonymizeRequest) (*ppclient.DeanonymizeResponse, error)
+
+// ModerateFunc produces a moderation verdict, with errors as for AnonymizeFunc
+type ModerateFunc func(req ppclient.ModerateRequest) (*ppclient.ModerateResponse, error)
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server is a fake gateway. By default it returns texts unchanged, restoring
+// nothing, and finds every text acceptable.
+type Server struct {
+	*httptest.Server
+	// APIKey, if set, is required in X-API-Key; other keys get 401
+	APIKey string
+
+	mu          sync.Mutex
+	anonymize   AnonymizeFunc
+	deanonymize DeanonymizeFunc
+	moderate    ModerateFunc
+	health      *ppclient.HealthReport
+	jobs        map[string]*ppclient.Job
+	failures    []*ppclient.Error
+	requests    []Request
+}
+
+// NewServer starts a fake gateway. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		anonymize: func(req ppclient.AnonymizeRequest) (*ppclient.AnonymizeResponse, error) {
+			return &ppclient.AnonymizeResponse{OriginalText: req.Text, AnonymizedText: req.Text}, nil
+		},
+		deanonymize: func(req ppclient.DeanonymizeRequest) (*ppclient.DeanonymizeResponse, error) {
+			return &ppclient.DeanonymizeResponse{Text: req.Text}, nil
+		},
+		moderate: func(ppclient.ModerateRequest) (*ppclient.ModerateResponse, error) {
+			return &ppclient.ModerateResponse{IsAcceptable: true, Flags: []string{}, ConfidenceScore: 1}, nil
+		},
+		health: &ppclient.HealthReport{Status: ppclient.HealthOK, Service: "api-gateway"},
+		jobs:   make(map[string]*ppclient.Job),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/anonymize", s.handleAnonymize)
+	mux.HandleFunc("POST /api/v1/anonymize/stream", s.handleAnonymizeStream)
+	mux.HandleFunc("POST /api/v1/anonymize/batch", s.handleAnonymizeBatch)
+	mux.HandleFunc("POST /api/v1/deanonymize", s.handleDeanonymize)
+	mux.HandleFunc("POST /api/v1/moderate", s.handleModerate)
+	mux.HandleFunc("POST /api/v1/jobs", s.handleSubmitJob)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /readyz", s.handleHealth)
+	mux.HandleFunc("GET /health/deep", s.handleHealth)
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// Client returns a client for the server, authenticated with APIKey. Retries
+// back off for milliseconds instead of seconds; opts override any setting.
+func (s *Server) Client(opts ...ppclient.Option) *ppclient.Client {
+	defaults := []ppclient.Option{
+		ppclient.WithHTTPClient(s.Server.Client()),
+		ppclient.WithRetry(ppclient.RetryPolicy{
+			MaxAttempts:    ppclient.DefaultRetryPolicy.MaxAttempts,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			MaxRetryAfter:  ppclient.DefaultRetryPolicy.MaxRetryAfter,
+		}),
+	}
+	if s.APIKey != "" {
+		defaults = append(defaults, ppclient.WithAPIKey(s.APIKey))
+	}
+	return ppclient.New(s.URL, append(defaults, opts...)...)
+}
+
+// OnAnonymize sets how anonymizations, including batch items and streams, are answered
+func (s *Server) OnAnonymize(fn AnonymizeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.anonymize = fn
+}
+
+// OnDeanonymize sets how deanonymizations are answered
+func (s *Server) OnDeanonymize(fn DeanonymizeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deanonymize = fn
+}
+
+// OnModerate sets how moderations are answered
+func (s *Server) OnModerate(fn ModerateFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moderate = fn
+}
+
+// SetHealth sets the report of the readiness and deep health checks. An
+// Unavailable report is sent with status 503.
+func (s *Server) SetHealth(report *ppclient.HealthReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = report
+}
+
+// FailNext makes the next len(errs) requests, on any route, fail with errs in
+// order. Set StatusCode and RetryAfter to control the response; a zero
+// StatusCode is sent as 503. Retryable is sent as given, so set it for
+// failures the client should retry. A nil entry lets its request through.
+func (s *Server) FailNext(errs ...*ppclient.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, errs...)
+}
+
+// Requests returns the requests received so far, oldest first
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// middleware records requests, checks the API key and injects queued failures
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		var failure *ppclient.Error
+		if len(s.failures) > 0 {
+			failure, s.failures = s.failures[0], s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/readyz" && failure == nil:
+			next.ServeHTTP(w, r) // Unauthenticated on the gateway too
+		case s.APIKey != "" && r.Header.Get("X-API-Key") == "":
+			writeError(w, &ppclient.Error{StatusCode: http.StatusUnauthorized, Code: ppclient.CodeUnauthorized, Message: "API key required"})
+		case s.APIKey != "" && r.Header.Get("X-API-Key") != s.APIKey:
+			writeError(w, &ppclient.Error{StatusCode: http.StatusForbidden, Code: ppclient.CodeForbidden, Message: "Invalid API key"})
+		case failure != nil:
+			writeError(w, failure)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (s *Server) handleAnonymize(w http.ResponseWriter, r *http.Request) {
+	var req ppclient.AnonymizeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		writeError(w, invalidRequest("Invalid request: text is required"))
+		return
+	}
+	resp, err := s.anonymizeFunc()(req)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAnonymizeStream streams the anonymized text word by word
+func (s *Server) handleAnonymizeStream(w http.ResponseWriter, r *http.Request) {
+	var req ppclient.AnonymizeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		writeError(w, invalidRequest("Invalid request: text is required"))
+		return
+	}
+	resp, err := s.anonymizeFunc()(req)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, word := range strings.SplitAfter(resp.AnonymizedText, " ") {
+		writeEvent(w, "token", map[string]string{"text": word})
+	}
+	model := req.Model
+	if model == "" {
+		model = "fake"
+	}
+	writeEvent(w, "done", ppclient.StreamResult{AnonymizedText: resp.AnonymizedText, ModelUsed: model})
+}
+
+func (s *Server) handleAnonymizeBatch(w http.ResponseWriter, r *http.Request) {
+	var req ppclient.BatchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if len(req.Items) == 0 {
+		writeError(w, invalidRequest("Invalid request: items must not be empty"))
+		return
+	}
+	if len(req.Items) > ppclient.MaxBatchItems {
+		writeError(w, invalidRequest(fmt.Sprintf("Invalid request: batch exceeds the maximum of %d items", ppclient.MaxBatchItems)))
+		return
+	}
+
+	anonymize := s.anonymizeFunc()
+	resp := ppclient.BatchResponse{Results: make([]ppclient.BatchResult, len(req.Items))}
+	for i, item := range req.Items {
+		resp.Results[i].ID = item.ID
+		out, err := anonymize(ppclient.AnonymizeRequest{Text: item.Text})
+		if err != nil {
+			apiErr := *toAPIError(err)
+			apiErr.StatusCode, apiErr.RetryAfter = 0, 0
+			resp.Results[i].Error = &apiErr
+			resp.Failed++
+			continue
+		}
+		resp.Results[i].AnonymizedText = out.AnonymizedText
+		resp.Succeeded++
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDeanonymize(w http.ResponseWriter, r *http.Request) {
+	var req ppclient.DeanonymizeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" || req.Token == "" {
+		writeError(w, invalidRequest("Invalid request: text and deanonymize_token are required"))
+		return
+	}
+	s.mu.Lock()
+	deanonymize := s.deanonymize
+	s.mu.Unlock()
+	resp, err := deanonymize(req)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleModerate(w http.ResponseWriter, r *http.Request) {
+	var req ppclient.ModerateRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" && req.ImageURL == "" {
+		writeError(w, invalidRequest("Invalid request: text or imageUrl must be provided"))
+		return
+	}
+	s.mu.Lock()
+	moderate := s.moderate
+	s.mu.Unlock()
+	resp, err := moderate(req)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type        string          `json:"type"`
+		Input       json.RawMessage `json:"input"`
+		CallbackURL string          `json:"callback_url"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	var result any
+	var err error
+	switch req.Type {
+	case ppclient.JobTypeAnonymize:
+		var input ppclient.AnonymizeRequest
+		if json.Unmarshal(req.Input, &input) != nil || input.Text == "" {
+			writeError(w, invalidRequest("Invalid request: anonymize input requires a non-empty 'text' field"))
+			return
+		}
+		result, err = s.anonymizeFunc()(input)
+	case ppclient.JobTypeModerate:
+		var input ppclient.ModerateRequest
+		if json.Unmarshal(req.Input, &input) != nil || (input.Text == "" && input.ImageURL == "") {
+			writeError(w, invalidRequest("Invalid request: moderate input requires 'text' or 'imageUrl'"))
+			return
+		}
+		s.mu.Lock()
+		moderate := s.moderate
+		s.mu.Unlock()
+		result, err = moderate(input)
+	default:
+		writeError(w, invalidRequest(fmt.Sprintf("Invalid request: unsupported job type '%s'", req.Type)))
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(24 * time.Hour)
+	finished := &ppclient.Job{Type: req.Type, Status: ppclient.JobSucceeded, CallbackURL: req.CallbackURL, CreatedAt: now, StartedAt: &now, CompletedAt: &now, ExpiresAt: &expires}
+	if err != nil {
+		apiErr := *toAPIError(err)
+		apiErr.RetryAfter = 0
+		finished.Status, finished.Error = ppclient.JobFailed, &apiErr
+	} else {
+		finished.Result, _ = json.Marshal(result)
+	}
+
+	s.mu.Lock()
+	finished.ID = fmt.Sprintf("job_%032d", len(s.jobs)+1)
+	s.jobs[finished.ID] = finished
+	s.mu.Unlock()
+
+	w.Header().Set("Location", "/api/v1/jobs/"+finished.ID)
+	writeJSON(w, http.StatusAccepted, ppclient.Job{ID: finished.ID, Type: req.Type, Status: ppclient.JobQueued, CallbackURL: req.CallbackURL, CreatedAt: now})
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, &ppclient.Error{StatusCode: http.StatusNotFound, Code: ppclient.CodeNotFound, Message: "Job not found or expired"})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	report := s.health
+	s.mu.Unlock()
+	status := http.StatusOK
+	if report.Status == ppclient.HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func (s *Server) anonymizeFunc() AnonymizeFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.anonymize
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, invalidRequest("Invalid request body: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+func invalidRequest(message string) *ppclient.Error {
+	return &ppclient.Error{StatusCode: http.StatusBadRequest, Code: ppclient.CodeInvalidRequest, Message: message}
+}
+
+func toAPIError(err error) *ppclient.Error {
+	if apiErr, ok := err.(*ppclient.Error); ok {
+		return apiErr
+	}
+	return &ppclient.Error{StatusCode: http.StatusInternalServerError, Code: ppclient.CodeInternal, Message: err.Error()}
+}
+
+// writeError writes err in the gateway's error envelope
+func writeError(w http.ResponseWriter, err *ppclient.Error) {
+	out := *err
+	if out.StatusCode == 0 {
+		out.StatusCode = http.StatusServiceUnavailable
+	}
+	if out.Service == "" {
+		out.Service = "api-gateway"
+	}
+	if out.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((out.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeJSON(w, out.StatusCode, map[string]*ppclient.Error{"error": &out})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeEvent writes a Server-Sent Event the way the gateway does
+func writeEvent(w http.ResponseWriter, event string, data any) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event:%s\ndata:%s\n\n", event, payload)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,67 @@
+package ppclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how failed calls are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts per call, including the first; 1 disables retries
+	InitialBackoff time.Duration // Wait before the first retry; doubled for each further one
+	MaxBackoff     time.Duration // Upper bound of the computed backoff
+	// MaxRetryAfter is the longest Retry-After the client waits for. A longer
+	// one (e.g. a monthly quota being used up) ends the call with the error.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	MaxRetryAfter:  30 * time.Second,
+}
+
+// NoRetry makes every call a single attempt
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// next returns how long to wait before retrying after attempt failed with
+// err, or false if the call should end
+func (p RetryPolicy) next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !retryable(err) {
+		return 0, false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	// Exponential backoff with full jitter, so clients failing together do
+	// not retry together
+	backoff := p.InitialBackoff << (attempt - 1)
+	if backoff > p.MaxBackoff || backoff <= 0 {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	return rand.N(backoff) + 1, true
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package ppclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Server-Sent Event names of POST /api/v1/anonymize/stream
+const (
+	streamEventToken = "token"
+	streamEventDone  = "done"
+	streamEventError = "error"
+)
+
+// AnonymizeStream anonymizes a text, passing each safe-to-show piece of the
+// output to onToken as the model generates it. It returns the complete
+// result once the stream ends. Only failures before the first piece are
+// retried; an error returned by onToken ends the stream with that error.
+func (c *Client) AnonymizeStream(ctx context.Context, req AnonymizeRequest, onToken func(text string) error) (*StreamResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Closes the connection if the stream is abandoned
+
+	resp, err := c.post(ctx, "/api/v1/anonymize/stream", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+			continue
+		}
+
+		// A blank line dispatches the event
+		result, err := handleStreamEvent(event, data.String(), onToken)
+		if result != nil || err != nil {
+			return result, err
+		}
+		event = ""
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &transportError{err: err}
+	}
+	return nil, &transportError{err: errors.New("stream ended before it completed")}
+}
+
+// handleStreamEvent returns the result on "done", and an error on "error" or
+// if onToken fails
+func handleStreamEvent(event, data string, onToken func(string) error) (*StreamResult, error) {
+	switch event {
+	case streamEventToken:
+		var token struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(data), &token); err != nil {
+			return nil, fmt.Errorf("ppclient: decoding stream event: %w", err)
+		}
+		return nil, onToken(token.Text)
+	case streamEventDone:
+		var result StreamResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("ppclient: decoding stream event: %w", err)
+		}
+		return &result, nil
+	case streamEventError:
+		var env envelope
+		if err := json.Unmarshal([]byte(data), &env); err != nil || env.Error == nil {
+			return nil, fmt.Errorf("ppclient: decoding stream error event: %v", data)
+		}
+		return nil, env.Error
+	}
+	return nil, nil // Unknown events are ignored
+}
@@ -0,0 +1,245 @@
+// Package apierror implements the error envelope shared by all PrivacyPilot
+// services:
+//
+//	{"error": {"code": "...", "message": "...", "retryable": false, "request_id": "...", "service": "..."}}
+//
+// Errors originating in a service carry the name set with servicekit.SetName.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID carries the request ID echoed in error responses
+const HeaderRequestID = "X-Request-ID"
+
+// Machine-readable error codes
+const (
+	CodeInvalidRequest        = "invalid_request"         // The request is malformed or fails validation
+	CodeUnauthorized          = "unauthorized"            // The request carries no credentials
+	CodeForbidden             = "forbidden"               // The credentials do not allow this operation
+	CodeNotFound              = "not_found"               // The addressed resource does not exist
+	CodeModelNotFound         = "model_not_found"         // The requested model is not available
+	CodeUnsupportedTask       = "unsupported_task"        // The task type is unknown or not implemented
+	CodeRateLimited           = "rate_limited"            // Too many requests; see Retry-After
+	CodeQuotaExceeded         = "quota_exceeded"          // A character quota is used up; see Retry-After
+	CodePayloadTooLarge       = "payload_too_large"       // The request body is over the size limit
+	CodeQueueFull             = "queue_full"              // No capacity to accept more work right now
+	CodeVerificationFailed    = "verification_failed"     // Anonymized output still contains personal data
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"  // The Idempotency-Key was already used for a different request
+	CodeIdempotencyInProgress = "idempotency_in_progress" // The first request with this Idempotency-Key is still running
+	CodeUpstreamUnavailable   = "upstream_unavailable"    // A downstream service could not be reached
+	CodeUpstreamTimeout       = "upstream_timeout"        // A downstream service did not answer in time
+	CodeDeadlineExceeded      = "deadline_exceeded"       // The request's time budget is too short to process it
+	CodeCircuitOpen           = "circuit_open"            // Calls to a failing downstream service are suspended for now
+	CodeUpstreamError         = "upstream_error"          // A downstream service failed or answered garbage
+	CodeShuttingDown          = "shutting_down"           // The instance is shutting down; retry on another
+	CodeInternal              = "internal_error"          // An unexpected failure in this service
+)
+
+// Error is a service error. It is both a Go error and the body of the envelope.
+type Error struct {
+	Status    int    `json:"-"` // HTTP status the error is (or was) returned with
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+	RequestID string `json:"request_id,omitempty"`
+	Service   string `json:"service"` // Service the error originated in
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (%s, status %d)", e.Service, e.Message, e.Code, e.Status)
+}
+
+// LogValue implements slog.LogValuer. The message is left out of logs because
+// a downstream message may echo request content.
+func (e *Error) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("service", e.Service), slog.String("code", e.Code), slog.Int("status", e.Status))
+}
+
+// Envelope is the JSON body of every error response
+type Envelope struct {
+	Error *Error `json:"error"`
+}
+
+// New creates an error originating in this service. Retryable is derived from the status.
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		Retryable: retryableStatus(status),
+		Service:   servicekit.Name(),
+	}
+}
+
+// InvalidRequest creates a 400 invalid_request error
+func InvalidRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// DeadlineExceeded creates a 504 deadline_exceeded error. It is not
+// retryable: a retry with the same budget would fail the same way.
+func DeadlineExceeded(message string) *Error {
+	err := New(http.StatusGatewayTimeout, CodeDeadlineExceeded, message)
+	err.Retryable = false
+	return err
+}
+
+// Internal creates a 500 internal_error error
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, message)
+}
+
+// As extracts an *Error from err's chain
+func As(err error) (*Error, bool) {
+	var apiErr *Error
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// Respond writes err as an error envelope and aborts the request
+func Respond(c *gin.Context, err *Error) {
+	out := ForRequest(c, err)
+	c.AbortWithStatusJSON(out.Status, Envelope{Error: out})
+}
+
+// ForRequest returns a copy of err with the service and the current request's ID filled in
+func ForRequest(c *gin.Context, err *Error) *Error {
+	out := *err
+	if out.Service == "" {
+		out.Service = servicekit.Name()
+	}
+	if out.RequestID == "" {
+		out.RequestID = requestID(c)
+	}
+	return &out
+}
+
+// RespondError writes any error returned by a client or task. Errors from
+// downstream services are propagated (see Propagate); anything else becomes
+// a 500 with fallback as the message, so internal details are not exposed.
+func RespondError(c *gin.Context, err error, fallback string) {
+	Respond(c, From(err, fallback))
+}
+
+// From converts any error returned by a client or task to the error this
+// service returns, as RespondError does
+func From(err error, fallback string) *Error {
+	if apiErr, ok := As(err); ok {
+		return Propagate(apiErr)
+	}
+	return Internal(fallback)
+}
+
+// Propagate maps an error received from a downstream service to the error
+// this service returns. Client errors (4xx), 503 and 504 keep their status so
+// callers see e.g. a 404 model_not_found instead of a generic failure; other
+// server errors become 502. Code, message and origin are always kept. Errors
+// originating in this service are returned unchanged.
+func Propagate(err *Error) *Error {
+	out := *err
+	if out.Service == servicekit.Name() && out.Status != 0 {
+		return &out
+	}
+	if out.Status >= 500 && out.Status != http.StatusServiceUnavailable && out.Status != http.StatusGatewayTimeout {
+		out.Status = http.StatusBadGateway
+	}
+	if out.Status == 0 {
+		out.Status = http.StatusBadGateway
+	}
+	return &out
+}
+
+// FromResponse builds an error from a non-2xx downstream response. Error
+// envelopes are decoded as-is; other bodies (such as {"error": "..."}) are
+// attributed to downstream and given a code matching the status.
+func FromResponse(resp *http.Response, downstream string) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err == nil && env.Error != nil && env.Error.Code != "" {
+		env.Error.Status = resp.StatusCode
+		if env.Error.Service == "" {
+			env.Error.Service = downstream
+		}
+		return env.Error
+	}
+
+	message := http.StatusText(resp.StatusCode)
+	var legacy struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &legacy); err == nil && legacy.Error != "" {
+		message = legacy.Error
+	}
+	return &Error{
+		Status:    resp.StatusCode,
+		Code:      codeForStatus(resp.StatusCode),
+		Message:   message,
+		Retryable: retryableStatus(resp.StatusCode),
+		Service:   downstream,
+	}
+}
+
+// FromTransport wraps a failure to reach downstream (connection refused,
+// timeout, ...). The error originates in this service, which observed it.
+func FromTransport(err error, downstream string) *Error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return New(http.StatusGatewayTimeout, CodeUpstreamTimeout, downstream+" did not respond in time")
+	}
+	return New(http.StatusServiceUnavailable, CodeUpstreamUnavailable, downstream+" is unavailable")
+}
+
+// BadResponse reports a downstream response that could not be understood
+func BadResponse(downstream string) *Error {
+	return New(http.StatusBadGateway, CodeUpstreamError, "invalid response from "+downstream)
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeUnauthorized
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status == http.StatusServiceUnavailable:
+		return CodeUpstreamUnavailable
+	case status == http.StatusGatewayTimeout:
+		return CodeUpstreamTimeout
+	case status >= 400 && status < 500:
+		return CodeInvalidRequest
+	}
+	return CodeUpstreamError
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// requestID returns the ID assigned to this request, if any
+func requestID(c *gin.Context) string {
+	if id := c.Writer.Header().Get(HeaderRequestID); id != "" {
+		return id
+	}
+	return c.GetHeader(HeaderRequestID)
+}
@@ -0,0 +1,156 @@
+// Package budget carries a request's time budget (the time left before its
+// caller gives up) from service to service in the X-Request-Budget-Ms header,
+// so every hop stops working on a request once nobody waits for it anymore.
+//
+// Middleware turns an incoming budget, or the route's default budget, into a
+// deadline on the request context, keeping back a margin so the service can
+// still answer before its caller gives up. Inject writes what is left of the
+// context's deadline on outbound calls; since clients bound their calls with
+// their own timeouts first, the next hop gets the smaller of the two.
+// Budgets are relative rather than absolute times, so they do not depend on
+// the services' clocks agreeing.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+)
+
+// Header carries the budget between services, in whole milliseconds
+const Header = "X-Request-Budget-Ms"
+
+// Config sets the budgets of incoming requests
+type Config struct {
+	Default time.Duration `config:"default" env:"REQUEST_BUDGET"`       // Budget of requests that bring none; 0 leaves them unbounded
+	Routes  []string      `config:"routes" env:"REQUEST_BUDGET_ROUTES"` // route=budget entries overriding Default, e.g. /api/v1/anonymize/stream=80s
+	Max     time.Duration `config:"max" env:"REQUEST_BUDGET_MAX"`       // Upper bound of the budgets callers ask for; 0 for none
+	Margin  time.Duration `config:"margin" env:"REQUEST_BUDGET_MARGIN"` // Kept back from every budget to answer in time
+}
+
+// DefaultConfig returns the settings of a service that follows the budgets
+// its callers send and sets none itself
+func DefaultConfig() Config {
+	return Config{Margin: 100 * time.Millisecond}
+}
+
+// Validate checks that the settings are usable
+func (c Config) Validate() error {
+	var errs []error
+	if c.Default < 0 {
+		errs = append(errs, errors.New("budget.default: must not be negative"))
+	}
+	if _, err := parseRoutes(c.Routes); err != nil {
+		errs = append(errs, fmt.Errorf("budget.routes: %w", err))
+	}
+	if c.Max < 0 {
+		errs = append(errs, errors.New("budget.max: must not be negative"))
+	}
+	if c.Margin < 0 {
+		errs = append(errs, errors.New("budget.margin: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// parseRoutes parses route=budget entries
+func parseRoutes(entries []string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration, len(entries))
+	for _, entry := range entries {
+		route, value, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil || d <= 0 || strings.TrimSpace(route) == "" {
+			return nil, fmt.Errorf("expected route=budget with a positive duration, got %q", entry)
+		}
+		routes[strings.TrimSpace(route)] = d
+	}
+	return routes, nil
+}
+
+// Policy applies a Config to incoming requests
+type Policy struct {
+	current atomic.Pointer[policy]
+}
+
+type policy struct {
+	Config
+	routes map[string]time.Duration
+}
+
+// NewPolicy creates a policy applying cfg, which must be valid
+func NewPolicy(cfg Config) *Policy {
+	p := &Policy{}
+	p.SetConfig(cfg)
+	return p
+}
+
+// SetConfig changes the settings. Requests already running keep their deadline.
+func (p *Policy) SetConfig(cfg Config) {
+	routes, _ := parseRoutes(cfg.Routes) // Checked by Config.Validate
+	p.current.Store(&policy{Config: cfg, routes: routes})
+}
+
+// Middleware sets the request context's deadline to the request's budget
+// minus the margin. The budget is the one in the Header, capped at Max, or
+// else the route's. Requests whose budget does not even cover the margin
+// are refused with 504 deadline_exceeded; malformed budgets with 400.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := p.current.Load()
+		budget, ok := cfg.routes[c.FullPath()]
+		if !ok {
+			budget = cfg.Default
+		}
+		if value := c.GetHeader(Header); value != "" {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				apierror.Respond(c, apierror.InvalidRequest(Header+" must be a whole number of milliseconds"))
+				return
+			}
+			budget = time.Duration(ms) * time.Millisecond
+			if cfg.Max > 0 && budget > cfg.Max {
+				budget = cfg.Max
+			}
+			if budget <= cfg.Margin {
+				apierror.Respond(c, apierror.DeadlineExceeded(fmt.Sprintf("The request's time budget of %dms is too short to process it", ms)))
+				return
+			}
+		}
+		if budget <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget-cfg.Margin)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Remaining returns the time left before ctx's deadline, and false if it has none
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// Inject writes the time left before the request context's deadline, if it
+// has one, on the request's headers
+func Inject(req *http.Request) {
+	left, ok := Remaining(req.Context())
+	if !ok {
+		return
+	}
+	req.Header.Set(Header, strconv.FormatInt(max(left.Milliseconds(), 0), 10))
+}
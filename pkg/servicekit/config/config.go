@@ -0,0 +1,316 @@
+// Package config loads a service's typed configuration. Settings are applied
+// in layers: the defaults built into the service, then an optional YAML or
+// TOML file (named by CONFIG_FILE; the format follows the extension), then
+// environment variables. The result is validated before the service starts.
+//
+// Settings are declared with struct tags:
+//
+//	Timeout time.Duration `config:"timeout,hot" env:"OLLAMA_TIMEOUT"`
+//
+// config gives the key in the file and in the /config view, optionally
+// followed by "hot" for settings that are applied on reload without a restart
+// (a hot struct makes all its fields hot) and "secret" for values the view
+// redacts. env names the environment override; in a nested struct, "*" in
+// its fields' env tags is replaced by the struct's own env tag, so one type
+// can describe several routes. Fields without a config tag are not settings.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the configuration file
+const FileEnv = "CONFIG_FILE"
+
+// Redacted replaces secret values in the view
+const Redacted = "[REDACTED]"
+
+// Validator is implemented by configurations that check their own values
+type Validator interface {
+	Validate() error
+}
+
+// field is a setting declared by a struct field's tags
+type field struct {
+	index  int    // Index of the struct field
+	name   string // Key in the file and the view
+	env    string // Environment variable, "" if none
+	hot    bool
+	secret bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills cfg, a pointer to a struct holding the defaults, from the file
+// at path (unless path is empty) and the environment, then validates it
+func Load(path string, cfg any) error {
+	v := reflect.ValueOf(cfg).Elem()
+	var errs []error
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		if err := applyFile(v, values, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	if err := applyEnv(v, ""); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if validator, ok := cfg.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFile decodes a YAML or TOML file into generic values
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%s: unsupported configuration file type %q (expected .yaml, .yml or .toml)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// applyFile sets the fields of v from values. Unknown keys are errors, so
+// misspelled settings are not silently ignored.
+func applyFile(v reflect.Value, values map[string]any, prefix string) error {
+	var errs []error
+	known := map[string]bool{}
+	for _, f := range fields(v.Type()) {
+		fv := v.Field(f.index)
+		known[f.name] = true
+		raw, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		key := prefix + f.name
+		if fv.Kind() == reflect.Struct {
+			nested, ok := raw.(map[string]any)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: expected a table of settings", key))
+				continue
+			}
+			if err := applyFile(fv, nested, key+"."); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		s, err := scalarString(fv, raw)
+		if err == nil {
+			err = setString(fv, s)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	var unknown []string
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, prefix+name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Errorf("%s: unknown setting", name))
+	}
+	return errors.Join(errs...)
+}
+
+// scalarString converts a decoded file value to the string form parsed by
+// setString. Lists are only accepted for string list settings.
+func scalarString(fv reflect.Value, raw any) (string, error) {
+	switch raw := raw.(type) {
+	case string:
+		return raw, nil
+	case []any:
+		if fv.Kind() != reflect.Slice {
+			return "", errors.New("expected a single value, got a list")
+		}
+		items := make([]string, len(raw))
+		for i, item := range raw {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", errors.New("expected a single value, got a table")
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(raw), nil
+}
+
+// applyEnv sets the fields of v from their environment variables
+func applyEnv(v reflect.Value, envPrefix string) error {
+	var errs []error
+	for _, f := range fields(v.Type()) {
+		fv := v.Field(f.index)
+		env := strings.ReplaceAll(f.env, "*", envPrefix)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, env); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if env == "" {
+			continue
+		}
+		if s := os.Getenv(env); s != "" {
+			if err := setString(fv, s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setString parses s into fv according to its type
+func setString(fv reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 30s, got %q", s)
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", s)
+		}
+		fv.SetFloat(x)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported setting type %s", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", fv.Type())
+	}
+	return nil
+}
+
+// fields returns the settings declared by the struct type t
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("config")
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{index: i, name: parts[0], env: sf.Tag.Get("env")}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "hot":
+				f.hot = true
+			case "secret":
+				f.secret = true
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// View returns the settings of cfg (a struct or a pointer to one) by key,
+// with secrets redacted and durations written as in the file
+func View(cfg any) map[string]any {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	out := map[string]any{}
+	for _, f := range fields(v.Type()) {
+		fv := v.Field(f.index)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			out[f.name] = View(fv.Interface())
+		case f.secret:
+			if fv.IsZero() {
+				out[f.name] = ""
+			} else {
+				out[f.name] = Redacted
+			}
+		case fv.Type() == durationType:
+			out[f.name] = time.Duration(fv.Int()).String()
+		default:
+			out[f.name] = fv.Interface()
+		}
+	}
+	return out
+}
+
+// mergeHot copies the hot settings of src into dst, both pointers to the same
+// struct type, and returns the keys of other settings that differ
+func mergeHot(dst, src any) []string {
+	return merge(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem(), "", false)
+}
+
+func merge(dst, src reflect.Value, prefix string, hot bool) []string {
+	var restart []string
+	for _, f := range fields(dst.Type()) {
+		d, s := dst.Field(f.index), src.Field(f.index)
+		key := prefix + f.name
+		switch {
+		case d.Kind() == reflect.Struct:
+			restart = append(restart, merge(d, s, key+".", hot || f.hot)...)
+		case hot || f.hot:
+			d.Set(s)
+		case !reflect.DeepEqual(d.Interface(), s.Interface()):
+			restart = append(restart, key)
+		}
+	}
+	return restart
+}
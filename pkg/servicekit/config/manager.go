@@ -0,0 +1,139 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WatchInterval is how often Watch checks the file for changes
+const WatchInterval = 5 * time.Second
+
+// Manager holds a service's current configuration of type T and reloads it
+type Manager[T any] struct {
+	path     string
+	defaults T
+	current  atomic.Pointer[T]
+
+	mu       sync.Mutex // Serializes reloads
+	modTime  time.Time
+	onReload []func(cfg *T)
+}
+
+// NewManager loads the configuration from defaults, the file at path (unless
+// path is empty) and the environment (see Load)
+func NewManager[T any](path string, defaults T) (*Manager[T], error) {
+	m := &Manager[T]{path: path, defaults: defaults}
+	cfg := defaults
+	if err := Load(path, &cfg); err != nil {
+		return nil, err
+	}
+	m.modTime = m.fileModTime()
+	m.current.Store(&cfg)
+	return m, nil
+}
+
+// Current returns the configuration in effect. It must not be modified.
+func (m *Manager[T]) Current() *T {
+	return m.current.Load()
+}
+
+// OnReload registers fn to apply the hot settings of a reloaded
+// configuration. It must be called before Watch.
+func (m *Manager[T]) OnReload(fn func(cfg *T)) {
+	m.onReload = append(m.onReload, fn)
+}
+
+// Reload reads the file and the environment again. Hot settings take effect
+// at once; other settings keep their running values until a restart and are
+// logged. An invalid configuration is rejected as a whole.
+func (m *Manager[T]) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modTime = m.fileModTime()
+
+	next := m.defaults
+	if err := Load(m.path, &next); err != nil {
+		return err
+	}
+	updated := *m.current.Load()
+	if restart := mergeHot(&updated, &next); len(restart) > 0 {
+		slog.Warn("Configuration changes need a restart to take effect", "settings", restart)
+	}
+	if validator, ok := any(&updated).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return err
+		}
+	}
+	m.current.Store(&updated)
+	for _, fn := range m.onReload {
+		fn(&updated)
+	}
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the file's
+// modification time changes, until ctx is cancelled. Failed reloads are
+// logged and leave the running configuration in place.
+func (m *Manager[T]) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			m.reload("signal")
+		case <-ticker.C:
+			if m.path == "" {
+				continue
+			}
+			m.mu.Lock()
+			changed := !m.fileModTime().Equal(m.modTime)
+			m.mu.Unlock()
+			if changed {
+				m.reload("file_change")
+			}
+		}
+	}
+}
+
+func (m *Manager[T]) reload(trigger string) {
+	if err := m.Reload(); err != nil {
+		slog.Error("Configuration reload failed, keeping the running configuration", "trigger", trigger, "file", m.path, "error", err)
+		return
+	}
+	slog.Info("Configuration reloaded", "trigger", trigger, "file", m.path)
+}
+
+// fileModTime returns the file's modification time, or the zero time if
+// there is no file or it cannot be read
+func (m *Manager[T]) fileModTime() time.Time {
+	if m.path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Handler serves the configuration in effect, with secrets redacted
+func (m *Manager[T]) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"file": m.path, "config": View(m.Current())})
+	}
+}
@@ -0,0 +1,233 @@
+// Package health serves a service's liveness, readiness and deep health
+// checks. Liveness (/livez) only says the process is serving. Readiness
+// (/readyz) probes the dependencies the service cannot work without, and deep
+// health (/health/deep) walks the whole topology behind it. Probe results are
+// cached briefly and every probe has a timeout, so frequent checks neither
+// pile up on a slow dependency nor multiply the load on it.
+//
+// Readiness probes downstream services' /livez rather than their /readyz, so
+// one broken dependency takes only its direct callers out of rotation instead
+// of cascading up the whole call chain; /health/deep is where the full
+// picture is reported.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Status of a service or of one of its checks
+type Status string
+
+const (
+	StatusOK          Status = "OK"
+	StatusDegraded    Status = "Degraded"    // An optional dependency is failing
+	StatusUnavailable Status = "Unavailable" // A required dependency is failing
+)
+
+// Report is the result of a check. Reports of downstream services are nested
+// under Checks, so a deep report describes the whole topology.
+type Report struct {
+	Status    Status             `json:"status"`
+	Service   string             `json:"service,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Required  bool               `json:"required,omitempty"`
+	LatencyMS int64              `json:"latency_ms"`
+	CheckedAt time.Time          `json:"checked_at,omitempty"`
+	Details   map[string]any     `json:"details,omitempty"`
+	Checks    map[string]*Report `json:"checks,omitempty"`
+}
+
+// Config controls the probes. Changes need a restart.
+type Config struct {
+	Timeout     time.Duration `config:"timeout" env:"HEALTH_TIMEOUT"`           // Per readiness probe
+	DeepTimeout time.Duration `config:"deep_timeout" env:"HEALTH_DEEP_TIMEOUT"` // Per deep probe; keep above the downstream service's own
+	CacheTTL    time.Duration `config:"cache_ttl" env:"HEALTH_CACHE_TTL"`       // How long probe results are reused
+}
+
+// DefaultConfig returns the default timeouts. deepTimeout depends on how many
+// services sit behind the caller, since deep probes wait for each other.
+func DefaultConfig(deepTimeout time.Duration) Config {
+	return Config{Timeout: 2 * time.Second, DeepTimeout: deepTimeout, CacheTTL: 5 * time.Second}
+}
+
+// Validate checks that the timeouts are positive and the cache TTL is not negative
+func (c Config) Validate() error {
+	var errs []error
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("health.timeout: must be positive"))
+	}
+	if c.DeepTimeout <= 0 {
+		errs = append(errs, errors.New("health.deep_timeout: must be positive"))
+	}
+	if c.CacheTTL < 0 {
+		errs = append(errs, errors.New("health.cache_ttl: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Probe checks one dependency. It may return a report with details or nested
+// checks (or nil); a non-nil error fails the check.
+type Probe func(ctx context.Context) (*Report, error)
+
+// Checker runs a set of probes with a timeout each and caches their results
+type Checker struct {
+	service string
+	timeout time.Duration
+	ttl     time.Duration
+	checks  []*check
+}
+
+type check struct {
+	name     string
+	required bool
+	probe    Probe
+
+	mu   sync.Mutex // Held while probing, so concurrent callers share one probe
+	last *Report
+}
+
+// NewChecker creates a checker for service. Probes are cancelled after
+// timeout and their results reused for ttl (zero disables caching).
+func NewChecker(service string, timeout, ttl time.Duration) *Checker {
+	return &Checker{service: service, timeout: timeout, ttl: ttl}
+}
+
+// Add registers a probe. A failing required probe makes the service
+// Unavailable; a failing optional one only Degraded. It must be called
+// before the checker is used.
+func (c *Checker) Add(name string, required bool, probe Probe) {
+	c.checks = append(c.checks, &check{name: name, required: required, probe: probe})
+}
+
+// Run runs (or reuses the cached results of) all probes concurrently
+func (c *Checker) Run(ctx context.Context) *Report {
+	report := &Report{Status: StatusOK, Service: c.service, CheckedAt: time.Now().UTC()}
+	if len(c.checks) == 0 {
+		return report
+	}
+
+	results := make([]*Report, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, ch)
+		}()
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]*Report, len(c.checks))
+	for i, ch := range c.checks {
+		result := results[i]
+		report.Checks[ch.name] = result
+		report.LatencyMS = max(report.LatencyMS, result.LatencyMS)
+		switch {
+		case result.Status == StatusOK:
+		case result.Status == StatusUnavailable && ch.required:
+			report.Status = StatusUnavailable
+		case report.Status == StatusOK:
+			// Failing optional dependencies, and required ones that are
+			// themselves only degraded, still leave the service usable
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run probes ch unless its last result is still fresh
+func (c *Checker) run(ctx context.Context, ch *check) *Report {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.last != nil && time.Since(ch.last.CheckedAt) < c.ttl {
+		return ch.last
+	}
+
+	probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	start := time.Now()
+	result, err := ch.probe(probeCtx)
+	if result == nil {
+		result = &Report{}
+	}
+	result.LatencyMS = time.Since(start).Milliseconds()
+	result.CheckedAt = start.UTC()
+	result.Required = ch.required
+	switch {
+	case err != nil:
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+		if errors.Is(probeCtx.Err(), context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("no answer within %s", c.timeout)
+		}
+	case result.Status == "":
+		result.Status = StatusOK
+	}
+	ch.last = result
+	return result
+}
+
+// Handler serves the checker's report: 200 while the service is OK or
+// Degraded, 503 when it is Unavailable
+func (c *Checker) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report := c.Run(ctx.Request.Context())
+		status := http.StatusOK
+		if report.Status == StatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, report)
+	}
+}
+
+// LiveHandler answers /livez: the process is up and serving requests
+func LiveHandler(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Report{Status: StatusOK, Service: service, CheckedAt: time.Now().UTC()})
+	}
+}
+
+// httpClient is used by HTTPProbe; probes are bounded by their context
+var httpClient = &http.Client{}
+
+// UseTransport makes HTTPProbe send its requests through transport, e.g. to
+// reach services over mutual TLS. It must be called before any probe runs.
+func UseTransport(transport http.RoundTripper) {
+	httpClient = &http.Client{Transport: transport}
+}
+
+// HTTPProbe GETs url and fails unless it answers 2xx. A JSON report in the
+// response (even a failing one) becomes the check's report, which is how
+// deep reports nest.
+func HTTPProbe(url string) Probe {
+	return func(ctx context.Context) (*Report, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		var report *Report
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(body, &report) != nil {
+			report = nil
+		}
+		if resp.StatusCode/100 != 2 {
+			return report, fmt.Errorf("answered %d", resp.StatusCode)
+		}
+		return report, nil
+	}
+}
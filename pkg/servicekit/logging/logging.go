@@ -0,0 +1,228 @@
+// Package logging configures structured JSON logging with log/slog. Every
+// record carries the service name and, when logged with a request context,
+// the request ID and trace ID.
+//
+// PrivacyPilot handles personal data, so the handler redacts user content at
+// every level: attributes under keys that hold request or response content
+// (see sensitiveKeys) and values wrapped in Sensitive are written as
+// [REDACTED]. Messages must be constant strings; use BindError to describe
+// invalid request bodies without echoing them.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces sensitive values
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are user content and are
+// therefore always redacted, wherever they appear
+var sensitiveKeys = map[string]bool{
+	"text":            true,
+	"body":            true,
+	"input":           true,
+	"output":          true,
+	"prompt":          true,
+	"system":          true,
+	"response":        true,
+	"result":          true,
+	"payload":         true,
+	"content":         true,
+	"query":           true,
+	"items":           true,
+	"token":           true,
+	"original_text":   true,
+	"anonymized_text": true,
+	"image_url":       true,
+	"imageurl":        true,
+}
+
+// Sensitive marks a value as user content. It is logged as [REDACTED] under
+// any key, and also when formatted with fmt.
+type Sensitive string
+
+// LogValue implements slog.LogValuer
+func (Sensitive) LogValue() slog.Value { return slog.StringValue(Redacted) }
+
+func (Sensitive) String() string { return Redacted }
+
+// level is the level of the default logger, changed by SetLevel
+var level slog.LevelVar
+
+// Setup makes a JSON logger writing to stdout the default for both log/slog
+// and the standard log package. LOG_LEVEL selects debug, info (default), warn
+// or error.
+func Setup() {
+	parsed, ok := ParseLevel(os.Getenv("LOG_LEVEL"))
+	level.Set(parsed)
+	logger := New(os.Stdout, &level)
+	slog.SetDefault(logger)
+	if !ok {
+		logger.Warn("Unsupported LOG_LEVEL, using info", "log_level", os.Getenv("LOG_LEVEL"))
+	}
+}
+
+// SetLevel changes the level of the logger installed by Setup
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// New creates a redacting JSON logger writing to w
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact})
+	return slog.New(contextHandler{handler}).With(slog.String("service", servicekit.Name()))
+}
+
+// ParseLevel parses a LOG_LEVEL value; empty means info
+func ParseLevel(s string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// Fatal logs at error level and exits, for unrecoverable startup errors
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// redact is the ReplaceAttr hook of the JSON handler. It sees every attribute,
+// including nested ones and those added with Logger.With, after LogValuer
+// values have been resolved.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+		return a
+	}
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// contextHandler adds the request ID and trace ID found in the context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// BindError describes why a request body could not be bound, naming fields
+// and positions but never echoing values from the body
+func BindError(err error) slog.Attr {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var validationErrs validator.ValidationErrors
+	var reason string
+	switch {
+	case errors.As(err, &validationErrs):
+		failed := make([]string, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			failed = append(failed, fmt.Sprintf("%s failed '%s'", fe.Field(), fe.Tag()))
+		}
+		reason = "validation failed: " + strings.Join(failed, ", ")
+	case errors.As(err, &syntaxErr):
+		reason = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		reason = fmt.Sprintf("field '%s' must be of type %s", typeErr.Field, typeErr.Type)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		reason = "empty or truncated body"
+	default:
+		reason = fmt.Sprintf("unparseable body (%T)", err)
+	}
+	return slog.String("error", reason)
+}
+
+// AccessLog logs one record per request with its method, route, status,
+// latency and client IP. The concrete path, query string and body are never
+// logged, as they may carry user data.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, "Request handled",
+			"method", c.Request.Method,
+			"route", route,
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500. Only runtime error messages
+// are logged, since other panic values may carry request data.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			slog.ErrorContext(c.Request.Context(), "Recovered from panic", "route", c.FullPath(), "panic", PanicValue(rec), "stack", string(debug.Stack()))
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+// PanicValue describes a recovered panic value for logging: runtime errors by
+// their message, anything else only by its type
+func PanicValue(rec any) string {
+	if rtErr, ok := rec.(runtime.Error); ok {
+		return rtErr.Error()
+	}
+	return fmt.Sprintf("%T", rec)
+}
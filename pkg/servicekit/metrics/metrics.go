@@ -0,0 +1,101 @@
+// Package metrics exposes Prometheus metrics on /metrics: request counts and
+// latencies per route and status for the Gin server, and latencies per
+// downstream service for outbound calls.
+//
+// Labels are limited to routes, methods, statuses and similar bounded values;
+// nothing derived from request content is ever used as a label.
+//
+// Services with metrics of their own define them next to the code that
+// records them, under Namespace.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every PrivacyPilot metric
+const Namespace = "privacypilot"
+
+// unmatchedRoute labels requests that did not match any route, so unknown
+// paths cannot create new label values
+const unmatchedRoute = "unmatched"
+
+var (
+	serverRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_server_requests_total",
+		Help:      "HTTP requests handled, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	serverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_server_request_duration_seconds",
+		Help:      "Time to handle HTTP requests, by route, method and status.",
+		Buckets:   LatencyBuckets,
+	}, []string{"route", "method", "status"})
+
+	clientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_client_request_duration_seconds",
+		Help:      "Time of outbound HTTP calls, by downstream service, method and status (\"error\" if no response was received).",
+		Buckets:   LatencyBuckets,
+	}, []string{"downstream", "method", "status"})
+)
+
+// LatencyBuckets span fast proxy hops to slow model generations, for every
+// latency histogram
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Middleware records the count and latency of every request
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		serverRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		serverDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Transport wraps base (http.DefaultTransport if nil) to record the latency of
+// calls to downstream. For streamed responses this is the time to the
+// response headers.
+func Transport(downstream string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &instrumentedTransport{downstream: downstream, base: base}
+}
+
+type instrumentedTransport struct {
+	downstream string
+	base       http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	clientDuration.WithLabelValues(t.downstream, req.Method, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
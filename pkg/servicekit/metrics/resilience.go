@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker of each downstream service: 0 closed, 1 half-open, 2 open.",
+	}, []string{"downstream"})
+
+	breakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "circuit_breaker_rejections_total",
+		Help:      "Calls failed fast because the circuit breaker of their downstream service was open, by downstream.",
+	}, []string{"downstream"})
+
+	clientRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_client_retries_total",
+		Help:      "Outbound calls retried after a retryable failure, by downstream service.",
+	}, []string{"downstream"})
+)
+
+// SetBreakerState records the state of downstream's circuit breaker
+func SetBreakerState(downstream string, state int) {
+	breakerState.WithLabelValues(downstream).Set(float64(state))
+}
+
+// ObserveBreakerRejection counts a call failed fast by an open breaker
+func ObserveBreakerRejection(downstream string) {
+	breakerRejections.WithLabelValues(downstream).Inc()
+}
+
+// ObserveRetry counts a retried outbound call
+func ObserveRetry(downstream string) {
+	clientRetries.WithLabelValues(downstream).Inc()
+}
@@ -0,0 +1,294 @@
+// Package mtls secures the calls between services with mutual TLS. Every
+// service presents a certificate naming its identity, and accepts a peer
+// only if the peer's certificate was issued by the configured CA and names
+// a service on its allow-list: callers are checked against AllowedClients,
+// the services this one calls against AllowedServers.
+//
+// Identities are URI SANs of the form spiffe://privacypilot/<service> (see
+// IdentityURI); hostnames are not checked, so services can be reached under
+// any name. Certificates, keys and CA bundles are read from files, which
+// Watch reloads when they change, so rotating them needs no restart.
+// Connections already open keep the certificates they were made with.
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+)
+
+// TrustDomain is the host of every service identity URI
+const TrustDomain = "privacypilot"
+
+// WatchInterval is how often Watch checks the files for changes
+const WatchInterval = 5 * time.Second
+
+// Config locates the certificate files and lists the accepted peers.
+// Changes need a restart; the files themselves are reloaded when they change.
+type Config struct {
+	Enabled        bool     `config:"enabled" env:"MTLS_ENABLED"`
+	CertFile       string   `config:"cert_file" env:"MTLS_CERT_FILE"`             // PEM certificate naming this service, followed by any intermediates
+	KeyFile        string   `config:"key_file" env:"MTLS_KEY_FILE"`               // PEM private key of the certificate
+	CAFile         string   `config:"ca_file" env:"MTLS_CA_FILE"`                 // PEM bundle of the CAs that issue peer certificates
+	AllowedClients []string `config:"allowed_clients" env:"MTLS_ALLOWED_CLIENTS"` // Services that may call this one's API
+	AllowedServers []string `config:"allowed_servers" env:"MTLS_ALLOWED_SERVERS"` // Services this one's clients accept answers from
+}
+
+// DefaultConfig returns disabled settings that read the files pp-certs writes
+// for a service, mounted at /etc/privacypilot/tls, and accept the given peers
+func DefaultConfig(allowedClients, allowedServers []string) Config {
+	return Config{
+		CertFile:       "/etc/privacypilot/tls/tls.crt",
+		KeyFile:        "/etc/privacypilot/tls/tls.key",
+		CAFile:         "/etc/privacypilot/tls/ca.crt",
+		AllowedClients: allowedClients,
+		AllowedServers: allowedServers,
+	}
+}
+
+// Validate checks that the files are named when mTLS is enabled
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	for _, file := range []struct{ name, value string }{
+		{"cert_file", c.CertFile},
+		{"key_file", c.KeyFile},
+		{"ca_file", c.CAFile},
+	} {
+		if file.value == "" {
+			errs = append(errs, fmt.Errorf("mtls.%s: required when mTLS is enabled", file.name))
+		}
+	}
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"allowed_clients", c.AllowedClients},
+		{"allowed_servers", c.AllowedServers},
+	} {
+		if slices.Contains(list.values, "") {
+			errs = append(errs, fmt.Errorf("mtls.%s: service names must not be empty", list.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IdentityURI returns the URI SAN that names service in its certificate
+func IdentityURI(service string) *url.URL {
+	return &url.URL{Scheme: "spiffe", Host: TrustDomain, Path: "/" + service}
+}
+
+// Identity returns the service a certificate names, and false if it names none
+func Identity(cert *x509.Certificate) (string, bool) {
+	for _, uri := range cert.URIs {
+		service := strings.TrimPrefix(uri.Path, "/")
+		if uri.Scheme == "spiffe" && uri.Host == TrustDomain && service != "" && !strings.Contains(service, "/") {
+			return service, true
+		}
+	}
+	return "", false
+}
+
+// Certs holds the service's certificate and the CAs it trusts, reloaded from
+// their files. A nil *Certs stands for mTLS being disabled: its transport is
+// plain and its middleware lets every request through.
+type Certs struct {
+	cfg     Config
+	current atomic.Pointer[bundle]
+
+	mu       sync.Mutex // Serializes reloads
+	modTimes []time.Time
+}
+
+// bundle is one generation of the loaded files
+type bundle struct {
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// Load reads the files named by cfg, and returns nil if mTLS is disabled
+func Load(cfg Config) (*Certs, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	c := &Certs{cfg: cfg}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the files again. If any of them is invalid, the certificates
+// in use are kept.
+func (c *Certs) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modTimes = c.fileModTimes()
+
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading the certificate: %w", err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return fmt.Errorf("parsing the certificate: %w", err)
+	}
+	if _, ok := Identity(cert.Leaf); !ok {
+		return fmt.Errorf("the certificate in %s names no service (expected a URI SAN such as %s)", c.cfg.CertFile, IdentityURI("api-gateway"))
+	}
+	pem, err := os.ReadFile(c.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("loading the CA bundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no CA certificates found in %s", c.cfg.CAFile)
+	}
+	c.current.Store(&bundle{cert: &cert, roots: roots})
+	return nil
+}
+
+// Watch reloads the files whenever one of their modification times changes,
+// until ctx is cancelled. Failed reloads are logged and keep the certificates
+// in use; since rotation may write the files one by one, the next change is
+// tried again.
+func (c *Certs) Watch(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			changed := !slices.EqualFunc(c.fileModTimes(), c.modTimes, time.Time.Equal)
+			c.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if err := c.Reload(); err != nil {
+				slog.Error("Certificate reload failed, keeping the certificates in use", "cert_file", c.cfg.CertFile, "error", err)
+				continue
+			}
+			slog.Info("Certificates reloaded", "cert_file", c.cfg.CertFile, "expires", c.current.Load().cert.Leaf.NotAfter)
+		}
+	}
+}
+
+// fileModTimes returns the files' modification times, zero for files that
+// cannot be read
+func (c *Certs) fileModTimes() []time.Time {
+	times := make([]time.Time, 0, 3)
+	for _, path := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.CAFile} {
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		times = append(times, modTime)
+	}
+	return times
+}
+
+// ServerConfig returns the TLS configuration of the service's server. Callers
+// are asked for a certificate, which must name an allowed client if they send
+// one; RequireClient rejects API requests without one. Health checks and
+// metrics scrapes can connect without a certificate.
+func (c *Certs) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.RequestClientCert, // Verified by VerifyConnection
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.current.Load().cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return nil
+			}
+			return c.verify(state.PeerCertificates, x509.ExtKeyUsageClientAuth, c.cfg.AllowedClients)
+		},
+	}
+}
+
+// ClientConfig returns the TLS configuration of the service's clients, which
+// present the service's certificate and accept only allowed servers
+func (c *Certs) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		// The chain and the service identity are verified by VerifyConnection
+		// instead of the hostname
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.current.Load().cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return c.verify(state.PeerCertificates, x509.ExtKeyUsageServerAuth, c.cfg.AllowedServers)
+		},
+	}
+}
+
+// verify checks that a peer's chain leads to a trusted CA and that its
+// certificate names an allowed service
+func (c *Certs) verify(chain []*x509.Certificate, usage x509.ExtKeyUsage, allowed []string) error {
+	if len(chain) == 0 {
+		return errors.New("mtls: the peer sent no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{Roots: c.current.Load().roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{usage}}
+	if _, err := chain[0].Verify(opts); err != nil {
+		return fmt.Errorf("mtls: %w", err)
+	}
+	service, ok := Identity(chain[0])
+	if !ok {
+		return errors.New("mtls: the peer's certificate names no service")
+	}
+	if !slices.Contains(allowed, service) {
+		return fmt.Errorf("mtls: service %q is not allowed", service)
+	}
+	return nil
+}
+
+// Transport returns the base transport of the service's clients: one
+// presenting the service's certificate, or nil (the default transport) if
+// mTLS is disabled. Only https URLs use TLS.
+func (c *Certs) Transport() http.RoundTripper {
+	if c == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.ClientConfig()
+	return transport
+}
+
+// RequireClient rejects requests that did not come with a client certificate
+// with 401. The certificate itself was checked when the connection was made.
+func (c *Certs) RequireClient() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if c != nil && (ctx.Request.TLS == nil || len(ctx.Request.TLS.PeerCertificates) == 0) {
+			apierror.Respond(ctx, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "A client certificate is required"))
+			return
+		}
+		ctx.Next()
+	}
+}
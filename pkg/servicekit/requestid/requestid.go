@@ -0,0 +1,70 @@
+// Package requestid assigns every request an X-Request-ID, carries it in the
+// request context and forwards it on outbound calls, so one request can be
+// followed through the logs of every service it touches (see package logging).
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header is the HTTP header carrying the request ID between services
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// validID restricts accepted IDs so a caller cannot inject arbitrary text into logs
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware accepts a well-formed incoming X-Request-ID or generates a new
+// one, echoes it on the response and stores it in the request context
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := Accept(c.GetHeader(Header))
+		c.Header(Header, id)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// Accept returns id if it is a well-formed request ID, otherwise a new one
+func Accept(id string) string {
+	if !validID.MatchString(id) {
+		return New()
+	}
+	return id
+}
+
+// New generates a random request ID
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano()) // Still unique enough to correlate logs
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Inject copies the request ID from the request's context onto its headers
+func Inject(req *http.Request) {
+	if id := FromContext(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
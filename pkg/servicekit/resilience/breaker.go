@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	Closed   State = iota // Calls go through
+	HalfOpen              // One probe call goes through to test the downstream
+	Open                  // Calls fail fast
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// result is how a call counts for the breaker
+type result int
+
+const (
+	success result = iota
+	failure
+	ignored
+)
+
+// Breaker is the circuit breaker of one downstream service
+type Breaker struct {
+	downstream string
+
+	mu       sync.Mutex
+	state    State
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the breaker last opened
+	probing  bool      // A half-open probe is in flight
+}
+
+func newBreaker(downstream string) *Breaker {
+	b := &Breaker{downstream: downstream}
+	metrics.SetBreakerState(downstream, int(Closed))
+	return b
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a call may go through, and whether it is the
+// half-open probe
+func (b *Breaker) allow(cfg Config) (probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= cfg.OpenTimeout {
+		b.setState(HalfOpen)
+	}
+	switch b.state {
+	case Closed:
+		return false, true
+	case HalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	}
+	return false, false
+}
+
+// record counts the outcome of a call that allow let through
+func (b *Breaker) record(cfg Config, probe bool, r result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case r == ignored:
+	case b.state == HalfOpen && probe && r == success:
+		b.failures = 0
+		b.setState(Closed)
+	case b.state == HalfOpen && probe:
+		b.open()
+	case b.state == Closed && r == success:
+		b.failures = 0
+	case b.state == Closed:
+		b.failures++
+		if b.failures >= cfg.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	b.failures = 0
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	slog.Warn("Circuit breaker changed state", "downstream", b.downstream, "from", b.state.String(), "to", s.String())
+	b.state = s
+	metrics.SetBreakerState(b.downstream, int(s))
+}
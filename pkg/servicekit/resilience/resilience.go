@@ -0,0 +1,220 @@
+// Package resilience guards calls to a downstream service with retries and a
+// circuit breaker, within the time the caller has left.
+//
+// Failed calls are retried with exponential backoff and full jitter, but only
+// when the failure is retryable (the downstream was unreachable or answered
+// 429, 502 or 503) and the call did not fail part way through a stream. Calls
+// that timed out are not retried: they would most likely time out again and
+// double the load on a downstream that is already struggling. Neither are
+// failures that the downstream only passed on from further down the chain:
+// the downstream already retried those, and retrying at every hop would
+// multiply the calls reaching the service that is failing.
+//
+// Each downstream has a circuit breaker. After a run of consecutive failures
+// it opens and calls fail fast with a circuit_open error instead of waiting
+// for their timeout. Once the open timeout has passed, one probe call is let
+// through (half-open): its success closes the breaker, its failure opens it
+// again.
+//
+// Calls are bounded by their context's deadline, which includes what is left
+// of the incoming request's. A call, or a retry, is not started when less
+// than the minimum budget is left, since it could not finish anyway.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+)
+
+// Config controls retries and circuit breakers. Changes apply to the next call.
+type Config struct {
+	MaxAttempts      int           `config:"max_attempts" env:"RETRY_MAX_ATTEMPTS"`                     // Attempts per call, including the first; 1 disables retries
+	InitialBackoff   time.Duration `config:"initial_backoff" env:"RETRY_INITIAL_BACKOFF"`               // Longest wait before the first retry; doubled for each further one
+	MaxBackoff       time.Duration `config:"max_backoff" env:"RETRY_MAX_BACKOFF"`                       // Upper bound of the backoff
+	MinBudget        time.Duration `config:"min_budget" env:"RETRY_MIN_BUDGET"`                         // Calls and retries are not started with less of the deadline left
+	FailureThreshold int           `config:"breaker_failure_threshold" env:"BREAKER_FAILURE_THRESHOLD"` // Consecutive failures that open a breaker
+	OpenTimeout      time.Duration `config:"breaker_open_timeout" env:"BREAKER_OPEN_TIMEOUT"`           // How long an open breaker fails calls before letting a probe through
+}
+
+// DefaultConfig returns the default retry and breaker settings
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:      3,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		MinBudget:        500 * time.Millisecond,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// Validate checks that the settings are usable
+func (c Config) Validate() error {
+	var errs []error
+	if c.MaxAttempts < 1 {
+		errs = append(errs, errors.New("resilience.max_attempts: must be at least 1"))
+	}
+	if c.InitialBackoff <= 0 {
+		errs = append(errs, errors.New("resilience.initial_backoff: must be positive"))
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		errs = append(errs, errors.New("resilience.max_backoff: must be at least resilience.initial_backoff"))
+	}
+	if c.MinBudget < 0 {
+		errs = append(errs, errors.New("resilience.min_budget: must not be negative"))
+	}
+	if c.FailureThreshold < 1 {
+		errs = append(errs, errors.New("resilience.breaker_failure_threshold: must be at least 1"))
+	}
+	if c.OpenTimeout <= 0 {
+		errs = append(errs, errors.New("resilience.breaker_open_timeout: must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Caller makes the calls to one downstream service. Clients of the same
+// downstream should share a Caller, so they share its breaker.
+type Caller struct {
+	downstream string
+	cfg        atomic.Pointer[Config]
+	breaker    *Breaker
+}
+
+// NewCaller creates a caller for downstream with a closed breaker
+func NewCaller(downstream string, cfg Config) *Caller {
+	c := &Caller{downstream: downstream, breaker: newBreaker(downstream)}
+	c.SetConfig(cfg)
+	return c
+}
+
+// SetConfig changes the settings. It is safe to call while calls are in flight.
+func (c *Caller) SetConfig(cfg Config) {
+	c.cfg.Store(&cfg)
+}
+
+// Breaker returns the downstream's circuit breaker
+func (c *Caller) Breaker() *Breaker {
+	return c.breaker
+}
+
+// Do runs call, retrying it while it fails with a retryable error, and fails
+// fast with a circuit_open error while the breaker is open. Only calls that
+// are safe to repeat may be made through Do; call should wrap errors after
+// which it must not be repeated (e.g. once a stream has started) with NoRetry.
+func (c *Caller) Do(ctx context.Context, call func(ctx context.Context) error) error {
+	cfg := *c.cfg.Load()
+	for attempt := 1; ; attempt++ {
+		if attempt == 1 && !hasBudget(ctx, cfg.MinBudget) {
+			return apierror.DeadlineExceeded("Not enough time left to call " + c.downstream)
+		}
+		probe, ok := c.breaker.allow(cfg)
+		if !ok {
+			metrics.ObserveBreakerRejection(c.downstream)
+			return apierror.New(http.StatusServiceUnavailable, apierror.CodeCircuitOpen, c.downstream+" is failing; calls to it are suspended for now")
+		}
+
+		err := call(ctx)
+		var stop *noRetryError
+		final := errors.As(err, &stop)
+		if final {
+			err = stop.err
+		}
+		c.breaker.record(cfg, probe, outcome(ctx, err))
+
+		if err == nil || final || attempt >= cfg.MaxAttempts || !c.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		wait := backoff(cfg, attempt)
+		if !hasBudget(ctx, wait+cfg.MinBudget) {
+			return err
+		}
+		metrics.ObserveRetry(c.downstream)
+		slog.DebugContext(ctx, "Retrying downstream call", "downstream", c.downstream, "attempt", attempt+1, "wait", wait.String(), "error", err)
+		if sleep(ctx, wait) != nil {
+			return err // The failure says more than the cancellation
+		}
+	}
+}
+
+// NoRetry marks err as final: Do returns it without retrying
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &noRetryError{err: err}
+}
+
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string { return e.err.Error() }
+func (e *noRetryError) Unwrap() error { return e.err }
+
+// retryable reports whether a failed call is worth repeating: the error must
+// be retryable, not a timeout, and come from the downstream itself or from
+// this service failing to reach it
+func (c *Caller) retryable(err error) bool {
+	apiErr, ok := apierror.As(err)
+	if !ok || !apiErr.Retryable || apiErr.Code == apierror.CodeUpstreamTimeout || apiErr.Code == apierror.CodeCircuitOpen {
+		return false
+	}
+	return apiErr.Service == servicekit.Name() || apiErr.Service == c.downstream
+}
+
+// outcome classifies a call for the breaker. Server errors, timeouts and
+// unreachable downstreams are failures; client errors are successes (the
+// downstream answered); the caller's own cancellation and errors that never
+// reached the downstream say nothing about its health.
+func outcome(ctx context.Context, err error) result {
+	if err == nil {
+		return success
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ignored
+	}
+	apiErr, ok := apierror.As(err)
+	switch {
+	case !ok:
+		return ignored
+	case apiErr.Status >= 500:
+		return failure
+	}
+	return success
+}
+
+// backoff returns the jittered wait before the retry after attempt
+func backoff(cfg Config, attempt int) time.Duration {
+	d := cfg.InitialBackoff << (attempt - 1)
+	if d > cfg.MaxBackoff || d <= 0 {
+		d = cfg.MaxBackoff
+	}
+	return rand.N(d) + 1
+}
+
+// hasBudget reports whether at least d is left before ctx's deadline
+func hasBudget(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) >= d
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
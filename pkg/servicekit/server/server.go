@@ -0,0 +1,214 @@
+// Package server runs a service's HTTP server with explicit timeouts and shuts
+// it down gracefully: on SIGINT or SIGTERM it fails readiness, stops
+// accepting connections and lets in-flight requests finish within a grace
+// period. Requests still running when the grace period is over have their
+// contexts cancelled with ErrShutdown, so outstanding work (e.g. Ollama
+// generations) stops cleanly before the remaining connections are closed.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrShutdown is the cause of request contexts cancelled because the grace
+// period ran out (see context.Cause)
+var ErrShutdown = errors.New("server is shutting down")
+
+// ErrGracePeriodExceeded is returned by Serve when in-flight work did not
+// finish within the grace period and had to be cancelled
+var ErrGracePeriodExceeded = errors.New("shutdown grace period exceeded")
+
+// cancelWait bounds how long handlers get to respond once their requests are
+// cancelled, before the remaining connections are closed
+const cancelWait = 5 * time.Second
+
+// Config controls the server's timeouts and shutdown. Changes need a restart.
+type Config struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"` // Time to read the request headers
+	ReadTimeout       time.Duration `config:"read_timeout" env:"HTTP_READ_TIMEOUT"`               // Time to read the whole request
+	WriteTimeout      time.Duration `config:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`             // Time from the end of the request headers to the end of the response, including streams
+	IdleTimeout       time.Duration `config:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`               // How long idle keep-alive connections are kept open
+	GracePeriod       time.Duration `config:"shutdown_grace_period" env:"SHUTDOWN_GRACE_PERIOD"`  // How long in-flight requests get to finish on shutdown
+	DrainDelay        time.Duration `config:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`    // How long readiness fails before the listener is closed, so load balancers can stop routing here
+}
+
+// DefaultConfig returns the default timeouts. WriteTimeout and GracePeriod
+// leave room for an Ollama generation, which can take close to a minute.
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      90 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		GracePeriod:       60 * time.Second,
+	}
+}
+
+// Validate checks that the timeouts are positive and the drain delay is not negative
+func (c Config) Validate() error {
+	var errs []error
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_grace_period", c.GracePeriod},
+	} {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("server.%s: must be positive", timeout.name))
+		}
+	}
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.shutdown_drain_delay: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Server is an HTTP server with graceful shutdown
+type Server struct {
+	cfg      Config
+	tls      *tls.Config
+	draining atomic.Bool
+	hooks    []func(ctx context.Context) error
+}
+
+// New creates a server; call Serve to run it
+func New(cfg Config) *Server {
+	return &Server{cfg: cfg}
+}
+
+// Draining reports whether the server is shutting down. Readiness checks
+// should fail while it is.
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// FailWhileDraining answers 503 while the server is shutting down, so the
+// health check it guards takes the instance out of rotation
+func (s *Server) FailWhileDraining() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.Draining() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"status": "Draining"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OnShutdown registers fn to run when the server shuts down, alongside the
+// HTTP drain. ctx ends when the grace period is over. It must be called
+// before Serve.
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, fn)
+}
+
+// UseTLS makes the server serve TLS with cfg, which must provide the
+// certificate. It must be called before Serve.
+func (s *Server) UseTLS(cfg *tls.Config) {
+	s.tls = cfg
+}
+
+// NotifyContext returns a context that is cancelled on SIGINT or SIGTERM
+func NotifyContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// Serve serves handler on the configured address until ctx is cancelled, then
+// shuts down gracefully. It returns nil after a clean drain,
+// ErrGracePeriodExceeded if work had to be cancelled, or the error that
+// stopped the server from serving.
+func (s *Server) Serve(ctx context.Context, handler http.Handler) error {
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(ctx, listener, handler)
+}
+
+// ServeListener is Serve on an existing listener, which it closes
+func (s *Server) ServeListener(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	requestCtx, cancelRequests := context.WithCancelCause(context.Background())
+	defer cancelRequests(nil)
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+		ReadTimeout:       s.cfg.ReadTimeout,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return requestCtx },
+		TLSConfig:         s.tls,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.tls != nil {
+			serveErr <- srv.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.draining.Store(true)
+	slog.Info("Shutting down", "grace_period", s.cfg.GracePeriod.String(), "drain_delay", s.cfg.DrainDelay.String())
+	if s.cfg.DrainDelay > 0 {
+		time.Sleep(s.cfg.DrainDelay)
+	}
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), s.cfg.GracePeriod)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	hookErrs := make([]error, len(s.hooks))
+	for i, hook := range s.hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hookErrs[i] = hook(graceCtx)
+		}()
+	}
+
+	// Shutdown closes the listener, then waits for in-flight requests
+	err := srv.Shutdown(graceCtx)
+	if err != nil {
+		slog.Warn("Grace period over, cancelling in-flight requests")
+		cancelRequests(ErrShutdown)
+		forceCtx, cancelForce := context.WithTimeout(context.Background(), cancelWait)
+		if srv.Shutdown(forceCtx) != nil {
+			_ = srv.Close()
+		}
+		cancelForce()
+		err = ErrGracePeriodExceeded
+	}
+	wg.Wait()
+
+	if err == nil {
+		err = errors.Join(hookErrs...)
+	}
+	if err == nil {
+		slog.Info("Shutdown complete")
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+// Package servicekit is the code the PrivacyPilot Go services share: the
+// error envelope (apierror), request IDs, logging, tracing, metrics, typed
+// configuration, health checks, time budgets, retries and circuit breakers,
+// mutual TLS and the HTTP server with graceful shutdown, each in its own
+// package.
+//
+// A service names itself with SetName before using any of them, e.g. from an
+// init function of its main package; the name is reported in error
+// envelopes, log records and spans.
+package servicekit
+
+// name is the service's name, set once at startup
+var name string
+
+// SetName sets the name the service reports, such as "api-gateway". It must
+// be called before the other packages are used and is not safe to call
+// concurrently with them.
+func SetName(service string) {
+	name = service
+}
+
+// Name returns the name set with SetName
+func Name() string {
+	return name
+}
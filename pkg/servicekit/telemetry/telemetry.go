@@ -0,0 +1,99 @@
+// Package telemetry configures OpenTelemetry tracing: the tracer provider and
+// exporter, W3C trace context propagation, server spans and instrumented HTTP
+// transports.
+//
+// Spans describe requests (routes, methods, status codes, models), never their
+// content: callers must not record request or response text as attributes.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters selectable with OTEL_TRACES_EXPORTER
+const (
+	ExporterNone   = "none"   // Tracing disabled (default)
+	ExporterOTLP   = "otlp"   // OTLP over HTTP; the endpoint comes from OTEL_EXPORTER_OTLP_ENDPOINT
+	ExporterStdout = "stdout" // Pretty-printed spans on stdout, for local debugging
+)
+
+// Setup installs the global tracer provider and propagator. The exporter is
+// chosen by OTEL_TRACES_EXPORTER. The returned function flushes and stops the
+// provider.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	// Propagation is always on, so traces started upstream continue through
+	// this service even when it does not export spans itself
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporterName := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")))
+	var exporter sdktrace.SpanExporter
+	switch exporterName {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout, "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (expected %s, %s or %s)", exporterName, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", exporterName, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(), // OTEL_RESOURCE_ATTRIBUTES, OTEL_SERVICE_NAME
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(serviceName())),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Tracing enabled", "exporter", exporterName)
+	return provider.Shutdown, nil
+}
+
+// Transport wraps base (http.DefaultTransport if nil) so every outbound request
+// gets a client span and carries the trace context in its headers
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(spanName))
+}
+
+// spanName names client spans "METHOD /path"; the query is left out because it may carry user data
+func spanName(_ string, r *http.Request) string {
+	return r.Method + " " + r.URL.Path
+}
+
+// serviceName lets OTEL_SERVICE_NAME override the name set with
+// servicekit.SetName
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return servicekit.Name()
+}
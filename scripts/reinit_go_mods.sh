@@ -10,6 +10,9 @@ GO_MODULES=(
     ["./services/anonymizer-service"]="privacypilot-anonymizer-service"
     ["./services/ai-coordinator"]="privacypilot-ai-coordinator"
     ["./ai-adapters/ollama-adapter"]="privacypilot-ollama-adapter"
+    ["./pkg/ppclient"]="github.com/mihaibc/PrivacyPilot/pkg/ppclient" # Public, so it has an importable path
+    ["./pkg/servicekit"]="github.com/mihaibc/PrivacyPilot/pkg/servicekit" # Shared by the services below
+    ["./tools/pp-certs"]="github.com/mihaibc/PrivacyPilot/tools/pp-certs" # Development tool, run with go run
     # Add other Go services/adapters here if created later
     # ["./ai-adapters/some-other-go-adapter"]="privacypilot-other-adapter"
 )
@@ -24,6 +27,14 @@ COMMON_DEPS=(
 declare -A SPECIFIC_DEPS
 SPECIFIC_DEPS["./ai-adapters/ollama-adapter"]="github.com/ollama/ollama/api@latest"
 
+# Modules that use the shared service packages, resolved from this repository
+SERVICEKIT_USERS=(
+    "./services/api-gateway"
+    "./services/anonymizer-service"
+    "./services/ai-coordinator"
+    "./ai-adapters/ollama-adapter"
+)
+
 # Get the absolute path of the script's directory to ensure correct relative paths
 SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 PROJECT_ROOT="$SCRIPT_DIR/.." # Assumes script is in 'scripts' dir at project root
@@ -59,6 +70,12 @@ init_module() {
         return
     fi
 
+    # Point the shared service packages at this repository
+    if [[ " ${SERVICEKIT_USERS[*]} " == *" $mod_dir "* ]]; then
+        echo "Using the shared module in ../../pkg/servicekit..."
+        go mod edit -replace github.com/mihaibc/PrivacyPilot/pkg/servicekit=../../pkg/servicekit
+    fi
+
     # Get common dependencies
     echo "Getting common dependencies..."
     for dep in "${COMMON_DEPS[@]}"; do
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"privacypilot-ai-coordinator/internal/clients"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+)
+
+// Config is the coordinator's configuration (see package config for the
+// tags). Hot settings are applied on reload by applySettings in main.
+type Config struct {
+	Port     string `config:"port" env:"PORT"`
+	GinMode  string `config:"gin_mode" env:"GIN_MODE"`
+	LogLevel string `config:"log_level,hot" env:"LOG_LEVEL"`
+
+	Server        server.Config       `config:"server"`
+	OllamaAdapter OllamaAdapterConfig `config:"ollama_adapter"`
+	Health        health.Config       `config:"health"`
+	Resilience    resilience.Config   `config:"resilience,hot"` // Retries and circuit breaker of the adapter client
+	Budget        budget.Config       `config:"budget,hot"`     // Time budgets of incoming requests
+	MTLS          mtls.Config         `config:"mtls"`           // Mutual TLS towards the callers and the adapter
+}
+
+// OllamaAdapterConfig locates the Ollama adapter and limits calls to it
+type OllamaAdapterConfig struct {
+	URL           string        `config:"url" env:"OLLAMA_ADAPTER_URL"` // Ollama tasks fail without one
+	Timeout       time.Duration `config:"timeout,hot" env:"OLLAMA_ADAPTER_TIMEOUT"`
+	StreamTimeout time.Duration `config:"stream_timeout,hot" env:"OLLAMA_ADAPTER_STREAM_TIMEOUT"`
+}
+
+// defaultConfig returns the settings used when neither the file nor the
+// environment sets them
+func defaultConfig() Config {
+	return Config{
+		Port:     "8083", // Default port for AI Coordinator service
+		GinMode:  "debug",
+		LogLevel: "info",
+		Server:   server.DefaultConfig(),
+		OllamaAdapter: OllamaAdapterConfig{
+			Timeout:       clients.DefaultOllamaAdapterTimeout,
+			StreamTimeout: clients.DefaultOllamaAdapterStreamTimeout,
+		},
+		Health:     health.DefaultConfig(4 * time.Second), // Above the adapter's, which waits for Ollama
+		Resilience: resilience.DefaultConfig(),
+		Budget:     budget.DefaultConfig(),
+		MTLS:       mtls.DefaultConfig([]string{"api-gateway", "anonymizer-service", "moderation-service"}, []string{"ollama-adapter"}),
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	if _, ok := logging.ParseLevel(c.LogLevel); !ok {
+		errs = append(errs, fmt.Errorf("log_level: unsupported level %q (expected debug, info, warn or error)", c.LogLevel))
+	}
+	errs = append(errs, c.Server.Validate())
+	if c.OllamaAdapter.URL != "" {
+		if u, err := url.Parse(c.OllamaAdapter.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ollama_adapter.url: expected an absolute URL such as http://host:port, got %q", c.OllamaAdapter.URL))
+		}
+	}
+	if c.OllamaAdapter.Timeout <= 0 {
+		errs = append(errs, errors.New("ollama_adapter.timeout: must be positive"))
+	}
+	if c.OllamaAdapter.StreamTimeout <= 0 {
+		errs = append(errs, errors.New("ollama_adapter.stream_timeout: must be positive"))
+	}
+	errs = append(errs, c.Health.Validate(), c.Resilience.Validate(), c.Budget.Validate(), c.MTLS.Validate())
+	return errors.Join(errs...)
+}
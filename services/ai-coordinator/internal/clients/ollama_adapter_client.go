@@ -1,15 +1,26 @@
 package clients
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io" // Import io
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
 )
 
+// OllamaAdapterServiceName attributes errors reported by the adapter
+const OllamaAdapterServiceName = "ollama-adapter"
+
 // Request structure to send TO the Ollama Adapter (now includes optional model)
 type OllamaAdapterAnonymizeRequest struct {
 	Text  string `json:"text"`
@@ -20,36 +31,71 @@ type OllamaAdapterAnonymizeRequest struct {
 type OllamaAdapterAnonymizeResponse struct {
 	AnonymizedText string `json:"anonymized_text"`
 	ModelUsed      string `json:"model_used"`
+	PromptVersion  string `json:"prompt_version"`
+}
+
+// OllamaAdapterStreamChunk is one line of the adapter's newline-delimited JSON stream
+type OllamaAdapterStreamChunk struct {
+	Token     string          `json:"token,omitempty"`
+	Done      bool            `json:"done,omitempty"`
+	ModelUsed string          `json:"model_used,omitempty"`
+	Error     *apierror.Error `json:"error,omitempty"`
 }
 
+// Default time limits on calls to the adapter (its generations stop at 55s)
+const (
+	DefaultOllamaAdapterTimeout       = 65 * time.Second
+	DefaultOllamaAdapterStreamTimeout = 65 * time.Second // Bounds a whole streamed generation
+)
+
 // OllamaAdapterClient remains the same
 type OllamaAdapterClient struct {
-	BaseURL    string
-	HttpClient *http.Client
+	BaseURL string
+	// HttpClient and StreamHttpClient have no overall timeout; calls are
+	// bounded by their context instead (see SetTimeouts)
+	HttpClient       *http.Client
+	StreamHttpClient *http.Client
+	Resilience       *resilience.Caller // Retries and circuit breaker
+	timeout          *timeout
+	streamTimeout    *timeout
 }
 
 // NewOllamaAdapterClient remains the same
 func NewOllamaAdapterClient(baseURL string) *OllamaAdapterClient {
 	if baseURL == "" {
-		log.Println("Warning: Ollama Adapter URL is empty. Client created but will likely fail.")
+		slog.Warn("Ollama Adapter URL is empty. Client created but will likely fail.")
 	}
 	return &OllamaAdapterClient{
-		BaseURL: baseURL,
-		HttpClient: &http.Client{
-			Timeout: 65 * time.Second,
-		},
+		BaseURL:          baseURL,
+		HttpClient:       &http.Client{Transport: metrics.Transport(OllamaAdapterServiceName, telemetry.Transport(nil))},
+		StreamHttpClient: &http.Client{Transport: metrics.Transport(OllamaAdapterServiceName, telemetry.Transport(nil))},
+		Resilience:       resilience.NewCaller(OllamaAdapterServiceName, resilience.DefaultConfig()),
+		timeout:          newTimeout(DefaultOllamaAdapterTimeout),
+		streamTimeout:    newTimeout(DefaultOllamaAdapterStreamTimeout),
 	}
 }
 
-// AnonymizeText now accepts an optional model hint
-func (c *OllamaAdapterClient) AnonymizeText(payload map[string]interface{}, modelHint string) (*OllamaAdapterAnonymizeResponse, error) {
-	if c.BaseURL == "" {
-		return nil, fmt.Errorf("ollama adapter client not configured (URL is empty)")
-	}
+// UseTransport sends the client's calls through base (the default transport
+// if nil), e.g. to call the adapter over mutual TLS. It must be called before
+// the client is used.
+func (c *OllamaAdapterClient) UseTransport(base http.RoundTripper) {
+	c.HttpClient.Transport = metrics.Transport(OllamaAdapterServiceName, telemetry.Transport(base))
+	c.StreamHttpClient.Transport = metrics.Transport(OllamaAdapterServiceName, telemetry.Transport(base))
+}
 
-	text, ok := payload["text"].(string)
-	if !ok || text == "" {
-		return nil, fmt.Errorf("invalid or missing 'text' field in payload for Ollama anonymization")
+// SetTimeouts changes the time limits on calls and on whole streams. It is
+// safe to call while calls are in flight; they keep their limits.
+func (c *OllamaAdapterClient) SetTimeouts(call, stream time.Duration) {
+	c.timeout.set(call)
+	c.streamTimeout.set(stream)
+}
+
+// AnonymizeText now accepts an optional model hint. Failures are returned as *apierror.Error.
+// Cancelling ctx aborts the call.
+func (c *OllamaAdapterClient) AnonymizeText(ctx context.Context, payload map[string]interface{}, modelHint string) (*OllamaAdapterAnonymizeResponse, error) {
+	text, apiErr := c.checkRequest(payload)
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
 	// Use the modelHint if provided
@@ -60,41 +106,135 @@ func (c *OllamaAdapterClient) AnonymizeText(payload map[string]interface{}, mode
 
 	payloadBytes, err := json.Marshal(adapterReq)
 	if err != nil {
-		log.Printf("Error marshalling Ollama adapter request payload: %v", err)
+		slog.ErrorContext(ctx, "Failed to marshal Ollama adapter request payload", "error", err)
 		return nil, fmt.Errorf("failed to create adapter request payload: %w", err)
 	}
 
+	var adapterResp *OllamaAdapterAnonymizeResponse
+	err = c.Resilience.Do(ctx, func(ctx context.Context) error {
+		adapterResp, err = c.anonymize(ctx, payloadBytes)
+		return err
+	})
+	return adapterResp, err
+}
+
+// anonymize makes one attempt at an anonymization
+func (c *OllamaAdapterClient) anonymize(ctx context.Context, payloadBytes []byte) (*OllamaAdapterAnonymizeResponse, error) {
+	ctx, cancel := c.timeout.bound(ctx)
+	defer cancel()
+
 	reqUrl := fmt.Sprintf("%s/anonymize", c.BaseURL)
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
 	if err != nil {
 		// ... error handling ...
-		log.Printf("Error creating request to Ollama adapter: %v", err)
+		slog.ErrorContext(ctx, "Failed to create request to Ollama adapter", "error", err)
 		return nil, fmt.Errorf("failed to create Ollama adapter request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
 
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
 		// ... error handling ...
-		log.Printf("Error sending request to Ollama adapter at %s: %v", reqUrl, err)
-		return nil, fmt.Errorf("ollama adapter request failed: %w", err)
+		slog.ErrorContext(ctx, "Failed to reach Ollama adapter", "url", reqUrl, "error", err)
+		return nil, apierror.FromTransport(err, OllamaAdapterServiceName)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		// ... error handling ...
-		bodyBytes, _ := io.ReadAll(resp.Body) // Use io.ReadAll
-		log.Printf("Ollama adapter returned non-OK status: %d. Body: %s", resp.StatusCode, string(bodyBytes))
-		return nil, fmt.Errorf("ollama adapter returned status %d", resp.StatusCode)
+		apiErr := apierror.FromResponse(resp, OllamaAdapterServiceName)
+		slog.WarnContext(ctx, "Ollama adapter returned an error", "error", apiErr)
+		return nil, apiErr
 	}
 
 	var adapterResp OllamaAdapterAnonymizeResponse
 	if err := json.NewDecoder(resp.Body).Decode(&adapterResp); err != nil {
 		// ... error handling ...
-		log.Printf("Error decoding Ollama adapter response: %v", err)
-		return nil, fmt.Errorf("failed to decode Ollama adapter response: %w", err)
+		slog.ErrorContext(ctx, "Failed to decode Ollama adapter response", "error", err)
+		return nil, apierror.BadResponse(OllamaAdapterServiceName)
 	}
 
-	log.Printf("Successfully received response from Ollama Adapter (Model Used: %s).", adapterResp.ModelUsed)
+	slog.DebugContext(ctx, "Received response from Ollama adapter", "model", adapterResp.ModelUsed)
 	return &adapterResp, nil
 }
+
+// checkRequest verifies the client is configured and extracts the text to anonymize
+func (c *OllamaAdapterClient) checkRequest(payload map[string]interface{}) (string, *apierror.Error) {
+	if c.BaseURL == "" {
+		return "", apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "ollama adapter client not configured (URL is empty)")
+	}
+	text, ok := payload["text"].(string)
+	if !ok || text == "" {
+		return "", apierror.InvalidRequest("invalid or missing 'text' field in payload for Ollama anonymization")
+	}
+	return text, nil
+}
+
+// AnonymizeTextStream asks the adapter to stream the anonymization and calls
+// onChunk for every chunk received, including the final Done or Error chunk.
+// Cancelling ctx aborts the stream (and the generation in the adapter). The
+// request is only retried until the stream has started.
+func (c *OllamaAdapterClient) AnonymizeTextStream(ctx context.Context, payload map[string]interface{}, modelHint string, onChunk func(OllamaAdapterStreamChunk) error) error {
+	text, apiErr := c.checkRequest(payload)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	payloadBytes, err := json.Marshal(OllamaAdapterAnonymizeRequest{Text: text, Model: modelHint})
+	if err != nil {
+		return fmt.Errorf("failed to create adapter request payload: %w", err)
+	}
+	return c.Resilience.Do(ctx, func(ctx context.Context) error {
+		return c.anonymizeStream(ctx, payloadBytes, onChunk)
+	})
+}
+
+// anonymizeStream makes one attempt at a streamed anonymization
+func (c *OllamaAdapterClient) anonymizeStream(ctx context.Context, payloadBytes []byte, onChunk func(OllamaAdapterStreamChunk) error) error {
+	ctx, cancel := c.streamTimeout.bound(ctx)
+	defer cancel()
+
+	reqUrl := fmt.Sprintf("%s/anonymize/stream", c.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create streaming request to Ollama adapter", "error", err)
+		return fmt.Errorf("failed to create Ollama adapter request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
+
+	resp, err := c.StreamHttpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reach Ollama adapter for streaming", "url", reqUrl, "error", err)
+		return apierror.FromTransport(err, OllamaAdapterServiceName)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "Ollama adapter stream returned an error", "status", resp.StatusCode)
+		return apierror.FromResponse(resp, OllamaAdapterServiceName)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk OllamaAdapterStreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode Ollama adapter stream chunk", "error", err)
+			return resilience.NoRetry(apierror.BadResponse(OllamaAdapterServiceName))
+		}
+		if err := onChunk(chunk); err != nil {
+			return resilience.NoRetry(err)
+		}
+		if chunk.Done || chunk.Error != nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.WarnContext(ctx, "Ollama adapter stream interrupted", "error", err)
+		return resilience.NoRetry(apierror.FromTransport(err, OllamaAdapterServiceName))
+	}
+	return resilience.NoRetry(apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "ollama-adapter stream ended without a final chunk"))
+}
@@ -0,0 +1,28 @@
+package clients
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// timeout is a time limit on calls that can be changed while calls are in
+// flight (e.g. by a configuration reload); it applies to the next call
+type timeout struct {
+	d atomic.Int64
+}
+
+func newTimeout(d time.Duration) *timeout {
+	t := &timeout{}
+	t.set(d)
+	return t
+}
+
+func (t *timeout) set(d time.Duration) {
+	t.d.Store(int64(d))
+}
+
+// bound returns ctx limited by the current timeout
+func (t *timeout) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(t.d.Load()))
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Label values for observeTask
+const (
+	adapterOllama = "ollama"
+	adapterNone   = "none" // The task was rejected before reaching an adapter
+
+	modeSync   = "sync"
+	modeStream = "stream"
+
+	outcomeSuccess = "success" // Otherwise the outcome is the error code
+
+	// unsupportedTaskType replaces unknown task types, which come from callers
+	unsupportedTaskType = "unsupported"
+)
+
+var coordinatorTasks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "coordinator_tasks_total",
+	Help:      "Tasks processed by the AI Coordinator, by task type, adapter, mode (sync or stream) and outcome (success or error code).",
+}, []string{"task_type", "adapter", "mode", "outcome"})
+
+// observeTask counts a processed task. taskType must be a known task type or
+// unsupportedTaskType.
+func observeTask(taskType, adapter, mode, outcome string) {
+	coordinatorTasks.WithLabelValues(taskType, adapter, mode, outcome).Inc()
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"privacypilot-ai-coordinator/internal/clients"
 
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,10 +21,13 @@ type AICoordinatorRequest struct {
 	Payload  map[string]interface{} `json:"payload" binding:"required"`
 	Config   map[string]string      `json:"config,omitempty"` // Config map for hints like model
 }
+
+// AICoordinatorResponse is the body of every /process response. On failure,
+// Error holds the standard error envelope body.
 type AICoordinatorResponse struct {
-	Success bool        `json:"success"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success bool            `json:"success"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *apierror.Error `json:"error,omitempty"`
 }
 
 const (
@@ -29,6 +36,14 @@ const (
 	TaskTypeModerateImage = "moderate_image"
 )
 
+// errAdapterNotConfigured is returned when no Ollama adapter URL is set
+var errAdapterNotConfigured = apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "ollama adapter client is not configured")
+
+// notImplemented reports a known task type that has no adapter yet
+func notImplemented(taskType string) *apierror.Error {
+	return apierror.New(http.StatusNotImplemented, apierror.CodeUnsupportedTask, fmt.Sprintf("adapter for task '%s' not implemented yet", taskType))
+}
+
 // ProcessHandler remains the same structure
 type ProcessHandler struct {
 	OllamaClient *clients.OllamaAdapterClient
@@ -38,32 +53,57 @@ type ProcessHandler struct {
 // NewProcessHandler remains the same
 func NewProcessHandler(ollamaClient *clients.OllamaAdapterClient /* other clients */) *ProcessHandler {
 	if ollamaClient == nil {
-		log.Println("Warning: OllamaAdapterClient is nil during ProcessHandler creation.")
+		slog.Warn("OllamaAdapterClient is nil during ProcessHandler creation")
 	}
 	return &ProcessHandler{
 		OllamaClient: ollamaClient,
 	}
 }
 
+// respondError writes a failed AICoordinatorResponse. Errors from the adapters
+// are propagated, anything else becomes an internal error.
+func respondError(c *gin.Context, err error, fallback string) {
+	apiErr, ok := apierror.As(err)
+	if ok {
+		apiErr = apierror.Propagate(apiErr)
+	} else {
+		apiErr = apierror.Internal(fallback)
+	}
+	apiErr = apierror.ForRequest(c, apiErr)
+	c.AbortWithStatusJSON(apiErr.Status, AICoordinatorResponse{Success: false, Error: apiErr})
+}
+
+// taskOutcome is the outcome label of a finished task: success or the error code
+func taskOutcome(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	if apiErr, ok := apierror.As(err); ok {
+		return apiErr.Code
+	}
+	return apierror.CodeInternal
+}
+
 func (h *ProcessHandler) HandleProcessRequest(c *gin.Context) {
 	var req AICoordinatorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("AI Coordinator: Error binding JSON for /process: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body: " + err.Error()})
+		slog.InfoContext(c.Request.Context(), "Invalid process request body", logging.BindError(err))
+		respondError(c, apierror.InvalidRequest("Invalid request body: "+err.Error()), "")
 		return
 	}
 
-	log.Printf("AI Coordinator: Received task '%s'", req.TaskType)
-
 	var result interface{}
 	var err error
+	taskType := strings.ToLower(req.TaskType)
+	adapter := adapterNone
 
 	// --- Routing Logic ---
-	switch strings.ToLower(req.TaskType) {
+	switch taskType {
 	case TaskTypeAnonymizeText:
-		log.Printf("AI Coordinator: Routing '%s' task to Ollama Adapter.", req.TaskType)
+		slog.DebugContext(c.Request.Context(), "Routing task to Ollama adapter", "task_type", taskType)
+		adapter = adapterOllama
 		if h.OllamaClient == nil {
-			err = fmt.Errorf("ollama adapter client is not configured")
+			err = errAdapterNotConfigured
 		} else {
 			// Extract model hint from config, if present
 			modelHint := ""
@@ -71,48 +111,112 @@ func (h *ProcessHandler) HandleProcessRequest(c *gin.Context) {
 				modelHint = req.Config["model"] // Look for a "model" key in the config map
 			}
 			if modelHint != "" {
-				log.Printf("AI Coordinator: Using model hint from request config: '%s'", modelHint)
+				slog.DebugContext(c.Request.Context(), "Using model hint from request config", "model", modelHint)
 			}
 
 			// Call the Ollama adapter client, passing the hint
 			var adapterResp *clients.OllamaAdapterAnonymizeResponse
-			adapterResp, err = h.OllamaClient.AnonymizeText(req.Payload, modelHint) // Pass modelHint
+			adapterResp, err = h.OllamaClient.AnonymizeText(c.Request.Context(), req.Payload, modelHint) // Pass modelHint
 
 			if adapterResp != nil {
 				// Store the structured result including the model used
 				result = map[string]string{
 					"anonymized_text": adapterResp.AnonymizedText,
 					"model_used":      adapterResp.ModelUsed,
+					"prompt_version":  adapterResp.PromptVersion,
 				}
 			}
 		}
 
 	// ... cases for TaskTypeModerateText, TaskTypeModerateImage remain the same ...
 	case TaskTypeModerateText:
-		log.Printf("AI Coordinator: Routing '%s' task (Not Implemented Yet)", req.TaskType)
-		err = fmt.Errorf("adapter for task '%s' not implemented yet", req.TaskType)
+		err = notImplemented(req.TaskType)
 	case TaskTypeModerateImage:
-		log.Printf("AI Coordinator: Routing '%s' task (Not Implemented Yet)", req.TaskType)
-		err = fmt.Errorf("adapter for task '%s' not implemented yet", req.TaskType)
+		err = notImplemented(req.TaskType)
 
 	default:
-		// ... default case remains the same ...
-		log.Printf("AI Coordinator: Unsupported task type '%s'", req.TaskType)
-		c.JSON(http.StatusBadRequest, AICoordinatorResponse{Success: false, Error: fmt.Sprintf("Unsupported task type: %s", req.TaskType)})
+		// The task type is not logged: it is caller input and may be anything
+		slog.InfoContext(c.Request.Context(), "Unsupported task type")
+		observeTask(unsupportedTaskType, adapter, modeSync, apierror.CodeUnsupportedTask)
+		respondError(c, apierror.New(http.StatusBadRequest, apierror.CodeUnsupportedTask, fmt.Sprintf("Unsupported task type: %s", req.TaskType)), "")
 		return
 	}
 	// --- End Routing ---
 
+	observeTask(taskType, adapter, modeSync, taskOutcome(err))
 	if err != nil {
-		// ... error handling remains the same ...
-		log.Printf("AI Coordinator: Error processing task '%s': %v", req.TaskType, err)
-		c.JSON(http.StatusInternalServerError, AICoordinatorResponse{Success: false, Error: fmt.Sprintf("Failed to process task '%s': %v", req.TaskType, err)})
+		slog.WarnContext(c.Request.Context(), "Task failed", "task_type", taskType, "error", err)
+		respondError(c, err, fmt.Sprintf("Failed to process task '%s'", req.TaskType))
 		return
 	}
 
-	log.Printf("AI Coordinator: Successfully processed task '%s'", req.TaskType)
+	slog.DebugContext(c.Request.Context(), "Task succeeded", "task_type", taskType)
 	c.JSON(http.StatusOK, AICoordinatorResponse{
 		Success: true,
 		Result:  result,
 	})
 }
+
+// HandleProcessStreamRequest relays a streamed task as newline-delimited JSON.
+// Only anonymize_text supports streaming at the moment.
+func (h *ProcessHandler) HandleProcessStreamRequest(c *gin.Context) {
+	var req AICoordinatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid process stream request body", logging.BindError(err))
+		respondError(c, apierror.InvalidRequest("Invalid request body: "+err.Error()), "")
+		return
+	}
+	if strings.ToLower(req.TaskType) != TaskTypeAnonymizeText {
+		observeTask(unsupportedTaskType, adapterNone, modeStream, apierror.CodeUnsupportedTask)
+		respondError(c, apierror.New(http.StatusBadRequest, apierror.CodeUnsupportedTask, fmt.Sprintf("Streaming is not supported for task type: %s", req.TaskType)), "")
+		return
+	}
+	if h.OllamaClient == nil {
+		observeTask(TaskTypeAnonymizeText, adapterOllama, modeStream, taskOutcome(errAdapterNotConfigured))
+		respondError(c, errAdapterNotConfigured, "")
+		return
+	}
+
+	modelHint := ""
+	if req.Config != nil {
+		modelHint = req.Config["model"]
+	}
+
+	slog.DebugContext(c.Request.Context(), "Streaming task from Ollama adapter", "task_type", TaskTypeAnonymizeText)
+
+	// Headers are sent with the first chunk, so an adapter failure before any
+	// output is returned with its own status
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	relay := func(chunk clients.OllamaAdapterStreamChunk) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(chunk); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	// The request context ends when our caller disconnects, aborting the adapter stream too
+	err := h.OllamaClient.AnonymizeTextStream(c.Request.Context(), req.Payload, modelHint, relay)
+	observeTask(TaskTypeAnonymizeText, adapterOllama, modeStream, taskOutcome(err))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Streaming task failed", "task_type", TaskTypeAnonymizeText, "error", err)
+		if !started {
+			respondError(c, err, fmt.Sprintf("Failed to process task '%s'", req.TaskType))
+			return
+		}
+		apiErr, ok := apierror.As(err)
+		if !ok {
+			apiErr = apierror.Internal(fmt.Sprintf("Failed to process task '%s'", req.TaskType))
+		}
+		_ = relay(clients.OllamaAdapterStreamChunk{Error: apierror.ForRequest(c, apierror.Propagate(apiErr))})
+		return
+	}
+	slog.DebugContext(c.Request.Context(), "Finished streaming task", "task_type", TaskTypeAnonymizeText)
+}
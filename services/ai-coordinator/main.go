@@ -1,44 +1,110 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	// Use the module name defined in this service's go.mod
 	"privacypilot-ai-coordinator/internal/clients"
 	"privacypilot-ai-coordinator/internal/handlers"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
+	"github.com/gin-gonic/gin"
 )
 
+func init() {
+	servicekit.SetName("ai-coordinator") // Reported in error envelopes, logs and spans
+}
+
 func main() {
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode == "" {
-		ginMode = gin.DebugMode
+	logging.Setup()
+
+	// --- Configuration ---
+	settings, err := config.NewManager(os.Getenv(config.FileEnv), defaultConfig())
+	if err != nil {
+		logging.Fatal("Failed to load configuration", "error", err)
+	}
+	cfg := settings.Current()
+	gin.SetMode(cfg.GinMode)
+
+	// --- Tracing ---
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(ctx)
+	}()
+
+	// --- Time Budgets ---
+	budgets := budget.NewPolicy(cfg.Budget)
+
+	// --- Mutual TLS ---
+	// Serves and calls over mTLS when enabled; nil otherwise
+	certs, err := mtls.Load(cfg.MTLS)
+	if err != nil {
+		logging.Fatal("Failed to load the mTLS certificates", "error", err)
+	}
+	health.UseTransport(certs.Transport())
+
+	// --- HTTP Server ---
+	serverConfig := cfg.Server
+	serverConfig.Addr = ":" + cfg.Port
+	httpServer := server.New(serverConfig)
+	if certs != nil {
+		httpServer.UseTLS(certs.ServerConfig())
 	}
-	gin.SetMode(ginMode)
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), budgets.Middleware())
 
 	// --- Service Clients for AI Adapters ---
 	// Initialize Ollama Client
-	ollamaAdapterURL := strings.TrimRight(os.Getenv("OLLAMA_ADAPTER_URL"), "/")
+	ollamaAdapterURL := strings.TrimRight(cfg.OllamaAdapter.URL, "/")
 	// Log a warning but don't make it fatal, client handles empty URL internally
 	if ollamaAdapterURL == "" {
-		log.Println("Warning: OLLAMA_ADAPTER_URL environment variable not set. Ollama functionality may be unavailable.")
+		slog.Warn("OLLAMA_ADAPTER_URL environment variable not set. Ollama functionality may be unavailable.")
 	}
 	ollamaClient := clients.NewOllamaAdapterClient(ollamaAdapterURL)
+	ollamaClient.UseTransport(certs.Transport())
+
+	// --- Hot Settings ---
+	// Applied now and again whenever the configuration is reloaded
+	applySettings := func(cfg *Config) {
+		level, _ := logging.ParseLevel(cfg.LogLevel)
+		logging.SetLevel(level)
+		ollamaClient.SetTimeouts(cfg.OllamaAdapter.Timeout, cfg.OllamaAdapter.StreamTimeout)
+		ollamaClient.Resilience.SetConfig(cfg.Resilience)
+		budgets.SetConfig(cfg.Budget)
+	}
+	applySettings(cfg)
+	settings.OnReload(applySettings)
 
 	// Placeholder for Azure Client initialization (when created)
 	// azureAdapterURL := strings.TrimRight(os.Getenv("AZURE_AI_ADAPTER_URL"), "/")
-	// if azureAdapterURL == "" { log.Println("Warning: AZURE_AI_ADAPTER_URL not set.") }
+	// if azureAdapterURL == "" { slog.Warn("AZURE_AI_ADAPTER_URL not set.") }
 	// azureClient := clients.NewAzureAdapterClient(azureAdapterURL)
 
 	// Placeholder for Stable Diffusion Client initialization (when created)
 	// sdAdapterURL := strings.TrimRight(os.Getenv("STABLE_DIFFUSION_ADAPTER_URL"), "/")
-	// if sdAdapterURL == "" { log.Println("Warning: STABLE_DIFFUSION_ADAPTER_URL not set.") }
+	// if sdAdapterURL == "" { slog.Warn("STABLE_DIFFUSION_ADAPTER_URL not set.") }
 	// sdClient := clients.NewStableDiffusionAdapterClient(sdAdapterURL)
 
 	// --- Handlers ---
@@ -49,31 +115,69 @@ func main() {
 		// sdClient,
 	)
 
+	// --- Health Checks ---
+	readiness, deepHealth := newHealthCheckers(cfg.Health, ollamaAdapterURL)
+
 	// --- Routes ---
-	router.GET("/health", healthCheckHandler)
+	router.GET("/health", httpServer.FailWhileDraining(), healthCheckHandler)
+	router.GET("/livez", health.LiveHandler(serviceName))
+	router.GET("/readyz", httpServer.FailWhileDraining(), readiness.Handler())
+	router.GET("/health/deep", deepHealth.Handler())
+	router.GET("/metrics", metrics.Handler()) // Prometheus scrape endpoint
 	// Register the main processing route, handled by the ProcessHandler
-	router.POST("/process", processHandler.HandleProcessRequest)
-
-	// --- Start Server ---
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8083" // Default port for AI Coordinator service
+	router.POST("/process", certs.RequireClient(), processHandler.HandleProcessRequest)
+	router.POST("/process/stream", certs.RequireClient(), processHandler.HandleProcessStreamRequest)
+	// Configuration in effect, secrets redacted; only served to callers with a
+	// client certificate, so not at all without mTLS
+	if certs != nil {
+		router.GET("/config", certs.RequireClient(), settings.Handler())
 	}
-	serverAddr := fmt.Sprintf(":%s", port)
 
-	log.Printf("AI Coordinator Service starting on port %s", port)
+	// --- Start Server ---
 	// Log the configured adapter URLs for easier debugging
-	log.Printf("--> Configured Ollama Adapter URL: %s", ollamaAdapterURL)
-	// log.Printf("--> Configured Azure AI Adapter URL: %s", azureAdapterURL) // Uncomment when added
-	// log.Printf("--> Configured Stable Diffusion Adapter URL: %s", sdAdapterURL) // Uncomment when added
+	slog.Info("AI Coordinator Service starting",
+		"port", cfg.Port,
+		"ollama_adapter_url", ollamaAdapterURL,
+		// "azure_ai_adapter_url", azureAdapterURL, // Uncomment when added
+		// "stable_diffusion_adapter_url", sdAdapterURL, // Uncomment when added
+		"mtls", cfg.MTLS.Enabled,
+		"shutdown_grace_period", serverConfig.GracePeriod.String(),
+	)
 
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start AI Coordinator Service: %v", err)
+	ctx, stop := server.NotifyContext() // Drain in-flight requests on SIGINT or SIGTERM
+	defer stop()
+	go settings.Watch(ctx, config.WatchInterval) // Reload on SIGHUP or when the file changes
+	go certs.Watch(ctx, mtls.WatchInterval)      // Reload rotated certificates
+	if err := httpServer.Serve(ctx, router); err != nil {
+		logging.Fatal("AI Coordinator Service stopped", "error", err)
 	}
 }
 
-// healthCheckHandler provides a basic health endpoint
+// serviceName identifies the service in health reports
+const serviceName = "AI Coordinator Service"
+
+// healthCheckHandler provides a basic health endpoint. Connectivity to the
+// adapters is checked by /readyz and /health/deep.
 func healthCheckHandler(c *gin.Context) {
-	// TODO: Add checks for connectivity to configured adapters if desired
-	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": "AI Coordinator Service"})
+	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": serviceName})
+}
+
+// newHealthCheckers builds the readiness and deep checks of the configured
+// adapters. Without an Ollama adapter every task fails, so the coordinator
+// reports itself Unavailable.
+func newHealthCheckers(cfg health.Config, ollamaAdapterURL string) (readiness, deep *health.Checker) {
+	readiness = health.NewChecker(serviceName, cfg.Timeout, cfg.CacheTTL)
+	deep = health.NewChecker(serviceName, cfg.DeepTimeout, cfg.CacheTTL)
+	if ollamaAdapterURL == "" {
+		notConfigured := func(context.Context) (*health.Report, error) {
+			return nil, errors.New("OLLAMA_ADAPTER_URL not set")
+		}
+		readiness.Add("ollama-adapter", true, notConfigured)
+		deep.Add("ollama-adapter", true, notConfigured)
+		return readiness, deep
+	}
+	readiness.Add("ollama-adapter", true, health.HTTPProbe(ollamaAdapterURL+"/livez"))
+	deep.Add("ollama-adapter", true, health.HTTPProbe(ollamaAdapterURL+"/health/deep"))
+	// Add other adapters here when they are created
+	return readiness, deep
 }
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"privacypilot-ai-coordinator/internal/clients"
+	"privacypilot-ai-coordinator/internal/handlers"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// --- Fake Ollama Adapter Setup ---
+
+// setupFakeAdapter serves the adapter's /anonymize and /anonymize/stream. The
+// stream sends chunks one line at a time; failWith, if set, answers both
+// routes with that error instead. The requests received are appended to
+// received.
+func setupFakeAdapter(t *testing.T, chunks []clients.OllamaAdapterStreamChunk, failWith *apierror.Error, received *[]clients.OllamaAdapterAnonymizeRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req clients.OllamaAdapterAnonymizeRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if received != nil {
+			*received = append(*received, req)
+		}
+		assert.NotEmpty(t, r.Header.Get(requestid.Header), "The request ID must be forwarded to the adapter")
+
+		if failWith != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(failWith.Status)
+			_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: failWith})
+			return
+		}
+		switch r.URL.Path {
+		case "/anonymize":
+			var text strings.Builder
+			for _, chunk := range chunks {
+				text.WriteString(chunk.Token)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(clients.OllamaAdapterAnonymizeResponse{AnonymizedText: text.String(), ModelUsed: req.Model, PromptVersion: "anonymize-v1"})
+		case "/anonymize/stream":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			for _, chunk := range chunks {
+				_ = json.NewEncoder(w).Encode(chunk)
+				w.(http.Flusher).Flush()
+			}
+		default:
+			t.Errorf("Unexpected adapter call to %s", r.URL.Path)
+		}
+	}))
+}
+
+// setupCoordinatorRouter registers the coordinator's routes, calling the adapter at adapterURL
+func setupCoordinatorRouter(adapterURL string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	processHandler := handlers.NewProcessHandler(clients.NewOllamaAdapterClient(adapterURL))
+
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), budget.NewPolicy(budget.DefaultConfig()).Middleware())
+	router.GET("/health", healthCheckHandler)
+	router.GET("/metrics", metrics.Handler())
+	router.POST("/process", processHandler.HandleProcessRequest)
+	router.POST("/process/stream", processHandler.HandleProcessStreamRequest)
+	return router
+}
+
+func postJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// readChunks decodes a newline-delimited JSON stream
+func readChunks(t *testing.T, body []byte) []clients.OllamaAdapterStreamChunk {
+	t.Helper()
+	var chunks []clients.OllamaAdapterStreamChunk
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var chunk clients.OllamaAdapterStreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			t.Fatalf("Invalid stream line %q: %v", scanner.Text(), err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func decodeResponse(t *testing.T, rr *httptest.ResponseRecorder) handlers.AICoordinatorResponse {
+	t.Helper()
+	var resp handlers.AICoordinatorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response %q: %v", rr.Body.String(), err)
+	}
+	return resp
+}
+
+var streamedChunks = []clients.OllamaAdapterStreamChunk{
+	{Token: "Call "},
+	{Token: "[NAME]"},
+	{Token: " at [PHONE]"},
+	{Done: true, ModelUsed: "llama3:8b"},
+}
+
+// --- Tests ---
+
+func TestHealthCheck(t *testing.T) {
+	router := setupCoordinatorRouter("")
+
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "OK", "service": "AI Coordinator Service"}`, rr.Body.String())
+}
+
+func TestProcess_AnonymizeText(t *testing.T) {
+	var received []clients.OllamaAdapterAnonymizeRequest
+	adapter := setupFakeAdapter(t, streamedChunks, nil, &received)
+	defer adapter.Close()
+	router := setupCoordinatorRouter(adapter.URL)
+
+	rr := postJSON(router, "/process", `{"task_type": "anonymize_text", "payload": {"text": "Call Bob at 555-0100"}, "config": {"model": "llama3:8b"}}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	resp := decodeResponse(t, rr)
+	assert.True(t, resp.Success)
+	assert.Equal(t, map[string]any{"anonymized_text": "Call [NAME] at [PHONE]", "model_used": "llama3:8b", "prompt_version": "anonymize-v1"}, resp.Result)
+	assert.Equal(t, []clients.OllamaAdapterAnonymizeRequest{{Text: "Call Bob at 555-0100", Model: "llama3:8b"}}, received)
+}
+
+func TestProcess_RejectsTasksWithoutAnAdapter(t *testing.T) {
+	adapter := setupFakeAdapter(t, nil, nil, nil)
+	defer adapter.Close()
+	router := setupCoordinatorRouter(adapter.URL)
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		{"/process", `{"task_type": "translate", "payload": {"text": "x"}}`, http.StatusBadRequest, apierror.CodeUnsupportedTask},
+		{"/process", `{"task_type": "moderate_text", "payload": {"text": "x"}}`, http.StatusNotImplemented, apierror.CodeUnsupportedTask},
+		{"/process", `{"task_type": "anonymize_text", "payload": {"text": ""}}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"/process", `{"payload": {"text": "x"}}`, http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"/process/stream", `{"task_type": "moderate_text", "payload": {"text": "x"}}`, http.StatusBadRequest, apierror.CodeUnsupportedTask},
+	} {
+		rr := postJSON(router, tc.path, tc.body)
+		assert.Equal(t, tc.status, rr.Code, tc.body)
+		resp := decodeResponse(t, rr)
+		assert.False(t, resp.Success)
+		if assert.NotNil(t, resp.Error, tc.body) {
+			assert.Equal(t, tc.code, resp.Error.Code, tc.body)
+			assert.Equal(t, servicekit.Name(), resp.Error.Service, tc.body)
+		}
+	}
+}
+
+func TestProcessStream_RelaysTheAdapterStream(t *testing.T) {
+	var received []clients.OllamaAdapterAnonymizeRequest
+	adapter := setupFakeAdapter(t, streamedChunks, nil, &received)
+	defer adapter.Close()
+	router := setupCoordinatorRouter(adapter.URL)
+
+	rr := postJSON(router, "/process/stream", `{"task_type": "anonymize_text", "payload": {"text": "Call Bob at 555-0100"}, "config": {"model": "llama3:8b"}}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	assert.Equal(t, streamedChunks, readChunks(t, rr.Body.Bytes()))
+	assert.Equal(t, []clients.OllamaAdapterAnonymizeRequest{{Text: "Call Bob at 555-0100", Model: "llama3:8b"}}, received)
+}
+
+func TestProcessStream_RelaysAdapterErrors(t *testing.T) {
+	// An error before the stream starts keeps its status and code
+	unknownModel := apierror.New(http.StatusNotFound, apierror.CodeModelNotFound, "Model 'nope' is not available on the Ollama server")
+	unknownModel.Service = clients.OllamaAdapterServiceName
+	adapter := setupFakeAdapter(t, nil, unknownModel, nil)
+	router := setupCoordinatorRouter(adapter.URL)
+	rr := postJSON(router, "/process/stream", `{"task_type": "anonymize_text", "payload": {"text": "x"}, "config": {"model": "nope"}}`)
+	adapter.Close()
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	resp := decodeResponse(t, rr)
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, apierror.CodeModelNotFound, resp.Error.Code)
+		assert.Equal(t, clients.OllamaAdapterServiceName, resp.Error.Service)
+		assert.NotEmpty(t, resp.Error.RequestID)
+	}
+
+	// An error chunk mid-stream is relayed as is and ends the stream
+	failed := apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "Ollama failed to run model 'llama3'")
+	failed.Service = clients.OllamaAdapterServiceName
+	adapter = setupFakeAdapter(t, []clients.OllamaAdapterStreamChunk{{Token: "Call "}, {Error: failed}, {Token: "never relayed"}}, nil, nil)
+	defer adapter.Close()
+	router = setupCoordinatorRouter(adapter.URL)
+	rr = postJSON(router, "/process/stream", `{"task_type": "anonymize_text", "payload": {"text": "x"}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	chunks := readChunks(t, rr.Body.Bytes())
+	if assert.Len(t, chunks, 2) && assert.NotNil(t, chunks[1].Error) {
+		assert.Equal(t, "Call ", chunks[0].Token)
+		assert.Equal(t, apierror.CodeUpstreamError, chunks[1].Error.Code)
+		assert.Equal(t, clients.OllamaAdapterServiceName, chunks[1].Error.Service)
+	}
+
+	// A stream cut off without a final chunk ends with an error chunk
+	adapter = setupFakeAdapter(t, []clients.OllamaAdapterStreamChunk{{Token: "Call "}}, nil, nil)
+	defer adapter.Close()
+	rr = postJSON(setupCoordinatorRouter(adapter.URL), "/process/stream", `{"task_type": "anonymize_text", "payload": {"text": "x"}}`)
+	chunks = readChunks(t, rr.Body.Bytes())
+	if assert.Len(t, chunks, 2) && assert.NotNil(t, chunks[1].Error) {
+		assert.Equal(t, apierror.CodeUpstreamError, chunks[1].Error.Code)
+	}
+}
+
+func TestProcess_TasksAreCounted(t *testing.T) {
+	adapter := setupFakeAdapter(t, streamedChunks, nil, nil)
+	defer adapter.Close()
+	router := setupCoordinatorRouter(adapter.URL)
+
+	postJSON(router, "/process", `{"task_type": "anonymize_text", "payload": {"text": "x"}}`)
+	postJSON(router, "/process/stream", `{"task_type": "anonymize_text", "payload": {"text": "x"}}`)
+	postJSON(router, "/process", `{"task_type": "some-task-name-from-a-caller", "payload": {"text": "x"}}`)
+
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	body := rr.Body.String()
+	assert.Contains(t, body, `privacypilot_coordinator_tasks_total{adapter="ollama",mode="sync",outcome="success",task_type="anonymize_text"}`)
+	assert.Contains(t, body, `privacypilot_coordinator_tasks_total{adapter="ollama",mode="stream",outcome="success",task_type="anonymize_text"}`)
+	assert.Contains(t, body, `privacypilot_coordinator_tasks_total{adapter="none",mode="sync",outcome="unsupported_task",task_type="unsupported"}`)
+	assert.NotContains(t, body, "some-task-name-from-a-caller")
+}
+
+// --- Logging Tests ---
+
+// logCanary is fake PII that must never reach the logs, spans or error bodies
+const logCanary = "Jane CANARY-7f3a9c Doe, jane.canary@example.com, +1 555 0199"
+
+// canaryFragments are the parts of logCanary looked for
+var canaryFragments = []string{"CANARY-7f3a9c", "jane.canary@example.com", "555 0199", "Jane"}
+
+// captureLogs sends the default logger to a buffer at debug level until the
+// test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestLogging_CanaryPIINeverLogged(t *testing.T) {
+	logs := captureLogs(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	// The adapter echoes the text. It fails, as the real one does, without the
+	// text in the message when the text contains "fail", and answers garbage
+	// holding the text when it contains "garbage".
+	failed := apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "Ollama failed to run model 'llama3'")
+	failed.Service = clients.OllamaAdapterServiceName
+	adapter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req clients.OllamaAdapterAnonymizeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		assert.Contains(t, req.Text, "CANARY-7f3a9c", "Fake: the canary should reach the adapter")
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		switch {
+		case strings.Contains(req.Text, "garbage"):
+			_, _ = fmt.Fprintf(w, "not JSON: %s\n", req.Text)
+		case strings.Contains(req.Text, "fail before"), strings.Contains(req.Text, "fail") && r.URL.Path == "/anonymize":
+			w.WriteHeader(failed.Status)
+			_ = encoder.Encode(apierror.Envelope{Error: failed})
+		case strings.Contains(req.Text, "fail"):
+			_ = encoder.Encode(clients.OllamaAdapterStreamChunk{Token: req.Text})
+			_ = encoder.Encode(clients.OllamaAdapterStreamChunk{Error: failed})
+		case r.URL.Path == "/anonymize":
+			_ = encoder.Encode(clients.OllamaAdapterAnonymizeResponse{AnonymizedText: req.Text, ModelUsed: "llama3"})
+		default:
+			_ = encoder.Encode(clients.OllamaAdapterStreamChunk{Token: req.Text})
+			_ = encoder.Encode(clients.OllamaAdapterStreamChunk{Done: true, ModelUsed: "llama3"})
+		}
+	}))
+	defer adapter.Close()
+	router := setupCoordinatorRouter(adapter.URL)
+	router.GET("/panic", func(c *gin.Context) { panic("processing " + logCanary) })
+
+	task := func(text string) string {
+		encoded, _ := json.Marshal(text)
+		return fmt.Sprintf(`{"task_type": "anonymize_text", "payload": {"text": %s}}`, encoded)
+	}
+	canary, _ := json.Marshal(logCanary)
+	query := "?q=" + url.QueryEscape(logCanary)
+	var errorBodies strings.Builder
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodGet, "/health" + query, ""},
+		{http.MethodGet, "/metrics" + query, ""},
+		{http.MethodGet, "/panic" + query, ""},
+		{http.MethodGet, "/no/such/" + url.PathEscape(logCanary), ""},
+		{http.MethodPost, "/process" + query, task(logCanary)},
+		{http.MethodPost, "/process", task(logCanary + " fail")},
+		{http.MethodPost, "/process", task(logCanary + " garbage")},
+		{http.MethodPost, "/process", fmt.Sprintf(`{"task_type": "translate", "payload": {"text": %s}}`, canary)},
+		{http.MethodPost, "/process", fmt.Sprintf(`{"task_type": "anonymize_text", "payload": {"text": 42, "note": %s}}`, canary)},
+		{http.MethodPost, "/process", fmt.Sprintf(`{"task_type": "anonymize_text", "payload": {"text": %s}`, canary)},
+		{http.MethodPost, "/process/stream" + query, task(logCanary)},
+		{http.MethodPost, "/process/stream", task(logCanary + " fail")},
+		{http.MethodPost, "/process/stream", task(logCanary + " fail before")},
+		{http.MethodPost, "/process/stream", task(logCanary + " garbage")},
+		{http.MethodPost, "/process/stream", fmt.Sprintf(`{"task_type": "anonymize_text", "payload": {"text": %s}`, canary)},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code >= http.StatusBadRequest {
+			errorBodies.WriteString(rr.Body.String())
+		} else if strings.HasPrefix(r.path, "/process/stream") {
+			for _, chunk := range readChunks(t, rr.Body.Bytes()) {
+				if chunk.Error != nil {
+					encoded, _ := json.Marshal(chunk.Error)
+					errorBodies.Write(encoded)
+				}
+			}
+		}
+	}
+
+	output := logs.String()
+	assert.Contains(t, output, `"route":"/process/stream"`)
+	var spans strings.Builder
+	for _, span := range recorder.Ended() {
+		fmt.Fprint(&spans, span.Name(), span.Attributes(), span.Events(), span.Status())
+	}
+	assert.Contains(t, spans.String(), "POST /process/stream")
+	assert.Contains(t, errorBodies.String(), apierror.CodeUpstreamError)
+	assert.Contains(t, errorBodies.String(), apierror.CodeInvalidRequest)
+	for _, fragment := range canaryFragments {
+		assert.NotContains(t, output, fragment, "Canary PII leaked into the logs")
+		assert.NotContains(t, spans.String(), fragment, "Canary PII leaked into the spans")
+		assert.NotContains(t, errorBodies.String(), fragment, "Canary PII leaked into an error body")
+	}
+
+	// Every record is JSON with the service field and, once routed, the request ID
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(line), &record), "Log line is not JSON: %s", line) {
+			continue
+		}
+		assert.Equal(t, servicekit.Name(), record["service"])
+		if record["msg"] == "Request handled" {
+			assert.NotEmpty(t, record["request_id"], "Access log record without request_id: %s", line)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"privacypilot-anonymizer-service/internal/clients"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+)
+
+// Config is the anonymizer's configuration (see package config for the
+// tags). Hot settings are applied on reload by applySettings in main.
+type Config struct {
+	Port     string `config:"port" env:"PORT"`
+	GinMode  string `config:"gin_mode" env:"GIN_MODE"`
+	LogLevel string `config:"log_level,hot" env:"LOG_LEVEL"`
+
+	Server        server.Config       `config:"server"`
+	AICoordinator AICoordinatorConfig `config:"ai_coordinator"`
+	Cache         CacheConfig         `config:"cache"`
+	Health        health.Config       `config:"health"`
+	Resilience    resilience.Config   `config:"resilience,hot"` // Retries and circuit breaker of the coordinator client
+	Budget        budget.Config       `config:"budget,hot"`     // Time budgets of incoming requests
+	MTLS          mtls.Config         `config:"mtls"`           // Mutual TLS towards the gateway and the coordinator
+}
+
+// AICoordinatorConfig locates the AI Coordinator and limits calls to it
+type AICoordinatorConfig struct {
+	URL           string        `config:"url" env:"AI_COORDINATOR_URL"`
+	Timeout       time.Duration `config:"timeout,hot" env:"AI_COORDINATOR_TIMEOUT"`
+	StreamTimeout time.Duration `config:"stream_timeout,hot" env:"AI_COORDINATOR_STREAM_TIMEOUT"`
+}
+
+// CacheConfig selects the anonymization result cache (see package cache)
+type CacheConfig struct {
+	Backend       string        `config:"backend" env:"ANONYMIZE_CACHE_BACKEND"` // off, memory or redis
+	RedisAddr     string        `config:"redis_addr" env:"REDIS_ADDR"`
+	MaxEntries    int           `config:"max_entries" env:"ANONYMIZE_CACHE_MAX_ENTRIES"` // Memory backend only
+	TTL           time.Duration `config:"ttl,hot" env:"ANONYMIZE_CACHE_TTL"`
+	EncryptionKey string        `config:"encryption_key,secret" env:"ANONYMIZE_CACHE_KEY"` // Random per process when unset (memory only)
+	PolicyVersion string        `config:"policy_version" env:"ANONYMIZE_POLICY_VERSION"`   // Changing it invalidates every entry
+}
+
+// defaultConfig returns the settings used when neither the file nor the
+// environment sets them
+func defaultConfig() Config {
+	return Config{
+		Port:     "8081",
+		GinMode:  "debug",
+		LogLevel: "info",
+		Server:   server.DefaultConfig(),
+		AICoordinator: AICoordinatorConfig{
+			Timeout:       clients.DefaultAICoordinatorTimeout,
+			StreamTimeout: clients.DefaultAICoordinatorStreamTimeout,
+		},
+		Cache: CacheConfig{
+			Backend:       "memory",
+			MaxEntries:    10000,
+			TTL:           24 * time.Hour,
+			PolicyVersion: "v1",
+		},
+		Health:     health.DefaultConfig(6 * time.Second), // Above the coordinator's, which waits for the adapter
+		Resilience: resilience.DefaultConfig(),
+		Budget:     budget.DefaultConfig(),
+		MTLS:       mtls.DefaultConfig([]string{"api-gateway"}, []string{"ai-coordinator"}),
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	if _, ok := logging.ParseLevel(c.LogLevel); !ok {
+		errs = append(errs, fmt.Errorf("log_level: unsupported level %q (expected debug, info, warn or error)", c.LogLevel))
+	}
+	errs = append(errs, c.Server.Validate())
+	if c.AICoordinator.URL == "" {
+		errs = append(errs, errors.New("ai_coordinator.url: required (AI_COORDINATOR_URL)"))
+	} else if u, err := url.Parse(c.AICoordinator.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("ai_coordinator.url: expected an absolute URL such as http://host:port, got %q", c.AICoordinator.URL))
+	}
+	if c.AICoordinator.Timeout <= 0 {
+		errs = append(errs, errors.New("ai_coordinator.timeout: must be positive"))
+	}
+	if c.AICoordinator.StreamTimeout <= 0 {
+		errs = append(errs, errors.New("ai_coordinator.stream_timeout: must be positive"))
+	}
+	errs = append(errs, c.Cache.validate())
+	errs = append(errs, c.Health.Validate(), c.Resilience.Validate(), c.Budget.Validate(), c.MTLS.Validate())
+	return errors.Join(errs...)
+}
+
+func (c *CacheConfig) validate() error {
+	var errs []error
+	switch strings.ToLower(c.Backend) {
+	case "off":
+		return nil
+	case "memory":
+		if c.MaxEntries < 1 {
+			errs = append(errs, errors.New("cache.max_entries: must be at least 1"))
+		}
+	case "redis":
+		if c.RedisAddr == "" {
+			errs = append(errs, errors.New("cache.redis_addr: required for the redis backend (REDIS_ADDR)"))
+		}
+		// Entries outlive the process in Redis and are shared between
+		// replicas, so they need a key every replica knows
+		if c.EncryptionKey == "" {
+			errs = append(errs, errors.New("cache.encryption_key: required for the redis backend (ANONYMIZE_CACHE_KEY)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cache.backend: unsupported backend %q (expected off, memory or redis)", c.Backend))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, errors.New("cache.ttl: must be positive"))
+	}
+	if c.PolicyVersion == "" {
+		errs = append(errs, errors.New("cache.policy_version: required"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,242 @@
+// Package cache keeps anonymization results so identical requests skip the
+// model. Entries are keyed by an HMAC of the normalized text, the caller, the
+// anonymization policy version, the model and the prompt version, and are
+// encrypted with AES-256-GCM before they reach a backend, so neither the keys
+// nor the values held in memory or in Redis reveal any text.
+//
+// The model and prompt version that will serve a request are only known from
+// the adapter's answers: the cache learns them from the results it stores, so
+// a new prompt template or default model stops old entries from matching as
+// soon as the first result produced with it has been stored.
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Mode is how a request uses the cache
+type Mode string
+
+const (
+	ModeDefault Mode = ""        // Use a cached result if there is one, otherwise store the new result
+	ModeRefresh Mode = "refresh" // Ignore any cached result and store the new one
+	ModeBypass  Mode = "bypass"  // Neither read nor write the cache
+)
+
+// Backend stores encrypted entries under opaque keys
+type Backend interface {
+	// Get returns the value stored under key, or ok=false if there is none
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Request identifies an anonymization. An empty Model means the adapter's
+// default model. Owner names the caller; entries are only served to the owner
+// that stored them, so one caller cannot tell whether another anonymized a
+// text.
+type Request struct {
+	Text  string
+	Model string
+	Owner string
+}
+
+// Entry is a cached anonymization result
+type Entry struct {
+	AnonymizedText string `json:"anonymized_text"`
+	ModelUsed      string `json:"model_used"`
+	PromptVersion  string `json:"prompt_version"`
+}
+
+// Cache encrypts, keys and expires anonymization results
+type Cache struct {
+	backend Backend
+	name    string // Backend name for logs and metrics
+	policy  string
+	aead    cipher.AEAD
+	macKey  []byte
+	ttl     atomic.Int64 // time.Duration
+
+	mu            sync.RWMutex
+	promptVersion string // Last prompt version reported by the adapter
+	defaultModel  string // Model last used for requests without one
+}
+
+// New creates a cache over backend. secret derives the encryption and key
+// hashing keys; an empty secret uses a random one, so entries only last as
+// long as the process. policy is the anonymization policy version: changing
+// it invalidates every entry.
+func New(backend Backend, name, secret, policy string, ttl time.Duration) (*Cache, error) {
+	master := []byte(secret)
+	if secret == "" {
+		master = make([]byte, 32)
+		if _, err := rand.Read(master); err != nil {
+			return nil, fmt.Errorf("generating a cache key: %w", err)
+		}
+	}
+	block, err := aes.NewCipher(derive(master, "privacypilot-cache-encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		backend: backend,
+		name:    name,
+		policy:  policy,
+		aead:    aead,
+		macKey:  derive(master, "privacypilot-cache-key"),
+	}
+	c.SetTTL(ttl)
+	return c, nil
+}
+
+// derive returns a 32-byte key for purpose from the master secret
+func derive(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Name returns the name of the backend
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// SetTTL changes how long new entries are kept. Stored entries keep theirs.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
+}
+
+// Normalize returns the form of text that is keyed: Unicode NFC, Unix line
+// endings and no surrounding whitespace
+func Normalize(text string) string {
+	text = norm.NFC.String(text)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimSpace(text)
+}
+
+// key hashes everything that determines a result. Fields are length-prefixed
+// so no two combinations produce the same input.
+func (c *Cache) key(owner, text, model, promptVersion string) string {
+	mac := hmac.New(sha256.New, c.macKey)
+	for _, field := range []string{c.policy, owner, model, promptVersion, Normalize(text)} {
+		fmt.Fprintf(mac, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lookupKey is the key a request would have been stored under, given what the
+// adapter last reported. It is empty until the cache has learned enough.
+func (c *Cache) lookupKey(req Request) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	model := req.Model
+	if model == "" {
+		model = c.defaultModel
+	}
+	if model == "" || c.promptVersion == "" {
+		return ""
+	}
+	return c.key(req.Owner, req.Text, model, c.promptVersion)
+}
+
+// Get returns the cached result of req. Backend failures and entries that
+// cannot be decrypted are logged and reported as misses.
+func (c *Cache) Get(ctx context.Context, req Request) (*Entry, bool) {
+	key := c.lookupKey(req)
+	if key == "" {
+		return nil, false
+	}
+	sealed, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Cache lookup failed", "backend", c.name, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	entry, err := c.open(key, sealed)
+	if err != nil {
+		slog.WarnContext(ctx, "Discarding unreadable cache entry", "backend", c.name, "error", err)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Put stores the result of req and learns the model and prompt version it
+// reports. Results without a prompt version are not stored, since they could
+// never be told apart from the results of another prompt.
+func (c *Cache) Put(ctx context.Context, req Request, entry Entry) {
+	if entry.PromptVersion == "" || (req.Model == "" && entry.ModelUsed == "") {
+		slog.DebugContext(ctx, "Not caching a result without model and prompt version")
+		return
+	}
+	c.mu.Lock()
+	c.promptVersion = entry.PromptVersion
+	if req.Model == "" {
+		c.defaultModel = entry.ModelUsed
+	}
+	c.mu.Unlock()
+
+	model := req.Model
+	if model == "" {
+		model = entry.ModelUsed
+	}
+	key := c.key(req.Owner, req.Text, model, entry.PromptVersion)
+	sealed, err := c.seal(key, entry)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encrypt cache entry", "error", err)
+		return
+	}
+	if err := c.backend.Set(ctx, key, sealed, time.Duration(c.ttl.Load())); err != nil {
+		slog.WarnContext(ctx, "Cache store failed", "backend", c.name, "error", err)
+	}
+}
+
+// seal encrypts entry, bound to key so it cannot be replayed under another
+func (c *Cache) seal(key string, entry Entry) ([]byte, error) {
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plain, []byte(key)), nil
+}
+
+func (c *Cache) open(key string, sealed []byte) (*Entry, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("entry too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(plain, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps entries in process memory, evicting the least recently
+// used once it holds maxEntries. It is private to one replica; use
+// RedisBackend to share entries between replicas.
+type MemoryBackend struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // Most recently used first
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type memoryItem struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryBackend creates an empty backend holding at most maxEntries
+func NewMemoryBackend(maxEntries int) *MemoryBackend {
+	return &MemoryBackend{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get implements Backend
+func (m *MemoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := el.Value.(*memoryItem)
+	if !m.now().Before(item.expiresAt) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return item.value, true, nil
+}
+
+// Set implements Backend
+func (m *MemoryBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt := m.now().Add(ttl)
+	if el, ok := m.items[key]; ok {
+		item := el.Value.(*memoryItem)
+		item.value, item.expiresAt = value, expiresAt
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, value: value, expiresAt: expiresAt})
+	for m.order.Len() > m.maxEntries {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries held, including expired ones not yet evicted
+func (m *MemoryBackend) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *MemoryBackend) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.items, el.Value.(*memoryItem).key)
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Label values for Observe
+const (
+	ResultHit     = "hit"
+	ResultMiss    = "miss"
+	ResultRefresh = "refresh" // The caller asked for a new result, which was stored
+	ResultBypass  = "bypass"  // The caller asked not to use the cache
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "anonymizer_cache_requests_total",
+	Help:      "Anonymization requests by result cache backend and result (hit, miss, refresh or bypass).",
+}, []string{"backend", "result"})
+
+// Observe counts an anonymization request's use of the result cache
+func Observe(backend, result string) {
+	cacheRequests.WithLabelValues(backend, result).Inc()
+}
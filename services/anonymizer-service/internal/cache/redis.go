@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackend shares entries between anonymizer replicas through Redis.
+// Redis expires entries itself; configure a maxmemory policy such as
+// allkeys-lru to bound its size.
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend creates a backend using the Redis server at addr (host:port)
+func NewRedisBackend(addr string) *RedisBackend {
+	return &RedisBackend{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: "privacypilot:anonymize-cache:",
+	}
+}
+
+// Ping verifies that the Redis server is reachable
+func (r *RedisBackend) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Get implements Backend
+func (r *RedisBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements Backend
+func (r *RedisBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
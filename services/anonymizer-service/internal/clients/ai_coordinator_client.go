@@ -1,14 +1,26 @@
 package clients
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
 )
 
+// AICoordinatorServiceName attributes errors reported by the coordinator
+const AICoordinatorServiceName = "ai-coordinator"
+
 // Define task types known by the coordinator
 const (
 	TaskTypeAnonymizeText = "anonymize_text"
@@ -25,82 +37,135 @@ type AICoordinatorRequest struct {
 // AICoordinatorResponse defines the generic structure for responses FROM the coordinator
 // The actual 'Result' will vary based on the task type.
 type AICoordinatorResponse struct {
-	Success bool        `json:"success"`
-	Result  interface{} `json:"result,omitempty"` // Use map[string]interface{} or specific structs
-	Error   string      `json:"error,omitempty"`
+	Success bool            `json:"success"`
+	Result  interface{}     `json:"result,omitempty"` // Use map[string]interface{} or specific structs
+	Error   *apierror.Error `json:"error,omitempty"`  // Standard error envelope body on failure
 }
 
 // AnonymizeTextResult defines the expected structure within the 'Result' field for anonymization tasks
 type AnonymizeTextResult struct {
 	AnonymizedText string `json:"anonymized_text"`
-	// Add other fields returned by the specific AI adapter via the coordinator if needed
+	ModelUsed      string `json:"model_used"`
+	PromptVersion  string `json:"prompt_version"` // Adapter prompt template that produced the output
+}
+
+// StreamChunk is one line of the coordinator's newline-delimited JSON stream
+type StreamChunk struct {
+	Token     string          `json:"token,omitempty"`
+	Done      bool            `json:"done,omitempty"`
+	ModelUsed string          `json:"model_used,omitempty"`
+	Error     *apierror.Error `json:"error,omitempty"`
 }
 
+// Default time limits on calls to the AI Coordinator
+const (
+	DefaultAICoordinatorTimeout       = 20 * time.Second // AI tasks might take longer
+	DefaultAICoordinatorStreamTimeout = 70 * time.Second // Bounds a whole streamed anonymization
+)
+
 // AICoordinatorClient holds configuration
 type AICoordinatorClient struct {
-	BaseURL    string
-	HttpClient *http.Client
+	BaseURL string
+	// HttpClient and StreamHttpClient have no overall timeout; calls are
+	// bounded by their context instead (see SetTimeouts)
+	HttpClient       *http.Client
+	StreamHttpClient *http.Client
+	Resilience       *resilience.Caller // Retries and circuit breaker
+	timeout          *timeout
+	streamTimeout    *timeout
 }
 
 // NewAICoordinatorClient creates a new client instance
 func NewAICoordinatorClient(baseURL string) *AICoordinatorClient {
 	return &AICoordinatorClient{
-		BaseURL: baseURL,
-		HttpClient: &http.Client{
-			Timeout: 20 * time.Second, // AI tasks might take longer
-		},
+		BaseURL:          baseURL,
+		HttpClient:       &http.Client{Transport: metrics.Transport(AICoordinatorServiceName, telemetry.Transport(nil))},
+		StreamHttpClient: &http.Client{Transport: metrics.Transport(AICoordinatorServiceName, telemetry.Transport(nil))},
+		Resilience:       resilience.NewCaller(AICoordinatorServiceName, resilience.DefaultConfig()),
+		timeout:          newTimeout(DefaultAICoordinatorTimeout),
+		streamTimeout:    newTimeout(DefaultAICoordinatorStreamTimeout),
 	}
 }
 
-// RequestAnonymization sends an anonymization task request to the AI Coordinator
-func (c *AICoordinatorClient) RequestAnonymization(text string) (*AnonymizeTextResult, error) {
-	// The payload specific to the anonymize_text task
-	payload := map[string]string{"text": text}
+// UseTransport sends the client's calls through base (the default transport
+// if nil), e.g. to call the coordinator over mutual TLS. It must be called before
+// the client is used.
+func (c *AICoordinatorClient) UseTransport(base http.RoundTripper) {
+	c.HttpClient.Transport = metrics.Transport(AICoordinatorServiceName, telemetry.Transport(base))
+	c.StreamHttpClient.Transport = metrics.Transport(AICoordinatorServiceName, telemetry.Transport(base))
+}
 
-	coordReq := AICoordinatorRequest{
-		TaskType: TaskTypeAnonymizeText,
-		Payload:  payload,
-		// Config: map[string]string{"model_preference": "ollama-fast"}, // Example optional config
-	}
+// SetTimeouts changes the time limits on calls and on whole streams. It is
+// safe to call while calls are in flight; they keep their limits.
+func (c *AICoordinatorClient) SetTimeouts(call, stream time.Duration) {
+	c.timeout.set(call)
+	c.streamTimeout.set(stream)
+}
+
+// RequestAnonymization sends an anonymization task request to the AI Coordinator.
+// model may be empty to use the adapter's default. Failures are returned as
+// *apierror.Error. Cancelling ctx aborts the call.
+func (c *AICoordinatorClient) RequestAnonymization(ctx context.Context, text, model string) (*AnonymizeTextResult, error) {
+	coordReq := newAnonymizeTask(text, model)
 
 	payloadBytes, err := json.Marshal(coordReq)
 	if err != nil {
-		log.Printf("Error marshalling AI coordinator request payload: %v", err)
+		slog.ErrorContext(ctx, "Failed to marshal AI coordinator request payload", "error", err)
 		return nil, fmt.Errorf("failed to create AI coordinator request payload: %w", err)
 	}
 
+	var result *AnonymizeTextResult
+	err = c.Resilience.Do(ctx, func(ctx context.Context) error {
+		result, err = c.requestAnonymization(ctx, payloadBytes)
+		return err
+	})
+	return result, err
+}
+
+// requestAnonymization makes one attempt at an anonymization task
+func (c *AICoordinatorClient) requestAnonymization(ctx context.Context, payloadBytes []byte) (*AnonymizeTextResult, error) {
+	ctx, cancel := c.timeout.bound(ctx)
+	defer cancel()
+
 	// Assuming the coordinator has a single endpoint like /process
 	reqUrl := fmt.Sprintf("%s/process", c.BaseURL)
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
 	if err != nil {
-		log.Printf("Error creating request to AI coordinator: %v", err)
+		slog.ErrorContext(ctx, "Failed to create request to AI coordinator", "error", err)
 		return nil, fmt.Errorf("failed to create AI coordinator request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
 
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		log.Printf("Error sending request to AI coordinator at %s: %v", reqUrl, err)
-		return nil, fmt.Errorf("AI coordinator request failed: %w", err)
+		slog.ErrorContext(ctx, "Failed to reach AI coordinator", "url", reqUrl, "error", err)
+		return nil, apierror.FromTransport(err, AICoordinatorServiceName)
 	}
 	defer resp.Body.Close()
 
+	// Failed responses carry the error envelope next to "success": false
+	if resp.StatusCode != http.StatusOK {
+		apiErr := apierror.FromResponse(resp, AICoordinatorServiceName)
+		slog.WarnContext(ctx, "AI coordinator returned an error", "error", apiErr)
+		return nil, apiErr
+	}
+
 	// Decode the generic response first
 	var coordResp AICoordinatorResponse
 	if err := json.NewDecoder(resp.Body).Decode(&coordResp); err != nil {
-		log.Printf("Error decoding AI coordinator generic response (status %d): %v", resp.StatusCode, err)
+		slog.ErrorContext(ctx, "Failed to decode AI coordinator response", "status", resp.StatusCode, "error", err)
 		// Return error even if status is 200 but body is unparsable
-		return nil, fmt.Errorf("failed to decode AI coordinator response: %w", err)
+		return nil, apierror.BadResponse(AICoordinatorServiceName)
 	}
-
-	// Check for non-OK status codes OR explicit failure in the response body
-	if resp.StatusCode != http.StatusOK || !coordResp.Success {
-		errorMsg := coordResp.Error
-		if errorMsg == "" {
-			errorMsg = fmt.Sprintf("AI Coordinator returned status %d with success=false", resp.StatusCode)
+	if !coordResp.Success {
+		slog.WarnContext(ctx, "AI coordinator returned status 200 with success=false")
+		if coordResp.Error != nil {
+			coordResp.Error.Status = http.StatusBadGateway
+			return nil, coordResp.Error
 		}
-		log.Printf("AI Coordinator request failed: %s", errorMsg)
-		return nil, fmt.Errorf("AI coordinator task failed: %s", errorMsg)
+		return nil, apierror.BadResponse(AICoordinatorServiceName)
 	}
 
 	// If successful, parse the specific result type (AnonymizeTextResult)
@@ -108,16 +173,92 @@ func (c *AICoordinatorClient) RequestAnonymization(text string) (*AnonymizeTextR
 	// so we marshal it back to bytes and unmarshal into the specific struct.
 	resultBytes, err := json.Marshal(coordResp.Result)
 	if err != nil {
-		log.Printf("Error marshalling coordinator result field: %v", err)
-		return nil, fmt.Errorf("failed to process coordinator result structure: %w", err)
+		slog.ErrorContext(ctx, "Failed to marshal coordinator result field", "error", err)
+		return nil, apierror.BadResponse(AICoordinatorServiceName)
 	}
 
 	var anonymizeResult AnonymizeTextResult
 	if err := json.Unmarshal(resultBytes, &anonymizeResult); err != nil {
-		log.Printf("Error unmarshalling specific AnonymizeTextResult from coordinator response: %v", err)
-		return nil, fmt.Errorf("failed to decode specific anonymization result: %w", err)
+		slog.ErrorContext(ctx, "Failed to decode anonymization result from coordinator response", "error", err)
+		return nil, apierror.BadResponse(AICoordinatorServiceName)
 	}
 
-	log.Printf("Successfully received anonymization result via AI Coordinator.")
+	slog.DebugContext(ctx, "Received anonymization result from AI coordinator")
 	return &anonymizeResult, nil
 }
+
+// RequestAnonymizationStream asks the AI Coordinator to stream an anonymization
+// and calls onChunk for every chunk, including the final Done or Error chunk.
+// The request is only retried until the stream has started.
+func (c *AICoordinatorClient) RequestAnonymizationStream(ctx context.Context, text, model string, onChunk func(StreamChunk) error) error {
+	coordReq := newAnonymizeTask(text, model)
+	payloadBytes, err := json.Marshal(coordReq)
+	if err != nil {
+		return fmt.Errorf("failed to create AI coordinator request payload: %w", err)
+	}
+	return c.Resilience.Do(ctx, func(ctx context.Context) error {
+		return c.requestAnonymizationStream(ctx, payloadBytes, onChunk)
+	})
+}
+
+// requestAnonymizationStream makes one attempt at a streamed anonymization
+func (c *AICoordinatorClient) requestAnonymizationStream(ctx context.Context, payloadBytes []byte, onChunk func(StreamChunk) error) error {
+	ctx, cancel := c.streamTimeout.bound(ctx)
+	defer cancel()
+
+	reqUrl := fmt.Sprintf("%s/process/stream", c.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create streaming request to AI coordinator", "error", err)
+		return fmt.Errorf("failed to create AI coordinator request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
+
+	resp, err := c.StreamHttpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reach AI coordinator for streaming", "url", reqUrl, "error", err)
+		return apierror.FromTransport(err, AICoordinatorServiceName)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "AI coordinator stream returned an error", "status", resp.StatusCode)
+		return apierror.FromResponse(resp, AICoordinatorServiceName)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk StreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode AI coordinator stream chunk", "error", err)
+			return resilience.NoRetry(apierror.BadResponse(AICoordinatorServiceName))
+		}
+		if err := onChunk(chunk); err != nil {
+			return resilience.NoRetry(err)
+		}
+		if chunk.Done || chunk.Error != nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.WarnContext(ctx, "AI coordinator stream interrupted", "error", err)
+		return resilience.NoRetry(apierror.FromTransport(err, AICoordinatorServiceName))
+	}
+	return resilience.NoRetry(apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "ai-coordinator stream ended without a final chunk"))
+}
+
+// newAnonymizeTask builds the coordinator request for an anonymize_text task.
+// The model, if any, is passed as the "model" hint the coordinator forwards to the adapter.
+func newAnonymizeTask(text, model string) AICoordinatorRequest {
+	req := AICoordinatorRequest{
+		TaskType: TaskTypeAnonymizeText,
+		Payload:  map[string]string{"text": text},
+	}
+	if model != "" {
+		req.Config = map[string]string{"model": model}
+	}
+	return req
+}
@@ -1,68 +1,199 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"privacypilot-anonymizer-service/internal/cache"
 	"privacypilot-anonymizer-service/internal/clients"
 
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
 	"github.com/gin-gonic/gin"
 )
 
 // Request/Response structs remain the same for this service's external API
 type AnonymizeRequest struct {
-	Text string `json:"text" binding:"required"`
+	Text  string `json:"text" binding:"required"`
+	Model string `json:"model,omitempty"`                                          // Optional model override, forwarded to the AI Coordinator
+	Cache string `json:"cache,omitempty" binding:"omitempty,oneof=refresh bypass"` // Optional cache.Mode; /anonymize/stream ignores it
+	Owner string `json:"owner,omitempty"`                                          // The gateway's caller; only mixed into the cache key
 }
 
 type AnonymizeResponse struct {
 	OriginalText   string `json:"original_text"`
 	AnonymizedText string `json:"anonymized_text"`
+	Cached         bool   `json:"cached"` // Served from the result cache
 }
 
 // Global variable for the AI Coordinator client (or use dependency injection)
 var aiCoordClient *clients.AICoordinatorClient
 
+// resultCache holds anonymization results; nil when caching is off
+var resultCache *cache.Cache
+
+func init() {
+	servicekit.SetName("anonymizer-service") // Reported in error envelopes, logs and spans
+}
+
 func main() {
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode == "" {
-		ginMode = gin.DebugMode
+	logging.Setup()
+
+	// --- Configuration ---
+	settings, err := config.NewManager(os.Getenv(config.FileEnv), defaultConfig())
+	if err != nil {
+		logging.Fatal("Failed to load configuration", "error", err)
 	}
-	gin.SetMode(ginMode)
+	cfg := settings.Current()
+	gin.SetMode(cfg.GinMode)
 
-	// --- Instantiate AI Coordinator Client ---
-	aiCoordinatorURL := strings.TrimRight(os.Getenv("AI_COORDINATOR_URL"), "/")
-	if aiCoordinatorURL == "" {
-		log.Fatal("AI_COORDINATOR_URL environment variable not set for Anonymizer Service")
+	// --- Tracing ---
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(ctx)
+	}()
+
+	// --- Mutual TLS ---
+	// Serves and calls over mTLS when enabled; nil otherwise
+	certs, err := mtls.Load(cfg.MTLS)
+	if err != nil {
+		logging.Fatal("Failed to load the mTLS certificates", "error", err)
 	}
+	health.UseTransport(certs.Transport())
+
+	// --- Instantiate AI Coordinator Client ---
+	aiCoordinatorURL := strings.TrimRight(cfg.AICoordinator.URL, "/")
 	aiCoordClient = clients.NewAICoordinatorClient(aiCoordinatorURL) // Assign to global variable
+	aiCoordClient.UseTransport(certs.Transport())
 	//-----------------------------------------
 
-	router := gin.Default()
+	// --- Result Cache ---
+	resultCache, err = newResultCache(cfg.Cache)
+	if err != nil {
+		logging.Fatal("Failed to set up the result cache", "error", err)
+	}
 
-	// --- Routes ---
-	router.GET("/health", healthCheckHandler)
-	router.POST("/anonymize", anonymizeHandler) // Handler now uses the client
+	// --- Time Budgets ---
+	budgets := budget.NewPolicy(cfg.Budget)
 
-	// --- Start Server ---
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+	// --- Hot Settings ---
+	// Applied now and again whenever the configuration is reloaded
+	applySettings := func(cfg *Config) {
+		level, _ := logging.ParseLevel(cfg.LogLevel)
+		logging.SetLevel(level)
+		aiCoordClient.SetTimeouts(cfg.AICoordinator.Timeout, cfg.AICoordinator.StreamTimeout)
+		aiCoordClient.Resilience.SetConfig(cfg.Resilience)
+		budgets.SetConfig(cfg.Budget)
+		if resultCache != nil {
+			resultCache.SetTTL(cfg.Cache.TTL)
+		}
+	}
+	applySettings(cfg)
+	settings.OnReload(applySettings)
+
+	// --- HTTP Server ---
+	serverConfig := cfg.Server
+	serverConfig.Addr = ":" + cfg.Port
+	httpServer := server.New(serverConfig)
+	if certs != nil {
+		httpServer.UseTLS(certs.ServerConfig())
 	}
-	serverAddr := fmt.Sprintf(":%s", port)
 
-	log.Printf("Anonymizer Service starting on port %s", port)
-	log.Printf("--> AI Coordinator URL: %s", aiCoordinatorURL)
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start Anonymizer Service: %v", err)
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), budgets.Middleware())
+
+	// --- Health Checks ---
+	readiness, deepHealth := newHealthCheckers(cfg.Health, aiCoordinatorURL)
+
+	// --- Routes ---
+	router.GET("/health", httpServer.FailWhileDraining(), healthCheckHandler)
+	router.GET("/livez", health.LiveHandler(serviceName))
+	router.GET("/readyz", httpServer.FailWhileDraining(), readiness.Handler())
+	router.GET("/health/deep", deepHealth.Handler())
+	router.GET("/metrics", metrics.Handler())                          // Prometheus scrape endpoint
+	router.POST("/anonymize", certs.RequireClient(), anonymizeHandler) // Handler now uses the client
+	router.POST("/anonymize/stream", certs.RequireClient(), anonymizeStreamHandler)
+	// Configuration in effect, secrets redacted; only served to callers with a
+	// client certificate, so not at all without mTLS
+	if certs != nil {
+		router.GET("/config", certs.RequireClient(), settings.Handler())
+	}
+
+	// --- Start Server ---
+	slog.Info("Anonymizer Service starting", "port", cfg.Port, "ai_coordinator_url", aiCoordinatorURL, "mtls", cfg.MTLS.Enabled, "shutdown_grace_period", serverConfig.GracePeriod.String())
+	ctx, stop := server.NotifyContext() // Drain in-flight requests on SIGINT or SIGTERM
+	defer stop()
+	go settings.Watch(ctx, config.WatchInterval) // Reload on SIGHUP or when the file changes
+	go certs.Watch(ctx, mtls.WatchInterval)      // Reload rotated certificates
+	if err := httpServer.Serve(ctx, router); err != nil {
+		logging.Fatal("Anonymizer Service stopped", "error", err)
 	}
 }
 
-// healthCheckHandler remains the same
+// serviceName identifies the service in health reports
+const serviceName = "Anonymizer Service"
+
+// healthCheckHandler remains the same. It does not check the AI Coordinator;
+// /readyz does.
 func healthCheckHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": "Anonymizer Service"})
+	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": serviceName})
+}
+
+// newHealthCheckers builds the readiness and deep checks; both need the AI
+// Coordinator
+func newHealthCheckers(cfg health.Config, aiCoordinatorURL string) (readiness, deep *health.Checker) {
+	readiness = health.NewChecker(serviceName, cfg.Timeout, cfg.CacheTTL)
+	readiness.Add("ai-coordinator", true, health.HTTPProbe(aiCoordinatorURL+"/livez"))
+	deep = health.NewChecker(serviceName, cfg.DeepTimeout, cfg.CacheTTL)
+	deep.Add("ai-coordinator", true, health.HTTPProbe(aiCoordinatorURL+"/health/deep"))
+	return readiness, deep
+}
+
+// newResultCache builds the anonymization result cache, or returns nil when
+// the backend is "off". Results are kept in process memory ("memory") or
+// shared across replicas in Redis ("redis").
+func newResultCache(cfg CacheConfig) (*cache.Cache, error) {
+	var backend cache.Backend
+	name := strings.ToLower(cfg.Backend)
+	switch name {
+	case "off":
+		slog.Info("Result cache disabled")
+		return nil, nil
+	case "redis":
+		redisBackend := cache.NewRedisBackend(cfg.RedisAddr)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := redisBackend.Ping(ctx); err != nil {
+			// Not fatal: lookups miss and results go uncached until Redis becomes reachable
+			slog.Warn("Could not reach Redis for the result cache", "redis_addr", cfg.RedisAddr, "error", err)
+		}
+		backend = redisBackend
+		slog.Info("Result cache configured", "backend", name, "redis_addr", cfg.RedisAddr, "ttl", cfg.TTL.String())
+	default:
+		backend = cache.NewMemoryBackend(cfg.MaxEntries)
+		slog.Info("Result cache configured", "backend", name, "max_entries", cfg.MaxEntries, "ttl", cfg.TTL.String())
+	}
+	return cache.New(backend, name, cfg.EncryptionKey, cfg.PolicyVersion, cfg.TTL)
 }
 
 // anonymizeHandler processes the anonymization request using the AI Coordinator Client
@@ -70,30 +201,106 @@ func anonymizeHandler(c *gin.Context) {
 	var req AnonymizeRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		slog.InfoContext(c.Request.Context(), "Invalid anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
 		return
 	}
 
+	// --- Result Cache ---
+	mode := cache.Mode(req.Cache)
+	cacheReq := cache.Request{Text: req.Text, Model: req.Model, Owner: req.Owner}
+	if resultCache != nil {
+		switch mode {
+		case cache.ModeBypass:
+			cache.Observe(resultCache.Name(), cache.ResultBypass)
+		case cache.ModeRefresh:
+			cache.Observe(resultCache.Name(), cache.ResultRefresh)
+		default:
+			if entry, ok := resultCache.Get(c.Request.Context(), cacheReq); ok {
+				cache.Observe(resultCache.Name(), cache.ResultHit)
+				slog.DebugContext(c.Request.Context(), "Anonymization served from cache", "model", entry.ModelUsed)
+				c.JSON(http.StatusOK, AnonymizeResponse{OriginalText: req.Text, AnonymizedText: entry.AnonymizedText, Cached: true})
+				return
+			}
+			cache.Observe(resultCache.Name(), cache.ResultMiss)
+		}
+	}
+	// --------------------------
+
 	// --- Call AI Coordinator ---
-	log.Printf("Anonymizer Service: Requesting anonymization from AI Coordinator for text.")
-	anonymizeResult, err := aiCoordClient.RequestAnonymization(req.Text)
+	slog.DebugContext(c.Request.Context(), "Requesting anonymization from AI coordinator", "text_length", len(req.Text))
+	anonymizeResult, err := aiCoordClient.RequestAnonymization(c.Request.Context(), req.Text, req.Model)
 	if err != nil {
-		log.Printf("Anonymizer Service: Error calling AI Coordinator: %v", err)
-		// Respond with a server error if the coordinator call failed
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process anonymization request via AI Coordinator"})
+		slog.WarnContext(c.Request.Context(), "Anonymization failed", "error", err)
+		// Downstream errors keep their code and origin (e.g. model_not_found from the adapter)
+		apierror.RespondError(c, err, "Failed to process anonymization request via AI Coordinator")
 		return
 	}
 	// --------------------------
 
+	if resultCache != nil && mode != cache.ModeBypass {
+		resultCache.Put(c.Request.Context(), cacheReq, cache.Entry{
+			AnonymizedText: anonymizeResult.AnonymizedText,
+			ModelUsed:      anonymizeResult.ModelUsed,
+			PromptVersion:  anonymizeResult.PromptVersion,
+		})
+	}
+
 	resp := AnonymizeResponse{
 		OriginalText:   req.Text,
 		AnonymizedText: anonymizeResult.AnonymizedText, // Use result from coordinator
 	}
 
-	log.Printf("Anonymizer Service: Successfully processed anonymization request.")
+	slog.DebugContext(c.Request.Context(), "Anonymization succeeded")
 	c.JSON(http.StatusOK, resp)
 }
 
+// anonymizeStreamHandler relays a streamed anonymization from the AI Coordinator
+// as newline-delimited JSON
+func anonymizeStreamHandler(c *gin.Context) {
+	var req AnonymizeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Requesting streamed anonymization from AI coordinator", "text_length", len(req.Text))
+
+	// Headers are sent with the first chunk, so a failure before any output
+	// is returned with its own status
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	relay := func(chunk clients.StreamChunk) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(chunk); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	if err := aiCoordClient.RequestAnonymizationStream(c.Request.Context(), req.Text, req.Model, relay); err != nil {
+		slog.WarnContext(c.Request.Context(), "Streaming anonymization failed", "error", err)
+		if !started {
+			apierror.RespondError(c, err, "Failed to process anonymization request via AI Coordinator")
+			return
+		}
+		apiErr, ok := apierror.As(err)
+		if !ok {
+			apiErr = apierror.Internal("Failed to process anonymization request via AI Coordinator")
+		}
+		_ = relay(clients.StreamChunk{Error: apierror.ForRequest(c, apierror.Propagate(apiErr))})
+		return
+	}
+	slog.DebugContext(c.Request.Context(), "Finished streaming anonymization")
+}
+
 // Remove the old placeholder function:
 // func performSimpleAnonymization(text string) string { ... }
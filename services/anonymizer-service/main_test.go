@@ -2,15 +2,46 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"privacypilot-anonymizer-service/internal/cache"
 	"privacypilot-anonymizer-service/internal/clients"
 
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // --- Mock AI Coordinator Setup ---
@@ -57,11 +88,14 @@ func setupAnonymizerRouterWithMocks(coordURL string) *gin.Engine {
 
 	// Create client pointing to mock server
 	aiCoordClient = clients.NewAICoordinatorClient(coordURL) // Assign to global for handler to use
+	resultCache = nil                                        // Tests that cache set their own
 
 	// Setup router (as before)
 	router := gin.New()
+	router.Use(requestid.Middleware(), logging.AccessLog(), logging.Recovery(), budget.NewPolicy(budget.DefaultConfig()).Middleware())
 	router.GET("/health", healthCheckHandler)
 	router.POST("/anonymize", anonymizeHandler)
+	router.POST("/anonymize/stream", anonymizeStreamHandler)
 	return router
 }
 
@@ -86,6 +120,49 @@ func TestAnonymizerHealthCheckRoute(t *testing.T) {
 	assert.Equal(t, "Anonymizer Service", responseBody["service"])
 }
 
+func TestAnonymizerReadinessChecksCoordinator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	coordinatorUp := true
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/livez", r.URL.Path)
+		if !coordinatorUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"OK","service":"AI Coordinator Service"}`))
+	}))
+	defer mockServer.Close()
+
+	// No caching, so every request probes the coordinator
+	readiness, _ := newHealthCheckers(health.Config{Timeout: time.Second, DeepTimeout: time.Second}, mockServer.URL)
+	router := gin.New()
+	router.GET("/readyz", readiness.Handler())
+	router.GET("/livez", health.LiveHandler(serviceName))
+
+	get := func(path string) (int, health.Report) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var report health.Report
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		return rr.Code, report
+	}
+
+	status, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "AI Coordinator Service", report.Checks["ai-coordinator"].Service)
+
+	coordinatorUp = false
+	status, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Equal(t, "answered 503", report.Checks["ai-coordinator"].Error)
+
+	// Liveness does not depend on the coordinator
+	status, report = get("/livez")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+}
+
 func TestAnonymizeHandler_Success(t *testing.T) {
 	// Input to the anonymizer service endpoint
 	inputText := "Contact me at test@example.com or call 123456789."
@@ -131,7 +208,11 @@ func TestAnonymizeHandler_CoordinatorError(t *testing.T) {
 	expectedCoordTaskType := clients.TaskTypeAnonymizeText
 
 	// 1. Setup Mock AI Coordinator to return an error (e.g., internal server error)
-	mockErrorResponse := clients.AICoordinatorResponse{Success: false, Error: "AI Model Failed"}
+	mockErrorResponse := clients.AICoordinatorResponse{Success: false, Error: &apierror.Error{
+		Code:    apierror.CodeUpstreamError,
+		Message: "AI Model Failed",
+		Service: "ollama-adapter",
+	}}
 	mockServer := setupMockAICoordinatorServer(t, expectedCoordTaskType, expectedCoordPayload, mockErrorResponse, http.StatusInternalServerError) // Or OK status with Success=false
 	defer mockServer.Close()
 
@@ -145,12 +226,130 @@ func TestAnonymizeHandler_CoordinatorError(t *testing.T) {
 	router.ServeHTTP(rr, req)
 
 	// 4. Assertions
-	// Anonymizer should return an internal server error if coordinator fails
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	var errorResponse map[string]string
+	// A downstream server error becomes 502; code, message and origin are kept
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	var errorResponse apierror.Envelope
 	err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
 	assert.NoError(t, err)
-	assert.Contains(t, errorResponse["error"], "Failed to process anonymization request via AI Coordinator")
+	if assert.NotNil(t, errorResponse.Error) {
+		assert.Equal(t, apierror.CodeUpstreamError, errorResponse.Error.Code)
+		assert.Equal(t, "AI Model Failed", errorResponse.Error.Message)
+		assert.Equal(t, "ollama-adapter", errorResponse.Error.Service)
+	}
+}
+
+func TestAnonymizeHandler_UnknownModelPropagates(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AICoordinatorRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		assert.Equal(t, "no-such-model", reqBody.Config["model"], "The model must be passed as a coordinator hint")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(clients.AICoordinatorResponse{Success: false, Error: &apierror.Error{
+			Code:    apierror.CodeModelNotFound,
+			Message: "Model 'no-such-model' is not available on the Ollama server",
+			Service: "ollama-adapter",
+		}})
+	}))
+	defer mockServer.Close()
+
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", bytes.NewBufferString(`{"text": "Hello", "model": "no-such-model"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	var errorResponse apierror.Envelope
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResponse))
+	if assert.NotNil(t, errorResponse.Error) {
+		assert.Equal(t, apierror.CodeModelNotFound, errorResponse.Error.Code)
+		assert.Equal(t, "ollama-adapter", errorResponse.Error.Service)
+		assert.False(t, errorResponse.Error.Retryable)
+	}
+}
+
+func TestAnonymizeHandler_ForwardsRequestID(t *testing.T) {
+	var seen string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(requestid.Header)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mockCoordinatorResponseAnonymizeOK)
+	}))
+	defer mockServer.Close()
+
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", bytes.NewBufferString(`{"text": "Hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestid.Header, "gw-req-7")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gw-req-7", rr.Header().Get(requestid.Header))
+	assert.Equal(t, "gw-req-7", seen, "The request ID must be forwarded to the AI Coordinator")
+}
+
+func TestAnonymizeHandler_ForwardsWhatIsLeftOfTheBudget(t *testing.T) {
+	var seen string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(budget.Header)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mockCoordinatorResponseAnonymizeOK)
+	}))
+	defer mockServer.Close()
+
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", bytes.NewBufferString(`{"text": "Hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(budget.Header, "3000")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	forwarded, err := strconv.Atoi(seen)
+	assert.NoError(t, err)
+	margin := budget.DefaultConfig().Margin.Milliseconds()
+	assert.True(t, forwarded > 2000 && forwarded <= 3000-int(margin), "Forwarded a budget of %dms out of 3000ms", forwarded)
+}
+
+func TestAnonymizeHandler_ContinuesTrace(t *testing.T) {
+	var traceparent string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mockCoordinatorResponseAnonymizeOK)
+	}))
+	defer mockServer.Close()
+
+	_, err := telemetry.Setup(context.Background()) // Installs W3C propagation
+	assert.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	gin.SetMode(gin.TestMode)
+	aiCoordClient = clients.NewAICoordinatorClient(mockServer.URL)
+	router := gin.New()
+	router.Use(telemetry.Middleware())
+	router.POST("/anonymize", anonymizeHandler)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", bytes.NewBufferString(`{"text": "Hello Bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, recorder.Ended(), 2, "Expected a server span and a client span")
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+	}
+	assert.Contains(t, traceparent, traceID, "The trace context must be forwarded to the AI Coordinator")
 }
 
 // TestAnonymizeHandler_BadRequest remains the same as before, testing input validation
@@ -171,6 +370,12 @@ func TestAnonymizeHandler_BadRequest(t *testing.T) {
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var errorResponse apierror.Envelope
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResponse))
+	if assert.NotNil(t, errorResponse.Error) {
+		assert.Equal(t, apierror.CodeInvalidRequest, errorResponse.Error.Code)
+		assert.Equal(t, servicekit.Name(), errorResponse.Error.Service)
+	}
 
 	// 4. Perform Request with missing field
 	missingFieldJSON := `{}`
@@ -180,3 +385,397 @@ func TestAnonymizeHandler_BadRequest(t *testing.T) {
 	router.ServeHTTP(rrMissing, reqMissing)
 	assert.Equal(t, http.StatusBadRequest, rrMissing.Code)
 }
+
+func TestAnonymizeStreamHandler_RetriesOnlyBeforeTheStreamStarts(t *testing.T) {
+	calls := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: &apierror.Error{Code: apierror.CodeShuttingDown, Message: "draining", Retryable: true, Service: clients.AICoordinatorServiceName}})
+			return
+		}
+		// The stream breaks off after its first chunk
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_ = json.NewEncoder(w).Encode(clients.StreamChunk{Token: "Hello "})
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer mockServer.Close()
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+	cfg := resilience.DefaultConfig()
+	cfg.InitialBackoff = time.Millisecond
+	aiCoordClient.Resilience.SetConfig(cfg)
+
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize/stream", strings.NewReader(`{"text": "Hello Jane"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"token":"Hello "`)
+		assert.Contains(t, lines[1], apierror.CodeUpstreamUnavailable)
+	}
+	assert.Equal(t, 2, calls, "Only the refused call may be retried")
+}
+
+// --- Mutual TLS Tests ---
+
+// testCA issues certificates in the layout pp-certs writes
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes tls.crt, tls.key and ca.crt for service to dir and returns
+// the settings that load them
+func (ca *testCA) issue(t *testing.T, dir, service string, serial int64) mtls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{mtls.IdentityURI(service)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	cfg := mtls.Config{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	assert.NoError(t, os.WriteFile(cfg.CAFile, ca.pem, 0o644))
+	assert.NoError(t, os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	assert.NoError(t, os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return cfg
+}
+
+func TestMTLS_APIRequiresAnAllowedClient(t *testing.T) {
+	mockCoord := setupMockAICoordinatorServer(t, "anonymize_text", map[string]string{"text": "Hello"}, mockCoordinatorResponseAnonymizeOK, http.StatusOK)
+	defer mockCoord.Close()
+	setupAnonymizerRouterWithMocks(mockCoord.URL)
+
+	ca := newTestCA(t)
+	cfg := ca.issue(t, t.TempDir(), "anonymizer-service", 1)
+	cfg.AllowedClients = defaultConfig().MTLS.AllowedClients
+	certs, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+	router := gin.New()
+	router.GET("/livez", health.LiveHandler(serviceName))
+	router.POST("/anonymize", certs.RequireClient(), anonymizeHandler)
+	srv := httptest.NewUnstartedServer(router)
+	srv.Listener = tls.NewListener(srv.Listener, certs.ServerConfig())
+	srv.Start()
+	defer srv.Close()
+	baseURL := "https://" + srv.Listener.Addr().String()
+
+	post := func(client *http.Client) (*http.Response, error) {
+		return client.Post(baseURL+"/anonymize", "application/json", strings.NewReader(`{"text": "Hello"}`))
+	}
+	clientAs := func(service string) *http.Client {
+		cfg := ca.issue(t, t.TempDir(), service, 2)
+		cfg.AllowedServers = []string{"anonymizer-service"}
+		certs, err := mtls.Load(cfg)
+		assert.NoError(t, err)
+		return &http.Client{Transport: certs.Transport()}
+	}
+
+	// Without a certificate, health checks pass but the API is closed
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := anonymous.Get(baseURL + "/livez")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp, err = post(anonymous)
+	if assert.NoError(t, err) {
+		var body apierror.Envelope
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, apierror.CodeUnauthorized, body.Error.Code)
+	}
+
+	// The gateway may call the API
+	resp, err = post(clientAs("api-gateway"))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Other services are refused during the handshake
+	_, err = post(clientAs("ollama-adapter"))
+	assert.Error(t, err)
+}
+
+// --- Logging Tests ---
+
+// logCanary is fake PII that must never reach the logs
+const logCanary = "Jane CANARY-7f3a9c Doe, jane.canary@example.com, +1 555 0199"
+
+func TestLogging_CanaryPIINeverLogged(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&logs, slog.LevelDebug))
+	defer slog.SetDefault(previous)
+
+	// The coordinator echoes the text, and fails with it in the message when it contains "fail"
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Payload struct {
+				Text string `json:"text"`
+			} `json:"payload"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&reqBody)
+		text := reqBody.Payload.Text
+		assert.Contains(t, text, "CANARY-7f3a9c", "Mock: the canary should reach the coordinator")
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(text, "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(clients.AICoordinatorResponse{Error: apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Cannot process: "+text)})
+			return
+		}
+		if r.URL.Path == "/process/stream" {
+			_ = json.NewEncoder(w).Encode(clients.StreamChunk{Token: text})
+			_ = json.NewEncoder(w).Encode(clients.StreamChunk{Done: true})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AICoordinatorResponse{Success: true, Result: map[string]string{"anonymized_text": text}})
+	}))
+	defer mockServer.Close()
+
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+	router.GET("/panic", func(c *gin.Context) { panic("processing " + logCanary) })
+
+	canary, _ := json.Marshal(logCanary)
+	failing, _ := json.Marshal(logCanary + " fail")
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodGet, "/health?q=" + logCanary, ""},
+		{http.MethodGet, "/panic", ""},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s, "model": 42}`, canary)},
+		{http.MethodPost, "/anonymize", fmt.Sprintf(`{"text": %s`, canary)},
+		{http.MethodPost, "/anonymize/stream", fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/anonymize/stream", fmt.Sprintf(`{"text": %s}`, failing)},
+	} {
+		req, _ := http.NewRequest(r.method, strings.ReplaceAll(r.path, " ", "%20"), strings.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The access log names each route that was hit
+	output := logs.String()
+	for _, route := range router.Routes() {
+		assert.Contains(t, output, fmt.Sprintf(`"method":"%s","route":"%s"`, route.Method, route.Path), "Route %s %s was not exercised", route.Method, route.Path)
+	}
+	for _, fragment := range []string{"CANARY-7f3a9c", "jane.canary@example.com", "555 0199", "Jane"} {
+		assert.NotContains(t, output, fragment, "Canary PII leaked into the logs")
+	}
+	assert.Contains(t, output, `"service":"anonymizer-service"`)
+	assert.Contains(t, output, `"request_id":`)
+}
+
+// recordingBackend keeps every value stored in the cache, to check what
+// reaches a backend
+type recordingBackend struct {
+	*cache.MemoryBackend
+	stored map[string][]byte
+}
+
+func (b *recordingBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.stored[key] = value
+	return b.MemoryBackend.Set(ctx, key, value, ttl)
+}
+
+// setupCachingCoordinator mocks a coordinator that counts its anonymizations
+// and reports the model and prompt version like the Ollama adapter
+func setupCachingCoordinator(t *testing.T, promptVersion *string) (*httptest.Server, *int) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req clients.AICoordinatorRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		calls++
+		model := req.Config["model"]
+		if model == "" {
+			model = "mistral:7b"
+		}
+		_ = json.NewEncoder(w).Encode(clients.AICoordinatorResponse{Success: true, Result: map[string]string{
+			"anonymized_text": fmt.Sprintf("[REDACTED_NAME] call %d", calls),
+			"model_used":      model,
+			"prompt_version":  *promptVersion,
+		}})
+	}))
+	return server, &calls
+}
+
+func postAnonymize(router *gin.Engine, body string) (int, AnonymizeResponse) {
+	req, _ := http.NewRequest(http.MethodPost, "/anonymize", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var resp AnonymizeResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr.Code, resp
+}
+
+func TestAnonymizeHandler_CachesResults(t *testing.T) {
+	promptVersion := "anonymize-v1"
+	mockServer, calls := setupCachingCoordinator(t, &promptVersion)
+	defer mockServer.Close()
+	router := setupAnonymizerRouterWithMocks(mockServer.URL)
+	backend := &recordingBackend{MemoryBackend: cache.NewMemoryBackend(100), stored: map[string][]byte{}}
+	var err error
+	resultCache, err = cache.New(backend, "memory", "test-secret", "v1", time.Hour)
+	assert.NoError(t, err)
+	defer func() { resultCache = nil }()
+
+	status, resp := postAnonymize(router, `{"text": "Hi, I am Jane Doe"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 1, *calls)
+
+	// Normalized text hits, and the original text is echoed back
+	status, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe\r\n"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, resp.Cached)
+	assert.Equal(t, "Hi, I am Jane Doe\r\n", resp.OriginalText)
+	assert.Equal(t, "[REDACTED_NAME] call 1", resp.AnonymizedText)
+	assert.Equal(t, 1, *calls)
+
+	// The default model resolved to mistral:7b, so naming it hits too; another model misses
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "model": "mistral:7b"}`)
+	assert.True(t, resp.Cached)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "model": "llama3"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 2, *calls)
+
+	// Refresh skips the lookup and replaces the entry
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "cache": "refresh"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 3, *calls)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe"}`)
+	assert.True(t, resp.Cached)
+	assert.Equal(t, "[REDACTED_NAME] call 3", resp.AnonymizedText)
+
+	// Bypass neither reads nor stores
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "cache": "bypass"}`)
+	assert.False(t, resp.Cached)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am John Roe", "cache": "bypass"}`)
+	assert.False(t, resp.Cached)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am John Roe"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 6, *calls)
+
+	// Another caller misses on the entry, so it cannot tell the text was seen
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "owner": "tenant:a"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 7, *calls)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "owner": "tenant:a"}`)
+	assert.True(t, resp.Cached)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "owner": "tenant:b"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 8, *calls)
+
+	status, _ = postAnonymize(router, `{"text": "Hi, I am Jane Doe", "cache": "sometimes"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// A new prompt version stops older entries from matching
+	promptVersion = "anonymize-v2"
+	_, resp = postAnonymize(router, `{"text": "Hi, I am John Roe", "cache": "refresh"}`)
+	assert.False(t, resp.Cached)
+	_, resp = postAnonymize(router, `{"text": "Hi, I am Jane Doe"}`)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, 10, *calls)
+
+	// Neither keys nor values reveal the text
+	assert.NotEmpty(t, backend.stored)
+	for key, value := range backend.stored {
+		for _, plaintext := range []string{"Jane", "John", "REDACTED", "mistral"} {
+			assert.NotContains(t, key, plaintext)
+			assert.NotContains(t, string(value), plaintext)
+		}
+	}
+
+	// Another policy version or encryption key misses
+	for _, c := range []struct{ secret, policy string }{{"test-secret", "v2"}, {"other-secret", "v1"}} {
+		other, err := cache.New(backend, "memory", c.secret, c.policy, time.Hour)
+		assert.NoError(t, err)
+		other.Put(context.Background(), cache.Request{Text: "warm up"}, cache.Entry{AnonymizedText: "x", ModelUsed: "mistral:7b", PromptVersion: "anonymize-v2"})
+		_, ok := other.Get(context.Background(), cache.Request{Text: "Hi, I am Jane Doe"})
+		assert.False(t, ok, "policy %s", c.policy)
+	}
+}
+
+func TestCacheMemoryBackend_EvictsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	backend := cache.NewMemoryBackend(2)
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), time.Hour))
+	assert.NoError(t, backend.Set(ctx, "b", []byte("2"), time.Hour))
+	_, ok, _ := backend.Get(ctx, "a") // a is now the most recently used
+	assert.True(t, ok)
+	assert.NoError(t, backend.Set(ctx, "c", []byte("3"), time.Hour))
+
+	_, ok, _ = backend.Get(ctx, "b")
+	assert.False(t, ok, "The least recently used entry should be evicted")
+	value, ok, _ := backend.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+	assert.Equal(t, 2, backend.Len())
+
+	assert.NoError(t, backend.Set(ctx, "short", []byte("4"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, ok, _ = backend.Get(ctx, "short")
+	assert.False(t, ok, "Expired entries should miss")
+}
+
+func TestConfig_CacheSettings(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AICoordinator.URL = "http://ai-coordinator:8083"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Cache.Backend = "redis"
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "cache.redis_addr")
+	assert.ErrorContains(t, err, "cache.encryption_key")
+
+	cfg.Cache = CacheConfig{Backend: "disk", TTL: 0}
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, `cache.backend: unsupported backend "disk"`)
+	assert.ErrorContains(t, err, "cache.ttl")
+
+	cfg.Cache.Backend = "off"
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,43 @@
+// Command audit-verify checks the hash chain of a gateway audit log file.
+//
+//	audit-verify [-file path]
+//
+// It prints the verification result as JSON and exits with status 1 if the
+// chain is broken, or 2 if the file cannot be read.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"privacypilot-api-gateway/internal/audit"
+)
+
+func main() {
+	path := flag.String("file", os.Getenv("AUDIT_LOG_PATH"), "audit log file (defaults to $AUDIT_LOG_PATH)")
+	flag.Parse()
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "audit-verify: no audit log given (use -file or set AUDIT_LOG_PATH)")
+		os.Exit(2)
+	}
+
+	sink, err := audit.OpenFileSink(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit-verify: %v\n", err)
+		os.Exit(2)
+	}
+	result, err := audit.Verify(sink)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit-verify: %v\n", err)
+		os.Exit(2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(result)
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/clients"
+	"privacypilot-api-gateway/internal/handlers"
+	"privacypilot-api-gateway/internal/jobs"
+	"privacypilot-api-gateway/internal/openapi"
+	"privacypilot-api-gateway/internal/ratelimit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+)
+
+// Config is the gateway's configuration (see package config for the tags).
+// Hot settings are applied on reload by applySettings in main.
+type Config struct {
+	Port     string `config:"port" env:"PORT"`
+	GRPCPort string `config:"grpc_port" env:"GRPC_PORT"`
+	GinMode  string `config:"gin_mode" env:"GIN_MODE"`
+	LogLevel string `config:"log_level,hot" env:"LOG_LEVEL"`
+
+	Server      server.Config     `config:"server"`
+	Downstream  DownstreamConfig  `config:"downstream"`
+	RateLimit   RateLimitConfig   `config:"rate_limit"`
+	Idempotency IdempotencyConfig `config:"idempotency"`
+	Batch       BatchConfig       `config:"batch"`
+	Jobs        JobsConfig        `config:"jobs"`
+	Audit       AuditConfig       `config:"audit"`
+	Health      health.Config     `config:"health"`
+	Resilience  resilience.Config `config:"resilience,hot"` // Retries and circuit breakers of the downstream clients
+	Budget      budget.Config     `config:"budget,hot"`     // Time budgets of API requests, passed on to every service behind the gateway
+	MTLS        mtls.Config       `config:"mtls"`           // Mutual TLS towards the anonymizer and the coordinator
+
+	ProcessMode               string `config:"process_mode" env:"PROCESS_MODE"`                               // sequential or concurrent
+	OpenAPIResponseValidation string `config:"openapi_response_validation" env:"OPENAPI_RESPONSE_VALIDATION"` // off, log or enforce
+	PipelinesConfig           string `config:"pipelines_config" env:"PIPELINES_CONFIG"`                       // YAML file with the named pipelines
+	AdminAPIKeys              string `config:"admin_api_keys,secret" env:"ADMIN_API_KEYS"`                    // Comma-separated; none disables the admin API
+	AITaskKeys                string `config:"ai_task_keys,secret" env:"AI_TASK_KEYS"`                        // key=scopes entries, comma-separated; none disables /api/v1/ai/tasks
+	TenantKeys                string `config:"tenant_keys,secret" env:"TENANT_KEYS"`                          // key=tenant entries, comma-separated; keys without a tenant are limited per IP
+	DeanonymizeKey            string `config:"deanonymize_key,secret" env:"DEANONYMIZE_KEY"`                  // Seals deanonymize tokens; none disables reversible anonymization
+}
+
+// DownstreamConfig locates the services the gateway calls
+type DownstreamConfig struct {
+	AnonymizerURL           string        `config:"anonymizer_url" env:"ANONYMIZER_SERVICE_URL"`
+	ModerationURL           string        `config:"moderation_url" env:"MODERATION_SERVICE_URL"`
+	AICoordinatorURL        string        `config:"ai_coordinator_url" env:"AI_COORDINATOR_URL"` // Optional; only pipeline task steps and AI tasks call it
+	AnonymizerTimeout       time.Duration `config:"anonymizer_timeout,hot" env:"ANONYMIZER_TIMEOUT"`
+	AnonymizerStreamTimeout time.Duration `config:"anonymizer_stream_timeout,hot" env:"ANONYMIZER_STREAM_TIMEOUT"`
+	ModerationTimeout       time.Duration `config:"moderation_timeout,hot" env:"MODERATION_TIMEOUT"`
+	AICoordinatorTimeout    time.Duration `config:"ai_coordinator_timeout,hot" env:"AI_COORDINATOR_TIMEOUT"`
+}
+
+// RateLimitConfig selects the limiter backend and the per-route policies
+type RateLimitConfig struct {
+	Backend   string           `config:"backend" env:"RATE_LIMIT_BACKEND"` // memory or redis
+	RedisAddr string           `config:"redis_addr" env:"REDIS_ADDR"`
+	Anonymize ratelimit.Policy `config:"anonymize,hot" env:"ANONYMIZE"`
+	Moderate  ratelimit.Policy `config:"moderate,hot" env:"MODERATE"`
+}
+
+// IdempotencyConfig selects where Idempotency-Key responses are kept and for how long
+type IdempotencyConfig struct {
+	Backend       string        `config:"backend" env:"IDEMPOTENCY_BACKEND"` // memory or redis
+	RedisAddr     string        `config:"redis_addr" env:"REDIS_ADDR"`
+	TTL           time.Duration `config:"ttl,hot" env:"IDEMPOTENCY_TTL"`                          // How long responses are replayed
+	LockTimeout   time.Duration `config:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`            // Frees keys of requests that never finished
+	EncryptionKey string        `config:"encryption_key,secret" env:"IDEMPOTENCY_ENCRYPTION_KEY"` // Random per process when unset (memory only)
+}
+
+// BatchConfig limits batch anonymization
+type BatchConfig struct {
+	Concurrency int `config:"concurrency" env:"ANONYMIZE_BATCH_CONCURRENCY"` // Callers may request less
+	MaxItems    int `config:"max_items" env:"ANONYMIZE_BATCH_MAX_ITEMS"`
+}
+
+// JobsConfig controls async jobs
+type JobsConfig struct {
+	Workers                 int           `config:"workers" env:"JOBS_WORKERS"`
+	QueueSize               int           `config:"queue_size" env:"JOBS_QUEUE_SIZE"`
+	ResultTTL               time.Duration `config:"result_ttl" env:"JOBS_RESULT_TTL"`
+	Timeout                 time.Duration `config:"timeout" env:"JOBS_TIMEOUT"`
+	WebhookSecret           string        `config:"webhook_secret,secret" env:"JOBS_WEBHOOK_SECRET"`                // Callbacks are disabled without one
+	CallbackPrivateNetworks bool          `config:"callback_private_networks" env:"JOBS_CALLBACK_PRIVATE_NETWORKS"` // Lets callbacks reach private, loopback and link-local addresses
+}
+
+// AuditConfig controls the audit log
+type AuditConfig struct {
+	LogPath       string `config:"log_path" env:"AUDIT_LOG_PATH"` // Records are only kept in memory without one
+	PolicyVersion string `config:"policy_version" env:"AUDIT_POLICY_VERSION"`
+	HashKey       string `config:"hash_key,secret" env:"AUDIT_HASH_KEY"`
+}
+
+// defaultConfig returns the settings used when neither the file nor the
+// environment sets them
+func defaultConfig() Config {
+	jobDefaults := jobs.DefaultConfig()
+	return Config{
+		Port:     "8080",
+		GRPCPort: "8090",
+		GinMode:  "debug",
+		LogLevel: "info",
+		Server:   server.DefaultConfig(),
+		Downstream: DownstreamConfig{
+			AnonymizerTimeout:       clients.DefaultAnonymizerTimeout,
+			AnonymizerStreamTimeout: clients.DefaultAnonymizerStreamTimeout,
+			ModerationTimeout:       clients.DefaultModerationTimeout,
+			AICoordinatorTimeout:    clients.DefaultAICoordinatorTimeout,
+		},
+		RateLimit: RateLimitConfig{
+			Backend:   "memory",
+			Anonymize: ratelimit.DefaultAnonymizePolicy,
+			Moderate:  ratelimit.DefaultModeratePolicy,
+		},
+		Idempotency: IdempotencyConfig{
+			Backend:     "memory",
+			TTL:         24 * time.Hour,
+			LockTimeout: 2 * time.Minute,
+		},
+		Batch: BatchConfig{
+			Concurrency: handlers.DefaultBatchConcurrency,
+			MaxItems:    handlers.DefaultMaxBatchItems,
+		},
+		Jobs: JobsConfig{
+			Workers:   jobDefaults.Workers,
+			QueueSize: jobDefaults.QueueSize,
+			ResultTTL: jobDefaults.ResultTTL,
+			Timeout:   jobDefaults.JobTimeout,
+		},
+		Audit:      AuditConfig{PolicyVersion: audit.DefaultPolicyVersion},
+		Health:     health.DefaultConfig(8 * time.Second), // Above the anonymizer's, which waits for the coordinator and the adapter
+		Resilience: resilience.DefaultConfig(),
+		Budget: budget.Config{
+			Default: 60 * time.Second,
+			Routes:  []string{"/api/v1/anonymize/stream=80s"}, // Above the anonymizer's stream timeout
+			Max:     2 * time.Minute,
+			Margin:  250 * time.Millisecond,
+		},
+		MTLS:                      mtls.DefaultConfig(nil, []string{"anonymizer-service", "ai-coordinator", "moderation-service"}),
+		ProcessMode:               string(handlers.ProcessSequential),
+		OpenAPIResponseValidation: string(openapi.ResponseValidationLog),
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	if _, ok := logging.ParseLevel(c.LogLevel); !ok {
+		errs = append(errs, fmt.Errorf("log_level: unsupported level %q (expected debug, info, warn or error)", c.LogLevel))
+	}
+	errs = append(errs, c.Server.Validate())
+
+	errs = append(errs,
+		checkURL("downstream.anonymizer_url", "ANONYMIZER_SERVICE_URL", c.Downstream.AnonymizerURL, true),
+		checkURL("downstream.moderation_url", "MODERATION_SERVICE_URL", c.Downstream.ModerationURL, true),
+		checkURL("downstream.ai_coordinator_url", "AI_COORDINATOR_URL", c.Downstream.AICoordinatorURL, false),
+		checkPositive("downstream.anonymizer_timeout", c.Downstream.AnonymizerTimeout),
+		checkPositive("downstream.anonymizer_stream_timeout", c.Downstream.AnonymizerStreamTimeout),
+		checkPositive("downstream.moderation_timeout", c.Downstream.ModerationTimeout),
+		checkPositive("downstream.ai_coordinator_timeout", c.Downstream.AICoordinatorTimeout),
+	)
+
+	switch strings.ToLower(c.RateLimit.Backend) {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisAddr == "" {
+			errs = append(errs, errors.New("rate_limit.redis_addr: required for the redis backend (REDIS_ADDR)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.backend: unsupported backend %q (expected memory or redis)", c.RateLimit.Backend))
+	}
+	errs = append(errs, c.RateLimit.Anonymize.Validate(), c.RateLimit.Moderate.Validate())
+
+	switch strings.ToLower(c.Idempotency.Backend) {
+	case "memory":
+	case "redis":
+		if c.Idempotency.RedisAddr == "" {
+			errs = append(errs, errors.New("idempotency.redis_addr: required for the redis backend (REDIS_ADDR)"))
+		}
+		// Responses outlive the process in Redis and are shared between
+		// replicas, so they need a key every replica knows
+		if c.Idempotency.EncryptionKey == "" {
+			errs = append(errs, errors.New("idempotency.encryption_key: required for the redis backend (IDEMPOTENCY_ENCRYPTION_KEY)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("idempotency.backend: unsupported backend %q (expected memory or redis)", c.Idempotency.Backend))
+	}
+	errs = append(errs, checkPositive("idempotency.ttl", c.Idempotency.TTL))
+	// A key must stay reserved while its request can still be running
+	if c.Idempotency.LockTimeout < c.Server.WriteTimeout {
+		errs = append(errs, fmt.Errorf("idempotency.lock_timeout: must be at least server.write_timeout (%s)", c.Server.WriteTimeout))
+	}
+
+	if c.Batch.Concurrency < 1 {
+		errs = append(errs, errors.New("batch.concurrency: must be at least 1"))
+	}
+	if c.Batch.MaxItems < 1 {
+		errs = append(errs, errors.New("batch.max_items: must be at least 1"))
+	}
+	if c.Jobs.Workers < 1 {
+		errs = append(errs, errors.New("jobs.workers: must be at least 1"))
+	}
+	if c.Jobs.QueueSize < 1 {
+		errs = append(errs, errors.New("jobs.queue_size: must be at least 1"))
+	}
+	errs = append(errs, checkPositive("jobs.result_ttl", c.Jobs.ResultTTL), checkPositive("jobs.timeout", c.Jobs.Timeout))
+	errs = append(errs, c.Health.Validate(), c.Resilience.Validate(), c.Budget.Validate(), c.MTLS.Validate())
+
+	if _, ok := handlers.ParseProcessMode(c.ProcessMode); !ok {
+		errs = append(errs, fmt.Errorf("process_mode: unsupported mode %q (expected sequential or concurrent)", c.ProcessMode))
+	}
+	if _, ok := openapi.ParseResponseMode(c.OpenAPIResponseValidation); !ok {
+		errs = append(errs, fmt.Errorf("openapi_response_validation: unsupported mode %q (expected off, log or enforce)", c.OpenAPIResponseValidation))
+	}
+	errs = append(errs, checkAITaskKeys(c.AITaskKeys))
+	if _, err := auth.ParseTenantKeys(c.TenantKeys); err != nil {
+		errs = append(errs, fmt.Errorf("tenant_keys: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkAITaskKeys reports malformed AI task key entries and unknown scopes.
+// Keys are named by their fingerprint, never quoted.
+func checkAITaskKeys(value string) error {
+	keys, err := auth.ParseScopedKeys(value)
+	if err != nil {
+		return fmt.Errorf("ai_task_keys: %w", err)
+	}
+	known := map[string]bool{handlers.AITaskScope("*"): true}
+	for _, t := range handlers.AITaskTypes() {
+		known[handlers.AITaskScope(t)] = true
+	}
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		for _, scope := range keys[key] {
+			if !known[scope] {
+				errs = append(errs, fmt.Errorf("ai_task_keys: key %s: unknown scope %q (expected ai:* or ai:<task type>)", auth.Fingerprint(key), scope))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkURL reports a missing (if required) or malformed service URL
+func checkURL(key, env, value string, required bool) error {
+	if value == "" {
+		if required {
+			return fmt.Errorf("%s: required (%s)", key, env)
+		}
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s: expected an absolute URL such as http://host:port, got %q", key, value)
+	}
+	return nil
+}
+
+func checkPositive(key string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s: must be positive", key)
+	}
+	return nil
+}
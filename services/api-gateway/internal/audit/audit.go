@@ -0,0 +1,273 @@
+// Package audit keeps a tamper-evident record of every privacy operation the
+// gateway performs: who (principal and tenant) called which route, with which
+// model and policy version, how many entities of each type were anonymized,
+// and hashes of the input and output. Raw text is never recorded.
+//
+// Records are hash-chained: each carries the hash of its predecessor and a
+// hash over its own content, so editing, removing or reordering records breaks
+// the chain and is reported by Verify.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the log. Job submissions are recorded as the action
+// of their job type; ActionJob is only used when the type is not known.
+const (
+	ActionAnonymize   = "anonymize"
+	ActionDeanonymize = "deanonymize" // Original values put back from a reversible anonymization
+	ActionModerate    = "moderate"
+	ActionProcess     = "process" // Moderation and anonymization in one call
+	ActionPipeline    = "pipeline"
+	ActionAITask      = "ai_task" // A task run directly on the AI coordinator
+	ActionJob         = "job"
+	ActionAdmin       = "admin"
+)
+
+// DefaultPolicyVersion is recorded when no policy version is configured
+const DefaultPolicyVersion = "v1"
+
+// GenesisHash is the PrevHash of the first record in a log
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Record is one audit log entry
+type Record struct {
+	Seq           uint64         `json:"seq"`
+	Time          time.Time      `json:"time"`
+	RequestID     string         `json:"request_id,omitempty"`
+	Action        string         `json:"action"`
+	Principal     string         `json:"principal"`
+	Tenant        string         `json:"tenant,omitempty"`
+	Method        string         `json:"method"`
+	Route         string         `json:"route"`
+	Status        int            `json:"status"`
+	Model         string         `json:"model,omitempty"`
+	PolicyVersion string         `json:"policy_version"`
+	EntityCounts  map[string]int `json:"entity_counts,omitempty"`
+	InputHash     string         `json:"input_hash,omitempty"`
+	OutputHash    string         `json:"output_hash,omitempty"`
+	JobID         string         `json:"job_id,omitempty"`
+	PrevHash      string         `json:"prev_hash"`
+	Hash          string         `json:"hash"`
+}
+
+// computeHash hashes the record's content, including PrevHash but not Hash.
+// encoding/json writes struct fields in declaration order and map keys
+// sorted, so the encoding is stable.
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Config controls how records are written
+type Config struct {
+	// PolicyVersion identifies the anonymization policy in force, so records
+	// can be matched to the rules that applied when they were written
+	PolicyVersion string
+	// HashKey, if set, keys the input/output hashes (HMAC-SHA256) so short
+	// inputs such as phone numbers cannot be recovered by brute force
+	HashKey []byte
+}
+
+// Log appends hash-chained records to a Sink
+type Log struct {
+	sink     Sink
+	cfg      Config
+	mu       sync.Mutex
+	lastSeq  uint64
+	lastHash string
+	now      func() time.Time
+}
+
+// NewLog continues the chain already stored in sink
+func NewLog(sink Sink, cfg Config) (*Log, error) {
+	l := &Log{sink: sink, cfg: cfg, lastHash: GenesisHash, now: time.Now}
+	err := sink.Scan(func(r *Record) bool {
+		l.lastSeq, l.lastHash = r.Seq, r.Hash
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing audit records: %w", err)
+	}
+	return l, nil
+}
+
+// Sink returns the sink records are written to
+func (l *Log) Sink() Sink {
+	return l.sink
+}
+
+// Append chains rec onto the log and writes it. Seq, Time, PolicyVersion,
+// PrevHash and Hash are filled in.
+func (l *Log) Append(rec Record) (*Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.lastSeq + 1
+	rec.Time = l.now().UTC()
+	rec.PolicyVersion = l.cfg.PolicyVersion
+	rec.PrevHash = l.lastHash
+	h, err := rec.computeHash()
+	if err != nil {
+		return nil, err
+	}
+	rec.Hash = h
+	if err := l.sink.Append(&rec); err != nil {
+		return nil, err
+	}
+	l.lastSeq, l.lastHash = rec.Seq, rec.Hash
+	return &rec, nil
+}
+
+// HashTexts digests one or more texts as "sha256:<hex>", or
+// "hmac-sha256:<hex>" when a hash key is configured. Each text is
+// length-prefixed so that different splits of the same characters differ.
+func (l *Log) HashTexts(texts ...string) string {
+	var h hash.Hash
+	prefix := "sha256:"
+	if len(l.cfg.HashKey) > 0 {
+		h = hmac.New(sha256.New, l.cfg.HashKey)
+		prefix = "hmac-sha256:"
+	} else {
+		h = sha256.New()
+	}
+	var n [8]byte
+	for _, t := range texts {
+		binary.BigEndian.PutUint64(n[:], uint64(len(t)))
+		h.Write(n[:])
+		h.Write([]byte(t))
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// placeholderPattern matches the placeholders anonymized text uses, e.g.
+// [EMAIL], or [EMAIL_2] in reversible anonymizations
+var placeholderPattern = regexp.MustCompile(`\[([A-Z][A-Z_]*?)(?:_[1-9][0-9]*)?\]`)
+
+// knownEntityTypes are the placeholders the anonymization prompt asks for;
+// anything else is counted as OTHER
+var knownEntityTypes = map[string]bool{
+	"NAME": true, "EMAIL": true, "PHONE": true, "ADDRESS": true, "CREDIT_CARD": true, "SSN": true,
+}
+
+// entityType is the type an entity is counted as
+func entityType(placeholderType string) string {
+	if !knownEntityTypes[placeholderType] {
+		return "OTHER"
+	}
+	return placeholderType
+}
+
+// CountEntities counts the placeholders in anonymized texts by entity type
+func CountEntities(texts ...string) map[string]int {
+	counts := make(map[string]int)
+	for _, text := range texts {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			counts[entityType(m[1])]++
+		}
+	}
+	return counts
+}
+
+// Verification is the result of checking a chain
+type Verification struct {
+	Valid   bool   `json:"valid"`
+	Records uint64 `json:"records"`             // Records checked
+	BadSeq  uint64 `json:"bad_seq,omitempty"`   // First record that failed, if any
+	Reason  string `json:"reason,omitempty"`    // Why it failed
+	Head    string `json:"head_hash,omitempty"` // Hash of the last valid record
+}
+
+// Verify walks the records in sink and checks that sequence numbers are
+// contiguous, every record links to its predecessor and every hash matches
+// the record's content
+func Verify(sink Sink) (Verification, error) {
+	v := Verification{Valid: true, Head: GenesisHash}
+	prevHash := GenesisHash
+	var prevSeq uint64
+	err := sink.Scan(func(r *Record) bool {
+		fail := func(reason string) bool {
+			v.Valid, v.BadSeq, v.Reason = false, r.Seq, reason
+			return false
+		}
+		if r.Seq != prevSeq+1 {
+			return fail(fmt.Sprintf("expected seq %d, found %d", prevSeq+1, r.Seq))
+		}
+		if r.PrevHash != prevHash {
+			return fail("prev_hash does not match the previous record")
+		}
+		h, err := r.computeHash()
+		if err != nil || h != r.Hash {
+			return fail("hash does not match the record content")
+		}
+		v.Records++
+		prevSeq, prevHash = r.Seq, r.Hash
+		v.Head = r.Hash
+		return true
+	})
+	if errors.Is(err, ErrCorrupt) {
+		v.Valid, v.BadSeq, v.Reason = false, prevSeq+1, err.Error()
+		return v, nil
+	}
+	return v, err
+}
+
+// Filter selects records in Query. Zero fields match everything.
+type Filter struct {
+	Principal string
+	Tenant    string
+	Action    string
+	Route     string
+	Since     time.Time // Inclusive
+	Until     time.Time // Exclusive
+	AfterSeq  uint64    // Only records after this sequence number, for paging
+}
+
+func (f Filter) matches(r *Record) bool {
+	switch {
+	case r.Seq <= f.AfterSeq,
+		f.Principal != "" && r.Principal != f.Principal,
+		f.Tenant != "" && r.Tenant != f.Tenant,
+		f.Action != "" && r.Action != f.Action,
+		f.Route != "" && r.Route != f.Route,
+		!f.Since.IsZero() && r.Time.Before(f.Since),
+		!f.Until.IsZero() && !r.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns up to limit records matching f, oldest first, and whether
+// more matching records follow
+func Query(sink Sink, f Filter, limit int) ([]Record, bool, error) {
+	records := []Record{}
+	more := false
+	err := sink.Scan(func(r *Record) bool {
+		if !f.matches(r) {
+			return true
+		}
+		if len(records) == limit {
+			more = true
+			return false
+		}
+		records = append(records, *r)
+		return true
+	})
+	return records, more, err
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+
+	"privacypilot-api-gateway/internal/auth"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// detailsKey stores the *details of the current request in its context
+type detailsKey struct{}
+
+// details are what handlers add to a request's record. Texts are hashed as
+// soon as they are reported, so no raw text is held on to.
+type details struct {
+	log          *Log
+	action       string
+	model        string
+	inputHash    string
+	outputHash   string
+	entityCounts map[string]int
+	jobID        string
+}
+
+func current(ctx context.Context) *details {
+	d, _ := ctx.Value(detailsKey{}).(*details)
+	return d
+}
+
+// Begin starts the record of a request. Handlers add to it through the
+// returned context (see Input and the other helpers); end writes it, with
+// rec supplying what only the transport knows: request ID, caller, method,
+// route and status.
+func (l *Log) Begin(ctx context.Context, action string) (context.Context, func(rec Record)) {
+	d := &details{log: l, action: action}
+	end := func(rec Record) {
+		rec.Action = d.action
+		rec.Model = d.model
+		rec.EntityCounts = d.entityCounts
+		rec.InputHash = d.inputHash
+		rec.OutputHash = d.outputHash
+		rec.JobID = d.jobID
+		if _, err := l.Append(rec); err != nil {
+			slog.ErrorContext(ctx, "Failed to write audit record", "action", rec.Action, "route", rec.Route, "error", err)
+		}
+	}
+	return context.WithValue(ctx, detailsKey{}, d), end
+}
+
+// Middleware writes one record for every request to the route, whatever its
+// outcome, after the handler has run. It must come before any middleware that
+// can reject the request (authorization, rate limiting) so rejected calls are
+// recorded too.
+func (l *Log) Middleware(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l.record(c, action)
+	}
+}
+
+// MiddlewareByRoute is Middleware for a group of routes, recording each
+// request as the action its route (full path) has in actions. Requests to
+// other routes are not recorded. Registered on the group ahead of the group's
+// other middleware, it records the requests that middleware rejects too.
+func (l *Log) MiddlewareByRoute(actions map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := actions[c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		l.record(c, action)
+	}
+}
+
+// record runs the rest of the chain and writes the request's record
+func (l *Log) record(c *gin.Context, action string) {
+	ctx, end := l.Begin(c.Request.Context(), action)
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	end(Record{
+		RequestID: requestid.FromContext(ctx),
+		Principal: auth.Principal(c),
+		Tenant:    auth.Tenant(c),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Status:    c.Writer.Status(),
+	})
+}
+
+// Input records the hash of the text(s) a request submitted
+func Input(ctx context.Context, texts ...string) {
+	if d := current(ctx); d != nil {
+		d.inputHash = d.log.HashTexts(texts...)
+	}
+}
+
+// Output records the hash of the anonymized text(s) returned and counts their
+// entities by type
+func Output(ctx context.Context, texts ...string) {
+	if d := current(ctx); d != nil {
+		d.outputHash = d.log.HashTexts(texts...)
+		if counts := CountEntities(texts...); len(counts) > 0 {
+			d.entityCounts = counts
+		}
+	}
+}
+
+// Restored records the hash of a deanonymized text and counts the entities
+// put back into it, given by placeholder type
+func Restored(ctx context.Context, text string, counts map[string]int) {
+	if d := current(ctx); d != nil {
+		d.outputHash = d.log.HashTexts(text)
+		if len(counts) > 0 {
+			d.entityCounts = make(map[string]int, len(counts))
+			for placeholderType, n := range counts {
+				d.entityCounts[entityType(placeholderType)] += n
+			}
+		}
+	}
+}
+
+// Verdict records the hash of a non-text result, such as a moderation verdict
+func Verdict(ctx context.Context, encoded []byte) {
+	if d := current(ctx); d != nil {
+		d.outputHash = d.log.HashTexts(string(encoded))
+	}
+}
+
+// Model records the model that served the request; empty means the default
+func Model(ctx context.Context, model string) {
+	if d := current(ctx); d != nil {
+		d.model = model
+	}
+}
+
+// Job records the ID of the job a request submitted
+func Job(ctx context.Context, id string) {
+	if d := current(ctx); d != nil {
+		d.jobID = id
+	}
+}
+
+// Action overrides the action recorded for the request, e.g. with the type of
+// a submitted job
+func Action(ctx context.Context, action string) {
+	if d := current(ctx); d != nil {
+		d.action = action
+	}
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrCorrupt is wrapped by Scan errors for records that cannot be decoded
+var ErrCorrupt = errors.New("corrupt audit record")
+
+// Sink stores audit records. Implementations only ever append.
+type Sink interface {
+	// Append durably stores a record after the previous one
+	Append(rec *Record) error
+	// Scan calls fn for every record in order until fn returns false
+	Scan(fn func(*Record) bool) error
+}
+
+// FileSink stores records as JSON lines in an append-only file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (creating if needed) the audit file at path
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileSink{path: path, file: f}, nil
+}
+
+// OpenFileSink opens an existing audit file for reading only, e.g. to verify it
+func OpenFileSink(path string) (*FileSink, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileSink{path: path}, nil
+}
+
+// Append writes the record as one line and syncs it to disk
+func (s *FileSink) Append(rec *Record) error {
+	if s.file == nil {
+		return errors.New("audit log is opened read-only")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Scan reads the file from the start
+func (s *FileSink) Scan(fn func(*Record) bool) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%w at line %d", ErrCorrupt, line)
+		}
+		if !fn(&rec) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// MemorySink keeps records in memory. Records are lost on restart, so it is
+// only meant for development and tests.
+type MemorySink struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+// NewMemorySink creates an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Append stores a copy of the record
+func (s *MemorySink) Append(rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, *rec)
+	return nil
+}
+
+// Scan iterates over copies of the stored records
+func (s *MemorySink) Scan(fn func(*Record) bool) error {
+	s.mu.RLock()
+	records := s.records
+	s.mu.RUnlock()
+	for i := range records {
+		rec := records[i]
+		if !fn(&rec) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package auth identifies the caller of a request and guards the admin API
+// and the routes that need scoped API keys.
+//
+// Callers identify themselves with an X-API-Key header. The tenant a caller
+// acts for is never taken from the request: it is looked up from the key in
+// the configured tenant keys. API keys are never stored or logged: a principal
+// is named by a short fingerprint of its key.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"privacypilot-api-gateway/internal/bodylimit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderAPIKey carries the caller's API key
+const HeaderAPIKey = "X-API-Key"
+
+// Anonymous is the principal of requests without an API key
+const Anonymous = "anonymous"
+
+// tenantContextKey holds the tenant TenantKeys.Middleware resolved
+const tenantContextKey = "auth.tenant"
+
+// Principal names the caller: "key:<fingerprint>" for API key holders,
+// otherwise Anonymous
+func Principal(c *gin.Context) string {
+	return PrincipalForKey(c.GetHeader(HeaderAPIKey))
+}
+
+// PrincipalForKey names the holder of apiKey ("" for none), as Principal does
+func PrincipalForKey(apiKey string) string {
+	if apiKey != "" {
+		return "key:" + Fingerprint(apiKey)
+	}
+	return Anonymous
+}
+
+// Owner names who may read what the caller creates, such as jobs: the tenant
+// of its API key, otherwise the holder of the key. Callers without a key are
+// only told apart by IP address.
+func Owner(c *gin.Context) string {
+	return OwnerFor(Tenant(c), c.GetHeader(HeaderAPIKey), c.ClientIP())
+}
+
+// OwnerFor names the owner for a tenant and API key (either may be empty) and
+// IP address, as Owner does
+func OwnerFor(tenant, apiKey, ip string) string {
+	switch {
+	case tenant != "":
+		return "tenant:" + tenant
+	case apiKey != "":
+		return PrincipalForKey(apiKey)
+	default:
+		return Anonymous + "|ip:" + ip
+	}
+}
+
+// ownerContextKey holds the owner of a request's context
+type ownerContextKey struct{}
+
+// WithOwner returns a copy of ctx naming owner (see Owner) as the caller, for
+// work that outlives the gin context such as jobs and downstream calls
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerContextKey{}, owner)
+}
+
+// OwnerFromContext returns the owner WithOwner stored in ctx, or ""
+func OwnerFromContext(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerContextKey{}).(string)
+	return owner
+}
+
+// Tenant returns the tenant of the caller's API key, as resolved by
+// TenantKeys.Middleware, or "" if the key belongs to no tenant
+func Tenant(c *gin.Context) string {
+	return c.GetString(tenantContextKey)
+}
+
+// Fingerprint is a short, non-reversible identifier for an API key
+func Fingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParseKeys splits a comma-separated list of API keys, ignoring blanks
+func ParseKeys(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// AdminKeys holds the API keys allowed to use the admin API
+type AdminKeys struct {
+	digests [][32]byte
+}
+
+// NewAdminKeys keeps digests of keys. With no keys the admin API is disabled.
+func NewAdminKeys(keys []string) *AdminKeys {
+	a := &AdminKeys{digests: make([][32]byte, len(keys))}
+	for i, k := range keys {
+		a.digests[i] = sha256.Sum256([]byte(k))
+	}
+	return a
+}
+
+// Authorize returns nil if apiKey is an admin key, otherwise the error to
+// reject the request with
+func (a *AdminKeys) Authorize(apiKey string) *apierror.Error {
+	if len(a.digests) == 0 {
+		return apierror.New(http.StatusForbidden, apierror.CodeForbidden, "The admin API is disabled on this gateway")
+	}
+	if apiKey == "" {
+		return apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "An admin API key is required")
+	}
+	// Comparing fixed-size digests keeps the comparison constant-time regardless of key length
+	presented := sha256.Sum256([]byte(apiKey))
+	admin := 0
+	for _, d := range a.digests {
+		admin |= subtle.ConstantTimeCompare(presented[:], d[:])
+	}
+	if admin != 1 {
+		return apierror.New(http.StatusForbidden, apierror.CodeForbidden, "This API key is not allowed to use the admin API")
+	}
+	return nil
+}
+
+// RequireAdmin only lets requests through whose X-API-Key is one of adminKeys.
+// With no admin keys configured the admin API is disabled.
+func RequireAdmin(adminKeys []string) gin.HandlerFunc {
+	return NewAdminKeys(adminKeys).Middleware()
+}
+
+// Middleware only lets requests through whose X-API-Key is an admin key
+func (a *AdminKeys) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := a.Authorize(c.GetHeader(HeaderAPIKey)); err != nil {
+			apierror.Respond(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ScopedKeys holds API keys that are each granted a set of scopes, such as
+// "ai:anonymize_text". A scope ending in ":*" grants every scope with that
+// prefix.
+type ScopedKeys struct {
+	grants []grant
+}
+
+type grant struct {
+	digest [32]byte
+	scopes []string
+}
+
+// ParseScopedKeys parses a comma-separated list of key=scopes entries, where
+// scopes are separated by spaces, e.g. "k1=ai:anonymize_text,k2=ai:*"
+func ParseScopedKeys(s string) (map[string][]string, error) {
+	keys := make(map[string][]string)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, scopes, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("entry %d: expected key=scopes", len(keys)+1)
+		}
+		fields := strings.Fields(scopes)
+		if len(fields) == 0 {
+			// The key itself is not quoted, so it cannot end up in logs
+			return nil, fmt.Errorf("key %s: no scopes granted", Fingerprint(key))
+		}
+		keys[key] = append(keys[key], fields...)
+	}
+	return keys, nil
+}
+
+// NewScopedKeys keeps digests of the keys with their scopes. With no keys
+// every request is refused.
+func NewScopedKeys(keys map[string][]string) *ScopedKeys {
+	s := &ScopedKeys{grants: make([]grant, 0, len(keys))}
+	for k, scopes := range keys {
+		s.grants = append(s.grants, grant{digest: sha256.Sum256([]byte(k)), scopes: scopes})
+	}
+	return s
+}
+
+// scopes returns the scopes apiKey is granted, or the error to reject the
+// request with if it is not one of the keys
+func (s *ScopedKeys) scopes(apiKey string) ([]string, *apierror.Error) {
+	if len(s.grants) == 0 {
+		return nil, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "No API keys are allowed to use this route on this gateway")
+	}
+	if apiKey == "" {
+		return nil, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "An API key is required")
+	}
+	// Every digest is compared, so the time taken does not reveal which key matched
+	presented := sha256.Sum256([]byte(apiKey))
+	var scopes []string
+	for _, g := range s.grants {
+		if subtle.ConstantTimeCompare(presented[:], g.digest[:]) == 1 {
+			scopes = g.scopes
+		}
+	}
+	if scopes == nil {
+		return nil, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "This API key is not allowed to use this route")
+	}
+	return scopes, nil
+}
+
+// Authorize returns nil if apiKey is granted scope, otherwise the error to
+// reject the request with
+func (s *ScopedKeys) Authorize(apiKey, scope string) *apierror.Error {
+	scopes, err := s.scopes(apiKey)
+	if err != nil {
+		return err
+	}
+	for _, granted := range scopes {
+		if granted == scope || (strings.HasSuffix(granted, ":*") && strings.HasPrefix(scope, strings.TrimSuffix(granted, "*"))) {
+			return nil
+		}
+	}
+	return apierror.New(http.StatusForbidden, apierror.CodeForbidden, fmt.Sprintf("This API key is not granted the %s scope", scope))
+}
+
+// MiddlewareByRoute is registered on a group ahead of anything that reads the
+// body, and only lets requests to routes (full paths) through whose X-API-Key
+// is one of the keys. Which scope the key needs is checked by
+// MiddlewareByBody once the body may be read.
+func (s *ScopedKeys) MiddlewareByRoute(routes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(routes, c.FullPath()) {
+			c.Next()
+			return
+		}
+		if _, err := s.scopes(c.GetHeader(HeaderAPIKey)); err != nil {
+			apierror.Respond(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// MiddlewareByBody only lets requests through whose X-API-Key is granted the
+// scope that scopeOf derives from the request body
+func (s *ScopedKeys) MiddlewareByBody(scopeOf func(body []byte) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := bodylimit.Read(c)
+		if !ok {
+			return
+		}
+		if err := s.Authorize(c.GetHeader(HeaderAPIKey), scopeOf(body)); err != nil {
+			apierror.Respond(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// TenantKeys maps API keys to the tenant they belong to. Several keys may
+// belong to one tenant, and then share its rate limits and quotas.
+type TenantKeys struct {
+	grants []tenantGrant
+}
+
+type tenantGrant struct {
+	digest [32]byte
+	tenant string
+}
+
+// ParseTenantKeys parses a comma-separated list of key=tenant entries, e.g.
+// "k1=acme,k2=acme,k3=globex"
+func ParseTenantKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for i, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, tenant, ok := strings.Cut(entry, "=")
+		key, tenant = strings.TrimSpace(key), strings.TrimSpace(tenant)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("entry %d: expected key=tenant", i+1)
+		}
+		if tenant == "" {
+			return nil, fmt.Errorf("key %s: no tenant given", Fingerprint(key))
+		}
+		if other, dup := keys[key]; dup && other != tenant {
+			return nil, fmt.Errorf("key %s: assigned to both %q and %q", Fingerprint(key), other, tenant)
+		}
+		keys[key] = tenant
+	}
+	return keys, nil
+}
+
+// NewTenantKeys keeps digests of the keys with their tenants
+func NewTenantKeys(keys map[string]string) *TenantKeys {
+	t := &TenantKeys{grants: make([]tenantGrant, 0, len(keys))}
+	for k, tenant := range keys {
+		t.grants = append(t.grants, tenantGrant{digest: sha256.Sum256([]byte(k)), tenant: tenant})
+	}
+	return t
+}
+
+// Tenant returns the tenant apiKey belongs to, or "" for unknown keys
+func (t *TenantKeys) Tenant(apiKey string) string {
+	if t == nil || apiKey == "" {
+		return ""
+	}
+	// Every digest is compared, so the time taken does not reveal which key matched
+	presented := sha256.Sum256([]byte(apiKey))
+	tenant := ""
+	for _, g := range t.grants {
+		if subtle.ConstantTimeCompare(presented[:], g.digest[:]) == 1 {
+			tenant = g.tenant
+		}
+	}
+	return tenant
+}
+
+// Middleware resolves the tenant of the request's X-API-Key for Tenant, and
+// so for the rate limiter, idempotency keys and audit records. The request's
+// context names the caller's Owner, for downstream calls.
+func (t *TenantKeys) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(tenantContextKey, t.Tenant(c.GetHeader(HeaderAPIKey)))
+		c.Request = c.Request.WithContext(WithOwner(c.Request.Context(), Owner(c)))
+		c.Next()
+	}
+}
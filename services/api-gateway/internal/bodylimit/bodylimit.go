@@ -0,0 +1,38 @@
+// Package bodylimit bounds the request bodies the gateway buffers. Every
+// middleware that reads a body before the handler (contract validation, scope
+// checks, idempotency keys, rate limiting) reads it through Read, so the same
+// limit applies however early in the chain the body is read.
+package bodylimit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBytes bounds the request bodies the gateway buffers
+const MaxBytes = 10 << 20
+
+// Read buffers the request body, up to MaxBytes, and restores it for the
+// handler. It returns false if the request was rejected (and the response
+// already written): 413 for a body over the limit, 400 if it cannot be read.
+func Read(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Respond(c, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit)))
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.InvalidRequest("Failed to read request body"))
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
@@ -0,0 +1,126 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+)
+
+// AICoordinatorServiceName attributes errors reported by the AI coordinator
+const AICoordinatorServiceName = "ai-coordinator"
+
+// AICoordinatorRequest matches the body of the coordinator's /process endpoint
+type AICoordinatorRequest struct {
+	TaskType string                 `json:"task_type"`
+	Payload  map[string]interface{} `json:"payload"`
+	Config   map[string]string      `json:"config,omitempty"` // Hints such as the model
+}
+
+// AICoordinatorResponse matches the coordinator's response. On failure, Error
+// holds the standard error envelope body.
+type AICoordinatorResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *apierror.Error `json:"error,omitempty"`
+}
+
+// AICoordinatorClient runs tasks on the AI coordinator directly, for
+// capabilities that have no dedicated service
+type AICoordinatorClient struct {
+	BaseURL    string
+	HttpClient *http.Client       // No overall timeout; calls are bounded by their context instead (see SetTimeout)
+	Resilience *resilience.Caller // Retries and circuit breaker; shared with other clients of the service
+	timeout    *timeout
+}
+
+// DefaultAICoordinatorTimeout limits task calls, which end in a model call
+const DefaultAICoordinatorTimeout = 30 * time.Second
+
+// NewAICoordinatorClient creates a new client instance
+func NewAICoordinatorClient(baseURL string) *AICoordinatorClient {
+	return &AICoordinatorClient{
+		BaseURL:    baseURL,
+		HttpClient: &http.Client{Transport: metrics.Transport(AICoordinatorServiceName, telemetry.Transport(nil))},
+		Resilience: resilience.NewCaller(AICoordinatorServiceName, resilience.DefaultConfig()),
+		timeout:    newTimeout(DefaultAICoordinatorTimeout),
+	}
+}
+
+// SetTimeout changes the time limit on calls. It is safe to call while calls
+// are in flight; they keep their limit.
+func (c *AICoordinatorClient) SetTimeout(d time.Duration) {
+	c.timeout.set(d)
+}
+
+// UseTransport sends the client's calls through base (the default transport
+// if nil), e.g. to call the service over mutual TLS. It must be called before
+// the client is used.
+func (c *AICoordinatorClient) UseTransport(base http.RoundTripper) {
+	c.HttpClient.Transport = metrics.Transport(AICoordinatorServiceName, telemetry.Transport(base))
+}
+
+// RunTask runs a task and returns its raw result. Failures are returned as
+// *apierror.Error.
+func (c *AICoordinatorClient) RunTask(ctx context.Context, taskType string, payload map[string]interface{}, config map[string]string) (json.RawMessage, error) {
+	payloadBytes, err := json.Marshal(AICoordinatorRequest{TaskType: taskType, Payload: payload, Config: config})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal coordinator request payload", "error", err)
+		return nil, fmt.Errorf("failed to create request payload: %w", err)
+	}
+
+	var result json.RawMessage
+	err = c.Resilience.Do(ctx, func(ctx context.Context) error {
+		result, err = c.runTask(ctx, taskType, payloadBytes)
+		return err
+	})
+	return result, err
+}
+
+// runTask makes one attempt at running a task
+func (c *AICoordinatorClient) runTask(ctx context.Context, taskType string, payloadBytes []byte) (json.RawMessage, error) {
+	ctx, cancel := c.timeout.bound(ctx)
+	defer cancel()
+
+	reqUrl := fmt.Sprintf("%s/process", c.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create request to AI coordinator", "error", err)
+		return nil, fmt.Errorf("failed to create coordinator request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reach AI coordinator", "url", reqUrl, "error", err)
+		return nil, apierror.FromTransport(err, AICoordinatorServiceName)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := apierror.FromResponse(resp, AICoordinatorServiceName)
+		slog.WarnContext(ctx, "AI coordinator returned an error", "task_type", taskType, "error", apiErr)
+		return nil, apiErr
+	}
+
+	var coordResp AICoordinatorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&coordResp); err != nil || !coordResp.Success {
+		slog.ErrorContext(ctx, "Failed to decode AI coordinator response", "task_type", taskType)
+		return nil, apierror.BadResponse(AICoordinatorServiceName)
+	}
+
+	slog.DebugContext(ctx, "Received task result from AI coordinator", "task_type", taskType)
+	return coordResp.Result, nil
+}
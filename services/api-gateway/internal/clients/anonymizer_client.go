@@ -1,81 +1,281 @@
 package clients
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
+
+	"privacypilot-api-gateway/internal/auth"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+)
+
+// Service names used when attributing downstream errors
+const (
+	AnonymizerServiceName = "anonymizer-service"
+	ModerationServiceName = "moderation-service"
 )
 
 // AnonymizerRequest matches the expected input structure of the Anonymizer service
 type AnonymizerRequest struct {
-	Text string `json:"text"`
+	Text  string `json:"text"`
+	Model string `json:"model,omitempty"` // Optional model override passed down to the AI adapter
+	Cache string `json:"cache,omitempty"` // Optional CacheRefresh or CacheBypass
+	Owner string `json:"owner,omitempty"` // The caller (see auth.Owner); cached results are only served to the same owner
 }
 
 // AnonymizerResponse matches the expected output structure of the Anonymizer service
 type AnonymizerResponse struct {
 	OriginalText   string `json:"original_text"`
 	AnonymizedText string `json:"anonymized_text"`
-	// Add other fields if the anonymizer service returns more details
+	Cached         bool   `json:"cached"` // Served from the anonymizer's result cache
+	// Set by the gateway for reversible anonymizations, never by the anonymizer
+	DeanonymizeToken string `json:"deanonymize_token,omitempty"`
+}
+
+// How an anonymization uses the anonymizer service's result cache
+const (
+	CacheDefault = ""        // Use a cached result if there is one, otherwise cache the new result
+	CacheRefresh = "refresh" // Ignore any cached result and cache the new one
+	CacheBypass  = "bypass"  // Neither use nor store a cached result
+)
+
+// ValidCacheMode reports whether mode is one of the cache modes
+func ValidCacheMode(mode string) bool {
+	return mode == CacheDefault || mode == CacheRefresh || mode == CacheBypass
+}
+
+// AnonymizeBatchItem is a single client-identified record in a batch request
+type AnonymizeBatchItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// AnonymizeBatchResult is the outcome for one batch item. Exactly one of
+// AnonymizedText or Error is meaningful.
+type AnonymizeBatchResult struct {
+	ID             string          `json:"id"`
+	AnonymizedText string          `json:"anonymized_text,omitempty"`
+	Error          *apierror.Error `json:"error,omitempty"`
+}
+
+// AnonymizeStreamChunk is one line of the anonymizer service's newline-delimited JSON stream
+type AnonymizeStreamChunk struct {
+	Token     string          `json:"token,omitempty"`
+	Done      bool            `json:"done,omitempty"`
+	ModelUsed string          `json:"model_used,omitempty"`
+	Error     *apierror.Error `json:"error,omitempty"`
 }
 
+// Default time limits on calls to the anonymizer service
+const (
+	DefaultAnonymizerTimeout       = 10 * time.Second
+	DefaultAnonymizerStreamTimeout = 75 * time.Second // Bounds a whole streamed anonymization
+)
+
 // AnonymizerClient holds configuration for the client
 type AnonymizerClient struct {
-	BaseURL    string
-	HttpClient *http.Client
+	BaseURL string
+	// HttpClient and StreamHttpClient have no overall timeout; calls are
+	// bounded by their context instead (see SetTimeouts)
+	HttpClient       *http.Client
+	StreamHttpClient *http.Client
+	Resilience       *resilience.Caller // Retries and circuit breaker; shared with other clients of the service
+	timeout          *timeout
+	streamTimeout    *timeout
 }
 
 // NewAnonymizerClient creates a new client instance
 func NewAnonymizerClient(baseURL string) *AnonymizerClient {
 	return &AnonymizerClient{
-		BaseURL: baseURL,
-		HttpClient: &http.Client{
-			Timeout: 10 * time.Second, // Sensible default timeout
-		},
+		BaseURL:          baseURL,
+		HttpClient:       &http.Client{Transport: metrics.Transport(AnonymizerServiceName, telemetry.Transport(nil))},
+		StreamHttpClient: &http.Client{Transport: metrics.Transport(AnonymizerServiceName, telemetry.Transport(nil))},
+		Resilience:       resilience.NewCaller(AnonymizerServiceName, resilience.DefaultConfig()),
+		timeout:          newTimeout(DefaultAnonymizerTimeout),
+		streamTimeout:    newTimeout(DefaultAnonymizerStreamTimeout),
 	}
 }
 
-// AnonymizeText sends a request to the anonymizer service
-func (c *AnonymizerClient) AnonymizeText(text string) (*AnonymizerResponse, error) {
-	requestPayload := AnonymizerRequest{Text: text}
+// SetTimeouts changes the time limits on calls and on whole streams. It is
+// safe to call while calls are in flight; they keep their limits.
+func (c *AnonymizerClient) SetTimeouts(call, stream time.Duration) {
+	c.timeout.set(call)
+	c.streamTimeout.set(stream)
+}
+
+// UseTransport sends the client's calls through base (the default transport
+// if nil), e.g. to call the service over mutual TLS. It must be called before
+// the client is used.
+func (c *AnonymizerClient) UseTransport(base http.RoundTripper) {
+	c.HttpClient.Transport = metrics.Transport(AnonymizerServiceName, telemetry.Transport(base))
+	c.StreamHttpClient.Transport = metrics.Transport(AnonymizerServiceName, telemetry.Transport(base))
+}
+
+// AnonymizeText sends a request to the anonymizer service. model may be empty
+// to use the default model; cacheMode is one of the Cache constants. The caller named in ctx (see auth.WithOwner) is
+// sent along, so cached results are not shared between callers. Failures reported by the service (or by services
+// behind it) are returned as *apierror.Error.
+func (c *AnonymizerClient) AnonymizeText(ctx context.Context, text, model, cacheMode string) (*AnonymizerResponse, error) {
+	requestPayload := AnonymizerRequest{Text: text, Model: model, Cache: cacheMode, Owner: auth.OwnerFromContext(ctx)}
 	payloadBytes, err := json.Marshal(requestPayload)
 	if err != nil {
-		log.Printf("Error marshalling anonymizer request payload: %v", err)
+		slog.ErrorContext(ctx, "Failed to marshal anonymizer request payload", "error", err)
 		return nil, fmt.Errorf("failed to create request payload: %w", err)
 	}
 
+	var anonymizerResp *AnonymizerResponse
+	err = c.Resilience.Do(ctx, func(ctx context.Context) error {
+		anonymizerResp, err = c.anonymize(ctx, payloadBytes)
+		return err
+	})
+	return anonymizerResp, err
+}
+
+// anonymize makes one attempt at an anonymization
+func (c *AnonymizerClient) anonymize(ctx context.Context, payloadBytes []byte) (*AnonymizerResponse, error) {
+	ctx, cancel := c.timeout.bound(ctx)
+	defer cancel()
+
 	reqUrl := fmt.Sprintf("%s/anonymize", c.BaseURL) // Ensure BaseURL doesn't have a trailing slash
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
 	if err != nil {
-		log.Printf("Error creating request to anonymizer service: %v", err)
+		slog.ErrorContext(ctx, "Failed to create request to anonymizer service", "error", err)
 		return nil, fmt.Errorf("failed to create anonymizer request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	// Add other headers like trace IDs if implementing tracing
+	requestid.Inject(req)
+	budget.Inject(req)
 
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		log.Printf("Error sending request to anonymizer service at %s: %v", reqUrl, err)
-		return nil, fmt.Errorf("anonymizer service request failed: %w", err)
+		slog.ErrorContext(ctx, "Failed to reach anonymizer service", "url", reqUrl, "error", err)
+		return nil, apierror.FromTransport(err, AnonymizerServiceName)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		// Attempt to read error body for more context (optional)
-		// var errorBody map[string]interface{}
-		// _ = json.NewDecoder(resp.Body).Decode(&errorBody) // Ignore decode error here
-		log.Printf("Anonymizer service returned non-OK status: %d", resp.StatusCode)
-		return nil, fmt.Errorf("anonymizer service returned status %d", resp.StatusCode)
+		apiErr := apierror.FromResponse(resp, AnonymizerServiceName)
+		slog.WarnContext(ctx, "Anonymizer service returned an error", "error", apiErr)
+		return nil, apiErr
 	}
 
 	var anonymizerResp AnonymizerResponse
 	if err := json.NewDecoder(resp.Body).Decode(&anonymizerResp); err != nil {
-		log.Printf("Error decoding anonymizer service response: %v", err)
-		return nil, fmt.Errorf("failed to decode anonymizer response: %w", err)
+		slog.ErrorContext(ctx, "Failed to decode anonymizer service response", "error", err)
+		return nil, apierror.BadResponse(AnonymizerServiceName)
 	}
 
-	log.Printf("Successfully received anonymized text from service.")
+	slog.DebugContext(ctx, "Received anonymized text from anonymizer service")
 	return &anonymizerResp, nil
 }
+
+// AnonymizeBatch anonymizes every item, running at most concurrency requests
+// against the anonymizer service at once. Results are returned in the same
+// order as items; a failing item only sets that item's Error.
+func (c *AnonymizerClient) AnonymizeBatch(ctx context.Context, items []AnonymizeBatchItem, concurrency int) []AnonymizeBatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]AnonymizeBatchResult, len(items))
+	sem := make(chan struct{}, concurrency) // Bounds the number of in-flight requests
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item AnonymizeBatchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i].ID = item.ID
+			resp, err := c.AnonymizeText(ctx, item.Text, "", CacheDefault)
+			if err != nil {
+				apiErr, ok := apierror.As(err)
+				if !ok {
+					apiErr = apierror.Internal("Failed to anonymize item")
+				}
+				results[i].Error = apierror.Propagate(apiErr)
+				return
+			}
+			results[i].AnonymizedText = resp.AnonymizedText
+		}(i, item)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// AnonymizeTextStream requests a streamed anonymization and calls onChunk for
+// every chunk received, including the final Done or Error chunk. Cancelling
+// ctx (e.g. because the end user disconnected) aborts the whole chain. The
+// request is only retried until the stream has started.
+func (c *AnonymizerClient) AnonymizeTextStream(ctx context.Context, text, model string, onChunk func(AnonymizeStreamChunk) error) error {
+	payloadBytes, err := json.Marshal(AnonymizerRequest{Text: text, Model: model})
+	if err != nil {
+		return fmt.Errorf("failed to create request payload: %w", err)
+	}
+	return c.Resilience.Do(ctx, func(ctx context.Context) error {
+		return c.anonymizeStream(ctx, payloadBytes, onChunk)
+	})
+}
+
+// anonymizeStream makes one attempt at a streamed anonymization
+func (c *AnonymizerClient) anonymizeStream(ctx context.Context, payloadBytes []byte, onChunk func(AnonymizeStreamChunk) error) error {
+	ctx, cancel := c.streamTimeout.bound(ctx)
+	defer cancel()
+
+	reqUrl := fmt.Sprintf("%s/anonymize/stream", c.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create streaming request to anonymizer service", "error", err)
+		return fmt.Errorf("failed to create anonymizer request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.Inject(req)
+	budget.Inject(req)
+
+	resp, err := c.StreamHttpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reach anonymizer service for streaming", "url", reqUrl, "error", err)
+		return apierror.FromTransport(err, AnonymizerServiceName)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "Anonymizer service stream returned an error", "status", resp.StatusCode)
+		return apierror.FromResponse(resp, AnonymizerServiceName)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk AnonymizeStreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode anonymizer stream chunk", "error", err)
+			return resilience.NoRetry(apierror.BadResponse(AnonymizerServiceName))
+		}
+		if err := onChunk(chunk); err != nil {
+			return resilience.NoRetry(err)
+		}
+		if chunk.Done || chunk.Error != nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.WarnContext(ctx, "Anonymizer stream interrupted", "error", err)
+		return resilience.NoRetry(apierror.FromTransport(err, AnonymizerServiceName))
+	}
+	return resilience.NoRetry(apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "anonymizer-service stream ended without a final chunk"))
+}
@@ -2,11 +2,19 @@ package clients
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
 )
 
 // ModerationRequest matches the expected input structure of the Moderation service
@@ -23,62 +31,94 @@ type ModerationResponse struct {
 	ConfidenceScore float64  `json:"confidence_score"`
 }
 
+// DefaultModerationTimeout limits calls to the moderation service
+const DefaultModerationTimeout = 15 * time.Second // Moderation might take longer
+
 // ModerationClient holds configuration for the client
 type ModerationClient struct {
 	BaseURL    string
-	HttpClient *http.Client
+	HttpClient *http.Client       // No overall timeout; calls are bounded by their context instead (see SetTimeout)
+	Resilience *resilience.Caller // Retries and circuit breaker; shared with other clients of the service
+	timeout    *timeout
 }
 
 // NewModerationClient creates a new client instance
 func NewModerationClient(baseURL string) *ModerationClient {
 	return &ModerationClient{
-		BaseURL: baseURL,
-		HttpClient: &http.Client{
-			Timeout: 15 * time.Second, // Moderation might take longer
-		},
+		BaseURL:    baseURL,
+		HttpClient: &http.Client{Transport: metrics.Transport(ModerationServiceName, telemetry.Transport(nil))},
+		Resilience: resilience.NewCaller(ModerationServiceName, resilience.DefaultConfig()),
+		timeout:    newTimeout(DefaultModerationTimeout),
 	}
 }
 
-// ModerateContent sends a request to the moderation service
-func (c *ModerationClient) ModerateContent(text, imageURL string) (*ModerationResponse, error) {
+// SetTimeout changes the time limit on calls. It is safe to call while calls
+// are in flight; they keep their limit.
+func (c *ModerationClient) SetTimeout(d time.Duration) {
+	c.timeout.set(d)
+}
+
+// UseTransport sends the client's calls through base (the default transport
+// if nil). It must be called before the client is used.
+func (c *ModerationClient) UseTransport(base http.RoundTripper) {
+	c.HttpClient.Transport = metrics.Transport(ModerationServiceName, telemetry.Transport(base))
+}
+
+// ModerateContent sends a request to the moderation service. Failures are
+// returned as *apierror.Error.
+func (c *ModerationClient) ModerateContent(ctx context.Context, text, imageURL string) (*ModerationResponse, error) {
 	requestPayload := ModerationRequest{
 		Text:     text,
 		ImageURL: imageURL,
 	}
 	payloadBytes, err := json.Marshal(requestPayload)
 	if err != nil {
-		log.Printf("Error marshalling moderation request payload: %v", err)
+		slog.ErrorContext(ctx, "Failed to marshal moderation request payload", "error", err)
 		return nil, fmt.Errorf("failed to create request payload: %w", err)
 	}
 
+	var moderationResp *ModerationResponse
+	err = c.Resilience.Do(ctx, func(ctx context.Context) error {
+		moderationResp, err = c.moderate(ctx, payloadBytes)
+		return err
+	})
+	return moderationResp, err
+}
+
+// moderate makes one attempt at a moderation
+func (c *ModerationClient) moderate(ctx context.Context, payloadBytes []byte) (*ModerationResponse, error) {
+	ctx, cancel := c.timeout.bound(ctx)
+	defer cancel()
+
 	reqUrl := fmt.Sprintf("%s/moderate", c.BaseURL) // Ensure BaseURL doesn't have a trailing slash
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(payloadBytes))
 	if err != nil {
-		log.Printf("Error creating request to moderation service: %v", err)
+		slog.ErrorContext(ctx, "Failed to create request to moderation service", "error", err)
 		return nil, fmt.Errorf("failed to create moderation request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	// Add trace IDs etc.
+	requestid.Inject(req)
+	budget.Inject(req)
 
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		log.Printf("Error sending request to moderation service at %s: %v", reqUrl, err)
-		return nil, fmt.Errorf("moderation service request failed: %w", err)
+		slog.ErrorContext(ctx, "Failed to reach moderation service", "url", reqUrl, "error", err)
+		return nil, apierror.FromTransport(err, ModerationServiceName)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Moderation service returned non-OK status: %d", resp.StatusCode)
-		// Optionally read error body
-		return nil, fmt.Errorf("moderation service returned status %d", resp.StatusCode)
+		slog.WarnContext(ctx, "Moderation service returned an error", "status", resp.StatusCode)
+		// The Node service answers {"error": "..."}; FromResponse attributes it to the service
+		return nil, apierror.FromResponse(resp, ModerationServiceName)
 	}
 
 	var moderationResp ModerationResponse
 	if err := json.NewDecoder(resp.Body).Decode(&moderationResp); err != nil {
-		log.Printf("Error decoding moderation service response: %v", err)
-		return nil, fmt.Errorf("failed to decode moderation response: %w", err)
+		slog.ErrorContext(ctx, "Failed to decode moderation service response", "error", err)
+		return nil, apierror.BadResponse(ModerationServiceName)
 	}
 
-	log.Printf("Successfully received moderation result from service.")
+	slog.DebugContext(ctx, "Received moderation result from moderation service")
 	return &moderationResp, nil
 }
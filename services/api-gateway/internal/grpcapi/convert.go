@@ -0,0 +1,124 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"time"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/jobs"
+	"privacypilot-api-gateway/internal/pipeline"
+	pb "privacypilot-api-gateway/proto/privacypilot/v1"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errorMessage converts an error reported inside a response, or returns nil
+func errorMessage(e *apierror.Error) *pb.Error {
+	if e == nil {
+		return nil
+	}
+	return &pb.Error{
+		Code:      e.Code,
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		RequestId: e.RequestID,
+		Service:   e.Service,
+	}
+}
+
+func pipelineResult(r *pipeline.Result) (*pb.RunPipelineResponse, error) {
+	out := &pb.RunPipelineResponse{
+		Pipeline:   r.Pipeline,
+		Text:       r.Text,
+		Steps:      make([]*pb.PipelineStep, len(r.Steps)),
+		DurationMs: r.DurationMs,
+	}
+	for i, step := range r.Steps {
+		output, err := value(step.Output)
+		if err != nil {
+			return nil, apierror.Internal("Failed to encode the output of step '" + step.Name + "'")
+		}
+		out.Steps[i] = &pb.PipelineStep{
+			Name:       step.Name,
+			Capability: step.Capability,
+			Status:     step.Status,
+			DurationMs: step.DurationMs,
+			Output:     output,
+		}
+	}
+	return out, nil
+}
+
+func jobMessage(j *jobs.Job) (*pb.Job, error) {
+	result, err := value(j.Result)
+	if err != nil {
+		return nil, apierror.Internal("Failed to encode the job result")
+	}
+	return &pb.Job{
+		Id:          j.ID,
+		Type:        j.Type,
+		Status:      j.Status,
+		Result:      result,
+		Error:       errorMessage(j.Error),
+		CallbackUrl: j.CallbackURL,
+		CreatedAt:   timestamppb.New(j.CreatedAt),
+		StartedAt:   timestamp(j.StartedAt),
+		CompletedAt: timestamp(j.CompletedAt),
+		ExpiresAt:   timestamp(j.ExpiresAt),
+	}, nil
+}
+
+func auditRecord(r *audit.Record) *pb.AuditRecord {
+	out := &pb.AuditRecord{
+		Seq:           r.Seq,
+		Time:          timestamppb.New(r.Time),
+		RequestId:     r.RequestID,
+		Action:        r.Action,
+		Principal:     r.Principal,
+		Tenant:        r.Tenant,
+		Method:        r.Method,
+		Route:         r.Route,
+		Status:        int32(r.Status),
+		Model:         r.Model,
+		PolicyVersion: r.PolicyVersion,
+		InputHash:     r.InputHash,
+		OutputHash:    r.OutputHash,
+		JobId:         r.JobID,
+		PrevHash:      r.PrevHash,
+		Hash:          r.Hash,
+	}
+	if len(r.EntityCounts) > 0 {
+		out.EntityCounts = make(map[string]int32, len(r.EntityCounts))
+		for k, n := range r.EntityCounts {
+			out.EntityCounts[k] = int32(n)
+		}
+	}
+	return out
+}
+
+// value converts a result to a protobuf Value through its JSON encoding, the
+// shape the REST API returns. nil stays nil.
+func value(v interface{}) (*structpb.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := &structpb.Value{}
+	if err := out.UnmarshalJSON(encoded); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
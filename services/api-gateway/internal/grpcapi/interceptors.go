@@ -0,0 +1,231 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	pb "privacypilot-api-gateway/proto/privacypilot/v1"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys, the lower-case forms of the HTTP headers of the REST API
+const (
+	metadataRequestID        = "x-request-id"
+	metadataAPIKey           = "x-api-key"
+	metadataBatchConcurrency = "x-batch-concurrency"
+)
+
+// auditActions are the audit actions of the audited methods. As over HTTP,
+// job lookups are not audited.
+var auditActions = map[string]string{
+	pb.Gateway_Anonymize_FullMethodName:       audit.ActionAnonymize,
+	pb.Gateway_AnonymizeStream_FullMethodName: audit.ActionAnonymize,
+	pb.Gateway_AnonymizeBatch_FullMethodName:  audit.ActionAnonymize,
+	pb.Gateway_Moderate_FullMethodName:        audit.ActionModerate,
+	pb.Gateway_Process_FullMethodName:         audit.ActionProcess,
+	pb.Gateway_RunPipeline_FullMethodName:     audit.ActionPipeline,
+	pb.Gateway_RunAITask_FullMethodName:       audit.ActionAITask,
+	pb.Gateway_CreateJob_FullMethodName:       audit.ActionJob,
+	pb.Admin_QueryAudit_FullMethodName:        audit.ActionAdmin,
+	pb.Admin_VerifyAudit_FullMethodName:       audit.ActionAdmin,
+}
+
+// interceptor wraps a call to method, unary or streaming. next continues
+// the call with the given context.
+type interceptor func(ctx context.Context, method string, next func(context.Context) error) error
+
+// chain runs interceptors in order around call
+func chain(ctx context.Context, method string, interceptors []interceptor, call func(context.Context) error) error {
+	if len(interceptors) == 0 {
+		return call(ctx)
+	}
+	return interceptors[0](ctx, method, func(ctx context.Context) error {
+		return chain(ctx, method, interceptors[1:], call)
+	})
+}
+
+func unaryInterceptor(interceptors ...interceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := chain(ctx, info.FullMethod, interceptors, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, toStatusError(err)
+	}
+}
+
+func streamInterceptor(interceptors ...interceptor) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := chain(ss.Context(), info.FullMethod, interceptors, func(ctx context.Context) error {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+		return toStatusError(err)
+	}
+}
+
+// serverStream passes the context built by the interceptors to stream handlers
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestID accepts a well-formed incoming x-request-id or generates a
+// new one, echoes it in the response header and stores it in the context
+func withRequestID(ctx context.Context, _ string, next func(context.Context) error) error {
+	id := requestid.Accept(incoming(ctx, metadataRequestID))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, id))
+	return next(requestid.NewContext(ctx, id))
+}
+
+// withOwner names the caller in the context, as auth.Owner does
+func withOwner(tenants *auth.TenantKeys) interceptor {
+	return func(ctx context.Context, _ string, next func(context.Context) error) error {
+		apiKey := incoming(ctx, metadataAPIKey)
+		return next(auth.WithOwner(ctx, auth.OwnerFor(tenants.Tenant(apiKey), apiKey, clientIP(ctx))))
+	}
+}
+
+// observe records metrics and logs one access record per call. As over HTTP,
+// nothing from the messages is logged.
+func observe(ctx context.Context, method string, next func(context.Context) error) error {
+	start := time.Now()
+	err := next(ctx)
+
+	code := codeOf(err)
+	observeCall(method, code.String(), time.Since(start))
+	httpStatus := statusOf(err)
+	level := slog.LevelInfo
+	if httpStatus >= 500 {
+		level = slog.LevelError
+	}
+	slog.Log(ctx, level, "Request handled",
+		"method", "gRPC",
+		"route", method,
+		"status", httpStatus,
+		"grpc_code", code.String(),
+		"latency_ms", time.Since(start).Milliseconds(),
+		"client_ip", clientIP(ctx),
+	)
+	return err
+}
+
+// recoverPanics turns a panic in a handler into an internal error. Only
+// runtime error messages are logged, since other panic values may carry
+// request data.
+func recoverPanics(ctx context.Context, method string, next func(context.Context) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			slog.ErrorContext(ctx, "Recovered from panic", "route", method, "panic", logging.PanicValue(rec), "stack", string(debug.Stack()))
+			err = apierror.Internal("Internal error")
+		}
+	}()
+	return next(ctx)
+}
+
+// errorEnvelope fills in the request ID of errors returned as *apierror.Error,
+// as apierror.Respond does over HTTP
+func errorEnvelope(ctx context.Context, _ string, next func(context.Context) error) error {
+	err := next(ctx)
+	if apiErr, ok := apierror.As(err); ok {
+		out := *apiErr
+		if out.Service == "" {
+			out.Service = servicekit.Name()
+		}
+		if out.RequestID == "" {
+			out.RequestID = requestid.FromContext(ctx)
+		}
+		return &out
+	}
+	return err
+}
+
+// auditCalls writes one audit record for every call to an audited method,
+// whatever its outcome. It comes before authorization and rate limiting so
+// rejected calls are recorded too.
+func auditCalls(log *audit.Log, tenants *auth.TenantKeys) interceptor {
+	return func(ctx context.Context, method string, next func(context.Context) error) error {
+		action, ok := auditActions[method]
+		if !ok {
+			return next(ctx)
+		}
+		ctx, end := log.Begin(ctx, action)
+		err := next(ctx)
+		end(audit.Record{
+			RequestID: requestid.FromContext(ctx),
+			Principal: auth.PrincipalForKey(incoming(ctx, metadataAPIKey)),
+			Tenant:    tenants.Tenant(incoming(ctx, metadataAPIKey)),
+			Method:    "gRPC",
+			Route:     method,
+			Status:    statusOf(err),
+		})
+		return err
+	}
+}
+
+// requireAdmin only lets calls to the Admin service through whose x-api-key
+// is an admin key
+func requireAdmin(keys *auth.AdminKeys) interceptor {
+	prefix := "/" + pb.Admin_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, method string, next func(context.Context) error) error {
+		if !strings.HasPrefix(method, prefix) {
+			return next(ctx)
+		}
+		if err := keys.Authorize(incoming(ctx, metadataAPIKey)); err != nil {
+			return err
+		}
+		return next(ctx)
+	}
+}
+
+// statusOf is the HTTP status the REST API would have answered a call with
+func statusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if apiErr, ok := apierror.As(err); ok {
+		return apiErr.Status
+	}
+	return httpStatus(status.Code(err))
+}
+
+// incoming returns the first value of an incoming metadata key, or ""
+func incoming(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// clientIP returns the address of the caller's end of the connection
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
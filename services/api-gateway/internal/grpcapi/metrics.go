@@ -0,0 +1,32 @@
+package grpcapi
+
+import (
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "grpc_server_requests_total",
+		Help:      "gRPC calls handled, by method and status code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "grpc_server_request_duration_seconds",
+		Help:      "Time to handle gRPC calls (to the end of the stream for streaming calls), by method and status code.",
+		Buckets:   metrics.LatencyBuckets,
+	}, []string{"method", "code"})
+)
+
+// observeCall records a handled gRPC call. method is the full method name,
+// which is bounded by the registered services.
+func observeCall(method, code string, elapsed time.Duration) {
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(elapsed.Seconds())
+}
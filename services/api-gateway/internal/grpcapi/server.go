@@ -0,0 +1,339 @@
+// Package grpcapi serves the gateway's gRPC API, defined in
+// proto/privacypilot/v1/gateway.proto. It is a second transport for the
+// REST API: every method calls the same handler method as its REST route,
+// with the same audit records, admin authorization and rate limits, so both
+// APIs validate, answer and fail alike.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/handlers"
+	"privacypilot-api-gateway/internal/ratelimit"
+	pb "privacypilot-api-gateway/proto/privacypilot/v1"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Config holds what the gRPC API shares with the REST API
+type Config struct {
+	Anonymize  *handlers.AnonymizeHandler
+	Moderate   *handlers.ModerateHandler
+	Process    *handlers.ProcessHandler
+	Pipelines  *handlers.PipelineHandler
+	AITasks    *handlers.AITaskHandler
+	Jobs       *handlers.JobsHandler
+	Admin      *handlers.AdminHandler
+	Limiter    *ratelimit.Limiter
+	Audit      *audit.Log
+	AdminKeys  *auth.AdminKeys
+	AITaskKeys *auth.ScopedKeys
+	TenantKeys *auth.TenantKeys // Tenants of the API keys, for rate limits and audit records
+}
+
+// NewServer creates a gRPC server with the Gateway and Admin services and
+// server reflection registered. Interceptors give every call a request ID,
+// metrics, an access log, panic recovery and, where the REST route has one,
+// an audit record; calls to Admin need an admin key.
+func NewServer(cfg Config, opts ...grpc.ServerOption) *grpc.Server {
+	interceptors := []interceptor{
+		withRequestID,
+		withOwner(cfg.TenantKeys),
+		observe,
+		recoverPanics,
+		errorEnvelope,
+		auditCalls(cfg.Audit, cfg.TenantKeys),
+		requireAdmin(cfg.AdminKeys),
+	}
+	opts = append([]grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()), // Server span, continuing any incoming W3C trace context
+		grpc.UnaryInterceptor(unaryInterceptor(interceptors...)),
+		grpc.StreamInterceptor(streamInterceptor(interceptors...)),
+	}, opts...)
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterGatewayServer(s, &gatewayServer{cfg: cfg})
+	pb.RegisterAdminServer(s, &adminServer{admin: cfg.Admin})
+	reflection.Register(s)
+	return s
+}
+
+// Shutdown stops srv gracefully: it stops accepting calls and waits for
+// in-flight ones. If ctx ends first, the remaining calls are cancelled and
+// ctx's error is returned.
+func Shutdown(ctx context.Context, srv *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+type gatewayServer struct {
+	pb.UnimplementedGatewayServer
+	cfg Config
+}
+
+func (s *gatewayServer) Anonymize(ctx context.Context, req *pb.AnonymizeRequest) (*pb.AnonymizeResponse, error) {
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(req.GetText()), "anonymize"); err != nil {
+		return nil, err
+	}
+	resp, apiErr := s.cfg.Anonymize.Anonymize(ctx, handlers.AnonymizeGatewayRequest{Text: req.GetText(), Model: req.GetModel(), Cache: req.GetCache()})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &pb.AnonymizeResponse{OriginalText: resp.OriginalText, AnonymizedText: resp.AnonymizedText, Cached: resp.Cached}, nil
+}
+
+func (s *gatewayServer) AnonymizeStream(req *pb.AnonymizeRequest, stream grpc.ServerStreamingServer[pb.AnonymizeStreamEvent]) error {
+	ctx := stream.Context()
+	if err := s.limit(ctx, streamHeader(stream), 1, utf8.RuneCountInString(req.GetText()), "anonymize"); err != nil {
+		return err
+	}
+	result, apiErr := s.cfg.Anonymize.AnonymizeStream(ctx, handlers.AnonymizeGatewayRequest{Text: req.GetText(), Model: req.GetModel()}, func(text string) error {
+		return stream.Send(&pb.AnonymizeStreamEvent{Event: &pb.AnonymizeStreamEvent_Token{Token: text}})
+	})
+	if apiErr != nil {
+		return apiErr
+	}
+	return stream.Send(&pb.AnonymizeStreamEvent{Event: &pb.AnonymizeStreamEvent_Done{Done: &pb.AnonymizeStreamDone{
+		AnonymizedText: result.AnonymizedText,
+		ModelUsed:      result.ModelUsed,
+	}}})
+}
+
+func (s *gatewayServer) AnonymizeBatch(stream grpc.ClientStreamingServer[pb.AnonymizeBatchItem, pb.AnonymizeBatchResponse]) error {
+	ctx := stream.Context()
+	var req handlers.AnonymizeBatchGatewayRequest
+	if v := incoming(ctx, metadataBatchConcurrency); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return apierror.InvalidRequest("Invalid request: x-batch-concurrency must be a positive integer")
+		}
+		req.Concurrency = n
+	}
+
+	// Items are collected until the client closes the stream; the batch is
+	// only limited, audited and run once complete, like the REST body
+	var chars int
+	for {
+		item, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(req.Items) == s.cfg.Anonymize.MaxBatchItems {
+			return apierror.InvalidRequest(fmt.Sprintf("Invalid request: batch exceeds the maximum of %d items", s.cfg.Anonymize.MaxBatchItems))
+		}
+		req.Items = append(req.Items, handlers.AnonymizeBatchItemRequest{ID: item.GetId(), Text: item.GetText()})
+		chars += utf8.RuneCountInString(item.GetText())
+	}
+
+	if err := s.limit(ctx, streamHeader(stream), len(req.Items), chars, "anonymize"); err != nil {
+		return err
+	}
+	resp, apiErr := s.cfg.Anonymize.AnonymizeBatch(ctx, req)
+	if apiErr != nil {
+		return apiErr
+	}
+	out := &pb.AnonymizeBatchResponse{
+		Results:   make([]*pb.AnonymizeBatchResult, len(resp.Results)),
+		Succeeded: int32(resp.Succeeded),
+		Failed:    int32(resp.Failed),
+	}
+	for i, r := range resp.Results {
+		out.Results[i] = &pb.AnonymizeBatchResult{Id: r.ID, AnonymizedText: r.AnonymizedText, Error: errorMessage(r.Error)}
+	}
+	return stream.SendAndClose(out)
+}
+
+func (s *gatewayServer) Moderate(ctx context.Context, req *pb.ModerateRequest) (*pb.ModerateResponse, error) {
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(req.GetText()), "moderate"); err != nil {
+		return nil, err
+	}
+	resp, apiErr := s.cfg.Moderate.Moderate(ctx, handlers.ModerateGatewayRequest{Text: req.GetText(), ImageURL: req.GetImageUrl()})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &pb.ModerateResponse{
+		IsAcceptable:    resp.IsAcceptable,
+		Flags:           resp.Flags,
+		Details:         resp.Details,
+		ConfidenceScore: resp.ConfidenceScore,
+	}, nil
+}
+
+func (s *gatewayServer) Process(ctx context.Context, req *pb.ProcessRequest) (*pb.ProcessResponse, error) {
+	// Charged against both the moderation and the anonymization limits
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(req.GetText()), "moderate", "anonymize"); err != nil {
+		return nil, err
+	}
+	resp, apiErr := s.cfg.Process.Process(ctx, handlers.ProcessGatewayRequest{Text: req.GetText(), ImageURL: req.GetImageUrl(), Model: req.GetModel()})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &pb.ProcessResponse{
+		Verdict:         resp.Verdict,
+		Flags:           resp.Flags,
+		Details:         resp.Details,
+		ConfidenceScore: resp.ConfidenceScore,
+		AnonymizedText:  resp.AnonymizedText,
+	}, nil
+}
+
+func (s *gatewayServer) RunPipeline(ctx context.Context, req *pb.RunPipelineRequest) (*pb.RunPipelineResponse, error) {
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(req.GetText()), s.cfg.Pipelines.RateLimitRoutesFor(req.GetName())...); err != nil {
+		return nil, err
+	}
+	result, apiErr := s.cfg.Pipelines.Run(ctx, req.GetName(), handlers.PipelineGatewayRequest{Text: req.GetText()})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return pipelineResult(result)
+}
+
+func (s *gatewayServer) RunAITask(ctx context.Context, req *pb.RunAITaskRequest) (*pb.RunAITaskResponse, error) {
+	// Authorized before the limiter, as the REST route's scope check is
+	if err := s.cfg.AITaskKeys.Authorize(incoming(ctx, metadataAPIKey), handlers.AITaskScope(req.GetTaskType())); err != nil {
+		return nil, err
+	}
+	payload := req.GetPayload().AsMap()
+	text, _ := payload["text"].(string)
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(text), handlers.AITaskRateLimitRouteFor(req.GetTaskType())); err != nil {
+		return nil, err
+	}
+	resp, apiErr := s.cfg.AITasks.RunTask(ctx, handlers.AITaskRequest{TaskType: req.GetTaskType(), Payload: payload, Config: req.GetConfig()})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	result, err := value(resp.Result)
+	if err != nil {
+		return nil, apierror.Internal("Failed to encode the task result")
+	}
+	return &pb.RunAITaskResponse{TaskType: resp.TaskType, Result: result}, nil
+}
+
+func (s *gatewayServer) CreateJob(ctx context.Context, req *pb.CreateJobRequest) (*pb.Job, error) {
+	var input []byte
+	if req.GetInput() != nil {
+		var err error
+		if input, err = protojson.Marshal(req.GetInput()); err != nil {
+			return nil, apierror.InvalidRequest("Invalid request: input could not be encoded")
+		}
+	}
+	if err := s.limit(ctx, grpc.SetHeader, 1, utf8.RuneCountInString(req.GetInput().GetFields()["text"].GetStringValue()), req.GetType()); err != nil {
+		return nil, err
+	}
+	job, apiErr := s.cfg.Jobs.CreateJob(ctx, auth.OwnerFromContext(ctx), handlers.CreateJobRequest{Type: req.GetType(), Input: input, CallbackURL: req.GetCallbackUrl()})
+	if apiErr != nil {
+		if apiErr.Code == apierror.CodeQueueFull {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(handlers.QueueFullRetryAfter)))
+		}
+		return nil, apiErr
+	}
+	return jobMessage(job)
+}
+
+func (s *gatewayServer) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	job, apiErr := s.cfg.Jobs.GetJob(auth.OwnerFromContext(ctx), req.GetId())
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return jobMessage(job)
+}
+
+// limit applies the rate limit policies of routes, as the REST route's
+// limiter middleware does, taking one token per request or batch item. The
+// rate limit headers are sent as header metadata.
+func (s *gatewayServer) limit(ctx context.Context, setHeader func(context.Context, metadata.MD) error, tokens, chars int, routes ...string) error {
+	h := make(http.Header)
+	client := ratelimit.ClientKeyFor(s.cfg.TenantKeys.Tenant(incoming(ctx, metadataAPIKey)), clientIP(ctx))
+	apiErr := s.cfg.Limiter.Check(ctx, routes, client, tokens, int64(chars), h)
+	if len(h) > 0 {
+		md := make(metadata.MD, len(h))
+		for k, v := range h {
+			md[strings.ToLower(k)] = v
+		}
+		_ = setHeader(ctx, md)
+	}
+	if apiErr != nil {
+		return apiErr
+	}
+	return nil
+}
+
+// streamHeader sets header metadata on a stream
+func streamHeader(stream grpc.ServerStream) func(context.Context, metadata.MD) error {
+	return func(_ context.Context, md metadata.MD) error {
+		return stream.SetHeader(md)
+	}
+}
+
+type adminServer struct {
+	pb.UnimplementedAdminServer
+	admin *handlers.AdminHandler
+}
+
+func (s *adminServer) QueryAudit(ctx context.Context, req *pb.QueryAuditRequest) (*pb.QueryAuditResponse, error) {
+	filter := audit.Filter{
+		Principal: req.GetPrincipal(),
+		Tenant:    req.GetTenant(),
+		Action:    req.GetAction(),
+		Route:     req.GetRoute(),
+		AfterSeq:  req.GetAfterSeq(),
+	}
+	if req.GetSince() != nil {
+		filter.Since = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		filter.Until = req.GetUntil().AsTime()
+	}
+	page, apiErr := s.admin.QueryAudit(ctx, filter, int(req.GetLimit()))
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	out := &pb.QueryAuditResponse{Records: make([]*pb.AuditRecord, len(page.Records)), NextAfterSeq: page.NextAfterSeq}
+	for i := range page.Records {
+		out.Records[i] = auditRecord(&page.Records[i])
+	}
+	return out, nil
+}
+
+func (s *adminServer) VerifyAudit(ctx context.Context, _ *pb.VerifyAuditRequest) (*pb.AuditVerification, error) {
+	result, apiErr := s.admin.VerifyAudit(ctx)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &pb.AuditVerification{
+		Valid:    result.Valid,
+		Records:  result.Records,
+		BadSeq:   result.BadSeq,
+		Reason:   result.Reason,
+		HeadHash: result.Head,
+	}, nil
+}
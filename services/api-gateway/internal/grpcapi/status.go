@@ -0,0 +1,116 @@
+package grpcapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatusError converts an *apierror.Error to the gRPC status error clients
+// receive. Other errors are returned as they are.
+func toStatusError(err error) error {
+	if apiErr, ok := apierror.As(err); ok {
+		return grpcStatus(apiErr).Err()
+	}
+	return err
+}
+
+// codeOf returns the gRPC status code err is returned with
+func codeOf(err error) codes.Code {
+	if apiErr, ok := apierror.As(err); ok {
+		return grpcCode(apiErr.Status)
+	}
+	return status.Code(err)
+}
+
+// grpcStatus converts an error envelope to a gRPC status. The status code is
+// derived from the HTTP status, and a google.rpc.ErrorInfo detail carries the
+// rest of the envelope (reason = code, domain = service).
+func grpcStatus(e *apierror.Error) *status.Status {
+	st := status.New(grpcCode(e.Status), e.Message)
+	info := &errdetails.ErrorInfo{
+		Reason:   e.Code,
+		Domain:   e.Service,
+		Metadata: map[string]string{"retryable": strconv.FormatBool(e.Retryable)},
+	}
+	if e.RequestID != "" {
+		info.Metadata["request_id"] = e.RequestID
+	}
+	if withInfo, err := st.WithDetails(info); err == nil {
+		return withInfo
+	}
+	return st
+}
+
+// grpcCode maps an HTTP status to the closest gRPC status code
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	switch {
+	case status >= 400 && status < 500:
+		return codes.InvalidArgument
+	case status >= 500:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// httpStatus maps a gRPC status code to the HTTP status the REST API would
+// have answered with, for status codes that did not come from an
+// *apierror.Error
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client closed the request, as reported by nginx
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusUnprocessableEntity
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"privacypilot-api-gateway/internal/audit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes for GET /api/v1/admin/audit
+const (
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 1000
+)
+
+// AuditPageResponse is one page of audit records. NextAfterSeq is set when
+// more records match; pass it back as after_seq to get the next page.
+type AuditPageResponse struct {
+	Records      []audit.Record `json:"records"`
+	NextAfterSeq uint64         `json:"next_after_seq,omitempty"`
+}
+
+// AdminHandler serves the admin API
+type AdminHandler struct {
+	Audit *audit.Log
+}
+
+// NewAdminHandler creates a new handler instance
+func NewAdminHandler(auditLog *audit.Log) *AdminHandler {
+	return &AdminHandler{
+		Audit: auditLog,
+	}
+}
+
+// HandleQueryAudit lists audit records, filtered by the principal, tenant,
+// action, route, since, until and after_seq query parameters
+func (h *AdminHandler) HandleQueryAudit(c *gin.Context) {
+	filter := audit.Filter{
+		Principal: c.Query("principal"),
+		Tenant:    c.Query("tenant"),
+		Action:    c.Query("action"),
+		Route:     c.Query("route"),
+	}
+	var err error
+	if filter.Since, err = queryTime(c, "since"); err != nil {
+		apierror.Respond(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+	if filter.Until, err = queryTime(c, "until"); err != nil {
+		apierror.Respond(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+	if v := c.Query("after_seq"); v != "" {
+		if filter.AfterSeq, err = strconv.ParseUint(v, 10, 64); err != nil {
+			apierror.Respond(c, apierror.InvalidRequest("Invalid request: after_seq must be a non-negative integer"))
+			return
+		}
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			apierror.Respond(c, invalidAuditLimit())
+			return
+		}
+	}
+
+	resp, apiErr := h.QueryAudit(c.Request.Context(), filter, limit)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// QueryAudit returns one page of matching audit records; a limit of 0 means
+// DefaultAuditPageSize. It is shared by the HTTP and gRPC APIs.
+func (h *AdminHandler) QueryAudit(ctx context.Context, filter audit.Filter, limit int) (*AuditPageResponse, *apierror.Error) {
+	if limit == 0 {
+		limit = DefaultAuditPageSize
+	}
+	if limit < 1 || limit > MaxAuditPageSize {
+		return nil, invalidAuditLimit()
+	}
+
+	records, more, err := audit.Query(h.Audit.Sink(), filter, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to query audit log", "error", err)
+		return nil, apierror.Internal("Failed to read the audit log")
+	}
+	resp := &AuditPageResponse{Records: records}
+	if more {
+		resp.NextAfterSeq = records[len(records)-1].Seq
+	}
+	return resp, nil
+}
+
+// HandleVerifyAudit checks the whole audit chain and reports the first broken record
+func (h *AdminHandler) HandleVerifyAudit(c *gin.Context) {
+	result, apiErr := h.VerifyAudit(c.Request.Context())
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifyAudit checks the whole audit chain. It is shared by the HTTP and gRPC
+// APIs.
+func (h *AdminHandler) VerifyAudit(ctx context.Context) (*audit.Verification, *apierror.Error) {
+	result, err := audit.Verify(h.Audit.Sink())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to verify audit log", "error", err)
+		return nil, apierror.Internal("Failed to read the audit log")
+	}
+	if !result.Valid {
+		slog.ErrorContext(ctx, "Audit chain verification failed", "bad_seq", result.BadSeq, "reason", result.Reason)
+	}
+	return &result, nil
+}
+
+func invalidAuditLimit() *apierror.Error {
+	return apierror.InvalidRequest(fmt.Sprintf("Invalid request: limit must be between 1 and %d", MaxAuditPageSize))
+}
+
+// queryTime parses an optional RFC 3339 query parameter
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid request: %s must be an RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
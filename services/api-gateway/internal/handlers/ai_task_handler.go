@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/clients"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AI task types accepted by POST /api/v1/ai/tasks. They are forwarded to the
+// coordinator's /process; only the types it can run are listed.
+const (
+	AITaskAnonymizeText = "anonymize_text"
+)
+
+// AITaskScopePrefix prefixes the scope an API key needs for a task type, e.g.
+// "ai:anonymize_text"; "ai:*" grants every task
+const AITaskScopePrefix = "ai:"
+
+// aiTaskSpec allow-lists what a task type may send to the coordinator. Every
+// payload field and config hint is a string.
+type aiTaskSpec struct {
+	rateLimitRoute string   // Policy the task is charged against
+	payload        []string // Allowed payload fields
+	required       []string // Payload fields that must be set
+	config         []string // Allowed config hints
+}
+
+var aiTaskSpecs = map[string]aiTaskSpec{
+	AITaskAnonymizeText: {rateLimitRoute: "anonymize", payload: []string{"text"}, required: []string{"text"}, config: []string{"model"}},
+}
+
+// AITaskTypes returns the task types POST /api/v1/ai/tasks accepts, sorted
+func AITaskTypes() []string {
+	types := make([]string, 0, len(aiTaskSpecs))
+	for t := range aiTaskSpecs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// AITaskScope is the scope an API key needs to run taskType
+func AITaskScope(taskType string) string {
+	return AITaskScopePrefix + taskType
+}
+
+// AITaskScopeOf returns the scope needed for the task in a request body, or
+// "" (which no key is granted) if the body names no task
+func AITaskScopeOf(body []byte) string {
+	var req struct {
+		TaskType string `json:"task_type"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.TaskType == "" {
+		return ""
+	}
+	return AITaskScope(req.TaskType)
+}
+
+// AITaskRateLimitRoute picks the rate limit policy and character count for an
+// AI task request body (see ratelimit.Limiter.MiddlewareByBody)
+func AITaskRateLimitRoute(body []byte) (string, int64) {
+	var req struct {
+		TaskType string `json:"task_type"`
+		Payload  struct {
+			Text string `json:"text"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", 0
+	}
+	return AITaskRateLimitRouteFor(req.TaskType), int64(utf8.RuneCountInString(req.Payload.Text))
+}
+
+// AITaskRateLimitRouteFor names the rate limit policy taskType is charged
+// against ("" for unknown types, which are rejected by the handler)
+func AITaskRateLimitRouteFor(taskType string) string {
+	return aiTaskSpecs[taskType].rateLimitRoute
+}
+
+// AITaskRequest represents the expected input to the AI task endpoint
+type AITaskRequest struct {
+	TaskType string                 `json:"task_type" binding:"required"`
+	Payload  map[string]interface{} `json:"payload" binding:"required"`
+	Config   map[string]string      `json:"config,omitempty"` // Optional hints, e.g. "model" for anonymize_text
+}
+
+// AITaskResponse carries the coordinator's result unchanged
+type AITaskResponse struct {
+	TaskType string          `json:"task_type"`
+	Result   json.RawMessage `json:"result"`
+}
+
+// errNoCoordinator is returned when no AI coordinator is configured
+var errNoCoordinator = apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "AI tasks need AI_COORDINATOR_URL to be configured")
+
+// AITaskHandler runs allow-listed tasks on the AI coordinator directly
+type AITaskHandler struct {
+	Coordinator *clients.AICoordinatorClient // nil when no coordinator is configured
+}
+
+// NewAITaskHandler creates a new handler instance
+func NewAITaskHandler(coordinatorClient *clients.AICoordinatorClient) *AITaskHandler {
+	return &AITaskHandler{
+		Coordinator: coordinatorClient,
+	}
+}
+
+// HandleRunTask forwards a task to the coordinator and returns its result.
+// The caller's scope for the task type is checked by the route's middleware.
+func (h *AITaskHandler) HandleRunTask(c *gin.Context) {
+	var req AITaskRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid AI task request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	resp, apiErr := h.RunTask(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RunTask checks a task against its allow-list and runs it on the
+// coordinator. Coordinator errors are passed through. It is shared by the
+// HTTP and gRPC APIs.
+func (h *AITaskHandler) RunTask(ctx context.Context, req AITaskRequest) (*AITaskResponse, *apierror.Error) {
+	spec, ok := aiTaskSpecs[req.TaskType]
+	if !ok {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeUnsupportedTask, fmt.Sprintf("Unsupported task type: %s (expected one of %s)", req.TaskType, strings.Join(AITaskTypes(), ", ")))
+	}
+	if apiErr := spec.check(req); apiErr != nil {
+		return nil, apiErr
+	}
+
+	text, _ := req.Payload["text"].(string)
+	imageURL, _ := req.Payload["image_url"].(string)
+	audit.Input(ctx, text, imageURL)
+	audit.Model(ctx, req.Config["model"])
+
+	if h.Coordinator == nil {
+		return nil, errNoCoordinator
+	}
+	result, err := h.Coordinator.RunTask(ctx, req.TaskType, req.Payload, req.Config)
+	if err != nil {
+		slog.WarnContext(ctx, "AI task failed", "task_type", req.TaskType, "error", err)
+		return nil, apierror.From(err, "Failed to run AI task")
+	}
+	if len(result) == 0 {
+		result = json.RawMessage("{}")
+	}
+
+	var anonymized struct {
+		AnonymizedText string `json:"anonymized_text"`
+	}
+	if req.TaskType == AITaskAnonymizeText && json.Unmarshal(result, &anonymized) == nil {
+		audit.Output(ctx, anonymized.AnonymizedText)
+	} else {
+		audit.Verdict(ctx, result)
+	}
+	return &AITaskResponse{TaskType: req.TaskType, Result: result}, nil
+}
+
+// check rejects payload fields and config hints the task does not allow, as
+// well as missing or non-string values
+func (s aiTaskSpec) check(req AITaskRequest) *apierror.Error {
+	for _, name := range slices.Sorted(maps.Keys(req.Payload)) { // Sorted, so the same request always gets the same error
+		value := req.Payload[name]
+		if !slices.Contains(s.payload, name) {
+			return apierror.InvalidRequest(fmt.Sprintf("Invalid request: payload.%s is not allowed for task %s", name, req.TaskType))
+		}
+		if _, ok := value.(string); !ok {
+			return apierror.InvalidRequest(fmt.Sprintf("Invalid request: payload.%s must be a string", name))
+		}
+	}
+	for _, name := range s.required {
+		if v, _ := req.Payload[name].(string); v == "" {
+			return apierror.InvalidRequest(fmt.Sprintf("Invalid request: payload.%s is required for task %s", name, req.TaskType))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Config)) {
+		if !slices.Contains(s.config, name) {
+			return apierror.InvalidRequest(fmt.Sprintf("Invalid request: config.%s is not allowed for task %s", name, req.TaskType))
+		}
+	}
+	return nil
+}
@@ -1,28 +1,72 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
 	"privacypilot-api-gateway/internal/clients"
+	"privacypilot-api-gateway/internal/reversible"
+	"privacypilot-api-gateway/internal/streaming"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AnonymizeRequest represents the expected input to the API Gateway's endpoint
 type AnonymizeGatewayRequest struct {
+	Text  string `json:"text" binding:"required"`
+	Model string `json:"model,omitempty"` // Optional: model to use instead of the adapter's default
+	Cache string `json:"cache,omitempty"` // Optional: "refresh" or "bypass" the anonymizer's result cache
+	// Optional: number the placeholders and return a token for POST /api/v1/deanonymize
+	Reversible bool `json:"reversible,omitempty"`
+}
+
+// AnonymizeBatchItemRequest is a single record in a batch request
+type AnonymizeBatchItemRequest struct {
+	ID   string `json:"id" binding:"required"`
 	Text string `json:"text" binding:"required"`
 }
 
+// AnonymizeBatchGatewayRequest represents the expected input to the batch endpoint
+type AnonymizeBatchGatewayRequest struct {
+	Items       []AnonymizeBatchItemRequest `json:"items" binding:"required,min=1,dive"`
+	Concurrency int                         `json:"concurrency,omitempty"` // Optional: lower the server's concurrency for this batch
+}
+
+// AnonymizeBatchGatewayResponse holds per-item results in request order
+type AnonymizeBatchGatewayResponse struct {
+	Results   []clients.AnonymizeBatchResult `json:"results"`
+	Succeeded int                            `json:"succeeded"`
+	Failed    int                            `json:"failed"`
+}
+
+// Defaults for batch processing, overridable via the handler fields
+const (
+	DefaultBatchConcurrency = 8
+	DefaultMaxBatchItems    = 1000
+)
+
 // AnonymizeHandler holds dependencies for the handler, like the client
 type AnonymizeHandler struct {
-	Anonymizer *clients.AnonymizerClient
+	Anonymizer       *clients.AnonymizerClient
+	BatchConcurrency int                // Maximum concurrent anonymizer calls per batch
+	MaxBatchItems    int                // Maximum number of items accepted in one batch
+	Sealer           *reversible.Sealer // Issues deanonymize tokens; nil refuses reversible requests
 }
 
 // NewAnonymizeHandler creates a new handler instance
 func NewAnonymizeHandler(anonymizerClient *clients.AnonymizerClient) *AnonymizeHandler {
 	return &AnonymizeHandler{
-		Anonymizer: anonymizerClient,
+		Anonymizer:       anonymizerClient,
+		BatchConcurrency: DefaultBatchConcurrency,
+		MaxBatchItems:    DefaultMaxBatchItems,
 	}
 }
 
@@ -31,20 +75,245 @@ func (h *AnonymizeHandler) HandleAnonymize(c *gin.Context) {
 	var req AnonymizeGatewayRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("API Gateway: Error binding JSON for /anonymize: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		slog.InfoContext(c.Request.Context(), "Invalid anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
 		return
 	}
 
-	// Call the anonymizer service via the client
-	anonymizeResp, err := h.Anonymizer.AnonymizeText(req.Text)
-	if err != nil {
-		log.Printf("API Gateway: Error calling anonymizer service: %v", err)
-		// Determine appropriate status code based on error type if possible
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to process request with anonymizer service"})
+	anonymizeResp, apiErr := h.Anonymize(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
 		return
 	}
 
 	// Return the response from the anonymizer service directly
 	c.JSON(http.StatusOK, anonymizeResp)
 }
+
+// Anonymize anonymizes one text. It is shared by the HTTP and gRPC APIs.
+func (h *AnonymizeHandler) Anonymize(ctx context.Context, req AnonymizeGatewayRequest) (*clients.AnonymizerResponse, *apierror.Error) {
+	if req.Text == "" {
+		return nil, apierror.InvalidRequest("Invalid request: text is required")
+	}
+	if !clients.ValidCacheMode(req.Cache) {
+		return nil, apierror.InvalidRequest("Invalid request: cache must be refresh or bypass")
+	}
+	if req.Reversible && h.Sealer == nil {
+		return nil, errDeanonymizeDisabled
+	}
+
+	audit.Input(ctx, req.Text)
+	audit.Model(ctx, req.Model)
+
+	// Call the anonymizer service via the client
+	anonymizeResp, err := h.Anonymizer.AnonymizeText(ctx, req.Text, req.Model, req.Cache)
+	if err != nil {
+		slog.WarnContext(ctx, "Anonymization failed", "error", err)
+		// Downstream errors keep their status and code (e.g. 404 model_not_found)
+		return nil, apierror.From(err, "Failed to process request with anonymizer service")
+	}
+	if req.Reversible {
+		if apiErr := h.makeReversible(ctx, req.Text, anonymizeResp); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+
+	audit.Output(ctx, anonymizeResp.AnonymizedText)
+	return anonymizeResp, nil
+}
+
+// makeReversible numbers the placeholders of resp and seals the values they
+// replaced into a deanonymize token for the caller
+func (h *AnonymizeHandler) makeReversible(ctx context.Context, original string, resp *clients.AnonymizerResponse) *apierror.Error {
+	numbered, mapping, err := reversible.Number(original, resp.AnonymizedText)
+	if err != nil {
+		slog.WarnContext(ctx, "Anonymization cannot be made reversible", "error", err)
+		return apierror.New(http.StatusBadGateway, apierror.CodeUpstreamError, "The anonymized text does not keep the original around its placeholders, so it cannot be deanonymized; retry with cache set to refresh")
+	}
+	token, err := h.Sealer.Seal(auth.OwnerFromContext(ctx), mapping)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to seal deanonymize token", "error", err)
+		return apierror.Internal("Failed to issue a deanonymize token")
+	}
+	resp.AnonymizedText = numbered
+	resp.DeanonymizeToken = token
+	return nil
+}
+
+// HandleAnonymizeBatch anonymizes many records in one call. Individual failures
+// are reported per item and never fail the whole batch.
+func (h *AnonymizeHandler) HandleAnonymizeBatch(c *gin.Context) {
+	var req AnonymizeBatchGatewayRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid batch anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	resp, apiErr := h.AnonymizeBatch(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AnonymizeBatch anonymizes a batch of records. It is shared by the HTTP and
+// gRPC APIs.
+func (h *AnonymizeHandler) AnonymizeBatch(ctx context.Context, req AnonymizeBatchGatewayRequest) (*AnonymizeBatchGatewayResponse, *apierror.Error) {
+	if len(req.Items) == 0 {
+		return nil, apierror.InvalidRequest("Invalid request: items must not be empty")
+	}
+	if len(req.Items) > h.MaxBatchItems {
+		return nil, apierror.InvalidRequest(fmt.Sprintf("Invalid request: batch exceeds the maximum of %d items", h.MaxBatchItems))
+	}
+
+	// IDs are how callers match results to records, so they must be unique
+	items := make([]clients.AnonymizeBatchItem, len(req.Items))
+	texts := make([]string, len(req.Items))
+	seen := make(map[string]struct{}, len(req.Items))
+	for i, item := range req.Items {
+		if item.ID == "" || item.Text == "" {
+			return nil, apierror.InvalidRequest(fmt.Sprintf("Invalid request: item %d requires an id and a text", i+1))
+		}
+		if _, dup := seen[item.ID]; dup {
+			return nil, apierror.InvalidRequest(fmt.Sprintf("Invalid request: duplicate item id '%s'", item.ID))
+		}
+		seen[item.ID] = struct{}{}
+		items[i] = clients.AnonymizeBatchItem{ID: item.ID, Text: item.Text}
+		texts[i] = item.Text
+	}
+	audit.Input(ctx, texts...)
+
+	// Callers may lower, but never raise, the configured concurrency
+	concurrency := h.BatchConcurrency
+	if req.Concurrency > 0 && req.Concurrency < concurrency {
+		concurrency = req.Concurrency
+	}
+
+	slog.InfoContext(ctx, "Anonymizing batch", "item_count", len(items), "concurrency", concurrency)
+	results := h.Anonymizer.AnonymizeBatch(ctx, items, concurrency)
+
+	resp := &AnonymizeBatchGatewayResponse{Results: results}
+	outputs := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Error != nil {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+			outputs = append(outputs, r.AnonymizedText)
+		}
+	}
+	audit.Output(ctx, outputs...)
+	if resp.Failed > 0 {
+		slog.WarnContext(ctx, "Batch finished with failed items", "failed", resp.Failed, "item_count", len(results))
+	}
+	return resp, nil
+}
+
+// SSE event names emitted by HandleAnonymizeStream
+const (
+	StreamEventToken = "token" // data: {"text": "..."} - a safe-to-show piece of output
+	StreamEventDone  = "done"  // data: {"anonymized_text": "...", "model_used": "..."}
+	StreamEventError = "error" // data: {"error": {...}} - the standard error envelope
+)
+
+// StreamResult is the outcome of a completed stream
+type StreamResult struct {
+	AnonymizedText string `json:"anonymized_text"`
+	ModelUsed      string `json:"model_used"`
+}
+
+// HandleAnonymizeStream streams anonymized output as Server-Sent Events
+func (h *AnonymizeHandler) HandleAnonymizeStream(c *gin.Context) {
+	var req AnonymizeGatewayRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid streaming anonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	// The event stream is only started once there is something to send, so
+	// failures before any output (e.g. model_not_found) keep their HTTP status
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+		c.Status(http.StatusOK)
+	}
+
+	result, apiErr := h.AnonymizeStream(c.Request.Context(), req, func(text string) error {
+		start()
+		c.SSEvent(StreamEventToken, gin.H{"text": text})
+		c.Writer.Flush()
+		return nil
+	})
+	if apiErr != nil {
+		if !started {
+			apierror.Respond(c, apiErr)
+			return
+		}
+		c.SSEvent(StreamEventError, apierror.Envelope{Error: apierror.ForRequest(c, apiErr)})
+		c.Writer.Flush()
+		return
+	}
+
+	start()
+	c.SSEvent(StreamEventDone, result)
+	c.Writer.Flush()
+}
+
+// AnonymizeStream anonymizes a text, passing each safe-to-show piece of
+// output to emit as it is generated. Output passes through a
+// streaming.Holdback so partial placeholders, partial words and prefixes of
+// PII values found in the input are never emitted. It is shared by the HTTP
+// and gRPC APIs.
+func (h *AnonymizeHandler) AnonymizeStream(ctx context.Context, req AnonymizeGatewayRequest, emit func(text string) error) (*StreamResult, *apierror.Error) {
+	if req.Text == "" {
+		return nil, apierror.InvalidRequest("Invalid request: text is required")
+	}
+
+	audit.Input(ctx, req.Text)
+	audit.Model(ctx, req.Model)
+
+	holdback := streaming.NewHoldback(req.Text)
+	var released strings.Builder
+	release := func(text string) error {
+		if text == "" {
+			return nil
+		}
+		released.WriteString(text)
+		return emit(text)
+	}
+
+	var modelUsed string
+	err := h.Anonymizer.AnonymizeTextStream(ctx, req.Text, req.Model, func(chunk clients.AnonymizeStreamChunk) error {
+		switch {
+		case chunk.Error != nil:
+			return chunk.Error
+		case chunk.Done:
+			modelUsed = chunk.ModelUsed
+			return release(holdback.Flush())
+		default:
+			return release(holdback.Push(chunk.Token))
+		}
+	})
+	if err != nil {
+		// Held back text is discarded: it may be an unfinished PII value
+		slog.WarnContext(ctx, "Streaming anonymization failed", "error", err)
+		return nil, apierror.From(err, "Failed to process request with anonymizer service")
+	}
+
+	result := &StreamResult{AnonymizedText: strings.TrimSpace(released.String()), ModelUsed: modelUsed}
+	audit.Model(ctx, modelUsed)
+	audit.Output(ctx, result.AnonymizedText)
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/reversible"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeanonymizeRequest is the input to POST /api/v1/deanonymize: a text with
+// the numbered placeholders of a reversible anonymization, e.g. the
+// anonymized text or something derived from it, and that anonymization's token
+type DeanonymizeRequest struct {
+	Text  string `json:"text" binding:"required"`
+	Token string `json:"deanonymize_token" binding:"required"`
+}
+
+// DeanonymizeResponse carries the restored text
+type DeanonymizeResponse struct {
+	Text     string `json:"text"`
+	Restored int    `json:"restored"` // Placeholders replaced by their original values
+}
+
+// errDeanonymizeDisabled is returned when no DEANONYMIZE_KEY is configured
+var errDeanonymizeDisabled = apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Deanonymization is disabled on this gateway")
+
+// DeanonymizeHandler restores texts from the tokens of reversible
+// anonymizations. It calls no other service.
+type DeanonymizeHandler struct {
+	Sealer *reversible.Sealer // nil disables the route
+}
+
+// NewDeanonymizeHandler creates a new handler instance
+func NewDeanonymizeHandler(sealer *reversible.Sealer) *DeanonymizeHandler {
+	return &DeanonymizeHandler{Sealer: sealer}
+}
+
+// HandleDeanonymize is the Gin handler function
+func (h *DeanonymizeHandler) HandleDeanonymize(c *gin.Context) {
+	var req DeanonymizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid deanonymization request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	resp, apiErr := h.Deanonymize(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Deanonymize restores the values req's token holds in req's text. Tokens
+// only open for the caller they were issued to (see auth.Owner); any other
+// token is refused with the same error, so callers cannot probe them.
+func (h *DeanonymizeHandler) Deanonymize(ctx context.Context, req DeanonymizeRequest) (*DeanonymizeResponse, *apierror.Error) {
+	if h.Sealer == nil {
+		return nil, errDeanonymizeDisabled
+	}
+
+	audit.Input(ctx, req.Text)
+	mapping, err := h.Sealer.Open(auth.OwnerFromContext(ctx), req.Token)
+	if err != nil {
+		return nil, apierror.InvalidRequest("Invalid request: deanonymize_token was not issued to this caller or is malformed")
+	}
+
+	text, counts := reversible.Restore(req.Text, mapping)
+	audit.Restored(ctx, text, counts)
+	restored := 0
+	for _, n := range counts {
+		restored += n
+	}
+	return &DeanonymizeResponse{Text: text, Restored: restored}, nil
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/clients"
+	"privacypilot-api-gateway/internal/jobs"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job types accepted by POST /api/v1/jobs
+const (
+	JobTypeAnonymize = "anonymize"
+	JobTypeModerate  = "moderate"
+)
+
+// CreateJobRequest represents the expected input to the job submission endpoint.
+// Input has the same shape as the body of the matching synchronous route.
+type CreateJobRequest struct {
+	Type        string          `json:"type" binding:"required"`
+	Input       json.RawMessage `json:"input" binding:"required"`
+	CallbackURL string          `json:"callback_url,omitempty"` // Optional: receives a signed webhook on completion
+}
+
+// JobsHandler holds dependencies for the async job endpoints
+type JobsHandler struct {
+	Manager *jobs.Manager
+}
+
+// NewJobsHandler creates a new handler instance
+func NewJobsHandler(manager *jobs.Manager) *JobsHandler {
+	return &JobsHandler{
+		Manager: manager,
+	}
+}
+
+// HandleCreateJob validates and enqueues a job, responding with 202 and its ID
+func (h *JobsHandler) HandleCreateJob(c *gin.Context) {
+	var req CreateJobRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid job request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	job, apiErr := h.CreateJob(c.Request.Context(), auth.Owner(c), req)
+	if apiErr != nil {
+		if apiErr.Code == apierror.CodeQueueFull {
+			c.Header("Retry-After", strconv.Itoa(QueueFullRetryAfter))
+		}
+		apierror.Respond(c, apiErr)
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// QueueFullRetryAfter is the number of seconds callers are asked to wait
+// when the job queue is full
+const QueueFullRetryAfter = 30
+
+// CreateJob validates and enqueues a job that only owner may read (see
+// auth.Owner). It is shared by the HTTP and gRPC APIs.
+func (h *JobsHandler) CreateJob(ctx context.Context, owner string, req CreateJobRequest) (*jobs.Job, *apierror.Error) {
+	if req.Type == "" || len(req.Input) == 0 {
+		return nil, apierror.InvalidRequest("Invalid request: type and input are required")
+	}
+	if req.CallbackURL != "" {
+		if !h.Manager.CallbacksEnabled() {
+			return nil, apierror.InvalidRequest("Invalid request: callbacks are not enabled on this gateway")
+		}
+		// Webhooks must not be pointed at the gateway's own network
+		if err := h.Manager.CheckCallbackURL(ctx, req.CallbackURL); err != nil {
+			return nil, apierror.InvalidRequest("Invalid request: " + err.Error())
+		}
+	}
+
+	// Only the parts of the input that are audited; the job task validates it
+	var input struct {
+		Text     string `json:"text"`
+		ImageURL string `json:"imageUrl"`
+		Model    string `json:"model"`
+	}
+	if json.Unmarshal(req.Input, &input) == nil {
+		switch req.Type {
+		case JobTypeAnonymize:
+			audit.Action(ctx, audit.ActionAnonymize)
+			audit.Input(ctx, input.Text)
+		case JobTypeModerate:
+			audit.Action(ctx, audit.ActionModerate)
+			audit.Input(ctx, input.Text, input.ImageURL)
+		}
+		audit.Model(ctx, input.Model)
+	}
+
+	job, err := h.Manager.Submit(ctx, owner, req.Type, req.Input, req.CallbackURL)
+	switch {
+	case errors.Is(err, jobs.ErrUnknownType):
+		return nil, apierror.InvalidRequest(fmt.Sprintf("Invalid request: unsupported job type '%s'", req.Type))
+	case errors.Is(err, jobs.ErrQueueFull):
+		slog.WarnContext(ctx, "Job queue full, rejecting job", "job_type", req.Type)
+		return nil, apierror.New(http.StatusServiceUnavailable, apierror.CodeQueueFull, "Job queue is full, retry later")
+	case errors.Is(err, jobs.ErrStopped):
+		return nil, apierror.New(http.StatusServiceUnavailable, apierror.CodeShuttingDown, "The gateway is shutting down, retry later")
+	case err != nil:
+		return nil, apierror.InvalidRequest("Invalid request: " + err.Error())
+	}
+
+	audit.Job(ctx, job.ID)
+	slog.InfoContext(ctx, "Queued job", "job_id", job.ID, "job_type", job.Type)
+	return job, nil
+}
+
+// HandleGetJob reports the status (and result, once finished) of a job
+func (h *JobsHandler) HandleGetJob(c *gin.Context) {
+	job, apiErr := h.GetJob(auth.Owner(c), c.Param("id"))
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJob looks up a job of owner. Other callers' jobs are reported as not
+// found, so their IDs cannot be probed. It is shared by the HTTP and gRPC APIs.
+func (h *JobsHandler) GetJob(owner, id string) (*jobs.Job, *apierror.Error) {
+	job, err := h.Manager.Get(id)
+	if err != nil || job.Owner() != owner {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "Job not found or expired")
+	}
+	return job, nil
+}
+
+// AnonymizeJobTask runs anonymize jobs through the anonymizer client
+func AnonymizeJobTask(anonymizer *clients.AnonymizerClient) jobs.Task {
+	return jobs.Task{
+		Validate: func(input json.RawMessage) error {
+			var req AnonymizeGatewayRequest
+			if err := json.Unmarshal(input, &req); err != nil || req.Text == "" {
+				return errors.New("anonymize input requires a non-empty 'text' field")
+			}
+			if !clients.ValidCacheMode(req.Cache) {
+				return errors.New("anonymize input 'cache' must be 'refresh' or 'bypass'")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, input json.RawMessage) (interface{}, error) {
+			var req AnonymizeGatewayRequest
+			if err := json.Unmarshal(input, &req); err != nil {
+				return nil, fmt.Errorf("invalid anonymize input: %w", err)
+			}
+			return anonymizer.AnonymizeText(ctx, req.Text, req.Model, req.Cache)
+		},
+	}
+}
+
+// ModerateJobTask runs moderate jobs through the moderation client
+func ModerateJobTask(moderator *clients.ModerationClient) jobs.Task {
+	return jobs.Task{
+		Validate: func(input json.RawMessage) error {
+			var req ModerateGatewayRequest
+			if err := json.Unmarshal(input, &req); err != nil || (req.Text == "" && req.ImageURL == "") {
+				return errors.New("moderate input requires 'text' or 'imageUrl'")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, input json.RawMessage) (interface{}, error) {
+			var req ModerateGatewayRequest
+			if err := json.Unmarshal(input, &req); err != nil {
+				return nil, fmt.Errorf("invalid moderate input: %w", err)
+			}
+			return moderator.ModerateContent(ctx, req.Text, req.ImageURL)
+		},
+	}
+}
+
+// JobRateLimitRoute maps a job submission body to the rate limit policy of the
+// equivalent synchronous route and the number of characters it submits
+func JobRateLimitRoute(body []byte) (string, int64) {
+	var req struct {
+		Type  string `json:"type"`
+		Input struct {
+			Text string `json:"text"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", 0
+	}
+	return req.Type, int64(utf8.RuneCountInString(req.Input.Text))
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 
+	"privacypilot-api-gateway/internal/audit"
 	"privacypilot-api-gateway/internal/clients"
 
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -34,26 +40,41 @@ func (h *ModerateHandler) HandleModerate(c *gin.Context) {
 	// Use Bind instead of ShouldBindJSON if you want to handle empty body gracefully
 	// Or check if text and imageUrl are both empty after binding
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("API Gateway: Error binding JSON for /moderate: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		slog.InfoContext(c.Request.Context(), "Invalid moderation request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	moderationResp, apiErr := h.Moderate(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
 		return
 	}
 
+	// Return the response from the moderation service
+	c.JSON(http.StatusOK, moderationResp)
+}
+
+// Moderate moderates a text and/or image. It is shared by the HTTP and gRPC
+// APIs.
+func (h *ModerateHandler) Moderate(ctx context.Context, req ModerateGatewayRequest) (*clients.ModerationResponse, *apierror.Error) {
 	// Basic validation: Ensure at least one field is present
 	if req.Text == "" && req.ImageURL == "" {
-		log.Printf("API Gateway: Moderation request missing text and imageUrl")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: text or imageUrl must be provided"})
-		return
+		slog.InfoContext(ctx, "Moderation request missing text and imageUrl")
+		return nil, apierror.InvalidRequest("Invalid request: text or imageUrl must be provided")
 	}
 
+	audit.Input(ctx, req.Text, req.ImageURL)
+
 	// Call the moderation service via the client
-	moderationResp, err := h.Moderator.ModerateContent(req.Text, req.ImageURL)
+	moderationResp, err := h.Moderator.ModerateContent(ctx, req.Text, req.ImageURL)
 	if err != nil {
-		log.Printf("API Gateway: Error calling moderation service: %v", err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to process request with moderation service"})
-		return
+		slog.WarnContext(ctx, "Moderation failed", "error", err)
+		return nil, apierror.From(err, "Failed to process request with moderation service")
 	}
 
-	// Return the response from the moderation service
-	c.JSON(http.StatusOK, moderationResp)
+	if verdict, err := json.Marshal(moderationResp); err == nil {
+		audit.Verdict(ctx, verdict)
+	}
+	return moderationResp, nil
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/pipeline"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PipelineGatewayRequest represents the expected input to the pipelines endpoint
+type PipelineGatewayRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// PipelineHandler runs the configured pipelines
+type PipelineHandler struct {
+	Pipelines *pipeline.Config // nil when no pipelines are configured
+	Runner    *pipeline.Runner
+}
+
+// NewPipelineHandler creates a new handler instance
+func NewPipelineHandler(pipelines *pipeline.Config, runner *pipeline.Runner) *PipelineHandler {
+	return &PipelineHandler{
+		Pipelines: pipelines,
+		Runner:    runner,
+	}
+}
+
+// RateLimitRoutes resolves the rate limit policies of the addressed pipeline
+// (none for an unknown pipeline, which the handler rejects)
+func (h *PipelineHandler) RateLimitRoutes(c *gin.Context) []string {
+	return h.RateLimitRoutesFor(c.Param("name"))
+}
+
+// RateLimitRoutesFor resolves the rate limit policies of the named pipeline
+func (h *PipelineHandler) RateLimitRoutesFor(name string) []string {
+	if p, ok := h.Pipelines.Get(name); ok {
+		return p.RateLimitRoutes()
+	}
+	return nil
+}
+
+// HandleRunPipeline runs the named pipeline on the request text and reports
+// the final text and every step's output and timing
+func (h *PipelineHandler) HandleRunPipeline(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := h.Pipelines.Get(name); !ok {
+		apierror.Respond(c, pipelineNotFound(name))
+		return
+	}
+
+	var req PipelineGatewayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid pipeline request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	result, apiErr := h.Run(c.Request.Context(), name, req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Run runs the named pipeline. It is shared by the HTTP and gRPC APIs.
+func (h *PipelineHandler) Run(ctx context.Context, name string, req PipelineGatewayRequest) (*pipeline.Result, *apierror.Error) {
+	p, ok := h.Pipelines.Get(name)
+	if !ok {
+		return nil, pipelineNotFound(name)
+	}
+	if req.Text == "" {
+		return nil, apierror.InvalidRequest("Invalid request: text is required")
+	}
+
+	audit.Input(ctx, req.Text)
+
+	result, err := h.Runner.Run(ctx, p, req.Text)
+	if err != nil {
+		var stepErr *pipeline.StepError
+		step := ""
+		if errors.As(err, &stepErr) {
+			step = stepErr.Step
+			err = stepErr.Err
+		}
+		slog.WarnContext(ctx, "Pipeline step failed", "pipeline", name, "step", step,
+			"steps_run", len(result.Steps), "duration_ms", result.DurationMs, "error", err)
+		return nil, apierror.From(err, fmt.Sprintf("Pipeline '%s' failed at step '%s'", name, step))
+	}
+
+	audit.Output(ctx, result.Text)
+	slog.DebugContext(ctx, "Pipeline completed", "pipeline", name, "duration_ms", result.DurationMs)
+	return result, nil
+}
+
+func pipelineNotFound(name string) *apierror.Error {
+	return apierror.New(http.StatusNotFound, apierror.CodeNotFound, fmt.Sprintf("Pipeline '%s' is not configured", name))
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/clients"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProcessMode controls how POST /api/v1/process runs its two steps
+type ProcessMode string
+
+const (
+	ProcessSequential ProcessMode = "sequential" // Moderate, then anonymize only if the content is acceptable
+	ProcessConcurrent ProcessMode = "concurrent" // Moderate and anonymize at once; anonymization is cancelled if the content is blocked
+)
+
+// ParseProcessMode maps an environment value to a ProcessMode ("" means sequential)
+func ParseProcessMode(v string) (ProcessMode, bool) {
+	switch ProcessMode(strings.ToLower(v)) {
+	case "", ProcessSequential:
+		return ProcessSequential, true
+	case ProcessConcurrent:
+		return ProcessConcurrent, true
+	}
+	return "", false
+}
+
+// Verdicts reported by POST /api/v1/process
+const (
+	VerdictAllowed = "allowed"
+	VerdictBlocked = "blocked"
+)
+
+// ProcessGatewayRequest represents the expected input to the process endpoint
+type ProcessGatewayRequest struct {
+	Text     string `json:"text" binding:"required"`
+	ImageURL string `json:"imageUrl,omitempty"` // Optional: moderated together with the text
+	Model    string `json:"model,omitempty"`    // Optional: anonymization model to use instead of the adapter's default
+}
+
+// ProcessGatewayResponse combines the moderation verdict with the anonymized
+// text. AnonymizedText is only set when the content is allowed.
+type ProcessGatewayResponse struct {
+	Verdict         string   `json:"verdict"`
+	Flags           []string `json:"flags"`
+	Details         string   `json:"details,omitempty"`
+	ConfidenceScore float64  `json:"confidence_score"`
+	AnonymizedText  string   `json:"anonymized_text,omitempty"`
+}
+
+// ProcessHandler moderates and anonymizes content in one call
+type ProcessHandler struct {
+	Anonymizer *clients.AnonymizerClient
+	Moderator  *clients.ModerationClient
+	Mode       ProcessMode
+}
+
+// NewProcessHandler creates a new handler instance
+func NewProcessHandler(anonymizerClient *clients.AnonymizerClient, moderationClient *clients.ModerationClient, mode ProcessMode) *ProcessHandler {
+	return &ProcessHandler{
+		Anonymizer: anonymizerClient,
+		Moderator:  moderationClient,
+		Mode:       mode,
+	}
+}
+
+// HandleProcess moderates the content and, unless it is blocked, anonymizes
+// the text. A moderation failure fails the request, since no verdict can be
+// given; an anonymization failure only does so for allowed content.
+func (h *ProcessHandler) HandleProcess(c *gin.Context) {
+	var req ProcessGatewayRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid process request body", logging.BindError(err))
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: "+err.Error()))
+		return
+	}
+
+	resp, apiErr := h.Process(c.Request.Context(), req)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Process moderates and, unless blocked, anonymizes one text. It is shared by
+// the HTTP and gRPC APIs.
+func (h *ProcessHandler) Process(ctx context.Context, req ProcessGatewayRequest) (*ProcessGatewayResponse, *apierror.Error) {
+	if req.Text == "" {
+		return nil, apierror.InvalidRequest("Invalid request: text is required")
+	}
+
+	audit.Input(ctx, req.Text, req.ImageURL)
+	audit.Model(ctx, req.Model)
+
+	var (
+		moderation *clients.ModerationResponse
+		anonymized *clients.AnonymizerResponse
+		err        error
+	)
+	if h.Mode == ProcessConcurrent {
+		moderation, anonymized, err = h.runConcurrent(ctx, req)
+	} else {
+		moderation, anonymized, err = h.runSequential(ctx, req)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Processing failed", "mode", string(h.Mode), "error", err)
+		return nil, apierror.From(err, "Failed to process content")
+	}
+
+	resp := &ProcessGatewayResponse{
+		Verdict:         VerdictAllowed,
+		Flags:           moderation.Flags,
+		Details:         moderation.Details,
+		ConfidenceScore: moderation.ConfidenceScore,
+	}
+	if resp.Flags == nil {
+		resp.Flags = []string{}
+	}
+	if !moderation.IsAcceptable {
+		resp.Verdict = VerdictBlocked
+		if verdict, err := json.Marshal(moderation); err == nil {
+			audit.Verdict(ctx, verdict)
+		}
+	} else {
+		resp.AnonymizedText = anonymized.AnonymizedText
+		audit.Output(ctx, anonymized.AnonymizedText)
+	}
+	return resp, nil
+}
+
+// runSequential only calls the anonymizer once moderation allowed the content
+func (h *ProcessHandler) runSequential(ctx context.Context, req ProcessGatewayRequest) (*clients.ModerationResponse, *clients.AnonymizerResponse, error) {
+	moderation, err := h.Moderator.ModerateContent(ctx, req.Text, req.ImageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !moderation.IsAcceptable {
+		return moderation, nil, nil
+	}
+	anonymized, err := h.Anonymizer.AnonymizeText(ctx, req.Text, req.Model, clients.CacheDefault)
+	if err != nil {
+		return nil, nil, err
+	}
+	return moderation, anonymized, nil
+}
+
+// runConcurrent starts both calls at once and cancels the anonymization as
+// soon as moderation blocks the content
+func (h *ProcessHandler) runConcurrent(ctx context.Context, req ProcessGatewayRequest) (*clients.ModerationResponse, *clients.AnonymizerResponse, error) {
+	anonymizeCtx, cancelAnonymize := context.WithCancel(ctx)
+	defer cancelAnonymize()
+
+	var (
+		wg           sync.WaitGroup
+		anonymized   *clients.AnonymizerResponse
+		anonymizeErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		anonymized, anonymizeErr = h.Anonymizer.AnonymizeText(anonymizeCtx, req.Text, req.Model, clients.CacheDefault)
+	}()
+
+	moderation, err := h.Moderator.ModerateContent(ctx, req.Text, req.ImageURL)
+	if err != nil || !moderation.IsAcceptable {
+		cancelAnonymize()
+	}
+	wg.Wait()
+
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case !moderation.IsAcceptable:
+		return moderation, nil, nil
+	case anonymizeErr != nil:
+		return nil, nil, anonymizeErr
+	}
+	return moderation, anonymized, nil
+}
@@ -0,0 +1,277 @@
+// Package idempotency lets clients retry POST requests safely. A request
+// carrying an Idempotency-Key header runs once per key and caller; its
+// response is stored for a configurable window and replayed to retries that
+// send the same request. Reusing a key for a different request is rejected
+// with 422, and a duplicate that arrives while the first is still running
+// waits for it and gets its response.
+//
+// Keys are scoped to the caller (tenant and API key, or the IP address of
+// anonymous callers), so callers cannot see each other's responses. Keys and
+// requests are stored as hashes only, and response bodies, which contain the
+// output returned to the caller, are encrypted with AES-256-GCM before they
+// reach a store.
+package idempotency
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/bodylimit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of the protocol
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed" // "true" on replayed responses
+)
+
+// MaxKeyLength bounds the Idempotency-Key header
+const MaxKeyLength = 255
+
+// MaxResponseBytes bounds stored responses. Larger responses are returned but
+// not stored, so a retry runs the request again.
+const MaxResponseBytes = 4 << 20
+
+// pollInterval is how often a duplicate checks whether the first request finished
+const pollInterval = 50 * time.Millisecond
+
+// replayedHeaders are the response headers stored with the body
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// Record is what is stored under a key: a pending marker while the first
+// request runs, then its response. Body is encrypted.
+type Record struct {
+	RequestHash string            `json:"request_hash"`
+	Done        bool              `json:"done,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// Store keeps records. Keys are opaque hashes.
+type Store interface {
+	// Reserve stores rec under key for ttl if the key is free. Otherwise it
+	// stores nothing and returns the record already held.
+	Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, error)
+	// Save replaces the record under key
+	Save(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release frees key, so the next request with it runs again
+	Release(ctx context.Context, key string) error
+}
+
+// Guard applies idempotency keys to requests
+type Guard struct {
+	store       Store
+	aead        cipher.AEAD
+	ttl         atomic.Int64 // time.Duration responses are replayed for
+	lockTimeout time.Duration
+}
+
+// NewGuard creates a guard storing responses in store for ttl. secret derives
+// the key response bodies are encrypted with; an empty secret uses a random
+// one, so stored responses only last as long as the process. lockTimeout
+// bounds how long a key stays reserved by a request that never finishes
+// (e.g. because its replica crashed); keep it above the longest request.
+func NewGuard(store Store, secret string, ttl, lockTimeout time.Duration) (*Guard, error) {
+	master := []byte(secret)
+	if secret == "" {
+		master = make([]byte, 32)
+		if _, err := rand.Read(master); err != nil {
+			return nil, fmt.Errorf("generating an idempotency key: %w", err)
+		}
+	}
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("privacypilot-idempotency-encryption"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	g := &Guard{store: store, aead: aead, lockTimeout: lockTimeout}
+	g.SetTTL(ttl)
+	return g, nil
+}
+
+// SetTTL changes how long new responses are replayed. Stored ones keep theirs.
+func (g *Guard) SetTTL(ttl time.Duration) {
+	g.ttl.Store(int64(ttl))
+}
+
+// Middleware makes requests with an Idempotency-Key header idempotent.
+// Requests without one pass through. Put it after authentication, so only
+// accepted callers reach stored responses, and before the rate limiter, so
+// replays use no quota.
+func (g *Guard) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idemKey := c.GetHeader(HeaderKey)
+		if idemKey == "" {
+			c.Next()
+			return
+		}
+		if len(idemKey) > MaxKeyLength || !printable(idemKey) {
+			apierror.Respond(c, apierror.InvalidRequest("Invalid Idempotency-Key: expected up to 255 printable ASCII characters"))
+			return
+		}
+		body, ok := bodylimit.Read(c)
+		if !ok {
+			return
+		}
+		key := storeKey(c, idemKey)
+		hash := requestHash(c.Request.Method, c.Request.URL.Path, body)
+		ctx := c.Request.Context()
+
+		for {
+			existing, err := g.store.Reserve(ctx, key, Record{RequestHash: hash}, g.lockTimeout)
+			if err != nil {
+				// Fail open: an unavailable store should not take the API down
+				slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+				c.Next()
+				return
+			}
+			switch {
+			case existing == nil:
+				g.run(c, key, hash)
+				return
+			case existing.RequestHash != hash:
+				apierror.Respond(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeIdempotencyKeyReused, "This Idempotency-Key was already used for a different request"))
+				return
+			case existing.Done:
+				body, err := g.open(key, existing.Body)
+				if err != nil {
+					// E.g. stored under another secret: run the request again
+					slog.WarnContext(ctx, "Discarding unreadable idempotency record", "error", err)
+					if err := g.store.Release(ctx, key); err != nil {
+						slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+						c.Next()
+						return
+					}
+					continue
+				}
+				replay(c, existing, body)
+				return
+			}
+
+			// The first request with this key is still running
+			select {
+			case <-ctx.Done():
+				apiErr := apierror.New(http.StatusConflict, apierror.CodeIdempotencyInProgress, "A request with this Idempotency-Key is still in progress")
+				apiErr.Retryable = true
+				apierror.Respond(c, apiErr)
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+}
+
+// run handles the first request with a key and stores its response. Responses
+// that ask to be retried (429 and 5xx) are not stored, so the retry runs again.
+func (g *Guard) run(c *gin.Context, key, hash string) {
+	rec := &recorder{ResponseWriter: c.Writer}
+	c.Writer = rec
+	c.Next()
+	c.Writer = rec.ResponseWriter
+
+	// The caller may be gone; the outcome must still be recorded
+	ctx := context.WithoutCancel(c.Request.Context())
+	status := rec.Status()
+	if !rec.Written() || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError || rec.overflow {
+		if err := g.store.Release(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+		}
+		return
+	}
+	header := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if v := rec.Header().Get(name); v != "" {
+			header[name] = v
+		}
+	}
+	body, err := g.seal(key, rec.body)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encrypt idempotency record", "error", err)
+		if err := g.store.Release(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+		}
+		return
+	}
+	record := Record{RequestHash: hash, Done: true, Status: status, Header: header, Body: body}
+	if err := g.store.Save(ctx, key, record, time.Duration(g.ttl.Load())); err != nil {
+		slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+	}
+}
+
+// replay writes a stored response with its decrypted body
+func replay(c *gin.Context, rec *Record, body []byte) {
+	for name, v := range rec.Header {
+		c.Header(name, v)
+	}
+	c.Header(HeaderReplayed, "true")
+	c.Status(rec.Status)
+	_, _ = c.Writer.Write(body)
+	c.Abort()
+}
+
+// seal encrypts a response body, bound to key so it cannot be replayed under another
+func (g *Guard) seal(key string, body []byte) ([]byte, error) {
+	nonce := make([]byte, g.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return g.aead.Seal(nonce, nonce, body, []byte(key)), nil
+}
+
+func (g *Guard) open(key string, sealed []byte) ([]byte, error) {
+	if len(sealed) < g.aead.NonceSize() {
+		return nil, errors.New("record too short")
+	}
+	nonce, ciphertext := sealed[:g.aead.NonceSize()], sealed[g.aead.NonceSize():]
+	return g.aead.Open(nil, nonce, ciphertext, []byte(key))
+}
+
+// storeKey scopes an Idempotency-Key to the caller. The result is hashed so
+// neither the key nor the caller appear in the store.
+func storeKey(c *gin.Context, idemKey string) string {
+	caller := "tenant:" + auth.Tenant(c) + "|" + auth.Principal(c)
+	if auth.Principal(c) == auth.Anonymous {
+		caller += "|ip:" + c.ClientIP()
+	}
+	sum := sha256.Sum256([]byte(caller + "\n" + idemKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often expired records are dropped
+const sweepInterval = time.Minute
+
+type memoryRecord struct {
+	rec       Record
+	expiresAt time.Time
+}
+
+// MemoryStore keeps records in process memory. It is suitable for a single
+// gateway replica; use RedisStore when running several replicas, so a retry
+// reaching another replica is still recognized.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*memoryRecord),
+		now:     time.Now,
+	}
+}
+
+// Reserve implements Store
+func (m *MemoryStore) Reserve(_ context.Context, key string, rec Record, ttl time.Duration) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	if existing, ok := m.records[key]; ok && now.Before(existing.expiresAt) {
+		out := existing.rec
+		return &out, nil
+	}
+	m.records[key] = &memoryRecord{rec: rec, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Save implements Store
+func (m *MemoryStore) Save(_ context.Context, key string, rec Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[key] = &memoryRecord{rec: rec, expiresAt: m.now().Add(ttl)}
+	return nil
+}
+
+// Release implements Store
+func (m *MemoryStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+// sweep drops expired records. Callers must hold m.mu.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, r := range m.records {
+		if !now.Before(r.expiresAt) {
+			delete(m.records, key)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package idempotency
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// recorder keeps a copy of the response body while writing it through, so
+// streamed responses still reach the caller as they are produced
+type recorder struct {
+	gin.ResponseWriter
+	body     []byte
+	overflow bool // The body exceeded MaxResponseBytes and is not kept
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.keep(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.keep([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+func (r *recorder) keep(b []byte) {
+	if r.overflow {
+		return
+	}
+	if len(r.body)+len(b) > MaxResponseBytes {
+		r.overflow, r.body = true, nil
+		return
+	}
+	r.body = append(r.body, b...)
+}
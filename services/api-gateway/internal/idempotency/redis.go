@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares records between gateway replicas through Redis
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store using the Redis server at addr (host:port)
+func NewRedisStore(addr string) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: "privacypilot:idempotency:",
+	}
+}
+
+// Ping verifies that the Redis server is reachable
+func (r *RedisStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Reserve implements Store
+func (r *RedisStore) Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, error) {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	// The record may expire or be released between SETNX and GET; try again then
+	for attempt := 0; attempt < 3; attempt++ {
+		ok, err := r.client.SetNX(ctx, r.prefix+key, value, ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis reserve failed: %w", err)
+		}
+		if ok {
+			return nil, nil
+		}
+		stored, err := r.client.Get(ctx, r.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redis get failed: %w", err)
+		}
+		var existing Record
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return nil, fmt.Errorf("invalid idempotency record in redis: %w", err)
+		}
+		return &existing, nil
+	}
+	return nil, errors.New("redis reserve failed: key kept changing")
+}
+
+// Save implements Store
+func (r *RedisStore) Save(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+// Release implements Store
+func (r *RedisStore) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+// Close releases the underlying Redis connections
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+// compile-time interface checks
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*RedisStore)(nil)
+)
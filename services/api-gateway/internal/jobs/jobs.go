@@ -0,0 +1,332 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"privacypilot-api-gateway/internal/auth"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("privacypilot-api-gateway/internal/jobs")
+
+// Status values reported for a job
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Errors returned by the Manager
+var (
+	ErrUnknownType = errors.New("unknown job type")
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrNotFound    = errors.New("job not found")
+	ErrStopped     = errors.New("job manager is shutting down")
+)
+
+// Job is the externally visible state of an asynchronous task
+type Job struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"`
+	Status      string            `json:"status"`
+	Result      interface{}       `json:"result,omitempty"`
+	Error       *apierror.Error   `json:"error,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"` // Set once the job is finished
+	owner       string            // Who submitted the job and may read it (see auth.Owner)
+	input       json.RawMessage   // Task input; dropped as soon as the job has run
+	requestID   string            // ID of the submitting request, used for the job's logs and calls
+	submitSpan  trace.SpanContext // Span of the submitting request, linked from the job's span
+}
+
+// Owner returns who submitted the job
+func (j *Job) Owner() string {
+	return j.owner
+}
+
+// Finished reports whether the job reached a terminal status
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Task describes how to validate and execute one job type
+type Task struct {
+	// Validate rejects malformed input at submission time
+	Validate func(input json.RawMessage) error
+	// Run performs the work and returns the job result
+	Run func(ctx context.Context, input json.RawMessage) (interface{}, error)
+}
+
+// Config controls the job manager
+type Config struct {
+	Workers    int           // Number of jobs processed concurrently
+	QueueSize  int           // Maximum number of queued jobs
+	ResultTTL  time.Duration // How long finished jobs are kept
+	JobTimeout time.Duration // Upper bound for a single job run
+}
+
+// DefaultConfig returns sensible defaults for a single gateway instance
+func DefaultConfig() Config {
+	return Config{
+		Workers:    4,
+		QueueSize:  1000,
+		ResultTTL:  24 * time.Hour,
+		JobTimeout: 10 * time.Minute,
+	}
+}
+
+// Manager queues jobs, runs them on a worker pool and stores their results
+type Manager struct {
+	cfg      Config
+	tasks    map[string]Task
+	store    *MemoryStore
+	queue    chan string
+	notifier *Notifier // Optional; nil disables webhooks
+	now      func() time.Time
+	wg       sync.WaitGroup
+	stop     chan struct{} // Closed by Shutdown; workers then take no more jobs
+	stopOnce sync.Once
+	cancel   context.CancelFunc // Cancels running jobs; set by Start
+}
+
+// NewManager creates a manager. notifier may be nil if callbacks are not supported.
+func NewManager(cfg Config, notifier *Notifier) *Manager {
+	return &Manager{
+		cfg:      cfg,
+		tasks:    make(map[string]Task),
+		store:    NewMemoryStore(),
+		queue:    make(chan string, cfg.QueueSize),
+		notifier: notifier,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register adds a job type. It must be called before Start.
+func (m *Manager) Register(jobType string, task Task) {
+	m.tasks[jobType] = task
+}
+
+// Start launches the worker pool and the expiry sweeper. They stop when ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	for i := 0; i < m.cfg.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker(ctx)
+	}
+	go m.store.sweepLoop(ctx, time.Minute)
+}
+
+// Wait blocks until all workers have exited (after the Start context is cancelled)
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Shutdown stops accepting jobs and waits for the running ones to finish. If
+// ctx ends first, running jobs are cancelled and ctx's error is returned.
+// Queued jobs are not run; like all results they are lost with the process.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if m.cancel != nil {
+			m.cancel()
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Submit validates and enqueues a job for owner, returning its initial state.
+// The request ID in ctx is carried over to the job's downstream calls and logs.
+func (m *Manager) Submit(ctx context.Context, owner, jobType string, input json.RawMessage, callbackURL string) (*Job, error) {
+	task, ok := m.tasks[jobType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+	if task.Validate != nil {
+		if err := task.Validate(input); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:          id,
+		Type:        jobType,
+		Status:      StatusQueued,
+		CallbackURL: callbackURL,
+		CreatedAt:   m.now().UTC(),
+		owner:       owner,
+		input:       input,
+		requestID:   requestid.FromContext(ctx),
+		submitSpan:  trace.SpanContextFromContext(ctx),
+	}
+	select {
+	case <-m.stop:
+		return nil, ErrStopped
+	default:
+	}
+	m.store.Put(job)
+
+	select {
+	case m.queue <- id:
+	default:
+		m.store.Delete(id)
+		return nil, ErrQueueFull
+	}
+	return m.store.Get(id)
+}
+
+// CallbacksEnabled reports whether completion webhooks can be delivered
+func (m *Manager) CallbacksEnabled() bool {
+	return m.notifier != nil
+}
+
+// CheckCallbackURL returns an error if webhooks cannot be sent to raw (see
+// Notifier.CheckURL). Callbacks must be enabled.
+func (m *Manager) CheckCallbackURL(ctx context.Context, raw string) error {
+	return m.notifier.CheckURL(ctx, raw)
+}
+
+// Get returns a snapshot of the job with the given ID
+func (m *Manager) Get(id string) (*Job, error) {
+	return m.store.Get(id)
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		// Checked first so no queued job is picked up once Shutdown was called
+		select {
+		case <-m.stop:
+			return
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stop:
+			return
+		case id := <-m.queue:
+			m.run(ctx, id)
+		}
+	}
+}
+
+// run executes a single job and records its outcome
+func (m *Manager) run(ctx context.Context, id string) {
+	var input json.RawMessage
+	var jobType, requestID, owner string
+	var submitSpan trace.SpanContext
+	started := m.now().UTC()
+	ok := m.store.Update(id, func(j *Job) {
+		j.Status = StatusRunning
+		j.StartedAt = &started
+		input = j.input
+		jobType = j.Type
+		requestID = j.requestID
+		owner = j.owner
+		submitSpan = j.submitSpan
+	})
+	if !ok {
+		return // Expired or removed while queued
+	}
+	if requestID != "" {
+		ctx = requestid.NewContext(ctx, requestID)
+	}
+	ctx = auth.WithOwner(ctx, owner)
+	// Jobs run after the submitting request has finished, so they get their
+	// own trace, linked to the request that created them
+	ctx, span := tracer.Start(ctx, "job "+jobType,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: submitSpan}),
+		trace.WithAttributes(attribute.String("job.id", id), attribute.String("job.type", jobType)),
+	)
+	defer span.End()
+
+	runCtx, cancel := context.WithTimeout(ctx, m.cfg.JobTimeout)
+	result, err := m.tasks[jobType].Run(runCtx, input)
+	cancel()
+
+	completed := m.now().UTC()
+	expires := completed.Add(m.cfg.ResultTTL)
+	var snapshot *Job
+	m.store.Update(id, func(j *Job) {
+		j.CompletedAt = &completed
+		j.ExpiresAt = &expires
+		j.input = nil // Don't keep raw input around once the job has run
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = jobError(err)
+		} else {
+			j.Status = StatusSucceeded
+			j.Result = result
+		}
+		copied := *j
+		snapshot = &copied
+	})
+
+	if err != nil {
+		span.SetStatus(codes.Error, jobError(err).Code)
+		slog.WarnContext(ctx, "Job failed", "job_id", id, "job_type", jobType, "error", err)
+	} else {
+		slog.InfoContext(ctx, "Job succeeded", "job_id", id, "job_type", jobType)
+	}
+
+	if snapshot != nil && snapshot.CallbackURL != "" && m.notifier != nil {
+		// Deliver in the background so slow receivers don't hold up the worker
+		go m.notifier.Deliver(ctx, snapshot)
+	}
+}
+
+// jobError converts a task error into the error reported on the job. Errors
+// from downstream services keep their code; anything else is reported as an
+// internal error without exposing its details.
+func jobError(err error) *apierror.Error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apierror.New(http.StatusGatewayTimeout, apierror.CodeUpstreamTimeout, "Job did not finish within its time limit")
+	}
+	if apiErr, ok := apierror.As(err); ok {
+		return apierror.Propagate(apiErr)
+	}
+	return apierror.Internal("Job failed")
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return "job_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs in process memory and forgets finished jobs after their TTL
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	now  func() time.Time
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs: make(map[string]*Job),
+		now:  time.Now,
+	}
+}
+
+// Put inserts or replaces a job
+func (s *MemoryStore) Put(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+}
+
+// Get returns a copy of the job, or ErrNotFound if it does not exist or has expired
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok || s.expired(job) {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// Update applies fn to the stored job under the store lock. It returns false
+// if the job does not exist.
+func (s *MemoryStore) Update(id string, fn func(*Job)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return false
+	}
+	fn(job)
+	return true
+}
+
+// Delete removes a job
+func (s *MemoryStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+}
+
+// expired reports whether a finished job is past its TTL. Caller must hold s.mu.
+func (s *MemoryStore) expired(job *Job) bool {
+	return job.ExpiresAt != nil && !s.now().Before(*job.ExpiresAt)
+}
+
+// sweepLoop periodically removes expired jobs until ctx is cancelled
+func (s *MemoryStore) sweepLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			for id, job := range s.jobs {
+				if s.expired(job) {
+					delete(s.jobs, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
+)
+
+// Webhook headers. Receivers verify the signature by computing
+// HMAC-SHA256(secret, timestamp + "." + body) and comparing it to the hex
+// digest after the "sha256=" prefix.
+const (
+	HeaderSignature = "X-PrivacyPilot-Signature"
+	HeaderTimestamp = "X-PrivacyPilot-Timestamp"
+	HeaderJobID     = "X-PrivacyPilot-Job-ID"
+)
+
+// ErrBlockedCallback is returned for callback hosts that are, or resolve to,
+// addresses webhooks are not sent to
+var ErrBlockedCallback = errors.New("callback host is a private, loopback or link-local address")
+
+// blockedPrefixes are the address ranges refused on top of the private,
+// loopback, link-local, multicast and unspecified ones
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT (RFC 6598)
+}
+
+// Notifier delivers signed job completion webhooks with retries
+type Notifier struct {
+	Secret         []byte
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	HttpClient     *http.Client
+	// AllowPrivateNetworks lets webhooks reach private, loopback and
+	// link-local addresses, e.g. receivers inside the deployment. Otherwise
+	// such hosts are refused at submission, and connections to them when
+	// delivering, so a host that resolves elsewhere later is refused too.
+	AllowPrivateNetworks bool
+	Resolver             *net.Resolver // Resolves callback hosts at submission; nil uses net.DefaultResolver
+	now                  func() time.Time
+}
+
+// NewNotifier creates a notifier signing payloads with secret
+func NewNotifier(secret []byte) *Notifier {
+	n := &Notifier{
+		Secret:         secret,
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		now:            time.Now,
+	}
+	// No proxy: the address checked when connecting must be the receiver's
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: n.checkDial}
+	n.HttpClient = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: metrics.Transport("webhook", telemetry.Transport(&http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		})),
+	}
+	return n
+}
+
+// CheckURL returns an error if raw is not an absolute http(s) URL, or if its
+// host is or resolves to an address webhooks are not sent to
+func (n *Notifier) CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("callback_url must be an absolute http(s) URL")
+	}
+	if n.AllowPrivateNetworks {
+		return nil
+	}
+	resolver := n.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("callback host %q cannot be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return ErrBlockedCallback
+		}
+	}
+	return nil
+}
+
+// checkDial refuses connections to addresses webhooks are not sent to. It
+// runs for every connection, including those of redirects.
+func (n *Notifier) checkDial(_, address string, _ syscall.RawConn) error {
+	if n.AllowPrivateNetworks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addrPort.Addr()) {
+		return ErrBlockedCallback
+	}
+	return nil
+}
+
+// publicAddress reports whether webhooks may be sent to addr
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature header value for a payload sent at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts the job to its callback URL, retrying with exponential backoff
+// on network errors and non-2xx responses
+func (n *Notifier) Deliver(ctx context.Context, job *Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode webhook", "job_id", job.ID, "error", err)
+		return
+	}
+
+	backoff := n.InitialBackoff
+	for attempt := 1; attempt <= n.MaxAttempts; attempt++ {
+		err = n.send(ctx, job, body)
+		if err == nil {
+			slog.InfoContext(ctx, "Delivered webhook", "job_id", job.ID, "attempt", attempt)
+			return
+		}
+		slog.WarnContext(ctx, "Webhook delivery failed", "job_id", job.ID, "attempt", attempt, "max_attempts", n.MaxAttempts, "error", err)
+		if attempt == n.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > n.MaxBackoff {
+			backoff = n.MaxBackoff
+		}
+	}
+	slog.ErrorContext(ctx, "Giving up on webhook", "job_id", job.ID)
+}
+
+// send performs a single, freshly signed delivery attempt
+func (n *Notifier) send(ctx context.Context, job *Job, body []byte) error {
+	timestamp := strconv.FormatInt(n.now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(n.Secret, timestamp, body))
+	req.Header.Set(HeaderJobID, job.ID)
+	requestid.Inject(req) // Lets receivers correlate the callback with the submission
+
+	resp, err := n.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook receiver returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"privacypilot-api-gateway/internal/bodylimit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseMode controls what happens when a handler's response violates the contract
+type ResponseMode string
+
+const (
+	ResponseValidationOff     ResponseMode = "off"     // Responses are not checked
+	ResponseValidationLog     ResponseMode = "log"     // Violations are logged, the response is sent unchanged
+	ResponseValidationEnforce ResponseMode = "enforce" // Violations are logged and replaced by a 500
+)
+
+// ParseResponseMode maps an environment value to a ResponseMode ("" means log)
+func ParseResponseMode(v string) (ResponseMode, bool) {
+	switch ResponseMode(strings.ToLower(v)) {
+	case "", ResponseValidationLog:
+		return ResponseValidationLog, true
+	case ResponseValidationOff:
+		return ResponseValidationOff, true
+	case ResponseValidationEnforce:
+		return ResponseValidationEnforce, true
+	}
+	return "", false
+}
+
+// Middleware validates request bodies against the operation's schema before
+// the handler runs, and (depending on mode) JSON responses after it ran.
+// Routes that are not in the document pass through untouched.
+func (s *Spec) Middleware(mode ResponseMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := s.Operation(c.Request.Method, GinPathToOpenAPI(c.FullPath()))
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if op.RequestBody != nil && !s.validateRequest(c, op) {
+			return
+		}
+
+		if mode == ResponseValidationOff || streamsResponse(op) {
+			c.Next()
+			return
+		}
+
+		// Buffer the response so it can be checked before anything is sent
+		original := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = original
+
+		body := buffered.body.Bytes()
+		if violations := s.validateResponse(op, buffered.status, body); len(violations) > 0 {
+			slog.ErrorContext(c.Request.Context(), "Response violates the OpenAPI contract",
+				"method", c.Request.Method, "route", c.FullPath(), "status", buffered.status, "violations", strings.Join(violations, "; "))
+			if mode == ResponseValidationEnforce {
+				original.Header().Del("Content-Length")
+				apierror.Respond(c, apierror.Internal("Internal error: response failed contract validation"))
+				return
+			}
+		}
+
+		original.WriteHeader(buffered.status)
+		if len(body) > 0 {
+			_, _ = original.Write(body)
+		} else {
+			original.WriteHeaderNow()
+		}
+	}
+}
+
+// validateRequest checks the JSON request body. It returns false if the
+// request was rejected (and the 400 or 413 response already written).
+func (s *Spec) validateRequest(c *gin.Context, op *Operation) bool {
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok || media.Schema == nil {
+		return true
+	}
+
+	// Bounded here, since this runs ahead of authentication and rate limiting
+	body, ok := bodylimit.Read(c)
+	if !ok {
+		return false
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			apierror.Respond(c, apierror.InvalidRequest("Invalid request body: body is required"))
+			return false
+		}
+		return true
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		// Deliberately not echoing err: it can quote parts of the submitted text
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request body: malformed JSON"))
+		return false
+	}
+
+	if violations := s.Validate(media.Schema, value); len(violations) > 0 {
+		apierror.Respond(c, apierror.InvalidRequest("Invalid request: "+strings.Join(violations, "; ")))
+		return false
+	}
+	return true
+}
+
+// validateResponse returns the contract violations of a JSON response
+func (s *Spec) validateResponse(op *Operation, status int, body []byte) []string {
+	resp, ok := s.response(op, status)
+	if !ok {
+		return []string{"undocumented status code"}
+	}
+	media, ok := resp.Content["application/json"]
+	if !ok || media.Schema == nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{"body is not valid JSON"}
+	}
+	return s.Validate(media.Schema, value)
+}
+
+// streamsResponse reports whether the operation's success response is an event stream
+func streamsResponse(op *Operation) bool {
+	for _, resp := range op.Responses {
+		if resp == nil {
+			continue
+		}
+		if _, ok := resp.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds back the status and body written by handlers
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int)              { w.status = code }
+func (w *bufferedWriter) WriteHeaderNow()                   {}
+func (w *bufferedWriter) Write(b []byte) (int, error)       { return w.body.Write(b) }
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *bufferedWriter) Status() int                       { return w.status }
+func (w *bufferedWriter) Size() int                         { return w.body.Len() }
+func (w *bufferedWriter) Written() bool                     { return w.body.Len() > 0 }
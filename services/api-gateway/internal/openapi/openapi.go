@@ -0,0 +1,147 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// specJSON is the gateway's API contract. api-specs/api-gateway.openapi.json
+// at the repository root points to this file.
+//
+//go:embed openapi.json
+var specJSON []byte
+
+// Schema is the subset of the OpenAPI 3.0 schema object the gateway validates
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+}
+
+// MediaType holds the schema for one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// RequestBody describes an operation's request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one documented response of an operation
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+// Spec is the parsed gateway contract
+type Spec struct {
+	raw []byte
+	doc document
+}
+
+// Load parses the embedded OpenAPI document
+func Load() (*Spec, error) {
+	var doc document
+	if err := json.Unmarshal(specJSON, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse embedded OpenAPI document: %w", err)
+	}
+	return &Spec{raw: specJSON, doc: doc}, nil
+}
+
+// Operation returns the operation for a method and an OpenAPI path template
+// such as "/api/v1/jobs/{id}"
+func (s *Spec) Operation(method, path string) (*Operation, bool) {
+	ops, ok := s.doc.Paths[path]
+	if !ok {
+		return nil, false
+	}
+	op, ok := ops[strings.ToLower(method)]
+	return op, ok && op != nil
+}
+
+// Paths lists every documented path template
+func (s *Spec) Paths() []string {
+	paths := make([]string, 0, len(s.doc.Paths))
+	for p := range s.doc.Paths {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// Schema returns a named component schema
+func (s *Spec) Schema(name string) (*Schema, bool) {
+	schema, ok := s.doc.Components.Schemas[name]
+	return schema, ok
+}
+
+// Resolve follows a local "#/components/schemas/..." reference
+func (s *Spec) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// response returns the documented response for a status code, following references
+func (s *Spec) response(op *Operation, status int) (*Response, bool) {
+	resp, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	for ok && resp != nil && resp.Ref != "" {
+		resp, ok = s.doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+	return resp, ok && resp != nil
+}
+
+// Handler serves the raw OpenAPI document
+func (s *Spec) Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", s.raw)
+}
+
+// GinPathToOpenAPI converts a Gin route pattern ("/jobs/:id") into an OpenAPI path template ("/jobs/{id}")
+func GinPathToOpenAPI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
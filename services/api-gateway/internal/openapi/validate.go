@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Validate checks a decoded JSON value (as produced by encoding/json into
+// interface{}) against schema and returns one message per violation
+func (s *Spec) Validate(schema *Schema, value interface{}) []string {
+	var errs []string
+	s.validate(schema, value, "body", &errs)
+	return errs
+}
+
+func (s *Spec) validate(schema *Schema, value interface{}, path string, errs *[]string) {
+	schema = s.Resolve(schema)
+	if schema == nil {
+		return
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			*errs = append(*errs, fmt.Sprintf("%s: must not be null", path))
+		}
+		return
+	}
+
+	if !s.checkType(schema, value, path, errs) {
+		return // Nested checks are meaningless once the type is wrong
+	}
+
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: must be one of %v", path, schema.Enum))
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && n < *schema.MinLength {
+			*errs = append(*errs, fmt.Sprintf("%s: must be at least %d characters", path, *schema.MinLength))
+		}
+		if schema.MaxLength != nil && n > *schema.MaxLength {
+			*errs = append(*errs, fmt.Sprintf("%s: must be at most %d characters", path, *schema.MaxLength))
+		}
+		checkFormat(schema.Format, v, path, errs)
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			*errs = append(*errs, fmt.Sprintf("%s: must be >= %v", path, *schema.Minimum))
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			*errs = append(*errs, fmt.Sprintf("%s: must be <= %v", path, *schema.Maximum))
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			*errs = append(*errs, fmt.Sprintf("%s: must contain at least %d items", path, *schema.MinItems))
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			*errs = append(*errs, fmt.Sprintf("%s: must contain at most %d items", path, *schema.MaxItems))
+		}
+		if schema.Items != nil {
+			for i, item := range v {
+				s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names) // Stable error order
+		for _, name := range names {
+			if field, ok := v[name]; ok {
+				s.validate(schema.Properties[name], field, path+"."+name, errs)
+			}
+		}
+	}
+
+	if len(schema.AnyOf) > 0 {
+		var alternatives []string
+		for _, alt := range schema.AnyOf {
+			var altErrs []string
+			s.validate(alt, value, path, &altErrs)
+			if len(altErrs) == 0 {
+				return
+			}
+			alternatives = append(alternatives, altErrs...)
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: must match at least one alternative (%v)", path, alternatives))
+	}
+}
+
+// checkType reports whether value has the schema's declared type
+func (s *Spec) checkType(schema *Schema, value interface{}, path string, errs *[]string) bool {
+	ok := true
+	switch schema.Type {
+	case "":
+		return true
+	case "object":
+		_, ok = value.(map[string]interface{})
+	case "array":
+		_, ok = value.([]interface{})
+	case "string":
+		_, ok = value.(string)
+	case "boolean":
+		_, ok = value.(bool)
+	case "number":
+		_, ok = value.(float64)
+	case "integer":
+		f, isNum := value.(float64)
+		ok = isNum && f == math.Trunc(f)
+	}
+	if !ok {
+		*errs = append(*errs, fmt.Sprintf("%s: must be of type %s", path, schema.Type))
+	}
+	return ok
+}
+
+func checkFormat(format, v, path string, errs *[]string) {
+	switch format {
+	case "uri":
+		if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+			*errs = append(*errs, fmt.Sprintf("%s: must be an absolute URI", path))
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: must be an RFC 3339 date-time", path))
+		}
+	}
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
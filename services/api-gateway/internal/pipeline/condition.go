@@ -0,0 +1,311 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition decides whether a step runs, based on the outputs of earlier
+// steps. The syntax is a list of comparisons joined by && and || (&& binds
+// tighter, there are no parentheses):
+//
+//	classify.label == "confidential"
+//	moderate.is_acceptable && moderate.confidence_score >= 0.8
+//	moderate.flags contains "spam" || !detect.clean
+//
+// Operands on the left are paths into a step's output ("step.field.field");
+// operands on the right are string, number, true, false or null literals. A
+// bare path is true when its value is truthy. Paths to missing values (for
+// example into a skipped step) make every comparison false.
+type Condition struct {
+	source string
+	anyOf  [][]comparison // OR of ANDs
+}
+
+type comparison struct {
+	negate bool
+	path   []string
+	op     string // "" for a truthiness test
+	value  interface{}
+}
+
+// Operators supported in conditions
+var operators = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true, "contains": true}
+
+// String returns the condition as written
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Steps returns the names of the steps the condition refers to
+func (c *Condition) Steps() []string {
+	var steps []string
+	for _, all := range c.anyOf {
+		for _, cmp := range all {
+			steps = append(steps, cmp.path[0])
+		}
+	}
+	return steps
+}
+
+// ParseCondition compiles a condition
+func ParseCondition(source string) (*Condition, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	c := &Condition{source: source}
+	var all []comparison
+	for i := 0; i < len(tokens); {
+		cmp := comparison{}
+		if tokens[i].text == "!" {
+			cmp.negate = true
+			i++
+		}
+		if i >= len(tokens) || tokens[i].kind != tokenPath {
+			return nil, fmt.Errorf("expected a step output path at position %d", tokenPos(tokens, i, source))
+		}
+		cmp.path = strings.Split(tokens[i].text, ".")
+		i++
+
+		if i < len(tokens) && operators[tokens[i].text] {
+			if cmp.negate {
+				return nil, fmt.Errorf("'!' can only negate a bare path")
+			}
+			cmp.op = tokens[i].text
+			i++
+			if i >= len(tokens) || tokens[i].kind != tokenLiteral {
+				return nil, fmt.Errorf("expected a literal after '%s'", cmp.op)
+			}
+			cmp.value = tokens[i].value
+			i++
+		}
+		all = append(all, cmp)
+
+		if i == len(tokens) {
+			break
+		}
+		switch tokens[i].text {
+		case "&&":
+		case "||":
+			c.anyOf = append(c.anyOf, all)
+			all = nil
+		default:
+			return nil, fmt.Errorf("expected '&&' or '||' at position %d", tokenPos(tokens, i, source))
+		}
+		i++
+		if i == len(tokens) {
+			return nil, fmt.Errorf("condition ends with an operator")
+		}
+	}
+	c.anyOf = append(c.anyOf, all)
+	return c, nil
+}
+
+// Eval evaluates the condition against the outputs of the steps run so far
+func (c *Condition) Eval(outputs map[string]interface{}) bool {
+	for _, all := range c.anyOf {
+		ok := true
+		for _, cmp := range all {
+			if !cmp.eval(outputs) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp comparison) eval(outputs map[string]interface{}) bool {
+	v, found := lookup(outputs, cmp.path)
+	if cmp.op == "" {
+		return found && truthy(v) != cmp.negate
+	}
+	if !found {
+		return false
+	}
+	switch cmp.op {
+	case "==":
+		return equal(v, cmp.value)
+	case "!=":
+		return !equal(v, cmp.value)
+	case "contains":
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if equal(item, cmp.value) {
+					return true
+				}
+			}
+		case string:
+			s, ok := cmp.value.(string)
+			return ok && strings.Contains(v, s)
+		}
+		return false
+	}
+	a, aok := v.(float64)
+	b, bok := cmp.value.(float64)
+	if !aok || !bok {
+		return false
+	}
+	switch cmp.op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+// lookup follows path through JSON-decoded values
+func lookup(outputs map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = outputs
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool, float64, string:
+		return a == b
+	}
+	return false
+}
+
+// --- Tokenizer ---
+
+type tokenKind int
+
+const (
+	tokenPath tokenKind = iota
+	tokenOperator
+	tokenLiteral
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{} // Literals only
+	pos   int
+}
+
+func tokenPos(tokens []token, i int, source string) int {
+	if i < len(tokens) {
+		return tokens[i].pos
+	}
+	return len(source)
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenLiteral, text: s[i : end+1], value: value, pos: i})
+			i = end + 1
+		case r == '-' || unicode.IsDigit(r):
+			end := i + 1
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			value, err := strconv.ParseFloat(s[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenLiteral, text: s[i:end], value: value, pos: i})
+			i = end
+		case r == '_' || unicode.IsLetter(r):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || s[end] == '.' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			word := s[i:end]
+			switch word {
+			case "true", "false":
+				tokens = append(tokens, token{kind: tokenLiteral, text: word, value: word == "true", pos: i})
+			case "null":
+				tokens = append(tokens, token{kind: tokenLiteral, text: word, pos: i})
+			case "contains":
+				tokens = append(tokens, token{kind: tokenOperator, text: word, pos: i})
+			default:
+				if strings.HasSuffix(word, ".") || strings.Contains(word, "..") {
+					return nil, fmt.Errorf("invalid path '%s'", word)
+				}
+				tokens = append(tokens, token{kind: tokenPath, text: word, pos: i})
+			}
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!"} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected '%c' at position %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,209 @@
+// Package pipeline runs named, declarative chains of processing steps loaded
+// from a YAML file, such as detect → anonymize → verify → moderate.
+//
+//	pipelines:
+//	  ugc:
+//	    description: Moderate user content, anonymize what is allowed
+//	    steps:
+//	      - name: moderate
+//	        capability: moderate
+//	      - name: anonymize
+//	        capability: anonymize
+//	        when: moderate.is_acceptable
+//	        timeout: 20s
+//
+// Every step works on the pipeline's current text: it starts as the request
+// text and is replaced by the output of each anonymize step. Steps run in
+// order; a step whose condition is false is skipped, and a failing step stops
+// the pipeline.
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Capabilities a step can use
+const (
+	CapabilityAnonymize = "anonymize" // Anonymizer service; replaces the current text
+	CapabilityModerate  = "moderate"  // Moderation service
+	CapabilityClassify  = "classify"  // Rule-based: labels the text "confidential" if it contains PII
+	CapabilityVerify    = "verify"    // Rule-based: fails the pipeline if the current text still contains PII
+	CapabilityTask      = "task"      // Any AI coordinator task_type
+)
+
+var capabilities = map[string]bool{
+	CapabilityAnonymize: true,
+	CapabilityModerate:  true,
+	CapabilityClassify:  true,
+	CapabilityVerify:    true,
+	CapabilityTask:      true,
+}
+
+// Inputs a step can work on
+const (
+	InputCurrent  = "current"  // The text as left by the previous anonymize step (default)
+	InputOriginal = "original" // The request text
+)
+
+var (
+	pipelineNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	stepNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Step is one step of a pipeline
+type Step struct {
+	Name       string        `yaml:"name"`
+	Capability string        `yaml:"capability"`
+	TaskType   string        `yaml:"task_type,omitempty"` // Required for the task capability
+	Model      string        `yaml:"model,omitempty"`     // Optional model for anonymize and task steps
+	Input      string        `yaml:"input,omitempty"`     // current (default) or original
+	When       string        `yaml:"when,omitempty"`      // Condition on earlier outputs; the step is skipped when false
+	Timeout    time.Duration `yaml:"timeout,omitempty"`   // Optional per-step bound
+
+	when *Condition
+}
+
+// Pipeline is a named chain of steps
+type Pipeline struct {
+	Name        string `yaml:"-"`
+	Description string `yaml:"description,omitempty"`
+	Steps       []Step `yaml:"steps"`
+}
+
+// Config is the pipelines file
+type Config struct {
+	Pipelines map[string]*Pipeline `yaml:"pipelines"`
+}
+
+// Load reads and validates the pipelines file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipelines file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates pipeline definitions. Unknown fields are
+// rejected so typos do not silently change a pipeline.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid pipelines file: %w", err)
+	}
+	for name, p := range cfg.Pipelines {
+		if p == nil {
+			return nil, fmt.Errorf("pipeline '%s' has no steps", name)
+		}
+		p.Name = name
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("pipeline '%s': %w", name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// Get returns the named pipeline
+func (c *Config) Get(name string) (*Pipeline, bool) {
+	if c == nil {
+		return nil, false
+	}
+	p, ok := c.Pipelines[name]
+	return p, ok
+}
+
+// Names lists the configured pipelines in alphabetical order
+func (c *Config) Names() []string {
+	if c == nil {
+		return nil
+	}
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Pipeline) validate() error {
+	if !pipelineNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits, '-' and '_'")
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+	seen := make(map[string]bool)
+	for i := range p.Steps {
+		s := &p.Steps[i]
+		if !stepNamePattern.MatchString(s.Name) {
+			return fmt.Errorf("step %d: name must be an identifier (letters, digits, '_')", i+1)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("step '%s': duplicate name", s.Name)
+		}
+		if !capabilities[s.Capability] {
+			return fmt.Errorf("step '%s': unknown capability '%s'", s.Name, s.Capability)
+		}
+		if (s.Capability == CapabilityTask) != (s.TaskType != "") {
+			return fmt.Errorf("step '%s': task_type is required for, and only allowed with, capability 'task'", s.Name)
+		}
+		if s.Model != "" && s.Capability != CapabilityAnonymize && s.Capability != CapabilityTask {
+			return fmt.Errorf("step '%s': model is only supported by anonymize and task steps", s.Name)
+		}
+		switch s.Input {
+		case "":
+			s.Input = InputCurrent
+		case InputCurrent, InputOriginal:
+		default:
+			return fmt.Errorf("step '%s': input must be 'current' or 'original'", s.Name)
+		}
+		if s.Timeout < 0 {
+			return fmt.Errorf("step '%s': timeout must be positive", s.Name)
+		}
+		if s.When != "" {
+			cond, err := ParseCondition(s.When)
+			if err != nil {
+				return fmt.Errorf("step '%s': invalid condition: %w", s.Name, err)
+			}
+			for _, ref := range cond.Steps() {
+				if !seen[ref] {
+					return fmt.Errorf("step '%s': condition refers to '%s', which is not an earlier step", s.Name, ref)
+				}
+			}
+			s.when = cond
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// RateLimitRoutes names the rate limit policies a run of the pipeline is
+// charged against: one per kind of AI-backed step. Coordinator tasks count
+// as anonymizations, the only general-purpose model policy.
+func (p *Pipeline) RateLimitRoutes() []string {
+	var routes []string
+	seen := make(map[string]bool)
+	for _, s := range p.Steps {
+		route := ""
+		switch s.Capability {
+		case CapabilityAnonymize, CapabilityTask:
+			route = "anonymize"
+		case CapabilityModerate:
+			route = "moderate"
+		}
+		if route != "" && !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
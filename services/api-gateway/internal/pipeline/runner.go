@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"privacypilot-api-gateway/internal/clients"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+)
+
+// Step statuses reported in a Result
+const (
+	StatusSucceeded = "succeeded"
+	StatusSkipped   = "skipped"
+)
+
+// Labels assigned by classify steps
+const (
+	LabelConfidential = "confidential"
+	LabelPublic       = "public"
+)
+
+// errNoCoordinator is returned by task steps when no AI coordinator is configured
+var errNoCoordinator = apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "task steps need AI_COORDINATOR_URL to be configured")
+
+// piiPatterns find values that anonymized text must not contain. They match
+// the patterns the stream holdback redacts.
+var piiPatterns = map[string]*regexp.Regexp{
+	"EMAIL":  regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	"NUMBER": regexp.MustCompile(`\+?\d[\d\s().-]{5,}\d`), // Phone, card and ID numbers
+}
+
+// StepResult reports one step of a run
+type StepResult struct {
+	Name       string      `json:"name"`
+	Capability string      `json:"capability"`
+	Status     string      `json:"status"`
+	DurationMs float64     `json:"duration_ms"`
+	Output     interface{} `json:"output,omitempty"`
+}
+
+// Result is the outcome of a successful run. Text is the final current text.
+type Result struct {
+	Pipeline   string       `json:"pipeline"`
+	Text       string       `json:"text"`
+	Steps      []StepResult `json:"steps"`
+	DurationMs float64      `json:"duration_ms"`
+}
+
+// StepError is returned when a step fails. Err is an *apierror.Error
+// whenever the failure came from a downstream service.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step '%s' failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Runner executes pipelines against the downstream services. Coordinator may
+// be nil, in which case task steps fail.
+type Runner struct {
+	Anonymizer  *clients.AnonymizerClient
+	Moderator   *clients.ModerationClient
+	Coordinator *clients.AICoordinatorClient
+}
+
+// Run executes p on text. The returned Result covers every step up to and
+// including a failed one, so callers can report timings either way.
+func (r *Runner) Run(ctx context.Context, p *Pipeline, text string) (*Result, error) {
+	start := time.Now()
+	res := &Result{Pipeline: p.Name, Text: text, Steps: make([]StepResult, 0, len(p.Steps))}
+	outputs := make(map[string]interface{}, len(p.Steps))
+
+	for _, step := range p.Steps {
+		sr := StepResult{Name: step.Name, Capability: step.Capability, Status: StatusSkipped}
+		if step.when != nil && !step.when.Eval(outputs) {
+			res.Steps = append(res.Steps, sr)
+			continue
+		}
+
+		input := res.Text
+		if step.Input == InputOriginal {
+			input = text
+		}
+		stepStart := time.Now()
+		output, err := r.runStep(ctx, step, input)
+		sr.DurationMs = float64(time.Since(stepStart).Microseconds()) / 1000
+		if err != nil {
+			res.Steps = append(res.Steps, sr)
+			res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+			return res, &StepError{Step: step.Name, Err: err}
+		}
+
+		sr.Status = StatusSucceeded
+		sr.Output = output
+		outputs[step.Name] = output
+		if step.Capability == CapabilityAnonymize {
+			if m, ok := output.(map[string]interface{}); ok {
+				res.Text, _ = m["anonymized_text"].(string)
+			}
+		}
+		res.Steps = append(res.Steps, sr)
+	}
+
+	res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return res, nil
+}
+
+// runStep executes a single step and returns its output as JSON-decoded values
+func (r *Runner) runStep(ctx context.Context, step Step, input string) (interface{}, error) {
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	var output interface{}
+	switch step.Capability {
+	case CapabilityAnonymize:
+		resp, err := r.Anonymizer.AnonymizeText(ctx, input, step.Model, clients.CacheDefault)
+		if err != nil {
+			return nil, err
+		}
+		output = map[string]interface{}{"anonymized_text": resp.AnonymizedText}
+	case CapabilityModerate:
+		resp, err := r.Moderator.ModerateContent(ctx, input, "")
+		if err != nil {
+			return nil, err
+		}
+		output = resp
+	case CapabilityClassify:
+		entities := detect(input)
+		label := LabelPublic
+		if len(entities) > 0 {
+			label = LabelConfidential
+		}
+		output = map[string]interface{}{"label": label, "entities": entities}
+	case CapabilityVerify:
+		if len(detect(input)) > 0 {
+			return nil, apierror.New(http.StatusUnprocessableEntity, apierror.CodeVerificationFailed, "The anonymized text still contains personal data")
+		}
+		output = map[string]interface{}{"passed": true}
+	case CapabilityTask:
+		if r.Coordinator == nil {
+			return nil, errNoCoordinator
+		}
+		var config map[string]string
+		if step.Model != "" {
+			config = map[string]string{"model": step.Model}
+		}
+		raw, err := r.Coordinator.RunTask(ctx, step.TaskType, map[string]interface{}{"text": input}, config)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 {
+			return map[string]interface{}{}, nil
+		}
+		output = raw
+	}
+
+	// Normalize through JSON so conditions see the same shapes as the response
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// detect counts PII values in text by type
+func detect(text string) map[string]interface{} {
+	found := make(map[string]interface{})
+	for entityType, re := range piiPatterns {
+		if n := len(re.FindAllString(text, -1)); n > 0 {
+			found[entityType] = n
+		}
+	}
+	return found
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often stale buckets and expired quota counters are dropped
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // When the bucket will be full again (safe to forget after this)
+}
+
+type counter struct {
+	used    int64
+	resetAt time.Time
+}
+
+// MemoryBackend keeps limiter state in process memory. It is suitable for a
+// single gateway replica; use RedisBackend when running several replicas.
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+// Take implements Backend
+func (m *MemoryBackend) Take(_ context.Context, key string, rate float64, burst, n int) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	// Refill based on the time elapsed since the last request
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	b.updated = now
+
+	d := Decision{Limit: burst}
+	if need := float64(min(n, burst)); b.tokens >= need {
+		b.tokens -= float64(n)
+		d.Allowed = true
+	} else {
+		d.RetryAfter = secondsToDuration((need - b.tokens) / rate)
+	}
+	d.Remaining = max(int(math.Floor(b.tokens)), 0)
+	d.Reset = secondsToDuration((float64(burst) - b.tokens) / rate)
+	b.full = now.Add(d.Reset)
+	return d, nil
+}
+
+// Refund implements Backend
+func (m *MemoryBackend) Refund(_ context.Context, key string, rate float64, burst, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		return nil // Swept, so full again
+	}
+	now := m.now()
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate+float64(n))
+	b.updated = now
+	b.full = now.Add(secondsToDuration((float64(burst) - b.tokens) / rate))
+	return nil
+}
+
+// Consume implements Backend
+func (m *MemoryBackend) Consume(_ context.Context, windows []QuotaWindow, amount int64) (bool, []int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	remaining := make([]int64, len(windows))
+	allowed := true
+	for i, w := range windows {
+		used := int64(0)
+		if c, ok := m.counters[w.Key]; ok {
+			used = c.used
+		}
+		if used+amount > w.Limit {
+			allowed = false
+		}
+		remaining[i] = w.Limit - used
+	}
+	if !allowed {
+		return false, remaining, nil
+	}
+
+	for i, w := range windows {
+		c, ok := m.counters[w.Key]
+		if !ok {
+			c = &counter{resetAt: w.ResetAt}
+			m.counters[w.Key] = c
+		}
+		c.used += amount
+		remaining[i] = w.Limit - c.used
+	}
+	return true, remaining, nil
+}
+
+// sweep drops state that no longer affects any decision. Caller must hold m.mu.
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, c := range m.counters {
+		if !now.Before(c.resetAt) {
+			delete(m.counters, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 || math.IsInf(s, 0) || math.IsNaN(s) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,335 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/bodylimit"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CharCounter returns the number of characters a request body counts against quotas
+type CharCounter func(body []byte) int64
+
+// ItemCounter returns the number of tokens a request body takes from the
+// token bucket, such as the number of items of a batch
+type ItemCounter func(body []byte) int
+
+// TextLength counts the characters of the top-level "text" field of a JSON body
+func TextLength(body []byte) int64 {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0 // Malformed bodies are rejected by the handler; nothing to count
+	}
+	return int64(utf8.RuneCountInString(payload.Text))
+}
+
+// BatchTextLength counts the characters of every "items[].text" field of a JSON body
+func BatchTextLength(body []byte) int64 {
+	var payload struct {
+		Items []struct {
+			Text string `json:"text"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0
+	}
+	var total int64
+	for _, item := range payload.Items {
+		total += int64(utf8.RuneCountInString(item.Text))
+	}
+	return total
+}
+
+// BatchItems counts the "items" of a JSON body. Empty and malformed batches
+// count as one request.
+func BatchItems(body []byte) int {
+	var payload struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || len(payload.Items) == 0 {
+		return 1
+	}
+	return len(payload.Items)
+}
+
+// Limiter applies per-route token buckets and character quotas
+type Limiter struct {
+	Backend  Backend
+	mu       sync.RWMutex
+	policies map[string]Policy
+	now      func() time.Time
+}
+
+// NewLimiter creates a limiter for the given route policies
+func NewLimiter(backend Backend, policies ...Policy) *Limiter {
+	l := &Limiter{Backend: backend, now: time.Now}
+	l.SetPolicies(policies...)
+	return l
+}
+
+// SetPolicies replaces the route policies. Requests already past the limiter
+// are not affected; bucket and quota state is kept.
+func (l *Limiter) SetPolicies(policies ...Policy) {
+	byRoute := make(map[string]Policy, len(policies))
+	for _, p := range policies {
+		byRoute[p.Route] = p
+	}
+	l.mu.Lock()
+	l.policies = byRoute
+	l.mu.Unlock()
+}
+
+// Policy returns the policy registered for route
+func (l *Limiter) Policy(route string) (Policy, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	p, ok := l.policies[route]
+	return p, ok
+}
+
+// ClientKey identifies the caller a request is accounted to: the tenant its
+// API key belongs to (see auth.TenantKeys), so that all keys of a tenant share
+// its limits. Callers without a tenant key are accounted to their IP address,
+// since anyone can make up an API key or claim a tenant.
+func ClientKey(c *gin.Context) string {
+	return ClientKeyFor(auth.Tenant(c), c.ClientIP())
+}
+
+// ClientKeyFor identifies a caller from the tenant of its API key ("" for
+// none) and its IP address, as ClientKey does
+func ClientKeyFor(tenant, ip string) string {
+	if tenant != "" {
+		return "tenant:" + tenant
+	}
+	return "ip:" + ip
+}
+
+// Check enforces the policies registered for routes on client, for callers
+// outside Gin, as MiddlewareByRoutes does: one token is taken from each
+// bucket per request (or per batch item) and chars are charged against each
+// quota. The rate limit headers are added to h.
+func (l *Limiter) Check(ctx context.Context, routes []string, client string, tokens int, chars int64, h http.Header) *apierror.Error {
+	return l.enforce(ctx, l.policiesOf(routes), client, tokens, chars, h)
+}
+
+// Middleware enforces the policy registered for route. count may be nil when
+// the route has no character quotas.
+func (l *Limiter) Middleware(route string, count CharCounter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies := l.policiesOf([]string{route})
+		var chars int64
+		if count != nil && hasQuotas(policies) {
+			body, ok := bodylimit.Read(c)
+			if !ok {
+				return
+			}
+			chars = count(body)
+		}
+		l.enforceRequest(c, policies, 1, chars)
+	}
+}
+
+// MiddlewareByItems enforces the policy registered for route on batches,
+// taking one token per item counted by items and charging the characters
+// counted by count. count may be nil when the route has no character quotas.
+func (l *Limiter) MiddlewareByItems(route string, items ItemCounter, count CharCounter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies := l.policiesOf([]string{route})
+		if len(policies) == 0 {
+			c.Next()
+			return
+		}
+		body, ok := bodylimit.Read(c)
+		if !ok {
+			return
+		}
+		var chars int64
+		if count != nil {
+			chars = count(body)
+		}
+		l.enforceRequest(c, policies, items(body), chars)
+	}
+}
+
+// MiddlewareByBody enforces the policy chosen by resolve, which inspects the
+// request body and returns the route name and the characters to charge. It is
+// used by routes that proxy several operations, such as async jobs. Unknown
+// operations pass and are rejected by the handler.
+func (l *Limiter) MiddlewareByBody(resolve func(body []byte) (route string, chars int64)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := bodylimit.Read(c)
+		if !ok {
+			return
+		}
+		route, chars := resolve(body)
+		l.enforceRequest(c, l.policiesOf([]string{route}), 1, chars)
+	}
+}
+
+// MiddlewareByRoutes enforces every policy resolve names for the request,
+// charging the body's characters against each. It is used by routes whose
+// operations depend on configuration, such as pipelines. count may be nil
+// when the routes have no character quotas.
+func (l *Limiter) MiddlewareByRoutes(resolve func(c *gin.Context) []string, count CharCounter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies := l.policiesOf(resolve(c))
+		var chars int64
+		if count != nil && hasQuotas(policies) {
+			body, ok := bodylimit.Read(c)
+			if !ok {
+				return
+			}
+			chars = count(body)
+		}
+		l.enforceRequest(c, policies, 1, chars)
+	}
+}
+
+// policiesOf returns the policies registered for routes, skipping routes
+// without one
+func (l *Limiter) policiesOf(routes []string) []Policy {
+	var policies []Policy
+	for _, route := range routes {
+		if policy, ok := l.Policy(route); ok {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+// hasQuotas reports whether any of policies has a character quota
+func hasQuotas(policies []Policy) bool {
+	for _, p := range policies {
+		if p.DailyChars > 0 || p.MonthlyChars > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceRequest enforces policies on the request and lets it through, or
+// rejects it with the response written
+func (l *Limiter) enforceRequest(c *gin.Context, policies []Policy, tokens int, chars int64) {
+	if err := l.enforce(c.Request.Context(), policies, ClientKey(c), tokens, chars, c.Writer.Header()); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	c.Next()
+}
+
+// enforce takes tokens from the bucket of every policy and charges chars
+// against all their quota windows at once. A request refused by any of them
+// costs nothing: the tokens already taken are put back, and the quotas are
+// only charged if every window has room.
+func (l *Limiter) enforce(ctx context.Context, policies []Policy, client string, tokens int, chars int64, h http.Header) *apierror.Error {
+	now := l.now()
+	var windows []QuotaWindow
+	for i, policy := range policies {
+		if err := l.take(ctx, policy, client, tokens, h); err != nil {
+			l.refund(ctx, policies[:i], client, tokens)
+			return err
+		}
+		windows = append(windows, quotaWindows(policy, client, now)...)
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	if err := l.consume(ctx, windows, chars, h); err != nil {
+		l.refund(ctx, policies, client, tokens)
+		return err
+	}
+	return nil
+}
+
+// take takes tokens from the bucket of policy for client, returning the error
+// to reject the request with if it is over the limit
+func (l *Limiter) take(ctx context.Context, policy Policy, client string, tokens int, h http.Header) *apierror.Error {
+	if policy.RequestsPerSecond <= 0 {
+		return nil
+	}
+	d, err := l.Backend.Take(ctx, policy.Route+":"+client, policy.RequestsPerSecond, policy.Burst, max(tokens, 1))
+	if err != nil {
+		// Fail open: an unavailable limiter backend should not take the API down
+		slog.ErrorContext(ctx, "Rate limiter backend error", "policy", policy.Route, "error", err)
+		return nil
+	}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+		return apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limit exceeded, retry later")
+	}
+	return nil
+}
+
+// refund puts the tokens taken for a refused request back into the buckets
+// of policies
+func (l *Limiter) refund(ctx context.Context, policies []Policy, client string, tokens int) {
+	for _, policy := range policies {
+		if policy.RequestsPerSecond <= 0 {
+			continue
+		}
+		if err := l.Backend.Refund(ctx, policy.Route+":"+client, policy.RequestsPerSecond, policy.Burst, max(tokens, 1)); err != nil {
+			slog.ErrorContext(ctx, "Rate limiter backend error", "policy", policy.Route, "error", err)
+		}
+	}
+}
+
+// consume charges chars against the quota windows, returning the error to
+// reject the request with if a quota is used up
+func (l *Limiter) consume(ctx context.Context, windows []QuotaWindow, chars int64, h http.Header) *apierror.Error {
+	allowed, remaining, err := l.Backend.Consume(ctx, windows, chars)
+	if err != nil {
+		slog.ErrorContext(ctx, "Quota backend error", "error", err)
+		return nil
+	}
+	now := l.now()
+	for i, w := range windows {
+		setQuotaHeaders(h, w, remaining[i], now)
+	}
+	if allowed {
+		return nil
+	}
+
+	// Retry once every exhausted window has started over
+	var retryAt time.Time
+	for i, w := range windows {
+		if remaining[i] < chars && w.ResetAt.After(retryAt) {
+			retryAt = w.ResetAt
+		}
+	}
+	h.Set("Retry-After", strconv.Itoa(ceilSeconds(retryAt.Sub(now))))
+	return apierror.New(http.StatusTooManyRequests, apierror.CodeQuotaExceeded, "Character quota exceeded")
+}
+
+// setQuotaHeaders reports the state of a quota window, e.g. X-RateLimit-Quota-Daily-Remaining
+func setQuotaHeaders(h http.Header, w QuotaWindow, remaining int64, now time.Time) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set("X-RateLimit-Quota-"+w.Period+"-Limit", strconv.FormatInt(w.Limit, 10))
+	h.Set("X-RateLimit-Quota-"+w.Period+"-Remaining", strconv.FormatInt(remaining, 10))
+	h.Set("X-RateLimit-Quota-"+w.Period+"-Reset", strconv.Itoa(ceilSeconds(w.ResetAt.Sub(now))))
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Policy describes the limits applied to a single gateway route. As a
+// setting (see package config), its env tag names the route, e.g. ANONYMIZE
+// for RATE_LIMIT_ANONYMIZE_RPS.
+type Policy struct {
+	Route             string  // Logical route name, e.g. "anonymize" or "moderate"
+	RequestsPerSecond float64 `config:"requests_per_second" env:"RATE_LIMIT_*_RPS"` // Token refill rate; zero disables request throttling
+	Burst             int     `config:"burst" env:"RATE_LIMIT_*_BURST"`             // Bucket capacity (maximum burst of requests, or of batch items)
+	DailyChars        int64   `config:"daily_chars" env:"QUOTA_*_DAILY_CHARS"`      // Characters allowed per UTC day; zero means unlimited
+	MonthlyChars      int64   `config:"monthly_chars" env:"QUOTA_*_MONTHLY_CHARS"`  // Characters allowed per UTC month; zero means unlimited
+}
+
+// Decision is the outcome of taking a token from a bucket
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Whole tokens left after this request
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until the next token is available (only set when denied)
+}
+
+// QuotaWindow is a single character quota counter (e.g. today's usage for a tenant)
+type QuotaWindow struct {
+	Period  string // "Daily" or "Monthly", used in response headers
+	Key     string
+	Limit   int64
+	ResetAt time.Time // When the counter starts over
+}
+
+// Backend stores bucket and quota state. Implementations must be safe for concurrent use.
+type Backend interface {
+	// Take removes n tokens from the bucket identified by key. Taking more
+	// tokens than burst is allowed once the bucket is full and leaves it in
+	// debt, so that large batches are charged in full but not refused forever.
+	Take(ctx context.Context, key string, rate float64, burst, n int) (Decision, error)
+	// Refund puts n tokens taken from the bucket identified by key back, up
+	// to burst, when the request they were taken for is refused after all.
+	Refund(ctx context.Context, key string, rate float64, burst, n int) error
+	// Consume atomically adds amount to every window, or to none of them if any
+	// window would exceed its limit. It returns the remaining allowance per window.
+	Consume(ctx context.Context, windows []QuotaWindow, amount int64) (bool, []int64, error)
+}
+
+// Default policies used when no environment overrides are present
+var (
+	DefaultAnonymizePolicy = Policy{Route: "anonymize", RequestsPerSecond: 5, Burst: 10}
+	DefaultModeratePolicy  = Policy{Route: "moderate", RequestsPerSecond: 10, Burst: 20}
+)
+
+// Validate checks that the limits are usable
+func (p Policy) Validate() error {
+	var errs []error
+	if p.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.%s.requests_per_second: must not be negative", p.Route))
+	}
+	if p.Burst < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit.%s.burst: must be at least 1", p.Route))
+	}
+	if p.DailyChars < 0 || p.MonthlyChars < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.%s: character quotas must not be negative", p.Route))
+	}
+	return errors.Join(errs...)
+}
+
+// quotaWindows builds the daily/monthly counters that apply to a client on a route
+func quotaWindows(p Policy, client string, now time.Time) []QuotaWindow {
+	now = now.UTC()
+	var windows []QuotaWindow
+	if p.DailyChars > 0 {
+		windows = append(windows, QuotaWindow{
+			Period:  "Daily",
+			Key:     fmt.Sprintf("quota:daily:%s:%s:%s", p.Route, client, now.Format("2006-01-02")),
+			Limit:   p.DailyChars,
+			ResetAt: time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if p.MonthlyChars > 0 {
+		windows = append(windows, QuotaWindow{
+			Period:  "Monthly",
+			Key:     fmt.Sprintf("quota:monthly:%s:%s:%s", p.Route, client, now.Format("2006-01")),
+			Limit:   p.MonthlyChars,
+			ResetAt: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return windows
+}
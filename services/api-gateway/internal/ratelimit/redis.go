@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes ARGV[3] tokens from a token bucket stored as a
+// hash, as MemoryBackend.Take does. The Redis server clock is used so that all
+// gateway replicas agree on time. Returns {allowed, tokens_left_as_string}.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= math.min(n, burst) then
+  tokens = tokens - n
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// refundScript puts ARGV[3] tokens back into a token bucket, up to the burst.
+// A bucket that has expired is full and left alone.
+var refundScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  return 0
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate + n)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return 1
+`)
+
+// consumeScript checks every quota counter before incrementing any of them.
+// ARGV[1] is the amount, followed by (limit, reset_at_ms) pairs for each key.
+// Returns {allowed, used_1, used_2, ...}.
+var consumeScript = redis.NewScript(`
+local amount = tonumber(ARGV[1])
+local used = {}
+local allowed = 1
+for i, key in ipairs(KEYS) do
+  used[i] = tonumber(redis.call('GET', key) or '0')
+  if used[i] + amount > tonumber(ARGV[i * 2]) then
+    allowed = 0
+  end
+end
+if allowed == 1 then
+  for i, key in ipairs(KEYS) do
+    used[i] = redis.call('INCRBY', key, amount)
+    redis.call('PEXPIREAT', key, ARGV[i * 2 + 1])
+  end
+end
+local result = {allowed}
+for i = 1, #KEYS do
+  result[i + 1] = used[i]
+end
+return result
+`)
+
+// RedisBackend shares limiter state between gateway replicas through Redis
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend creates a backend using the Redis server at addr (host:port)
+func NewRedisBackend(addr string) *RedisBackend {
+	return &RedisBackend{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: "privacypilot:ratelimit:",
+	}
+}
+
+// Ping verifies that the Redis server is reachable
+func (r *RedisBackend) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Take implements Backend
+func (r *RedisBackend) Take(ctx context.Context, key string, rate float64, burst, n int) (Decision, error) {
+	res, err := takeScript.Run(ctx, r.client, []string{r.prefix + "bucket:" + key}, rate, burst, n).Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("redis token bucket script failed: %w", err)
+	}
+	if len(res) != 2 {
+		return Decision{}, fmt.Errorf("unexpected redis token bucket reply: %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("invalid token count %q from redis: %w", tokensStr, err)
+	}
+
+	d := Decision{
+		Allowed:   allowed == 1,
+		Limit:     burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     secondsToDuration((float64(burst) - tokens) / rate),
+	}
+	if !d.Allowed {
+		d.RetryAfter = secondsToDuration((float64(min(n, burst)) - tokens) / rate)
+	}
+	return d, nil
+}
+
+// Refund implements Backend
+func (r *RedisBackend) Refund(ctx context.Context, key string, rate float64, burst, n int) error {
+	if err := refundScript.Run(ctx, r.client, []string{r.prefix + "bucket:" + key}, rate, burst, n).Err(); err != nil {
+		return fmt.Errorf("redis token refund script failed: %w", err)
+	}
+	return nil
+}
+
+// Consume implements Backend
+func (r *RedisBackend) Consume(ctx context.Context, windows []QuotaWindow, amount int64) (bool, []int64, error) {
+	if len(windows) == 0 {
+		return true, nil, nil
+	}
+	keys := make([]string, len(windows))
+	args := []interface{}{amount}
+	for i, w := range windows {
+		keys[i] = r.prefix + w.Key
+		args = append(args, w.Limit, w.ResetAt.UnixMilli())
+	}
+
+	res, err := consumeScript.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		return false, nil, fmt.Errorf("redis quota script failed: %w", err)
+	}
+	if len(res) != len(windows)+1 {
+		return false, nil, fmt.Errorf("unexpected redis quota reply: %v", res)
+	}
+
+	remaining := make([]int64, len(windows))
+	for i, w := range windows {
+		remaining[i] = w.Limit - res[i+1]
+	}
+	return res[0] == 1, remaining, nil
+}
+
+// Close releases the underlying Redis connections
+func (r *RedisBackend) Close() error {
+	return r.client.Close()
+}
+
+// compile-time interface checks
+var (
+	_ Backend = (*MemoryBackend)(nil)
+	_ Backend = (*RedisBackend)(nil)
+)
@@ -0,0 +1,182 @@
+// Package reversible lets the caller that anonymized a text restore it. The
+// placeholders of a reversible anonymization are numbered, e.g. [NAME_1] and
+// [NAME_2], so each stands for one original value, and the values are sealed
+// into a token with AES-256-GCM. The gateway keeps nothing: the caller sends
+// the token back with the (possibly edited) text to deanonymize it, and a
+// token only opens for the owner it was issued to (see auth.Owner).
+package reversible
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNotAligned is returned when the anonymized text does not keep the
+// original around its placeholders, so the replaced values cannot be told
+var ErrNotAligned = errors.New("the anonymized text does not line up with the original")
+
+// ErrInvalidToken is returned for tokens that are malformed, were issued by a
+// gateway with another key or to another owner
+var ErrInvalidToken = errors.New("invalid deanonymize token")
+
+// placeholderPattern matches the placeholders the model writes, e.g. [EMAIL]
+var placeholderPattern = regexp.MustCompile(`\[([A-Z][A-Z_]*)\]`)
+
+// numberedPattern matches the numbered placeholders Number writes, e.g. [EMAIL_2]
+var numberedPattern = regexp.MustCompile(`\[([A-Z][A-Z_]*)_([1-9][0-9]*)\]`)
+
+// Mapping pairs each numbered placeholder with the original value it replaced
+type Mapping map[string]string
+
+// Sealer seals mappings into tokens and opens them again
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// New creates a sealer whose key is derived from secret. Every gateway
+// replica needs the same secret to open the others' tokens.
+func New(secret string) (*Sealer, error) {
+	if secret == "" {
+		return nil, errors.New("a secret is required")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("privacypilot-deanonymize-token"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts m into a token that only opens for owner
+func (s *Sealer) Seal(owner string, m Mapping) (string, error) {
+	plain, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plain, []byte(owner))), nil
+}
+
+// Open decrypts a token Seal issued to owner
+func (s *Sealer) Open(owner, token string) (Mapping, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, ErrInvalidToken
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(owner))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var m Mapping
+	if err := json.Unmarshal(plain, &m); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return m, nil
+}
+
+// Number lines anonymized up with original to find the value each
+// placeholder replaced, and numbers the placeholders per entity type: the
+// same value gets the same number. It returns the numbered text and the
+// values. Surrounding whitespace is ignored, as the model may drop it.
+func Number(original, anonymized string) (string, Mapping, error) {
+	original, anonymized = strings.TrimSpace(original), strings.TrimSpace(anonymized)
+	matches := placeholderPattern.FindAllStringSubmatchIndex(anonymized, -1)
+	if len(matches) == 0 {
+		return anonymized, Mapping{}, nil
+	}
+
+	// The text between placeholders is kept, so each must be found in the
+	// original in order; what lies between them there was replaced.
+	literals := make([]string, len(matches)+1)
+	prev := 0
+	for i, m := range matches {
+		literals[i] = anonymized[prev:m[0]]
+		prev = m[1]
+	}
+	literals[len(matches)] = anonymized[prev:]
+	if !strings.HasPrefix(original, literals[0]) {
+		return "", nil, ErrNotAligned
+	}
+	pos := len(literals[0])
+	values := make([]string, len(matches))
+	for i := range matches {
+		next := literals[i+1]
+		var end int
+		if i == len(matches)-1 {
+			if !strings.HasSuffix(original[pos:], next) {
+				return "", nil, ErrNotAligned
+			}
+			end = len(original) - len(next)
+		} else {
+			// Adjacent placeholders leave no way to tell where one value ends
+			if next == "" || pos >= len(original) {
+				return "", nil, ErrNotAligned
+			}
+			idx := strings.Index(original[pos+1:], next)
+			if idx < 0 {
+				return "", nil, ErrNotAligned
+			}
+			end = pos + 1 + idx
+		}
+		if end <= pos {
+			return "", nil, ErrNotAligned
+		}
+		values[i] = original[pos:end]
+		pos = end + len(next)
+	}
+
+	mapping := Mapping{}
+	numbers := map[string]string{} // Entity type and value to placeholder
+	counts := map[string]int{}
+	var b strings.Builder
+	for i, m := range matches {
+		b.WriteString(literals[i])
+		entityType := anonymized[m[2]:m[3]]
+		key := entityType + "\x00" + values[i]
+		placeholder, ok := numbers[key]
+		if !ok {
+			counts[entityType]++
+			placeholder = fmt.Sprintf("[%s_%d]", entityType, counts[entityType])
+			numbers[key] = placeholder
+			mapping[placeholder] = values[i]
+		}
+		b.WriteString(placeholder)
+	}
+	b.WriteString(literals[len(matches)])
+	return b.String(), mapping, nil
+}
+
+// Restore replaces the numbered placeholders of m in text with their original
+// values, wherever they were moved to. It returns the restored text and the
+// number of values restored by entity type; placeholders m does not know are
+// left as they are.
+func Restore(text string, m Mapping) (string, map[string]int) {
+	counts := map[string]int{}
+	restored := numberedPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := m[placeholder]
+		if !ok {
+			return placeholder
+		}
+		counts[numberedPattern.FindStringSubmatch(placeholder)[1]]++
+		return value
+	})
+	return restored, counts
+}
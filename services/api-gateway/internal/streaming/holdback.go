@@ -0,0 +1,110 @@
+package streaming
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactedPlaceholder replaces sensitive input values that the model echoed back
+const RedactedPlaceholder = "[REDACTED]"
+
+// Patterns for values in the original input that must never reach the client,
+// even if the model copies them into its output
+var sensitivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), // Email addresses
+	regexp.MustCompile(`\+?\d[\d\s().-]{5,}\d`),                          // Phone, card and ID numbers
+}
+
+// Holdback buffers streamed model output and releases only text that is safe
+// to show. Text is held back while:
+//   - a placeholder is still open ("[NAM" has not become "[NAME]" yet),
+//   - a word is incomplete (the next token may continue it), or
+//   - the tail could be the start of a sensitive value taken from the input.
+//
+// This guarantees that no prefix of a detected PII value is ever emitted: the
+// value is either replaced as a whole or never released at all.
+type Holdback struct {
+	pending   string
+	sensitive []string // Sensitive input values, longest first
+}
+
+// NewHoldback creates a buffer guarding against the PII found in original
+func NewHoldback(original string) *Holdback {
+	seen := make(map[string]struct{})
+	var values []string
+	for _, re := range sensitivePatterns {
+		for _, v := range re.FindAllString(original, -1) {
+			v = strings.TrimSpace(v)
+			if _, ok := seen[v]; ok || v == "" {
+				continue
+			}
+			seen[v] = struct{}{}
+			values = append(values, v)
+		}
+	}
+	// Replace longer values first so a value containing another is fully redacted
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return &Holdback{sensitive: values}
+}
+
+// Push adds a token and returns the text that can be released now (possibly empty)
+func (h *Holdback) Push(token string) string {
+	h.pending = h.redact(h.pending + token)
+
+	cut := safeBoundary(h.pending)
+	cut = h.backOffSensitivePrefix(cut)
+
+	out := h.pending[:cut]
+	h.pending = h.pending[cut:]
+	return out
+}
+
+// Flush releases whatever is still held back, once the stream has ended
+func (h *Holdback) Flush() string {
+	out := h.redact(h.pending)
+	h.pending = ""
+	return out
+}
+
+// redact replaces complete occurrences of sensitive values
+func (h *Holdback) redact(s string) string {
+	for _, v := range h.sensitive {
+		s = strings.ReplaceAll(s, v, RedactedPlaceholder)
+	}
+	return s
+}
+
+// backOffSensitivePrefix moves cut back if the text just before it could be
+// the beginning of a sensitive value that the following tokens would complete
+func (h *Holdback) backOffSensitivePrefix(cut int) int {
+	for _, v := range h.sensitive {
+		maxLen := len(v) - 1
+		if maxLen > cut {
+			maxLen = cut
+		}
+		for k := maxLen; k > 0; k-- {
+			if h.pending[cut-k:cut] == v[:k] {
+				cut -= k
+				break
+			}
+		}
+	}
+	return cut
+}
+
+// safeBoundary returns the length of the longest prefix of s that ends on a
+// word or placeholder boundary and is not inside an open placeholder
+func safeBoundary(s string) int {
+	limit := len(s)
+	if open := strings.LastIndex(s, "["); open >= 0 && !strings.Contains(s[open:], "]") {
+		limit = open // Never release an unfinished placeholder
+	}
+
+	head := s[:limit]
+	cut := strings.LastIndexAny(head, " \t\r\n") + 1
+	if closed := strings.LastIndex(head, "]") + 1; closed > cut {
+		cut = closed
+	}
+	return cut
+}
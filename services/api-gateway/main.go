@@ -1,86 +1,495 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
 	"privacypilot-api-gateway/internal/clients"
+	"privacypilot-api-gateway/internal/grpcapi"
 	"privacypilot-api-gateway/internal/handlers"
+	"privacypilot-api-gateway/internal/idempotency"
+	"privacypilot-api-gateway/internal/jobs"
+	"privacypilot-api-gateway/internal/openapi"
+	"privacypilot-api-gateway/internal/pipeline"
+	"privacypilot-api-gateway/internal/ratelimit"
+	"privacypilot-api-gateway/internal/reversible"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
 
 	"github.com/gin-gonic/gin"
 )
 
+func init() {
+	servicekit.SetName("api-gateway") // Reported in error envelopes, logs and spans
+}
+
+// auditedRoutes are the /api/v1 routes whose every request is audited, whatever
+// its outcome, and the action each is recorded as
+var auditedRoutes = map[string]string{
+	"/api/v1/anonymize":          audit.ActionAnonymize,
+	"/api/v1/anonymize/stream":   audit.ActionAnonymize,
+	"/api/v1/anonymize/batch":    audit.ActionAnonymize,
+	"/api/v1/deanonymize":        audit.ActionDeanonymize,
+	"/api/v1/moderate":           audit.ActionModerate,
+	"/api/v1/process":            audit.ActionProcess,
+	"/api/v1/pipelines/:name":    audit.ActionPipeline,
+	"/api/v1/ai/tasks":           audit.ActionAITask,
+	"/api/v1/jobs":               audit.ActionJob,
+	"/api/v1/admin/audit":        audit.ActionAdmin,
+	"/api/v1/admin/audit/verify": audit.ActionAdmin,
+}
+
 func main() {
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode == "" {
-		ginMode = gin.DebugMode
+	logging.Setup()
+
+	// --- Configuration ---
+	settings, err := config.NewManager(os.Getenv(config.FileEnv), defaultConfig())
+	if err != nil {
+		logging.Fatal("Failed to load configuration", "error", err)
+	}
+	cfg := settings.Current()
+	gin.SetMode(cfg.GinMode)
+
+	// --- Tracing ---
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
 	}
-	gin.SetMode(ginMode)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(ctx)
+	}()
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(
+		telemetry.Middleware(), // Server span, continuing any incoming W3C trace context
+		requestid.Middleware(), // Accept or assign X-Request-ID before anything logs
+		metrics.Middleware(),
+		logging.AccessLog(), // Structured access log that never records paths, queries or bodies
+		logging.Recovery(),
+	)
 
-	// --- Service Clients ---
-	anonymizerURL := strings.TrimRight(os.Getenv("ANONYMIZER_SERVICE_URL"), "/")
-	if anonymizerURL == "" {
-		log.Fatal("ANONYMIZER_SERVICE_URL environment variable not set")
+	// --- Mutual TLS ---
+	// Certificates for calls to https downstream URLs; nil when disabled
+	certs, err := mtls.Load(cfg.MTLS)
+	if err != nil {
+		logging.Fatal("Failed to load the mTLS certificates", "error", err)
 	}
+	health.UseTransport(certs.Transport())
+
+	// --- Service Clients ---
+	anonymizerURL := strings.TrimRight(cfg.Downstream.AnonymizerURL, "/")
 	anonymizerClient := clients.NewAnonymizerClient(anonymizerURL)
+	anonymizerClient.UseTransport(certs.Transport())
 
-	moderationURL := strings.TrimRight(os.Getenv("MODERATION_SERVICE_URL"), "/")
-	if moderationURL == "" {
-		log.Fatal("MODERATION_SERVICE_URL environment variable not set")
-	}
+	moderationURL := strings.TrimRight(cfg.Downstream.ModerationURL, "/")
 	moderationClient := clients.NewModerationClient(moderationURL) // Instantiate moderation client
+	moderationClient.UseTransport(certs.Transport())
 
-	// aiCoordinatorURL := strings.TrimRight(os.Getenv("AI_COORDINATOR_URL"), "/")
-	// if aiCoordinatorURL == "" {
-	//  log.Fatal("AI_COORDINATOR_URL environment variable not set")
-	// }
-	// aiCoordinatorClient := clients.NewAICoordinatorClient(aiCoordinatorURL) // Create later
+	// Optional: only pipeline task steps and AI tasks call it directly
+	var aiCoordinatorClient *clients.AICoordinatorClient
+	aiCoordinatorURL := strings.TrimRight(cfg.Downstream.AICoordinatorURL, "/")
+	if aiCoordinatorURL != "" {
+		aiCoordinatorClient = clients.NewAICoordinatorClient(aiCoordinatorURL)
+		aiCoordinatorClient.UseTransport(certs.Transport())
+	}
 
 	// --- Handlers ---
 	// anonymizerClient := clients.NewAnonymizerClient(anonymizerURL)
 	// moderationClient := clients.NewModerationClient(moderationURL)
 	anonymizeHandler := handlers.NewAnonymizeHandler(anonymizerClient)
+	anonymizeHandler.BatchConcurrency = cfg.Batch.Concurrency
+	anonymizeHandler.MaxBatchItems = cfg.Batch.MaxItems
 	moderateHandler := handlers.NewModerateHandler(moderationClient)
-	// aiHandler := handlers.NewAIHandler(aiCoordinatorClient) // Create later
+	processMode, _ := handlers.ParseProcessMode(cfg.ProcessMode) // Checked by Config.Validate
+	processHandler := handlers.NewProcessHandler(anonymizerClient, moderationClient, processMode)
+	pipelineHandler := handlers.NewPipelineHandler(loadPipelines(cfg.PipelinesConfig, aiCoordinatorClient != nil), &pipeline.Runner{
+		Anonymizer:  anonymizerClient,
+		Moderator:   moderationClient,
+		Coordinator: aiCoordinatorClient,
+	})
+	aiTaskHandler := handlers.NewAITaskHandler(aiCoordinatorClient)
+
+	// Reversible anonymization seals the replaced values into tokens with a key every replica shares
+	var sealer *reversible.Sealer
+	if cfg.DeanonymizeKey != "" {
+		if sealer, err = reversible.New(cfg.DeanonymizeKey); err != nil {
+			logging.Fatal("Failed to set up deanonymize tokens", "error", err)
+		}
+	} else {
+		slog.Info("DEANONYMIZE_KEY not set. Reversible anonymization and /api/v1/deanonymize are disabled.")
+	}
+	anonymizeHandler.Sealer = sealer
+	deanonymizeHandler := handlers.NewDeanonymizeHandler(sealer)
+
+	// --- HTTP Server ---
+	serverConfig := cfg.Server
+	serverConfig.Addr = ":" + cfg.Port
+	httpServer := server.New(serverConfig)
+
+	// --- Async Jobs ---
+	jobManager := newJobManager(cfg.Jobs, anonymizerClient, moderationClient)
+	jobManager.Start(context.Background())
+	httpServer.OnShutdown(jobManager.Shutdown) // Running jobs get the same grace period as requests
+	jobsHandler := handlers.NewJobsHandler(jobManager)
+
+	// --- Tenants ---
+	// The tenant of a request comes from its API key, never from a header
+	tenantGrants, _ := auth.ParseTenantKeys(cfg.TenantKeys) // Checked by Config.Validate
+	tenantKeys := auth.NewTenantKeys(tenantGrants)
+	router.Use(tenantKeys.Middleware())
+	if len(tenantGrants) == 0 {
+		slog.Info("TENANT_KEYS not set. Rate limits and quotas apply per client IP.")
+	}
+
+	// --- Rate Limiting ---
+	limiter := newRateLimiter(cfg.RateLimit)
+
+	// --- Idempotency Keys ---
+	idempotencyGuard, err := newIdempotencyGuard(cfg.Idempotency)
+	if err != nil {
+		logging.Fatal("Failed to set up idempotency keys", "error", err)
+	}
+	idempotent := idempotencyGuard.Middleware()
+
+	// --- Audit Log ---
+	auditLog := newAuditLog(cfg.Audit)
+	adminHandler := handlers.NewAdminHandler(auditLog)
+	adminKeys := auth.NewAdminKeys(auth.ParseKeys(cfg.AdminAPIKeys))
+	aiTaskGrants, _ := auth.ParseScopedKeys(cfg.AITaskKeys) // Checked by Config.Validate
+	aiTaskKeys := auth.NewScopedKeys(aiTaskGrants)
+	switch {
+	case len(aiTaskGrants) == 0:
+		slog.Info("AI_TASK_KEYS not set. /api/v1/ai/tasks is disabled.")
+	case aiCoordinatorClient == nil:
+		slog.Warn("AI_TASK_KEYS is set but AI_COORDINATOR_URL is not; AI tasks will fail")
+	}
+
+	// --- Time Budgets ---
+	budgets := budget.NewPolicy(cfg.Budget)
+
+	// --- Hot Settings ---
+	// Applied now and again whenever the configuration is reloaded
+	applySettings := func(cfg *Config) {
+		level, _ := logging.ParseLevel(cfg.LogLevel)
+		logging.SetLevel(level)
+		anonymizerClient.SetTimeouts(cfg.Downstream.AnonymizerTimeout, cfg.Downstream.AnonymizerStreamTimeout)
+		moderationClient.SetTimeout(cfg.Downstream.ModerationTimeout)
+		anonymizerClient.Resilience.SetConfig(cfg.Resilience)
+		moderationClient.Resilience.SetConfig(cfg.Resilience)
+		if aiCoordinatorClient != nil {
+			aiCoordinatorClient.SetTimeout(cfg.Downstream.AICoordinatorTimeout)
+			aiCoordinatorClient.Resilience.SetConfig(cfg.Resilience)
+		}
+		limiter.SetPolicies(cfg.RateLimit.Anonymize, cfg.RateLimit.Moderate)
+		budgets.SetConfig(cfg.Budget)
+		idempotencyGuard.SetTTL(cfg.Idempotency.TTL)
+		for _, p := range []ratelimit.Policy{cfg.RateLimit.Anonymize, cfg.RateLimit.Moderate} {
+			slog.Info("Rate limit configured", "policy", p.Route, "requests_per_second", p.RequestsPerSecond,
+				"burst", p.Burst, "daily_chars", p.DailyChars, "monthly_chars", p.MonthlyChars)
+		}
+	}
+	applySettings(cfg)
+	settings.OnReload(applySettings)
+
+	// --- API Contract ---
+	spec, err := openapi.Load()
+	if err != nil {
+		logging.Fatal("Failed to load OpenAPI document", "error", err)
+	}
+	responseMode, _ := openapi.ParseResponseMode(cfg.OpenAPIResponseValidation) // Checked by Config.Validate
+
+	// --- Health Checks ---
+	readiness, deepHealth := newHealthCheckers(cfg.Health, anonymizerURL, moderationURL, aiCoordinatorURL)
 
 	// --- Routes ---
-	router.GET("/health", healthCheckHandler)
+	router.GET("/health", httpServer.FailWhileDraining(), healthCheckHandler)
+	router.GET("/livez", health.LiveHandler(serviceName))
+	router.GET("/readyz", httpServer.FailWhileDraining(), readiness.Handler())
+	// Whole topology down to Ollama; admin only, since failures name internal hosts
+	router.GET("/health/deep", auditLog.Middleware(audit.ActionAdmin), adminKeys.Middleware(), deepHealth.Handler())
+	router.GET("/metrics", metrics.Handler()) // Prometheus scrape endpoint
+	// Configuration in effect, secrets redacted; admin only like the admin API
+	router.GET("/config", auditLog.Middleware(audit.ActionAdmin), adminKeys.Middleware(), settings.Handler())
 
 	// API v1 Routes
 	apiV1 := router.Group("/api/v1")
 	{
 		// Add authentication middleware here later
 		// apiV1.Use(authMiddleware())
+		// Audit comes before anything that can reject a request, so rejected calls are recorded too.
+		apiV1.Use(auditLog.MiddlewareByRoute(auditedRoutes))
+		// AI task keys are checked before the contract reads the body; their scope only once it has
+		apiV1.Use(aiTaskKeys.MiddlewareByRoute("/api/v1/ai/tasks"))
+		apiV1.Use(budgets.Middleware())          // Deadline from the caller's or the route's time budget
+		apiV1.Use(spec.Middleware(responseMode)) // Validate against the OpenAPI contract
+
+		apiV1.GET("/openapi.json", spec.Handler)
+
+		// Idempotency-Key replays come before the limiter, so they are audited but use no quota.
+		apiV1.POST("/anonymize", idempotent, limiter.Middleware("anonymize", ratelimit.TextLength), anonymizeHandler.HandleAnonymize)
+		apiV1.POST("/anonymize/stream", idempotent, limiter.Middleware("anonymize", ratelimit.TextLength), anonymizeHandler.HandleAnonymizeStream)
+		apiV1.POST("/anonymize/batch", idempotent, limiter.MiddlewareByItems("anonymize", ratelimit.BatchItems, ratelimit.BatchTextLength), anonymizeHandler.HandleAnonymizeBatch)
+		// Deanonymization calls no other service, so neither idempotency nor the limits apply
+		apiV1.POST("/deanonymize", deanonymizeHandler.HandleDeanonymize)
+		apiV1.POST("/moderate", idempotent, limiter.Middleware("moderate", ratelimit.TextLength), moderateHandler.HandleModerate) // Register moderate route
+		// Processing is charged against both the moderation and the anonymization limits
+		apiV1.POST("/process", idempotent, limiter.Middleware("moderate", ratelimit.TextLength), limiter.Middleware("anonymize", ratelimit.TextLength), processHandler.HandleProcess)
+		apiV1.POST("/pipelines/:name", idempotent, limiter.MiddlewareByRoutes(pipelineHandler.RateLimitRoutes, ratelimit.TextLength), pipelineHandler.HandleRunPipeline)
+		// The key's scope for the task type is checked before the task is charged against the limits
+		apiV1.POST("/ai/tasks", aiTaskKeys.MiddlewareByBody(handlers.AITaskScopeOf), idempotent, limiter.MiddlewareByBody(handlers.AITaskRateLimitRoute), aiTaskHandler.HandleRunTask)
+		apiV1.POST("/jobs", idempotent, limiter.MiddlewareByBody(handlers.JobRateLimitRoute), jobsHandler.HandleCreateJob)
+		apiV1.GET("/jobs/:id", jobsHandler.HandleGetJob)
+
+		admin := apiV1.Group("/admin", adminKeys.Middleware())
+		admin.GET("/audit", adminHandler.HandleQueryAudit)
+		admin.GET("/audit/verify", adminHandler.HandleVerifyAudit)
+	}
 
-		apiV1.POST("/anonymize", anonymizeHandler.HandleAnonymize)
-		apiV1.POST("/moderate", moderateHandler.HandleModerate) // Register moderate route
+	// --- gRPC API ---
+	// Same handlers, audit log, keys and limiter as the REST API
+	grpcServer := grpcapi.NewServer(grpcapi.Config{
+		Anonymize:  anonymizeHandler,
+		Moderate:   moderateHandler,
+		Process:    processHandler,
+		Pipelines:  pipelineHandler,
+		AITasks:    aiTaskHandler,
+		Jobs:       jobsHandler,
+		Admin:      adminHandler,
+		Limiter:    limiter,
+		Audit:      auditLog,
+		AdminKeys:  adminKeys,
+		AITaskKeys: aiTaskKeys,
+		TenantKeys: tenantKeys,
+	})
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		logging.Fatal("Failed to listen for gRPC", "port", cfg.GRPCPort, "error", err)
 	}
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			logging.Fatal("Failed to serve gRPC", "error", err)
+		}
+	}()
+	httpServer.OnShutdown(func(ctx context.Context) error {
+		return grpcapi.Shutdown(ctx, grpcServer)
+	})
+
+	slog.Info("API Gateway starting",
+		"port", cfg.Port,
+		"grpc_port", cfg.GRPCPort,
+		"config_file", os.Getenv(config.FileEnv),
+		"anonymizer_url", anonymizerURL,
+		"moderation_url", moderationURL,
+		"ai_coordinator_url", aiCoordinatorURL,
+		"mtls", cfg.MTLS.Enabled,
+		"openapi_response_validation", string(responseMode),
+		"process_mode", string(processMode),
+		"shutdown_grace_period", serverConfig.GracePeriod.String(),
+	)
 
 	// --- Start Server ---
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Runs until SIGINT or SIGTERM, then drains in-flight requests, gRPC calls and jobs
+	ctx, stop := server.NotifyContext()
+	defer stop()
+	go settings.Watch(ctx, config.WatchInterval) // Reload on SIGHUP or when the file changes
+	go certs.Watch(ctx, mtls.WatchInterval)      // Reload rotated certificates
+	if err := httpServer.Serve(ctx, router); err != nil {
+		logging.Fatal("Server stopped", "error", err)
 	}
-	serverAddr := fmt.Sprintf(":%s", port)
+}
+
+// newRateLimiter builds the per-route limiter. The backend is "memory" (one
+// replica) or "redis" (shared across replicas); the policies are set by the
+// hot settings.
+func newRateLimiter(cfg RateLimitConfig) *ratelimit.Limiter {
+	var backend ratelimit.Backend
+	switch strings.ToLower(cfg.Backend) {
+	case "redis":
+		redisBackend := ratelimit.NewRedisBackend(cfg.RedisAddr)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := redisBackend.Ping(ctx); err != nil {
+			// Not fatal: the limiter fails open until Redis becomes reachable
+			slog.Warn("Could not reach Redis for rate limiting", "redis_addr", cfg.RedisAddr, "error", err)
+		}
+		backend = redisBackend
+		slog.Info("Rate limiter configured", "backend", "redis", "redis_addr", cfg.RedisAddr)
+	default:
+		backend = ratelimit.NewMemoryBackend()
+		slog.Info("Rate limiter configured", "backend", "memory")
+	}
+	return ratelimit.NewLimiter(backend)
+}
 
-	log.Printf("API Gateway starting on port %s\n", port)
-	log.Printf("--> Anonymizer Service URL: %s", anonymizerURL)
-	log.Printf("--> Moderation Service URL: %s", moderationURL) // Log moderation URL
-	// log.Printf("--> AI Coordinator URL: %s", aiCoordinatorURL)
+// newIdempotencyGuard builds the Idempotency-Key guard. The store is "memory"
+// (one replica) or "redis" (shared across replicas); the TTL is a hot setting.
+func newIdempotencyGuard(cfg IdempotencyConfig) (*idempotency.Guard, error) {
+	var store idempotency.Store
+	switch strings.ToLower(cfg.Backend) {
+	case "redis":
+		redisStore := idempotency.NewRedisStore(cfg.RedisAddr)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := redisStore.Ping(ctx); err != nil {
+			// Not fatal: keys are ignored until Redis becomes reachable
+			slog.Warn("Could not reach Redis for idempotency keys", "redis_addr", cfg.RedisAddr, "error", err)
+		}
+		store = redisStore
+		slog.Info("Idempotency keys configured", "backend", "redis", "redis_addr", cfg.RedisAddr)
+	default:
+		store = idempotency.NewMemoryStore()
+		slog.Info("Idempotency keys configured", "backend", "memory")
+	}
+	return idempotency.NewGuard(store, cfg.EncryptionKey, cfg.TTL, cfg.LockTimeout)
+}
+
+// newJobManager configures the async job subsystem. Jobs use their own clients
+// whose timeout matches the job timeout rather than the synchronous 10-15s;
+// they share the synchronous clients' circuit breakers.
+func newJobManager(settings JobsConfig, anonymizerClient *clients.AnonymizerClient, moderationClient *clients.ModerationClient) *jobs.Manager {
+	cfg := jobs.Config{
+		Workers:    settings.Workers,
+		QueueSize:  settings.QueueSize,
+		ResultTTL:  settings.ResultTTL,
+		JobTimeout: settings.Timeout,
+	}
 
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	var notifier *jobs.Notifier
+	if settings.WebhookSecret != "" {
+		notifier = jobs.NewNotifier([]byte(settings.WebhookSecret))
+		notifier.AllowPrivateNetworks = settings.CallbackPrivateNetworks
+	} else {
+		slog.Warn("JOBS_WEBHOOK_SECRET not set. Job callbacks are disabled.")
+	}
+
+	jobAnonymizerClient := clients.NewAnonymizerClient(anonymizerClient.BaseURL)
+	jobAnonymizerClient.SetTimeouts(cfg.JobTimeout, cfg.JobTimeout)
+	jobAnonymizerClient.HttpClient = anonymizerClient.HttpClient
+	jobAnonymizerClient.StreamHttpClient = anonymizerClient.StreamHttpClient
+	jobAnonymizerClient.Resilience = anonymizerClient.Resilience
+	jobModerationClient := clients.NewModerationClient(moderationClient.BaseURL)
+	jobModerationClient.SetTimeout(cfg.JobTimeout)
+	jobModerationClient.HttpClient = moderationClient.HttpClient
+	jobModerationClient.Resilience = moderationClient.Resilience
+
+	manager := jobs.NewManager(cfg, notifier)
+	manager.Register(handlers.JobTypeAnonymize, handlers.AnonymizeJobTask(jobAnonymizerClient))
+	manager.Register(handlers.JobTypeModerate, handlers.ModerateJobTask(jobModerationClient))
+
+	slog.Info("Async jobs configured", "workers", cfg.Workers, "queue_size", cfg.QueueSize,
+		"result_ttl", cfg.ResultTTL.String(), "job_timeout", cfg.JobTimeout.String())
+	return manager
+}
+
+// loadPipelines reads the pipeline definitions at path. An invalid file stops
+// the gateway; without one no pipelines are available.
+func loadPipelines(path string, haveCoordinator bool) *pipeline.Config {
+	if path == "" {
+		slog.Info("PIPELINES_CONFIG not set. No pipelines are configured.")
+		return nil
+	}
+	cfg, err := pipeline.Load(path)
+	if err != nil {
+		logging.Fatal("Failed to load pipelines", "path", path, "error", err)
+	}
+	for _, name := range cfg.Names() {
+		p, _ := cfg.Get(name)
+		for _, step := range p.Steps {
+			if step.Capability == pipeline.CapabilityTask && !haveCoordinator {
+				slog.Warn("Pipeline has task steps but AI_COORDINATOR_URL is not set; they will fail", "pipeline", name, "step", step.Name)
+			}
+		}
 	}
+	slog.Info("Pipelines configured", "path", path, "pipelines", cfg.Names())
+	return cfg
 }
 
-// healthCheckHandler remains the same
+// newAuditLog opens the audit log at settings.LogPath and checks its chain.
+// Without a path records are only kept in memory.
+func newAuditLog(settings AuditConfig) *audit.Log {
+	cfg := audit.Config{
+		PolicyVersion: settings.PolicyVersion,
+		HashKey:       []byte(settings.HashKey),
+	}
+
+	var sink audit.Sink
+	path := settings.LogPath
+	if path != "" {
+		fileSink, err := audit.NewFileSink(path)
+		if err != nil {
+			logging.Fatal("Failed to open audit log", "path", path, "error", err)
+		}
+		sink = fileSink
+	} else {
+		slog.Warn("AUDIT_LOG_PATH not set. Audit records are kept in memory and lost on restart.")
+		sink = audit.NewMemorySink()
+	}
+
+	// A broken chain is reported but does not stop the gateway: refusing to
+	// start would turn tampering into an outage, and new records still chain
+	// onto the last one written. An unreadable file does stop it (in NewLog).
+	result, err := audit.Verify(sink)
+	if err != nil {
+		logging.Fatal("Failed to read audit log", "path", path, "error", err)
+	}
+	if !result.Valid {
+		slog.Error("Audit chain verification failed", "path", path, "bad_seq", result.BadSeq, "reason", result.Reason)
+	}
+	auditLog, err := audit.NewLog(sink, cfg)
+	if err != nil {
+		logging.Fatal("Failed to open audit log", "path", path, "error", err)
+	}
+
+	slog.Info("Audit log configured", "path", path, "records", result.Records,
+		"head_hash", result.Head, "policy_version", cfg.PolicyVersion, "keyed_hashes", len(cfg.HashKey) > 0)
+	return auditLog
+}
+
+// serviceName identifies the gateway in health reports
+const serviceName = "API Gateway"
+
+// healthCheckHandler remains the same. It does not check downstream
+// services; /readyz does.
 func healthCheckHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": "API Gateway"})
+	c.JSON(http.StatusOK, gin.H{"status": "OK", "service": serviceName})
+}
+
+// newHealthCheckers builds the readiness checks, which need the anonymizer
+// and moderation services to be up, and the deep checks, which collect their
+// own deep reports. The coordinator is optional (only pipeline task steps
+// call it), so it can only degrade the gateway.
+func newHealthCheckers(cfg health.Config, anonymizerURL, moderationURL, aiCoordinatorURL string) (readiness, deep *health.Checker) {
+	readiness = health.NewChecker(serviceName, cfg.Timeout, cfg.CacheTTL)
+	readiness.Add("anonymizer-service", true, health.HTTPProbe(anonymizerURL+"/livez"))
+	readiness.Add("moderation-service", true, health.HTTPProbe(moderationURL+"/livez"))
+
+	deep = health.NewChecker(serviceName, cfg.DeepTimeout, cfg.CacheTTL)
+	deep.Add("anonymizer-service", true, health.HTTPProbe(anonymizerURL+"/health/deep"))
+	deep.Add("moderation-service", true, health.HTTPProbe(moderationURL+"/health/deep"))
+
+	if aiCoordinatorURL != "" {
+		readiness.Add("ai-coordinator", false, health.HTTPProbe(aiCoordinatorURL+"/livez"))
+		deep.Add("ai-coordinator", false, health.HTTPProbe(aiCoordinatorURL+"/health/deep"))
+	}
+	return readiness, deep
 }
 
 // Placeholder for auth middleware
@@ -2,15 +2,76 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"privacypilot-api-gateway/internal/audit"
+	"privacypilot-api-gateway/internal/auth"
+	"privacypilot-api-gateway/internal/bodylimit"
 	"privacypilot-api-gateway/internal/clients"
+	"privacypilot-api-gateway/internal/grpcapi"
 	"privacypilot-api-gateway/internal/handlers"
-	"testing"
+	"privacypilot-api-gateway/internal/idempotency"
+	"privacypilot-api-gateway/internal/jobs"
+	"privacypilot-api-gateway/internal/openapi"
+	"privacypilot-api-gateway/internal/pipeline"
+	"privacypilot-api-gateway/internal/ratelimit"
+	"privacypilot-api-gateway/internal/reversible"
+	pb "privacypilot-api-gateway/proto/privacypilot/v1"
+
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/apierror"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/budget"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/config"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/health"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/logging"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/metrics"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/mtls"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/requestid"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/resilience"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/server"
+	"github.com/mihaibc/PrivacyPilot/pkg/servicekit/telemetry"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // --- Mock Moderation Service Setup ---
@@ -56,6 +117,7 @@ func setupMockModerationServer(t *testing.T, expectedReqBody clients.ModerationR
 func setupGatewayRouter(anonymizerURL, moderationURL string) *gin.Engine { // Add moderationURL param
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	router.Use(requestid.Middleware())
 
 	anonymizerClient := clients.NewAnonymizerClient(anonymizerURL)
 	moderationClient := clients.NewModerationClient(moderationURL) // Create moderation client
@@ -67,6 +129,8 @@ func setupGatewayRouter(anonymizerURL, moderationURL string) *gin.Engine { // Ad
 	apiV1 := router.Group("/api/v1")
 	{
 		apiV1.POST("/anonymize", anonymizeHandler.HandleAnonymize)
+		apiV1.POST("/anonymize/batch", anonymizeHandler.HandleAnonymizeBatch)
+		apiV1.POST("/anonymize/stream", anonymizeHandler.HandleAnonymizeStream)
 		apiV1.POST("/moderate", moderateHandler.HandleModerate) // Register moderation handler
 	}
 
@@ -151,11 +215,12 @@ func TestModerateRoute_ModerationServiceError(t *testing.T) {
 	router.ServeHTTP(rr, req)
 
 	// 4. Assertions
-	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Expected Service Unavailable from gateway")
-	var errorResponse map[string]string
-	err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
-	assert.NoError(t, err)
-	assert.Contains(t, errorResponse["error"], "Failed to process request", "Expected error message")
+	// A downstream 500 is reported as 502 Bad Gateway, attributed to the moderation service
+	assert.Equal(t, http.StatusBadGateway, rr.Code, "Expected Bad Gateway from gateway")
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeUpstreamError, apiErr.Code)
+	assert.Equal(t, clients.ModerationServiceName, apiErr.Service)
+	assert.False(t, apiErr.Retryable, "A plain 500 is not known to be transient")
 }
 
 func TestModerateRoute_GatewayBadRequest_MissingFields(t *testing.T) {
@@ -176,10 +241,341 @@ func TestModerateRoute_GatewayBadRequest_MissingFields(t *testing.T) {
 
 	// 4. Assertions
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "Expected Bad Request from gateway for missing fields")
-	var errorResponse map[string]string
-	err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeInvalidRequest, apiErr.Code)
+	assert.Contains(t, apiErr.Message, "text or imageUrl must be provided")
+	assert.Equal(t, servicekit.Name(), apiErr.Service)
+	assert.False(t, apiErr.Retryable)
+}
+
+// decodeAPIError decodes the standard error envelope from a response
+func decodeAPIError(t *testing.T, rr *httptest.ResponseRecorder) *apierror.Error {
+	t.Helper()
+	var envelope apierror.Envelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("Expected an error envelope, got %q", rr.Body.String())
+	}
+	return envelope.Error
+}
+
+func TestAnonymizeRoute_UnknownModelPropagates(t *testing.T) {
+	// The anonymizer relays the adapter's envelope unchanged
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		assert.Equal(t, "no-such-model", reqBody.Model, "The model override must be passed on")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: &apierror.Error{
+			Code:    apierror.CodeModelNotFound,
+			Message: "Model 'no-such-model' is not available",
+			Service: "ollama-adapter",
+		}})
+	}))
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	requestBodyBytes, _ := json.Marshal(handlers.AnonymizeGatewayRequest{Text: "Hello Jane", Model: "no-such-model"})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(apierror.HeaderRequestID, "req-123")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code, "A client error downstream must stay a 4xx")
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeModelNotFound, apiErr.Code)
+	assert.Equal(t, "ollama-adapter", apiErr.Service, "The originating service must be kept")
+	assert.Equal(t, "req-123", apiErr.RequestID)
+	assert.False(t, apiErr.Retryable)
+}
+
+func TestAnonymizeRoute_ForwardsTheCallerForTheCache(t *testing.T) {
+	owners := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		owners <- reqBody.Owner
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: "Hello [NAME]"})
+	}))
+	defer mockServer.Close()
+	router := setupIdempotentRouter(t, mockServer.URL, idempotency.NewMemoryStore(), "")
+
+	// The anonymizer keys cached results by owner, so tenants cannot probe each other's
+	for apiKey, owner := range map[string]string{
+		"acme-key":   "tenant:acme",
+		"acme-key-2": "tenant:acme",
+		"globex-key": "tenant:globex",
+		"solo-key":   auth.PrincipalForKey("solo-key"),
+	} {
+		rr := postWithIdempotencyKey(router, "/api/v1/anonymize", "", apiKey, `{"text": "Hello Jane"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, owner, <-owners, apiKey)
+	}
+}
+
+func TestAnonymizeRoute_AnonymizerUnreachable(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockServer.Close() // Nothing listens on this URL anymore
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "Hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeUpstreamUnavailable, apiErr.Code)
+	assert.Equal(t, servicekit.Name(), apiErr.Service)
+	assert.True(t, apiErr.Retryable)
+}
+
+func TestAnonymizeRoute_CacheModeAndCachedFlag(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: "Hello [NAME]", Cached: reqBody.Cache == clients.CacheDefault})
+	}))
+	defer mockServer.Close()
+
+	router, _ := setupValidatedGatewayRouter(t, mockServer.URL, "", openapi.ResponseValidationEnforce)
+	post := func(body string) (int, clients.AnonymizerResponse) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp clients.AnonymizerResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	status, resp := post(`{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, resp.Cached, "The anonymizer's cached flag must be passed on")
+
+	// The cache mode is forwarded to the anonymizer
+	status, resp = post(`{"text": "Hello Jane", "cache": "refresh"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, resp.Cached)
+
+	status, _ = post(`{"text": "Hello Jane", "cache": "never"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// setupIdempotentRouter serves the anonymize and job routes behind the
+// contract and an Idempotency-Key guard over store, as in main
+func setupIdempotentRouter(t *testing.T, anonymizerURL string, store idempotency.Store, secret string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(anonymizerURL))
+	jobManager := jobs.NewManager(jobs.DefaultConfig(), nil)
+	jobManager.Register(handlers.JobTypeAnonymize, handlers.AnonymizeJobTask(clients.NewAnonymizerClient(anonymizerURL)))
+	jobsHandler := handlers.NewJobsHandler(jobManager)
+	guard, err := idempotency.NewGuard(store, secret, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create idempotency guard: %v", err)
+	}
+	idempotent := guard.Middleware()
+
+	router := gin.New()
+	router.Use(testTenantKeys.Middleware())
+	apiV1 := router.Group("/api/v1", spec.Middleware(openapi.ResponseValidationEnforce))
+	apiV1.POST("/anonymize", idempotent, anonymizeHandler.HandleAnonymize)
+	apiV1.POST("/jobs", idempotent, jobsHandler.HandleCreateJob)
+	return router
+}
+
+func postWithIdempotencyKey(router *gin.Engine, path, key, apiKey, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotency.HeaderKey, key)
+	}
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestIdempotency_ReplaysFirstResponse(t *testing.T) {
+	var calls, flakyCalls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if reqBody.Text == "Hello flaky" && flakyCalls.Add(1) == 1 {
+			// Passed on from further down, so the gateway does not retry it itself
+			busy := apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "busy")
+			busy.Service = clients.AICoordinatorServiceName
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: busy})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: fmt.Sprintf("Hello [NAME] #%d", n)})
+	}))
+	defer mockServer.Close()
+	router := setupIdempotentRouter(t, mockServer.URL, idempotency.NewMemoryStore(), "")
+
+	first := postWithIdempotencyKey(router, "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get(idempotency.HeaderReplayed))
+
+	retry := postWithIdempotencyKey(router, "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.Equal(t, int32(1), calls.Load(), "A retry must not reach the anonymizer")
+
+	// Another body, or another route, with the same key is refused
+	rr := postWithIdempotencyKey(router, "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello John"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, apierror.CodeIdempotencyKeyReused, decodeAPIError(t, rr).Code)
+	rr = postWithIdempotencyKey(router, "/api/v1/jobs", "key-1", "acme-key", `{"type": "anonymize", "input": {"text": "Hello Jane"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// Keys are scoped to the caller
+	rr = postWithIdempotencyKey(router, "/api/v1/anonymize", "key-1", "globex-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Responses that ask for a retry are not kept
+	rr = postWithIdempotencyKey(router, "/api/v1/anonymize", "key-2", "acme-key", `{"text": "Hello flaky"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	rr = postWithIdempotencyKey(router, "/api/v1/anonymize", "key-2", "acme-key", `{"text": "Hello flaky"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(idempotency.HeaderReplayed))
+
+	// A job is created once, and its retry gets the same job back
+	job := postWithIdempotencyKey(router, "/api/v1/jobs", "job-1", "acme-key", `{"type": "anonymize", "input": {"text": "Hello Jane"}}`)
+	assert.Equal(t, http.StatusAccepted, job.Code)
+	jobRetry := postWithIdempotencyKey(router, "/api/v1/jobs", "job-1", "acme-key", `{"type": "anonymize", "input": {"text": "Hello Jane"}}`)
+	assert.Equal(t, http.StatusAccepted, jobRetry.Code)
+	assert.Equal(t, job.Body.String(), jobRetry.Body.String())
+	assert.Equal(t, job.Header().Get("Location"), jobRetry.Header().Get("Location"))
+
+	// Requests without a key are never deduplicated; malformed keys are refused
+	before := calls.Load()
+	postWithIdempotencyKey(router, "/api/v1/anonymize", "", "acme-key", `{"text": "Hello Jane"}`)
+	postWithIdempotencyKey(router, "/api/v1/anonymize", "", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, before+2, calls.Load())
+	rr = postWithIdempotencyKey(router, "/api/v1/anonymize", strings.Repeat("k", idempotency.MaxKeyLength+1), "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestIdempotency_SerializesConcurrentDuplicates(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "Hello Jane", AnonymizedText: "Hello [NAME]"})
+	}))
+	defer mockServer.Close()
+	router := setupIdempotentRouter(t, mockServer.URL, idempotency.NewMemoryStore(), "")
+
+	const duplicates = 5
+	responses := make([]*httptest.ResponseRecorder, duplicates)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = postWithIdempotencyKey(router, "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond) // Give the duplicates time to (wrongly) reach the anonymizer
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load(), "Only the first request may run")
+	replayed := 0
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, responses[0].Body.String(), rr.Body.String())
+		if rr.Header().Get(idempotency.HeaderReplayed) == "true" {
+			replayed++
+		}
+	}
+	assert.Equal(t, duplicates-1, replayed)
+}
+
+// savingStore records the bodies saved to its Store
+type savingStore struct {
+	idempotency.Store
+	mu     sync.Mutex
+	bodies [][]byte
+}
+
+func (s *savingStore) Save(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	s.mu.Lock()
+	s.bodies = append(s.bodies, rec.Body)
+	s.mu.Unlock()
+	return s.Store.Save(ctx, key, rec, ttl)
+}
+
+func TestIdempotency_StoresEncryptedResponses(t *testing.T) {
+	var calls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "Hello Jane", AnonymizedText: "Hello [NAME]"})
+	}))
+	defer mockServer.Close()
+	store := &savingStore{Store: idempotency.NewMemoryStore()}
+
+	first := postWithIdempotencyKey(setupIdempotentRouter(t, mockServer.URL, store, "secret"), "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	if assert.Len(t, store.bodies, 1) {
+		assert.NotContains(t, string(store.bodies[0]), "Hello", "Stored responses must be encrypted")
+		assert.NotContains(t, string(store.bodies[0]), "[NAME]", "Stored responses must be encrypted")
+	}
+
+	// Another replica with the same secret replays the response
+	retry := postWithIdempotencyKey(setupIdempotentRouter(t, mockServer.URL, store, "secret"), "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, "true", retry.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	// One with another secret cannot read it, so the request runs again
+	rr := postWithIdempotencyKey(setupIdempotentRouter(t, mockServer.URL, store, "other-secret"), "/api/v1/anonymize", "key-1", "acme-key", `{"text": "Hello Jane"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotency_BodySizeIsBounded(t *testing.T) {
+	guard, err := idempotency.NewGuard(idempotency.NewMemoryStore(), "", time.Hour, time.Minute)
 	assert.NoError(t, err)
-	assert.Contains(t, errorResponse["error"], "text or imageUrl must be provided")
+	router := gin.New()
+	router.POST("/api/v1/jobs", guard.Middleware(), func(c *gin.Context) {
+		t.Error("Oversized requests should not reach the handler")
+	})
+
+	// Same limit and error as everywhere else, even without the contract in front
+	endless := &endlessBody{}
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", endless)
+	req.Header.Set(idempotency.HeaderKey, "key-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Equal(t, apierror.CodePayloadTooLarge, decodeAPIError(t, rr).Code)
+	assert.LessOrEqual(t, endless.read, bodylimit.MaxBytes+64<<10, "Read far past the limit")
 }
 
 // Keep existing tests for /health and /api/v1/anonymize
@@ -189,3 +585,3282 @@ func TestModerateRoute_GatewayBadRequest_MissingFields(t *testing.T) {
 // func TestAnonymizeRoute_BadRequest(t *testing.T) { ... }
 
 // Remember helper functions like setupMockAnonymizerServer if not shown fully above.
+
+// --- Rate Limiting Tests ---
+
+// testTenantKeys are the tenant keys configured in test routers
+var testTenantKeys = auth.NewTenantKeys(map[string]string{"acme-key": "acme", "acme-key-2": "acme", "globex-key": "globex"})
+
+// setupRateLimitedRouter registers the moderation route behind a limiter using the given policy
+func setupRateLimitedRouter(moderationURL string, policy ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	moderateHandler := handlers.NewModerateHandler(clients.NewModerationClient(moderationURL))
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), policy)
+
+	router.Use(testTenantKeys.Middleware())
+	router.POST("/api/v1/moderate", limiter.Middleware(policy.Route, ratelimit.TextLength), moderateHandler.HandleModerate)
+	return router
+}
+
+func performModerateRequest(router *gin.Engine, text, apiKey string) *httptest.ResponseRecorder {
+	requestBodyBytes, _ := json.Marshal(handlers.ModerateGatewayRequest{Text: text})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/moderate", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRateLimit_BurstExceeded(t *testing.T) {
+	mockServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "hello"}, mockModerationResponseOK, http.StatusOK)
+	defer mockServer.Close()
+
+	router := setupRateLimitedRouter(mockServer.URL, ratelimit.Policy{Route: "moderate", RequestsPerSecond: 0.01, Burst: 1})
+
+	// First request consumes the only token
+	rr := performModerateRequest(router, "hello", "acme-key")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+
+	// Second request is throttled
+	rr = performModerateRequest(router, "hello", "acme-key")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"), "429 must carry Retry-After")
+	assert.NotEmpty(t, rr.Header().Get("X-RateLimit-Reset"))
+
+	// Another tenant has its own bucket
+	rr = performModerateRequest(router, "hello", "globex-key")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRateLimit_DailyCharacterQuota(t *testing.T) {
+	mockServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "12345678"}, mockModerationResponseOK, http.StatusOK)
+	defer mockServer.Close()
+
+	router := setupRateLimitedRouter(mockServer.URL, ratelimit.Policy{Route: "moderate", DailyChars: 10})
+
+	rr := performModerateRequest(router, "12345678", "acme-key")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Quota-Daily-Remaining"))
+
+	// 8 more characters would exceed the 10 character daily quota
+	rr = performModerateRequest(router, "12345678", "acme-key")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Quota-Daily-Remaining"), "Rejected requests must not consume quota")
+}
+
+func TestRateLimit_TenantComesFromTheAPIKey(t *testing.T) {
+	mockServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "hello"}, mockModerationResponseOK, http.StatusOK)
+	defer mockServer.Close()
+
+	router := setupRateLimitedRouter(mockServer.URL, ratelimit.Policy{Route: "moderate", RequestsPerSecond: 0.01, Burst: 1})
+
+	// The keys of one tenant share its bucket
+	assert.Equal(t, http.StatusOK, performModerateRequest(router, "hello", "acme-key").Code)
+	assert.Equal(t, http.StatusTooManyRequests, performModerateRequest(router, "hello", "acme-key-2").Code)
+
+	// Unknown keys are limited by IP, so making up keys or claiming a tenant does not escape the limit
+	assert.Equal(t, http.StatusOK, performModerateRequest(router, "hello", "made-up-key").Code)
+	requestBodyBytes, _ := json.Marshal(handlers.ModerateGatewayRequest{Text: "hello"})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/moderate", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderAPIKey, "another-made-up-key")
+	req.Header.Set("X-Tenant-ID", "globex")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, http.StatusOK, performModerateRequest(router, "hello", "globex-key").Code)
+}
+
+func TestRateLimit_BodySizeIsBounded(t *testing.T) {
+	router := setupRateLimitedRouter("http://moderation.invalid", ratelimit.Policy{Route: "moderate", DailyChars: 10})
+
+	body := `{"text": "` + strings.Repeat("a", bodylimit.MaxBytes) + `"}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/moderate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Equal(t, apierror.CodePayloadTooLarge, decodeAPIError(t, rr).Code)
+}
+
+func TestRateLimit_SeveralPoliciesRefuseAsOne(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(),
+		ratelimit.Policy{Route: "moderate", RequestsPerSecond: 0.01, Burst: 1, DailyChars: 10},
+		ratelimit.Policy{Route: "anonymize", DailyChars: 5},
+	)
+	router := gin.New()
+	router.Use(testTenantKeys.Middleware())
+	router.POST("/api/v1/pipelines/:name", limiter.MiddlewareByRoutes(func(*gin.Context) []string { return []string{"moderate", "anonymize"} }, ratelimit.TextLength), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	run := func(text string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(map[string]string{"text": text})
+		return postWithIdempotencyKey(router, "/api/v1/pipelines/p", "", "acme-key", string(payload))
+	}
+
+	// The second policy's quota has no room for 8 characters
+	rr := run("12345678")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, apierror.CodeQuotaExceeded, decodeAPIError(t, rr).Code)
+
+	// So the first policy's bucket and quota are as they were
+	h := make(http.Header)
+	assert.Nil(t, limiter.Check(context.Background(), []string{"moderate"}, ratelimit.ClientKeyFor("acme", ""), 1, 10, h))
+	assert.Equal(t, "0", h.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "0", h.Get("X-RateLimit-Quota-Daily-Remaining"))
+}
+
+// --- Combined Processing Tests ---
+
+// setupProcessRouter registers only the process route
+func setupProcessRouter(anonymizerURL, moderationURL string, mode handlers.ProcessMode) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestid.Middleware())
+	processHandler := handlers.NewProcessHandler(clients.NewAnonymizerClient(anonymizerURL), clients.NewModerationClient(moderationURL), mode)
+	router.POST("/api/v1/process", processHandler.HandleProcess)
+	return router
+}
+
+func postProcess(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/process", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestProcessRoute_AllowedContentIsAnonymized(t *testing.T) {
+	for _, mode := range []handlers.ProcessMode{handlers.ProcessSequential, handlers.ProcessConcurrent} {
+		t.Run(string(mode), func(t *testing.T) {
+			moderationServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "Call Bob"}, mockModerationResponseOK, http.StatusOK)
+			defer moderationServer.Close()
+			anonymizerServer := setupMockAnonymizerServer(t, "")
+			defer anonymizerServer.Close()
+
+			rr := postProcess(setupProcessRouter(anonymizerServer.URL, moderationServer.URL, mode), `{"text": "Call Bob"}`)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var resp handlers.ProcessGatewayResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, handlers.VerdictAllowed, resp.Verdict)
+			assert.Equal(t, []string{}, resp.Flags)
+			assert.Equal(t, mockModerationResponseOK.ConfidenceScore, resp.ConfidenceScore)
+			assert.Equal(t, "[ANON] Call Bob", resp.AnonymizedText)
+		})
+	}
+}
+
+func TestProcessRoute_BlockedContentSkipsAnonymization(t *testing.T) {
+	moderationServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "Bad words", ImageURL: "http://example.com/a.png"}, mockModerationResponseFlagged, http.StatusOK)
+	defer moderationServer.Close()
+	anonymizerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The anonymizer should not be called for blocked content")
+	}))
+	defer anonymizerServer.Close()
+
+	rr := postProcess(setupProcessRouter(anonymizerServer.URL, moderationServer.URL, handlers.ProcessSequential), `{"text": "Bad words", "imageUrl": "http://example.com/a.png"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp handlers.ProcessGatewayResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, handlers.VerdictBlocked, resp.Verdict)
+	assert.Equal(t, mockModerationResponseFlagged.Flags, resp.Flags)
+	assert.Empty(t, resp.AnonymizedText)
+	assert.NotContains(t, rr.Body.String(), "anonymized_text")
+}
+
+func TestProcessRoute_ConcurrentBlockCancelsAnonymization(t *testing.T) {
+	moderationServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "Bad words"}, mockModerationResponseFlagged, http.StatusOK)
+	defer moderationServer.Close()
+	cancelled := make(chan struct{})
+	anonymizerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+			t.Error("Anonymization was not cancelled")
+		}
+	}))
+	defer anonymizerServer.Close()
+
+	start := time.Now()
+	rr := postProcess(setupProcessRouter(anonymizerServer.URL, moderationServer.URL, handlers.ProcessConcurrent), `{"text": "Bad words"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"verdict":"blocked"`)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("The anonymizer did not see the cancellation")
+	}
+}
+
+func TestProcessRoute_FailuresPropagate(t *testing.T) {
+	// Moderation failing means no verdict, even if anonymization succeeded
+	moderationServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "Hello"}, clients.ModerationResponse{}, http.StatusServiceUnavailable)
+	defer moderationServer.Close()
+	anonymizerServer := setupMockAnonymizerServer(t, "")
+	defer anonymizerServer.Close()
+
+	rr := postProcess(setupProcessRouter(anonymizerServer.URL, moderationServer.URL, handlers.ProcessConcurrent), `{"text": "Hello"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, clients.ModerationServiceName, decodeAPIError(t, rr).Service)
+
+	// Anonymization failing fails allowed content
+	okServer := setupMockModerationServer(t, clients.ModerationRequest{Text: "Hello"}, mockModerationResponseOK, http.StatusOK)
+	defer okServer.Close()
+	failingServer := setupMockAnonymizerServer(t, "Hello")
+	defer failingServer.Close()
+
+	rr = postProcess(setupProcessRouter(failingServer.URL, okServer.URL, handlers.ProcessSequential), `{"text": "Hello"}`)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Equal(t, clients.AnonymizerServiceName, decodeAPIError(t, rr).Service)
+}
+
+// --- Pipeline Tests ---
+
+// testPipelinesYAML defines the pipelines used by the tests
+const testPipelinesYAML = `
+pipelines:
+  ugc:
+    description: Classify, anonymize confidential text, verify, then moderate
+    steps:
+      - name: classify
+        capability: classify
+      - name: anonymize
+        capability: anonymize
+        when: classify.label == "confidential"
+        timeout: 5s
+      - name: verify
+        capability: verify
+      - name: moderate
+        capability: moderate
+  routed:
+    steps:
+      - name: detect
+        capability: task
+        task_type: detect_topic
+        model: tiny
+      - name: anonymize
+        capability: anonymize
+        when: detect.topic == "billing" && detect.score >= 0.5 || detect.tags contains "pii"
+`
+
+// setupPipelineServer mocks the anonymizer, moderation and coordinator
+// services. The anonymizer replaces emails with [EMAIL] unless the text
+// contains "leak"; moderation records the text it was asked about.
+func setupPipelineServer(t *testing.T, moderated *[]string, coordinatorResult string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/anonymize":
+			text, _ := body["text"].(string)
+			if !strings.Contains(text, "leak") {
+				text = strings.ReplaceAll(text, "bob@example.com", "[EMAIL]")
+			}
+			_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{AnonymizedText: text})
+		case "/moderate":
+			mu.Lock()
+			*moderated = append(*moderated, body["text"].(string))
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(mockModerationResponseOK)
+		case "/process":
+			assert.Equal(t, "detect_topic", body["task_type"])
+			assert.Equal(t, map[string]interface{}{"model": "tiny"}, body["config"])
+			_, _ = io.WriteString(w, `{"success": true, "result": `+coordinatorResult+`}`)
+		default:
+			t.Errorf("Mock: unexpected path %s", r.URL.Path)
+		}
+	}))
+}
+
+func setupPipelineRouter(t *testing.T, serverURL string) *gin.Engine {
+	pipelines, err := pipeline.Parse([]byte(testPipelinesYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse pipelines: %v", err)
+	}
+	handler := handlers.NewPipelineHandler(pipelines, &pipeline.Runner{
+		Anonymizer:  clients.NewAnonymizerClient(serverURL),
+		Moderator:   clients.NewModerationClient(serverURL),
+		Coordinator: clients.NewAICoordinatorClient(serverURL),
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/pipelines/:name", handler.HandleRunPipeline)
+	return router
+}
+
+func runPipeline(t *testing.T, router *gin.Engine, name, text string) (*httptest.ResponseRecorder, pipeline.Result) {
+	body, _ := json.Marshal(handlers.PipelineGatewayRequest{Text: text})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/pipelines/"+name, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var result pipeline.Result
+	if rr.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	}
+	return rr, result
+}
+
+func stepStatuses(result pipeline.Result) []string {
+	var statuses []string
+	for _, s := range result.Steps {
+		statuses = append(statuses, s.Name+":"+s.Status)
+	}
+	return statuses
+}
+
+func TestPipeline_ConditionsSelectSteps(t *testing.T) {
+	var moderated []string
+	server := setupPipelineServer(t, &moderated, `{}`)
+	defer server.Close()
+	router := setupPipelineRouter(t, server.URL)
+
+	// Confidential text is anonymized, verified, and only then moderated
+	rr, result := runPipeline(t, router, "ugc", "Mail bob@example.com")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ugc", result.Pipeline)
+	assert.Equal(t, "Mail [EMAIL]", result.Text)
+	assert.Equal(t, []string{"classify:succeeded", "anonymize:succeeded", "verify:succeeded", "moderate:succeeded"}, stepStatuses(result))
+	assert.Equal(t, map[string]interface{}{"label": "confidential", "entities": map[string]interface{}{"EMAIL": float64(1)}}, result.Steps[0].Output)
+	for _, s := range result.Steps {
+		assert.GreaterOrEqual(t, s.DurationMs, 0.0)
+	}
+	assert.GreaterOrEqual(t, result.DurationMs, result.Steps[1].DurationMs)
+
+	// Public text skips anonymization
+	rr, result = runPipeline(t, router, "ugc", "Nice weather")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "Nice weather", result.Text)
+	assert.Equal(t, []string{"classify:succeeded", "anonymize:skipped", "verify:succeeded", "moderate:succeeded"}, stepStatuses(result))
+	assert.Nil(t, result.Steps[1].Output)
+
+	assert.Equal(t, []string{"Mail [EMAIL]", "Nice weather"}, moderated)
+}
+
+func TestPipeline_CustomTaskOutputDrivesConditions(t *testing.T) {
+	cases := []struct {
+		result   string
+		expected string
+	}{
+		{`{"topic": "billing", "score": 0.9}`, "anonymize:succeeded"},
+		{`{"topic": "billing", "score": 0.2}`, "anonymize:skipped"},
+		{`{"topic": "other", "tags": ["pii"]}`, "anonymize:succeeded"},
+		{`{"topic": "other"}`, "anonymize:skipped"},
+	}
+	for _, tc := range cases {
+		server := setupPipelineServer(t, new([]string), tc.result)
+		rr, result := runPipeline(t, setupPipelineRouter(t, server.URL), "routed", "Mail bob@example.com")
+		server.Close()
+
+		assert.Equal(t, http.StatusOK, rr.Code, tc.result)
+		assert.Equal(t, []string{"detect:succeeded", tc.expected}, stepStatuses(result), tc.result)
+	}
+}
+
+func TestPipeline_Failures(t *testing.T) {
+	server := setupPipelineServer(t, new([]string), `{}`)
+	defer server.Close()
+	router := setupPipelineRouter(t, server.URL)
+
+	// The anonymizer leaves the email in place: verification stops the pipeline before moderation
+	rr, _ := runPipeline(t, router, "ugc", "leak bob@example.com")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeVerificationFailed, apiErr.Code)
+	assert.NotContains(t, rr.Body.String(), "bob@example.com")
+
+	rr, _ = runPipeline(t, router, "missing", "text")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Task steps without a coordinator
+	pipelines, _ := pipeline.Parse([]byte(testPipelinesYAML))
+	handler := handlers.NewPipelineHandler(pipelines, &pipeline.Runner{})
+	noCoordinator := gin.New()
+	noCoordinator.POST("/api/v1/pipelines/:name", handler.HandleRunPipeline)
+	rr, _ = runPipeline(t, noCoordinator, "routed", "text")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestPipeline_InvalidDefinitionsAreRejected(t *testing.T) {
+	cases := map[string]string{
+		"unknown capability":  "pipelines: {p: {steps: [{name: a, capability: translate}]}}",
+		"unknown field":       "pipelines: {p: {steps: [{name: a, capability: classify, retries: 3}]}}",
+		"missing task_type":   "pipelines: {p: {steps: [{name: a, capability: task}]}}",
+		"task_type on step":   "pipelines: {p: {steps: [{name: a, capability: classify, task_type: x}]}}",
+		"duplicate step":      "pipelines: {p: {steps: [{name: a, capability: classify}, {name: a, capability: verify}]}}",
+		"later step":          `pipelines: {p: {steps: [{name: a, capability: classify, when: "b.passed"}, {name: b, capability: verify}]}}`,
+		"bad condition":       `pipelines: {p: {steps: [{name: a, capability: classify}, {name: b, capability: verify, when: "a.label =="}]}}`,
+		"negated comparison":  `pipelines: {p: {steps: [{name: a, capability: classify}, {name: b, capability: verify, when: "!a.label == 1"}]}}`,
+		"bad input":           "pipelines: {p: {steps: [{name: a, capability: classify, input: previous}]}}",
+		"no steps":            "pipelines: {p: {steps: []}}",
+		"bad pipeline name":   "pipelines: {My Pipeline: {steps: [{name: a, capability: classify}]}}",
+		"model on moderation": "pipelines: {p: {steps: [{name: a, capability: moderate, model: x}]}}",
+	}
+	for name, yaml := range cases {
+		_, err := pipeline.Parse([]byte(yaml))
+		assert.Error(t, err, name)
+	}
+
+	cfg, err := pipeline.Parse([]byte(testPipelinesYAML))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"routed", "ugc"}, cfg.Names())
+	ugc, _ := cfg.Get("ugc")
+	assert.Equal(t, []string{"anonymize", "moderate"}, ugc.RateLimitRoutes())
+}
+
+// --- Batch Anonymization Tests ---
+
+// setupMockAnonymizerServer returns "[ANON] <text>" for every request, and a 500
+// for any text equal to failText
+func setupMockAnonymizerServer(t *testing.T, failText string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Mock Anonymizer: Expected POST request")
+		assert.Equal(t, "/anonymize", r.URL.Path, "Mock Anonymizer: Expected path /anonymize")
+
+		var reqBody clients.AnonymizerRequest
+		err := json.NewDecoder(r.Body).Decode(&reqBody)
+		assert.NoError(t, err, "Mock Anonymizer: Failed to decode request body")
+
+		w.Header().Set("Content-Type", "application/json")
+		if reqBody.Text == failText {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "AI Model Failed"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{
+			OriginalText:   reqBody.Text,
+			AnonymizedText: "[ANON] " + reqBody.Text,
+		})
+	}))
+}
+
+func TestAnonymizeBatchRoute_PartialFailurePreservesOrder(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "fail")
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	batch := handlers.AnonymizeBatchGatewayRequest{
+		Items: []handlers.AnonymizeBatchItemRequest{
+			{ID: "a", Text: "first"},
+			{ID: "b", Text: "fail"},
+			{ID: "c", Text: "third"},
+			{ID: "d", Text: "fourth"},
+		},
+		Concurrency: 2,
+	}
+	requestBodyBytes, _ := json.Marshal(batch)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize/batch", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "A failing item must not fail the batch")
+	var resp handlers.AnonymizeBatchGatewayResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, resp.Succeeded)
+	assert.Equal(t, 1, resp.Failed)
+	if assert.Len(t, resp.Results, 4) {
+		assert.Equal(t, "a", resp.Results[0].ID)
+		assert.Equal(t, "[ANON] first", resp.Results[0].AnonymizedText)
+		assert.Equal(t, "b", resp.Results[1].ID)
+		if assert.NotNil(t, resp.Results[1].Error) {
+			assert.Equal(t, apierror.CodeUpstreamError, resp.Results[1].Error.Code)
+			assert.Equal(t, clients.AnonymizerServiceName, resp.Results[1].Error.Service)
+		}
+		assert.Empty(t, resp.Results[1].AnonymizedText)
+		assert.Equal(t, "c", resp.Results[2].ID)
+		assert.Equal(t, "[ANON] third", resp.Results[2].AnonymizedText)
+		assert.Equal(t, "d", resp.Results[3].ID)
+		assert.Equal(t, "[ANON] fourth", resp.Results[3].AnonymizedText)
+	}
+}
+
+func TestAnonymizeBatchRoute_DuplicateIDs(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Mock anonymizer server should not be called")
+	}))
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	body := `{"items": [{"id": "x", "text": "one"}, {"id": "x", "text": "two"}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize/batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "duplicate item id")
+}
+
+func TestAnonymizeBatchRoute_ChargesOneTokenPerItem(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(testTenantKeys.Middleware())
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Policy{Route: "anonymize", RequestsPerSecond: 0.01, Burst: 5})
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(mockServer.URL))
+	router.POST("/api/v1/anonymize/batch", limiter.MiddlewareByItems("anonymize", ratelimit.BatchItems, ratelimit.BatchTextLength), anonymizeHandler.HandleAnonymizeBatch)
+
+	postBatch := func(apiKey string, items int) *httptest.ResponseRecorder {
+		batch := handlers.AnonymizeBatchGatewayRequest{}
+		for i := 0; i < items; i++ {
+			batch.Items = append(batch.Items, handlers.AnonymizeBatchItemRequest{ID: strconv.Itoa(i), Text: "text"})
+		}
+		requestBodyBytes, _ := json.Marshal(batch)
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize/batch", bytes.NewBuffer(requestBodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := postBatch("acme-key", 3)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Remaining"))
+	rr = postBatch("acme-key", 3)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, "3 items need 3 tokens")
+
+	// A batch larger than the burst goes through on a full bucket, and is charged in full
+	assert.Equal(t, http.StatusOK, postBatch("globex-key", 8).Code)
+	rr = postBatch("globex-key", 1)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	retryAfter, _ := strconv.Atoi(rr.Header().Get("Retry-After"))
+	assert.Greater(t, retryAfter, 300, "The bucket is 3 tokens in debt at 0.01 tokens per second")
+}
+
+// --- Async Job Tests ---
+
+// setupJobsRouter starts a job manager backed by the given anonymizer URL
+func setupJobsRouter(t *testing.T, anonymizerURL string, notifier *jobs.Notifier) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	manager := jobs.NewManager(jobs.DefaultConfig(), notifier)
+	manager.Register(handlers.JobTypeAnonymize, handlers.AnonymizeJobTask(clients.NewAnonymizerClient(anonymizerURL)))
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		manager.Wait()
+	})
+
+	jobsHandler := handlers.NewJobsHandler(manager)
+	router.Use(requestid.Middleware(), testTenantKeys.Middleware())
+	router.POST("/api/v1/jobs", jobsHandler.HandleCreateJob)
+	router.GET("/api/v1/jobs/:id", jobsHandler.HandleGetJob)
+	return router
+}
+
+// waitForJob polls the job endpoint until the job has finished
+func waitForJob(t *testing.T, router *gin.Engine, id string) jobs.Job {
+	var job jobs.Job
+	assert.Eventually(t, func() bool {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/"+id, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			return false
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &job)
+		return job.Finished()
+	}, 2*time.Second, 10*time.Millisecond, "Job should finish")
+	return job
+}
+
+func TestJobs_AnonymizeLifecycle(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+
+	router := setupJobsRouter(t, mockServer.URL, nil)
+
+	body := `{"type": "anonymize", "input": {"text": "Call Bob"}}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var created jobs.Job
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "/api/v1/jobs/"+created.ID, rr.Header().Get("Location"))
+
+	job := waitForJob(t, router, created.ID)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+	assert.NotNil(t, job.ExpiresAt, "Finished jobs must carry an expiry")
+	result, ok := job.Result.(map[string]interface{})
+	if assert.True(t, ok, "Result should be an object") {
+		assert.Equal(t, "[ANON] Call Bob", result["anonymized_text"])
+	}
+}
+
+func TestJobs_RejectsInvalidSubmissions(t *testing.T) {
+	router := setupJobsRouter(t, "http://unused.invalid", nil)
+
+	cases := map[string]string{
+		"unknown type":        `{"type": "summarize", "input": {"text": "x"}}`,
+		"missing text":        `{"type": "anonymize", "input": {}}`,
+		"callbacks disabled":  `{"type": "anonymize", "input": {"text": "x"}, "callback_url": "https://example.com/hook"}`,
+		"missing input field": `{"type": "anonymize"}`,
+	}
+	for name, body := range cases {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/job_doesnotexist", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestJobs_SignedWebhookIsRetried(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+
+	secret := []byte("test-secret")
+	var attempts int32
+	delivered := make(chan jobs.Job, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first delivery to exercise the retry path
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r.Body)
+		expected := jobs.Sign(secret, r.Header.Get(jobs.HeaderTimestamp), buf.Bytes())
+		assert.Equal(t, expected, r.Header.Get(jobs.HeaderSignature), "Webhook signature must verify")
+
+		var job jobs.Job
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &job))
+		w.WriteHeader(http.StatusNoContent)
+		delivered <- job
+	}))
+	defer receiver.Close()
+
+	notifier := jobs.NewNotifier(secret)
+	notifier.InitialBackoff = 10 * time.Millisecond
+	notifier.AllowPrivateNetworks = true // The receiver listens on loopback
+	router := setupJobsRouter(t, mockServer.URL, notifier)
+
+	body, _ := json.Marshal(handlers.CreateJobRequest{
+		Type:        handlers.JobTypeAnonymize,
+		Input:       json.RawMessage(`{"text": "hello"}`),
+		CallbackURL: receiver.URL,
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case job := <-delivered:
+		assert.Equal(t, jobs.StatusSucceeded, job.Status)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	case <-time.After(2 * time.Second):
+		t.Fatal("Webhook was not delivered")
+	}
+}
+
+func TestJobs_RefusesCallbacksIntoPrivateNetworks(t *testing.T) {
+	router := setupJobsRouter(t, "http://unused.invalid", jobs.NewNotifier([]byte("test-secret")))
+
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook", // Resolves to loopback
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.7/hook",
+		"http://100.64.0.1/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.1.1]/hook",
+		"ftp://example.com/hook",
+	} {
+		body, _ := json.Marshal(handlers.CreateJobRequest{Type: handlers.JobTypeAnonymize, Input: json.RawMessage(`{"text": "hello"}`), CallbackURL: callbackURL})
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, callbackURL)
+	}
+
+	// Deliveries are checked again when connecting, in case the host resolves elsewhere by then
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The webhook reached a loopback receiver")
+	}))
+	defer receiver.Close()
+	_, err := jobs.NewNotifier([]byte("test-secret")).HttpClient.Post(receiver.URL, "application/json", nil)
+	assert.ErrorIs(t, err, jobs.ErrBlockedCallback)
+}
+
+func TestJobs_OnlyTheOwnerCanReadAJob(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+	router := setupJobsRouter(t, mockServer.URL, nil)
+
+	call := func(method, path, apiKey, remoteAddr, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set(auth.HeaderAPIKey, apiKey)
+		}
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	submit := func(apiKey, remoteAddr string) string {
+		rr := call(http.MethodPost, "/api/v1/jobs", apiKey, remoteAddr, `{"type": "anonymize", "input": {"text": "Call Bob"}}`)
+		var created jobs.Job
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		return created.ID
+	}
+
+	// Any key of the submitting tenant can read the job
+	id := submit("acme-key", "192.0.2.1:1234")
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/v1/jobs/"+id, "acme-key-2", "198.51.100.9:1234", "").Code)
+	for name, apiKey := range map[string]string{"another tenant": "globex-key", "no key": "", "a key without a tenant": "other-key"} {
+		rr := call(http.MethodGet, "/api/v1/jobs/"+id, apiKey, "192.0.2.1:1234", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code, name)
+		assert.Equal(t, apierror.CodeNotFound, decodeAPIError(t, rr).Code, name)
+	}
+
+	// A key without a tenant owns its jobs; without a key the IP address does
+	id = submit("other-key", "192.0.2.1:1234")
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/v1/jobs/"+id, "other-key", "198.51.100.9:1234", "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/api/v1/jobs/"+id, "", "192.0.2.1:1234", "").Code)
+	id = submit("", "192.0.2.1:1234")
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/v1/jobs/"+id, "", "192.0.2.1:1234", "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/api/v1/jobs/"+id, "", "198.51.100.9:1234", "").Code)
+}
+
+// --- Streaming Tests ---
+
+// setupMockAnonymizerStreamServer streams the given chunks as newline-delimited JSON
+func setupMockAnonymizerStreamServer(t *testing.T, chunks []clients.AnonymizeStreamChunk) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/anonymize/stream", r.URL.Path, "Mock Anonymizer: Expected path /anonymize/stream")
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		for _, chunk := range chunks {
+			_ = encoder.Encode(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+// parseSSE splits an event stream body into (event, data) pairs
+func parseSSE(body string) [][2]string {
+	var events [][2]string
+	for _, block := range strings.Split(body, "\n\n") {
+		var event, data string
+		for _, line := range strings.Split(block, "\n") {
+			if strings.HasPrefix(line, "event:") {
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			} else if strings.HasPrefix(line, "data:") {
+				data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			}
+		}
+		if event != "" {
+			events = append(events, [2]string{event, data})
+		}
+	}
+	return events
+}
+
+func TestAnonymizeStreamRoute_HoldsBackUnsafeOutput(t *testing.T) {
+	// The model splits a placeholder across tokens and (wrongly) echoes the email back
+	mockServer := setupMockAnonymizerStreamServer(t, []clients.AnonymizeStreamChunk{
+		{Token: "Hi [NA"},
+		{Token: "ME], mail "},
+		{Token: "bob@exa"},
+		{Token: "mple.com to"},
+		{Token: "day"},
+		{Done: true, ModelUsed: "test-model"},
+	})
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	requestBodyBytes, _ := json.Marshal(handlers.AnonymizeGatewayRequest{Text: "Hi Alice, mail bob@example.com today"})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize/stream", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mediaType, _, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	assert.Equal(t, "text/event-stream", mediaType)
+
+	var streamed strings.Builder
+	var done map[string]string
+	for _, ev := range parseSSE(rr.Body.String()) {
+		switch ev[0] {
+		case handlers.StreamEventToken:
+			var data map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(ev[1]), &data))
+			assert.NotContains(t, data["text"], "bob", "No prefix of the email may be emitted")
+			assert.False(t, strings.Count(data["text"], "[") != strings.Count(data["text"], "]"), "Placeholders must not be split: %q", data["text"])
+			streamed.WriteString(data["text"])
+		case handlers.StreamEventDone:
+			assert.NoError(t, json.Unmarshal([]byte(ev[1]), &done))
+		default:
+			t.Errorf("Unexpected event %q", ev[0])
+		}
+	}
+	assert.Equal(t, "Hi [NAME], mail [REDACTED] today", streamed.String())
+	assert.Equal(t, "Hi [NAME], mail [REDACTED] today", done["anonymized_text"])
+	assert.Equal(t, "test-model", done["model_used"])
+}
+
+func TestAnonymizeStreamRoute_UpstreamErrorDiscardsHeldText(t *testing.T) {
+	mockServer := setupMockAnonymizerStreamServer(t, []clients.AnonymizeStreamChunk{
+		{Token: "Call 555 12"},
+		{Error: &apierror.Error{Code: apierror.CodeUpstreamError, Message: "model crashed", Service: "ollama-adapter"}},
+	})
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	requestBodyBytes, _ := json.Marshal(handlers.AnonymizeGatewayRequest{Text: "Call 555 1234 567"})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize/stream", bytes.NewBuffer(requestBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	events := parseSSE(rr.Body.String())
+	if assert.NotEmpty(t, events) {
+		last := events[len(events)-1]
+		assert.Equal(t, handlers.StreamEventError, last[0])
+		var envelope apierror.Envelope
+		assert.NoError(t, json.Unmarshal([]byte(last[1]), &envelope))
+		if assert.NotNil(t, envelope.Error) {
+			assert.Equal(t, apierror.CodeUpstreamError, envelope.Error.Code)
+			assert.Equal(t, "ollama-adapter", envelope.Error.Service)
+		}
+	}
+	assert.NotContains(t, rr.Body.String(), "555", "Held back digits must not be flushed on error")
+}
+
+// --- OpenAPI Contract Tests ---
+
+// setupValidatedGatewayRouter registers every /api/v1 route behind the contract middleware
+func setupValidatedGatewayRouter(t *testing.T, anonymizerURL, moderationURL string, mode openapi.ResponseMode) (*gin.Engine, *openapi.Spec) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(anonymizerURL))
+	moderateHandler := handlers.NewModerateHandler(clients.NewModerationClient(moderationURL))
+	processHandler := handlers.NewProcessHandler(clients.NewAnonymizerClient(anonymizerURL), clients.NewModerationClient(moderationURL), handlers.ProcessSequential)
+	pipelineHandler := handlers.NewPipelineHandler(nil, &pipeline.Runner{})
+	jobsHandler := handlers.NewJobsHandler(jobs.NewManager(jobs.DefaultConfig(), nil))
+	aiTaskHandler := handlers.NewAITaskHandler(nil)
+	auditLog, _ := audit.NewLog(audit.NewMemorySink(), audit.Config{PolicyVersion: audit.DefaultPolicyVersion})
+	adminHandler := handlers.NewAdminHandler(auditLog)
+
+	apiV1 := router.Group("/api/v1")
+	apiV1.Use(auditLog.MiddlewareByRoute(auditedRoutes), spec.Middleware(mode))
+	{
+		apiV1.GET("/openapi.json", spec.Handler)
+		apiV1.POST("/anonymize", anonymizeHandler.HandleAnonymize)
+		apiV1.POST("/anonymize/stream", anonymizeHandler.HandleAnonymizeStream)
+		apiV1.POST("/anonymize/batch", anonymizeHandler.HandleAnonymizeBatch)
+		apiV1.POST("/moderate", moderateHandler.HandleModerate)
+		apiV1.POST("/process", processHandler.HandleProcess)
+		apiV1.POST("/pipelines/:name", pipelineHandler.HandleRunPipeline)
+		apiV1.POST("/ai/tasks", aiTaskHandler.HandleRunTask)
+		apiV1.POST("/jobs", jobsHandler.HandleCreateJob)
+		apiV1.GET("/jobs/:id", jobsHandler.HandleGetJob)
+		admin := apiV1.Group("/admin", auth.RequireAdmin([]string{testAdminKey}))
+		admin.GET("/audit", adminHandler.HandleQueryAudit)
+		admin.GET("/audit/verify", adminHandler.HandleVerifyAudit)
+	}
+	return router, spec
+}
+
+func TestOpenAPI_DocumentIsServed(t *testing.T) {
+	router, _ := setupValidatedGatewayRouter(t, "", "", openapi.ResponseValidationEnforce)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestOpenAPI_EveryRouteIsDocumented(t *testing.T) {
+	router, spec := setupValidatedGatewayRouter(t, "", "", openapi.ResponseValidationEnforce)
+
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		_, ok := spec.Operation(route.Method, openapi.GinPathToOpenAPI(route.Path))
+		assert.True(t, ok, "Route %s %s is missing from the OpenAPI document", route.Method, route.Path)
+	}
+}
+
+func TestOpenAPI_RequestValidation(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Downstream services should not be called for invalid requests")
+	}))
+	defer mockServer.Close()
+
+	router, _ := setupValidatedGatewayRouter(t, mockServer.URL, mockServer.URL, openapi.ResponseValidationEnforce)
+
+	cases := []struct {
+		path, body, expected string
+	}{
+		{"/api/v1/anonymize", `{"text": "oops",}`, "malformed JSON"},
+		{"/api/v1/anonymize", `{"text": 42}`, "body.text: must be of type string"},
+		{"/api/v1/anonymize", `{}`, "body.text: is required"},
+		{"/api/v1/anonymize/batch", `{"items": [{"text": "x"}]}`, "body.items[0].id: is required"},
+		{"/api/v1/anonymize/batch", `{"items": []}`, "body.items: must contain at least 1 items"},
+		{"/api/v1/moderate", `{"text": ""}`, "must match at least one alternative"},
+		{"/api/v1/jobs", `{"type": "summarize", "input": {}}`, "body.type: must be one of"},
+		{"/api/v1/jobs", `{"type": "anonymize", "input": {}, "callback_url": "not a url"}`, "body.callback_url: must be an absolute URI"},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "%s %s", tc.path, tc.body)
+		apiErr := decodeAPIError(t, rr)
+		assert.Equal(t, apierror.CodeInvalidRequest, apiErr.Code)
+		assert.Contains(t, apiErr.Message, tc.expected, "%s %s", tc.path, tc.body)
+	}
+}
+
+// endlessBody is a request body that never ends, counting the bytes read from it
+type endlessBody struct{ read int }
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	b.read += len(p)
+	return len(p), nil
+}
+
+func TestOpenAPI_BodySizeIsBounded(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Downstream services should not be called for oversized requests")
+	}))
+	defer mockServer.Close()
+	router, _ := setupValidatedGatewayRouter(t, mockServer.URL, mockServer.URL, openapi.ResponseValidationEnforce)
+
+	// Validation runs before any API key or rate limit is checked, so it must
+	// stop reading at the limit rather than buffer whatever it is sent
+	endless := &endlessBody{}
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", io.MultiReader(strings.NewReader(`{"text": "`), endless))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodePayloadTooLarge, apiErr.Code)
+	assert.Contains(t, apiErr.Message, "larger than")
+	assert.LessOrEqual(t, endless.read, bodylimit.MaxBytes+64<<10, "Read far past the limit")
+}
+
+func TestOpenAPI_ResponseValidationEnforced(t *testing.T) {
+	spec, err := openapi.Load()
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	apiV1 := router.Group("/api/v1")
+	apiV1.Use(spec.Middleware(openapi.ResponseValidationEnforce))
+	// A handler that drifted from the contract (missing anonymized_text)
+	apiV1.POST("/anonymize", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"original_text": "x"})
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "original_text", "The drifted body must not be sent")
+}
+
+// contractStructs maps component schemas to the Go types that produce or consume them
+var contractStructs = map[string]interface{}{
+	"Error":                  apierror.Envelope{},
+	"ErrorDetail":            apierror.Error{},
+	"AnonymizeRequest":       handlers.AnonymizeGatewayRequest{},
+	"AnonymizeResponse":      clients.AnonymizerResponse{},
+	"AnonymizeBatchItem":     handlers.AnonymizeBatchItemRequest{},
+	"AnonymizeBatchRequest":  handlers.AnonymizeBatchGatewayRequest{},
+	"AnonymizeBatchResult":   clients.AnonymizeBatchResult{},
+	"AnonymizeBatchResponse": handlers.AnonymizeBatchGatewayResponse{},
+	"ModerateRequest":        handlers.ModerateGatewayRequest{},
+	"ModerationResponse":     clients.ModerationResponse{},
+	"ProcessRequest":         handlers.ProcessGatewayRequest{},
+	"ProcessResponse":        handlers.ProcessGatewayResponse{},
+	"PipelineRequest":        handlers.PipelineGatewayRequest{},
+	"PipelineResult":         pipeline.Result{},
+	"PipelineStepResult":     pipeline.StepResult{},
+	"AITaskRequest":          handlers.AITaskRequest{},
+	"AITaskResponse":         handlers.AITaskResponse{},
+	"CreateJobRequest":       handlers.CreateJobRequest{},
+	"Job":                    jobs.Job{},
+	"AuditRecord":            audit.Record{},
+	"AuditPage":              handlers.AuditPageResponse{},
+	"AuditVerification":      audit.Verification{},
+}
+
+// openAPIType maps a Go type to the OpenAPI type it serializes as ("" = any)
+func openAPIType(t reflect.Type) string {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return "object"
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return openAPIType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return ""
+}
+
+// TestOpenAPI_HandlerStructsMatchSpec fails when a request/response struct and
+// its schema drift apart: missing or extra fields, wrong types, or required
+// fields that the struct may omit.
+func TestOpenAPI_HandlerStructsMatchSpec(t *testing.T) {
+	spec, err := openapi.Load()
+	assert.NoError(t, err)
+
+	for name, value := range contractStructs {
+		schema, ok := spec.Schema(name)
+		if !assert.True(t, ok, "Schema %s missing from the OpenAPI document", name) {
+			continue
+		}
+		required := make(map[string]bool)
+		for _, r := range schema.Required {
+			required[r] = true
+		}
+
+		goFields := make(map[string]bool)
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" || tag == "" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			jsonName := parts[0]
+			omitempty := len(parts) > 1 && parts[1] == "omitempty"
+			goFields[jsonName] = true
+
+			prop, ok := schema.Properties[jsonName]
+			if !assert.True(t, ok, "%s.%s (%s) is not documented in schema %s", typ.Name(), field.Name, jsonName, name) {
+				continue
+			}
+			if propType := spec.Resolve(prop).Type; propType != "" {
+				goType := openAPIType(field.Type)
+				if goType != "" && !(propType == "object" && field.Type.Kind() == reflect.Interface) {
+					assert.Equal(t, propType, goType, "Type of %s.%s differs from schema %s", typ.Name(), field.Name, name)
+				}
+			}
+			if strings.Contains(field.Tag.Get("binding"), "required") {
+				assert.True(t, required[jsonName], "%s.%s is required by the handler but optional in schema %s", typ.Name(), field.Name, name)
+			}
+			if required[jsonName] && omitempty && !strings.Contains(field.Tag.Get("binding"), "required") {
+				t.Errorf("%s.%s is required in schema %s but may be omitted when serialized", typ.Name(), field.Name, name)
+			}
+		}
+		for prop := range schema.Properties {
+			assert.True(t, goFields[prop], "Schema %s documents '%s' but %s has no such field", name, prop, typ.Name())
+		}
+	}
+}
+
+// --- Request ID and Context Propagation Tests ---
+
+func TestRequestID_ForwardedToDownstream(t *testing.T) {
+	var seen string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(requestid.Header)
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestid.Header, "trace-abc.123")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "trace-abc.123", rr.Header().Get(requestid.Header), "An incoming request ID must be echoed")
+	assert.Equal(t, "trace-abc.123", seen, "The request ID must be forwarded downstream")
+}
+
+func TestRequestID_GeneratedWhenMissingOrInvalid(t *testing.T) {
+	var seen []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get(requestid.Header))
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	for i, incoming := range []string{"", "not valid; id", strings.Repeat("a", 200)} {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if incoming != "" {
+			req.Header.Set(requestid.Header, incoming)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(requestid.Header)
+		assert.Len(t, id, 32, "Expected a generated ID for %q", incoming)
+		assert.NotEqual(t, incoming, id)
+		if assert.Len(t, seen, i+1) {
+			assert.Equal(t, id, seen[i], "The generated ID must be forwarded downstream")
+		}
+	}
+}
+
+func TestRequestID_ClientCancellationReachesDownstream(t *testing.T) {
+	downstreamCancelled := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body) // The server only notices a closed connection once the body is read
+		select {
+		case <-r.Context().Done():
+			close(downstreamCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer mockServer.Close()
+
+	router := setupGatewayRouter(mockServer.URL, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "x"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel() // The end user goes away
+
+	select {
+	case <-downstreamCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Cancelling the gateway request must cancel the downstream call")
+	}
+	<-done
+}
+
+func TestRequestID_CarriedIntoJobs(t *testing.T) {
+	seen := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get(requestid.Header)
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+
+	router := setupJobsRouter(t, mockServer.URL, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(`{"type": "anonymize", "input": {"text": "x"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestid.Header, "submit-42")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case id := <-seen:
+		assert.Equal(t, "submit-42", id, "Job calls must carry the submitting request's ID")
+	case <-time.After(2 * time.Second):
+		t.Fatal("The job never called the anonymizer")
+	}
+}
+
+// --- Tracing Tests ---
+
+func TestTracing_PropagatesTraceContextWithoutRecordingText(t *testing.T) {
+	const secretText = "Call Jane Doe at jane@example.com"
+
+	var downstreamTraceparent string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamTraceparent = r.Header.Get("traceparent")
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: secretText, AnonymizedText: "Call [NAME] at [EMAIL]"})
+	}))
+	defer mockServer.Close()
+
+	// Tracing is off by default; Setup still installs W3C propagation
+	_, err := telemetry.Setup(context.Background())
+	assert.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(telemetry.Middleware(), requestid.Middleware())
+	router.POST("/api/v1/anonymize", handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(mockServer.URL)).HandleAnonymize)
+
+	// The caller already started a trace
+	const callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize?debug=1", bytes.NewBufferString(`{"text": "`+secretText+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+callerTraceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	kinds := map[trace.SpanKind]string{}
+	for _, span := range spans {
+		assert.Equal(t, callerTraceID, span.SpanContext().TraceID().String(), "Span %q must continue the caller's trace", span.Name())
+		kinds[span.SpanKind()] = span.Name()
+		for _, attr := range span.Attributes() {
+			value := attr.Value.Emit()
+			assert.NotContains(t, value, "Jane", "Span %q attribute %s must not contain request text", span.Name(), attr.Key)
+			assert.NotContains(t, value, "[NAME]", "Span %q attribute %s must not contain response text", span.Name(), attr.Key)
+		}
+	}
+	assert.Equal(t, "POST /api/v1/anonymize", kinds[trace.SpanKindServer])
+	assert.Equal(t, "POST /anonymize", kinds[trace.SpanKindClient])
+	assert.Contains(t, downstreamTraceparent, callerTraceID, "The trace context must be forwarded downstream")
+}
+
+// --- Metrics Tests ---
+
+func TestMetrics_RecordsRoutesAndDownstreamCalls(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/metrics", metrics.Handler())
+	router.POST("/api/v1/anonymize", handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(mockServer.URL)).HandleAnonymize)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	// Unknown paths share one label value instead of creating new series
+	req, _ = http.NewRequest(http.MethodGet, "/no/such/secret-path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `privacypilot_http_server_requests_total{method="POST",route="/api/v1/anonymize",status="200"}`)
+	assert.Contains(t, body, `privacypilot_http_server_request_duration_seconds_bucket{method="POST",route="/api/v1/anonymize",status="200"`)
+	assert.Contains(t, body, `privacypilot_http_server_requests_total{method="GET",route="unmatched",status="404"}`)
+	assert.Contains(t, body, `privacypilot_http_client_request_duration_seconds_count{downstream="anonymizer-service",method="POST",status="200"}`)
+	assert.NotContains(t, body, "secret-path")
+}
+
+// --- Resilience Tests ---
+
+// fastResilience returns retry and breaker settings that keep tests quick
+func fastResilience() resilience.Config {
+	cfg := resilience.DefaultConfig()
+	cfg.InitialBackoff = time.Millisecond
+	cfg.MaxBackoff = 5 * time.Millisecond
+	return cfg
+}
+
+func TestResilience_RetriesOnlyRetryableFailures(t *testing.T) {
+	var calls atomic.Int32
+	var status atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 && status.Load() != 0 {
+			w.WriteHeader(int(status.Load()))
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "failed"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+	client := clients.NewAnonymizerClient(mockServer.URL)
+	client.Resilience.SetConfig(fastResilience())
+
+	// Two 503s are retried away
+	status.Store(http.StatusServiceUnavailable)
+	resp, err := client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "y", resp.AnonymizedText)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Client errors and timeouts are not retried
+	for _, code := range []int{http.StatusNotFound, http.StatusGatewayTimeout} {
+		calls.Store(0)
+		status.Store(int32(code))
+		_, err = client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault)
+		apiErr, ok := apierror.As(err)
+		assert.True(t, ok)
+		assert.Equal(t, code, apiErr.Status)
+		assert.Equal(t, int32(1), calls.Load(), "status %d must not be retried", code)
+	}
+
+	// A call is not even started without enough of its deadline left
+	calls.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), fastResilience().MinBudget/2)
+	defer cancel()
+	_, err = client.AnonymizeText(ctx, "x", "", clients.CacheDefault)
+	apiErr, ok := apierror.As(err)
+	assert.True(t, ok)
+	assert.Equal(t, apierror.CodeDeadlineExceeded, apiErr.Code)
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestResilience_BreakerOpensAndRecovers(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.ModerationResponse{IsAcceptable: true, Flags: []string{}})
+	}))
+	defer mockServer.Close()
+	client := clients.NewModerationClient(mockServer.URL)
+	cfg := fastResilience()
+	cfg.FailureThreshold = 2
+	cfg.OpenTimeout = 50 * time.Millisecond
+	client.Resilience.SetConfig(cfg)
+	router := gin.New()
+	router.Use(requestid.Middleware())
+	router.POST("/api/v1/moderate", handlers.NewModerateHandler(client).HandleModerate)
+	moderate := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/moderate", bytes.NewBufferString(`{"text": "Hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for range 2 {
+		assert.Equal(t, http.StatusBadGateway, moderate().Code)
+	}
+	assert.Equal(t, resilience.Open, client.Resilience.Breaker().State())
+	assert.Equal(t, int32(2), calls.Load())
+
+	// While open, calls fail fast without reaching the service
+	rr := moderate()
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeCircuitOpen, apiErr.Code)
+	assert.True(t, apiErr.Retryable)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// A failed probe opens the breaker again; a successful one closes it
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusBadGateway, moderate().Code)
+	assert.Equal(t, resilience.Open, client.Resilience.Breaker().State())
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, moderate().Code)
+	assert.Equal(t, resilience.Closed, client.Resilience.Breaker().State())
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+// --- Time Budget Tests ---
+
+// setupBudgetRouter returns a gateway router applying policy, whose
+// downstream calls go to downstreamURL
+func setupBudgetRouter(downstreamURL string, policy budget.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	apiV1 := router.Group("/api/v1")
+	apiV1.Use(budget.NewPolicy(policy).Middleware())
+	apiV1.POST("/anonymize", handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(downstreamURL)).HandleAnonymize)
+	apiV1.POST("/moderate", handlers.NewModerateHandler(clients.NewModerationClient(downstreamURL)).HandleModerate)
+	return router
+}
+
+func postWithBudget(router *gin.Engine, path, budgetMs, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if budgetMs != "" {
+		req.Header.Set(budget.Header, budgetMs)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBudget_PropagatedToDownstream(t *testing.T) {
+	seen := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get(budget.Header)
+		if r.URL.Path == "/moderate" {
+			_ = json.NewEncoder(w).Encode(clients.ModerationResponse{IsAcceptable: true})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+	defer mockServer.Close()
+	router := setupBudgetRouter(mockServer.URL, budget.Config{
+		Default: 8 * time.Second,
+		Routes:  []string{"/api/v1/moderate=3s"},
+		Max:     20 * time.Second,
+		Margin:  250 * time.Millisecond,
+	})
+
+	for _, tc := range []struct {
+		name, path, budget string
+		min, max           int
+	}{
+		{"route default", "/api/v1/anonymize", "", 7000, 7750},
+		{"route override", "/api/v1/moderate", "", 2000, 2750},
+		{"caller's budget", "/api/v1/anonymize", "5000", 4000, 4750},
+		{"capped by the client timeout", "/api/v1/anonymize", "60000", 9000, int(clients.DefaultAnonymizerTimeout.Milliseconds())},
+	} {
+		rr := postWithBudget(router, tc.path, tc.budget, `{"text": "x"}`)
+		assert.Equal(t, http.StatusOK, rr.Code, tc.name)
+		forwarded, err := strconv.Atoi(<-seen)
+		assert.NoError(t, err, tc.name)
+		assert.True(t, forwarded > tc.min && forwarded <= tc.max, "%s: forwarded a budget of %dms", tc.name, forwarded)
+	}
+}
+
+func TestBudget_RejectsShortAndMalformedBudgets(t *testing.T) {
+	var calls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer mockServer.Close()
+	router := setupBudgetRouter(mockServer.URL, budget.Config{Margin: 250 * time.Millisecond})
+
+	rr := postWithBudget(router, "/api/v1/anonymize", "200", `{"text": "x"}`)
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Equal(t, apierror.CodeDeadlineExceeded, decodeAPIError(t, rr).Code)
+
+	for _, malformed := range []string{"soon", "-5", "1.5"} {
+		rr = postWithBudget(router, "/api/v1/anonymize", malformed, `{"text": "x"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "budget %q", malformed)
+	}
+	assert.Equal(t, int32(0), calls.Load(), "Refused requests must not reach the downstream")
+}
+
+// --- Mutual TLS Tests ---
+
+// testCA issues certificates in the layout pp-certs writes
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes tls.crt, tls.key and ca.crt for service to dir and returns
+// the settings that load them
+func (ca *testCA) issue(t *testing.T, dir, service string, serial int64) mtls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{mtls.IdentityURI(service)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	cfg := mtls.Config{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	assert.NoError(t, os.WriteFile(cfg.CAFile, ca.pem, 0o644))
+	assert.NoError(t, os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	assert.NoError(t, os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return cfg
+}
+
+// startMTLSAnonymizer starts a fake anonymizer serving over mTLS as service,
+// which reports the serial number of each caller's certificate
+func startMTLSAnonymizer(t *testing.T, ca *testCA, service string, serials chan<- int64) *httptest.Server {
+	return startMTLSServer(t, ca, service, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serials <- r.TLS.PeerCertificates[0].SerialNumber.Int64()
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: "x", AnonymizedText: "y"})
+	}))
+}
+
+// startMTLSServer serves handler over mTLS as service, accepting the gateway
+func startMTLSServer(t *testing.T, ca *testCA, service string, handler http.Handler) *httptest.Server {
+	t.Helper()
+	cfg := ca.issue(t, t.TempDir(), service, 100)
+	cfg.AllowedClients = []string{"api-gateway"}
+	certs, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+	srv := httptest.NewUnstartedServer(handler)
+	// StartTLS would add its own certificate, which takes precedence over
+	// GetCertificate
+	srv.Listener = tls.NewListener(srv.Listener, certs.ServerConfig())
+	srv.Start()
+	srv.URL = "https://" + srv.Listener.Addr().String()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMTLS_ClientsOnlyAcceptAllowedServices(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := ca.issue(t, t.TempDir(), "api-gateway", 1)
+	cfg.AllowedServers = defaultConfig().MTLS.AllowedServers
+	certs, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+
+	serials := make(chan int64, 1)
+	anonymizer := startMTLSAnonymizer(t, ca, "anonymizer-service", serials)
+	client := clients.NewAnonymizerClient(anonymizer.URL)
+	client.UseTransport(certs.Transport())
+	resp, err := client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "y", resp.AnonymizedText)
+		assert.Equal(t, int64(1), <-serials, "The gateway must present its certificate")
+	}
+
+	// A server presenting another service's certificate is refused
+	impostor := startMTLSAnonymizer(t, ca, "ollama-adapter", serials)
+	client = clients.NewAnonymizerClient(impostor.URL)
+	client.UseTransport(certs.Transport())
+	logs := captureLogs(t)
+	_, err = client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault)
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), `service \"ollama-adapter\" is not allowed`)
+
+	// So is one whose certificate another CA issued
+	cfg.CAFile = filepath.Join(t.TempDir(), "other-ca.crt")
+	assert.NoError(t, os.WriteFile(cfg.CAFile, newTestCA(t).pem, 0o644))
+	strict, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+	client = clients.NewAnonymizerClient(anonymizer.URL)
+	client.UseTransport(strict.Transport())
+	_, err = client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault)
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "unknown authority")
+}
+
+func TestMTLS_ModerationClientPresentsItsCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := ca.issue(t, t.TempDir(), "api-gateway", 1)
+	cfg.AllowedServers = defaultConfig().MTLS.AllowedServers
+	certs, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+
+	serials := make(chan int64, 1)
+	moderate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serials <- r.TLS.PeerCertificates[0].SerialNumber.Int64()
+		_ = json.NewEncoder(w).Encode(clients.ModerationResponse{IsAcceptable: true})
+	})
+	moderation := startMTLSServer(t, ca, "moderation-service", moderate)
+	client := clients.NewModerationClient(moderation.URL)
+	client.UseTransport(certs.Transport())
+	resp, err := client.ModerateContent(context.Background(), "x", "")
+	if assert.NoError(t, err) {
+		assert.True(t, resp.IsAcceptable)
+		assert.Equal(t, int64(1), <-serials, "The gateway must present its certificate")
+	}
+
+	// A server presenting another service's certificate is refused
+	impostor := startMTLSServer(t, ca, "ollama-adapter", moderate)
+	client = clients.NewModerationClient(impostor.URL)
+	client.UseTransport(certs.Transport())
+	logs := captureLogs(t)
+	_, err = client.ModerateContent(context.Background(), "x", "")
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), `service \"ollama-adapter\" is not allowed`)
+}
+
+func TestMTLS_RotatedCertificatesAreReloaded(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := ca.issue(t, dir, "api-gateway", 1)
+	cfg.AllowedServers = []string{"anonymizer-service"}
+	certs, err := mtls.Load(cfg)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, 10*time.Millisecond)
+
+	serials := make(chan int64, 1)
+	anonymizer := startMTLSAnonymizer(t, ca, "anonymizer-service", serials)
+	call := func() int64 {
+		client := clients.NewAnonymizerClient(anonymizer.URL) // New connections pick up the new certificate
+		client.UseTransport(certs.Transport())
+		if _, err := client.AnonymizeText(context.Background(), "x", "", clients.CacheDefault); !assert.NoError(t, err) {
+			return 0
+		}
+		return <-serials
+	}
+	assert.Equal(t, int64(1), call())
+
+	// A broken file is not picked up
+	assert.NoError(t, os.WriteFile(cfg.CertFile, []byte("garbage"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(1), call())
+
+	ca.issue(t, dir, "api-gateway", 2)
+	assert.Eventually(t, func() bool { return call() == 2 }, 2*time.Second, 20*time.Millisecond)
+}
+
+// --- Logging Tests ---
+
+// logCanary is fake PII that must never reach the logs
+const logCanary = "Jane CANARY-7f3a9c Doe, jane.canary@example.com, +1 555 0199"
+
+// captureLogs sends the default logger to a buffer at debug level until the
+// test ends
+func captureLogs(t *testing.T) *syncBuffer {
+	buf := &syncBuffer{}
+	previous := slog.Default()
+	slog.SetDefault(logging.New(buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return buf
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of job workers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// setupMockEchoServer echoes the text it receives from every downstream route,
+// and fails with the text in the error message when it contains "fail"
+func setupMockEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Text     string `json:"text"`
+			ImageUrl string `json:"imageUrl"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&reqBody)
+		assert.Contains(t, reqBody.Text+reqBody.ImageUrl, "CANARY-7f3a9c", "Mock: the canary should reach the downstream service")
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(reqBody.Text, "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Cannot process: "+reqBody.Text)})
+			return
+		}
+		switch r.URL.Path {
+		case "/anonymize":
+			_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: reqBody.Text})
+		case "/anonymize/stream":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_ = json.NewEncoder(w).Encode(clients.AnonymizeStreamChunk{Token: reqBody.Text})
+			_ = json.NewEncoder(w).Encode(clients.AnonymizeStreamChunk{Done: true})
+		case "/moderate":
+			_ = json.NewEncoder(w).Encode(clients.ModerationResponse{IsAcceptable: false, Details: "Flagged: " + reqBody.Text + reqBody.ImageUrl})
+		default:
+			t.Errorf("Mock: unexpected path %s", r.URL.Path)
+		}
+	}))
+}
+
+func TestLogging_CanaryPIINeverLogged(t *testing.T) {
+	logs := captureLogs(t)
+	mockServer := setupMockEchoServer(t)
+	defer mockServer.Close()
+
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	manager := jobs.NewManager(jobs.DefaultConfig(), nil)
+	manager.Register(handlers.JobTypeAnonymize, handlers.AnonymizeJobTask(clients.NewAnonymizerClient(mockServer.URL)))
+	manager.Register(handlers.JobTypeModerate, handlers.ModerateJobTask(clients.NewModerationClient(mockServer.URL)))
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.Start(ctx)
+	defer func() {
+		cancel()
+		manager.Wait()
+	}()
+
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(mockServer.URL))
+	moderateHandler := handlers.NewModerateHandler(clients.NewModerationClient(mockServer.URL))
+	processHandler := handlers.NewProcessHandler(clients.NewAnonymizerClient(mockServer.URL), clients.NewModerationClient(mockServer.URL), handlers.ProcessConcurrent)
+	pipelines, err := pipeline.Parse([]byte(testPipelinesYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse pipelines: %v", err)
+	}
+	pipelineHandler := handlers.NewPipelineHandler(pipelines, &pipeline.Runner{
+		Anonymizer: clients.NewAnonymizerClient(mockServer.URL),
+		Moderator:  clients.NewModerationClient(mockServer.URL),
+	})
+	jobsHandler := handlers.NewJobsHandler(manager)
+	// Default policies with room for every request below
+	anonymizePolicy, moderatePolicy := ratelimit.DefaultAnonymizePolicy, ratelimit.DefaultModeratePolicy
+	anonymizePolicy.Burst, moderatePolicy.Burst = 100, 100
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), anonymizePolicy, moderatePolicy)
+	auditSink := audit.NewMemorySink()
+	auditLog, _ := audit.NewLog(auditSink, audit.Config{PolicyVersion: audit.DefaultPolicyVersion})
+	adminHandler := handlers.NewAdminHandler(auditLog)
+
+	// Same middleware and routes as main, plus a route that panics with the canary
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	exercised := map[string]bool{}
+	router.Use(requestid.Middleware(), metrics.Middleware(), logging.AccessLog(), logging.Recovery(), func(c *gin.Context) {
+		exercised[c.Request.Method+" "+c.FullPath()] = true
+	})
+	router.GET("/health", healthCheckHandler)
+	router.GET("/metrics", metrics.Handler())
+	router.GET("/panic", func(c *gin.Context) { panic("processing " + logCanary) })
+	apiV1 := router.Group("/api/v1")
+	apiV1.Use(auditLog.MiddlewareByRoute(auditedRoutes), spec.Middleware(openapi.ResponseValidationLog))
+	{
+		apiV1.GET("/openapi.json", spec.Handler)
+		apiV1.POST("/anonymize", limiter.Middleware("anonymize", ratelimit.TextLength), anonymizeHandler.HandleAnonymize)
+		apiV1.POST("/anonymize/stream", limiter.Middleware("anonymize", ratelimit.TextLength), anonymizeHandler.HandleAnonymizeStream)
+		apiV1.POST("/anonymize/batch", limiter.Middleware("anonymize", ratelimit.BatchTextLength), anonymizeHandler.HandleAnonymizeBatch)
+		apiV1.POST("/moderate", limiter.Middleware("moderate", ratelimit.TextLength), moderateHandler.HandleModerate)
+		apiV1.POST("/process", limiter.Middleware("moderate", ratelimit.TextLength), limiter.Middleware("anonymize", ratelimit.TextLength), processHandler.HandleProcess)
+		apiV1.POST("/pipelines/:name", limiter.MiddlewareByRoutes(pipelineHandler.RateLimitRoutes, ratelimit.TextLength), pipelineHandler.HandleRunPipeline)
+		apiV1.POST("/jobs", limiter.MiddlewareByBody(handlers.JobRateLimitRoute), jobsHandler.HandleCreateJob)
+		apiV1.GET("/jobs/:id", jobsHandler.HandleGetJob)
+		admin := apiV1.Group("/admin", auth.RequireAdmin([]string{testAdminKey}))
+		admin.GET("/audit", adminHandler.HandleQueryAudit)
+		admin.GET("/audit/verify", adminHandler.HandleVerifyAudit)
+	}
+
+	canary, _ := json.Marshal(logCanary)
+	failing, _ := json.Marshal(logCanary + " fail")
+	query := "?q=" + url.QueryEscape(logCanary)
+	requests := []struct{ method, path, body string }{
+		{http.MethodGet, "/health" + query, ""},
+		{http.MethodGet, "/metrics" + query, ""},
+		{http.MethodGet, "/panic" + query, ""},
+		{http.MethodGet, "/no/such/" + url.PathEscape(logCanary) + query, ""},
+		{http.MethodGet, "/api/v1/openapi.json" + query, ""},
+		{http.MethodPost, "/api/v1/anonymize" + query, fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/api/v1/anonymize", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/api/v1/anonymize", fmt.Sprintf(`{"text": %s, "model": 42}`, canary)},
+		{http.MethodPost, "/api/v1/anonymize", fmt.Sprintf(`{"text": %s`, canary)},
+		{http.MethodPost, "/api/v1/anonymize/stream", fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/api/v1/anonymize/stream", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/api/v1/anonymize/batch", fmt.Sprintf(`{"items": [{"id": "a", "text": %s}, {"id": "b", "text": %s}]}`, canary, failing)},
+		{http.MethodPost, "/api/v1/moderate", fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/api/v1/moderate", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/api/v1/moderate", fmt.Sprintf(`{"imageUrl": %s}`, canary)},
+		{http.MethodPost, "/api/v1/process", fmt.Sprintf(`{"text": %s, "imageUrl": %s}`, canary, canary)},
+		{http.MethodPost, "/api/v1/process", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/api/v1/pipelines/ugc", fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/api/v1/pipelines/ugc", fmt.Sprintf(`{"text": %s}`, failing)},
+		{http.MethodPost, "/api/v1/pipelines/" + url.PathEscape(logCanary), fmt.Sprintf(`{"text": %s}`, canary)},
+		{http.MethodPost, "/api/v1/jobs", fmt.Sprintf(`{"type": %s, "input": {"text": %s}}`, canary, canary)},
+		{http.MethodGet, "/api/v1/jobs/" + url.PathEscape(logCanary), ""},
+		{http.MethodGet, "/api/v1/admin/audit?principal=" + url.QueryEscape(logCanary), ""},
+		{http.MethodGet, "/api/v1/admin/audit?since=" + url.QueryEscape(logCanary), ""},
+		{http.MethodGet, "/api/v1/admin/audit/verify" + query, ""},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.path, "/api/v1/admin/") {
+			req.Header.Set(auth.HeaderAPIKey, testAdminKey)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Jobs log from their workers after the request has returned
+	var jobIDs []string
+	for _, body := range []string{
+		fmt.Sprintf(`{"type": "anonymize", "input": {"text": %s}}`, canary),
+		fmt.Sprintf(`{"type": "anonymize", "input": {"text": %s}}`, failing),
+		fmt.Sprintf(`{"type": "moderate", "input": {"text": %s}}`, canary),
+	} {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		var job jobs.Job
+		_ = json.Unmarshal(rr.Body.Bytes(), &job)
+		jobIDs = append(jobIDs, job.ID)
+	}
+	for _, id := range jobIDs {
+		waitForJob(t, router, id)
+	}
+
+	for _, route := range router.Routes() {
+		assert.True(t, exercised[route.Method+" "+route.Path], "Route %s %s was not exercised", route.Method, route.Path)
+	}
+
+	output := logs.String()
+	assert.NotEmpty(t, output)
+	for _, fragment := range []string{"CANARY-7f3a9c", "jane.canary@example.com", "555 0199", "Jane"} {
+		assert.NotContains(t, output, fragment, "Canary PII leaked into the logs")
+	}
+
+	// The audit trail must not record it either
+	var auditRecords strings.Builder
+	_ = auditSink.Scan(func(r *audit.Record) bool {
+		line, _ := json.Marshal(r)
+		auditRecords.Write(line)
+		return true
+	})
+	assert.Contains(t, auditRecords.String(), `"action":"moderate"`)
+	for _, fragment := range []string{"CANARY-7f3a9c", "jane.canary@example.com", "555 0199", "Jane"} {
+		assert.NotContains(t, auditRecords.String(), fragment, "Canary PII leaked into the audit log")
+	}
+
+	// Every record is JSON with the service field; access log records carry the request ID
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(line), &record), "Log line is not JSON: %s", line) {
+			continue
+		}
+		assert.Equal(t, servicekit.Name(), record["service"])
+		if record["msg"] == "Request handled" {
+			assert.NotEmpty(t, record["request_id"], "Access log record without request_id: %s", line)
+		}
+	}
+}
+
+func TestLogging_RedactsSensitiveValues(t *testing.T) {
+	logs := captureLogs(t)
+
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	slog.InfoContext(ctx, "Processing", "text", logCanary, "anonymized_text", logCanary, "note", logging.Sensitive(logCanary))
+	slog.With("prompt", logCanary).Debug("Prompt built", slog.Group("request", "body", logCanary))
+
+	output := logs.String()
+	assert.NotContains(t, output, "CANARY-7f3a9c")
+	assert.Equal(t, 5, strings.Count(output, logging.Redacted))
+	assert.Contains(t, output, `"request_id":"req-123"`)
+}
+
+// --- Audit Log Tests ---
+
+// testAdminKey is the admin API key configured in test routers
+const testAdminKey = "admin-test-key"
+
+func TestAudit_ChainDetectsTampering(t *testing.T) {
+	path := t.TempDir() + "/audit.log"
+	sink, err := audit.NewFileSink(path)
+	assert.NoError(t, err)
+	auditLog, err := audit.NewLog(sink, audit.Config{PolicyVersion: "v7"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := auditLog.Append(audit.Record{Action: audit.ActionAnonymize, Principal: auth.Anonymous, Method: http.MethodPost, Route: "/api/v1/anonymize", Status: http.StatusOK})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sink.Close())
+
+	// Reopening continues the chain
+	sink, err = audit.NewFileSink(path)
+	assert.NoError(t, err)
+	auditLog, err = audit.NewLog(sink, audit.Config{PolicyVersion: "v7"})
+	assert.NoError(t, err)
+	rec, err := auditLog.Append(audit.Record{Action: audit.ActionAdmin, Principal: auth.Anonymous, Method: http.MethodGet, Route: "/api/v1/admin/audit", Status: http.StatusOK})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), rec.Seq)
+	assert.Equal(t, "v7", rec.PolicyVersion)
+	assert.NoError(t, sink.Close())
+
+	result, err := audit.Verify(sink)
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, uint64(4), result.Records)
+	assert.Equal(t, rec.Hash, result.Head)
+
+	original, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.SplitAfter(strings.TrimSpace(string(original)), "\n")
+
+	verify := func(content string) audit.Verification {
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		result, err := audit.Verify(sink)
+		assert.NoError(t, err)
+		return result
+	}
+
+	// Editing a record
+	edited := strings.Replace(string(original), `"status":200`, `"status":500`, 1)
+	result = verify(edited)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint64(1), result.BadSeq)
+
+	// Removing a record
+	result = verify(lines[0] + lines[2] + lines[3])
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint64(3), result.BadSeq)
+
+	// Reordering records
+	result = verify(lines[0] + lines[2] + lines[1] + lines[3])
+	assert.False(t, result.Valid)
+
+	// An undecodable line
+	result = verify(lines[0] + "{not json\n" + lines[1])
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint64(2), result.BadSeq)
+}
+
+func TestAudit_RecordsPrivacyCallsWithoutText(t *testing.T) {
+	const text = "Contact Jane Doe at jane@example.com or jane@work.example"
+	const anonymized = "Contact [NAME] at [EMAIL] or [EMAIL]"
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: text, AnonymizedText: anonymized})
+	}))
+	defer mockServer.Close()
+
+	sink := audit.NewMemorySink()
+	auditLog, _ := audit.NewLog(sink, audit.Config{PolicyVersion: "2024-06", HashKey: []byte("secret")})
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(mockServer.URL))
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Policy{Route: "anonymize", RequestsPerSecond: 1, Burst: 1})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestid.Middleware(), testTenantKeys.Middleware())
+	router.POST("/api/v1/anonymize", auditLog.Middleware(audit.ActionAnonymize), limiter.Middleware("anonymize", ratelimit.TextLength), anonymizeHandler.HandleAnonymize)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/anonymize", bytes.NewBufferString(`{"text": "`+text+`", "model": "llama3"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.HeaderAPIKey, "acme-key")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	records, _, err := audit.Query(sink, audit.Filter{}, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	rec := records[0]
+	assert.Equal(t, audit.ActionAnonymize, rec.Action)
+	assert.Equal(t, "key:"+auth.Fingerprint("acme-key"), rec.Principal)
+	assert.Equal(t, "acme", rec.Tenant)
+	assert.Equal(t, "/api/v1/anonymize", rec.Route)
+	assert.Equal(t, http.StatusOK, rec.Status)
+	assert.Equal(t, "llama3", rec.Model)
+	assert.Equal(t, "2024-06", rec.PolicyVersion)
+	assert.Equal(t, map[string]int{"NAME": 1, "EMAIL": 2}, rec.EntityCounts)
+	assert.Equal(t, auditLog.HashTexts(text), rec.InputHash)
+	assert.Equal(t, auditLog.HashTexts(anonymized), rec.OutputHash)
+	assert.True(t, strings.HasPrefix(rec.InputHash, "hmac-sha256:"))
+	assert.NotEmpty(t, rec.RequestID)
+
+	// The rate-limited call is recorded too, without an output
+	assert.Equal(t, http.StatusTooManyRequests, records[1].Status)
+	assert.Empty(t, records[1].OutputHash)
+	assert.Equal(t, rec.Hash, records[1].PrevHash)
+
+	encoded, _ := json.Marshal(records)
+	for _, fragment := range []string{"Jane", "jane@example.com", "[NAME]", "client-key"} {
+		assert.NotContains(t, string(encoded), fragment)
+	}
+}
+
+func TestAudit_AdminAPI(t *testing.T) {
+	router, _ := setupValidatedGatewayRouter(t, "", "", openapi.ResponseValidationEnforce)
+
+	get := func(path, apiKey string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set(auth.HeaderAPIKey, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/api/v1/admin/audit", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, apierror.CodeUnauthorized, decodeAPIError(t, rr).Code)
+
+	rr = get("/api/v1/admin/audit", "not-the-admin-key")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, apierror.CodeForbidden, decodeAPIError(t, rr).Code)
+
+	rr = get("/api/v1/admin/audit?limit=5000", testAdminKey)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// The rejected calls above were audited; page through them one at a time
+	rr = get("/api/v1/admin/audit?action=admin&limit=1", testAdminKey)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var page handlers.AuditPageResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	if assert.Len(t, page.Records, 1) {
+		assert.Equal(t, http.StatusUnauthorized, page.Records[0].Status)
+		assert.Equal(t, auth.Anonymous, page.Records[0].Principal)
+		assert.Equal(t, uint64(1), page.NextAfterSeq)
+	}
+
+	rr = get(fmt.Sprintf("/api/v1/admin/audit?after_seq=%d&principal=%s", page.NextAfterSeq, "key:"+auth.Fingerprint("not-the-admin-key")), testAdminKey)
+	page = handlers.AuditPageResponse{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	if assert.Len(t, page.Records, 1) {
+		assert.Equal(t, http.StatusForbidden, page.Records[0].Status)
+		assert.Zero(t, page.NextAfterSeq)
+	}
+
+	rr = get("/api/v1/admin/audit/verify", testAdminKey)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result audit.Verification
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.True(t, result.Valid)
+	assert.Equal(t, uint64(5), result.Records)
+}
+
+func TestAudit_AdminAPIDisabledWithoutKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/admin/audit", auth.RequireAdmin(auth.ParseKeys(" , ")), func(c *gin.Context) {
+		t.Error("The admin API should be disabled")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/admin/audit", nil)
+	req.Header.Set(auth.HeaderAPIKey, "")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAudit_RecordsCallsRejectedByGroupMiddleware(t *testing.T) {
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	sink := audit.NewMemorySink()
+	auditLog, _ := audit.NewLog(sink, audit.Config{PolicyVersion: audit.DefaultPolicyVersion})
+
+	// The group's middleware as in main
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	apiV1 := router.Group("/api/v1")
+	apiV1.Use(auditLog.MiddlewareByRoute(auditedRoutes), budget.NewPolicy(budget.Config{}).Middleware(), spec.Middleware(openapi.ResponseValidationEnforce))
+	apiV1.GET("/openapi.json", spec.Handler)
+	apiV1.POST("/anonymize", func(c *gin.Context) { t.Error("The rejected request reached the handler") })
+
+	for _, tc := range []struct{ budgetMs, body string }{
+		{"soon", `{"text": "x"}`}, // Malformed time budget
+		{"", `{"text": 42}`},      // Not in the contract
+	} {
+		rr := postWithBudget(router, "/api/v1/anonymize", tc.budgetMs, tc.body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	records, _, err := audit.Query(sink, audit.Filter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2, "Only the audited routes are recorded") {
+		for _, rec := range records {
+			assert.Equal(t, audit.ActionAnonymize, rec.Action)
+			assert.Equal(t, "/api/v1/anonymize", rec.Route)
+			assert.Equal(t, http.StatusBadRequest, rec.Status)
+		}
+	}
+}
+
+func TestAudit_RecordsDeanonymizations(t *testing.T) {
+	sink := audit.NewMemorySink()
+	auditLog, _ := audit.NewLog(sink, audit.Config{HashKey: []byte("secret")})
+	anonymizer := setupPlaceholderAnonymizer(t, "Hi [NAME], [NAME] and [NAME] ([EMAIL])")
+	router := setupDeanonymizeRouter(t, anonymizer.URL, "deanonymize-secret", auditLog)
+
+	rr := postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane Doe, John and Jane Doe (jane@example.com)", Reversible: true})
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var anonymized clients.AnonymizerResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &anonymized))
+	edited := handlers.DeanonymizeRequest{Text: "Dear [NAME_2], [NAME_1] wrote from [EMAIL_1] about [PHONE_1].", Token: anonymized.DeanonymizeToken}
+	rr = postJSONAs(router, "/api/v1/deanonymize", "acme-key-2", edited)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var restored handlers.DeanonymizeResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &restored))
+	rr = postJSONAs(router, "/api/v1/deanonymize", "globex-key", edited)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	records, _, err := audit.Query(sink, audit.Filter{}, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 3) {
+		return
+	}
+	assert.Equal(t, audit.ActionAnonymize, records[0].Action)
+	assert.Equal(t, map[string]int{"NAME": 3, "EMAIL": 1}, records[0].EntityCounts, "Numbered placeholders count as their type")
+
+	// Entity counts are of the values put back, not of the placeholders left
+	rec := records[1]
+	assert.Equal(t, audit.ActionDeanonymize, rec.Action)
+	assert.Equal(t, "/api/v1/deanonymize", rec.Route)
+	assert.Equal(t, "acme", rec.Tenant)
+	assert.Equal(t, http.StatusOK, rec.Status)
+	assert.Equal(t, map[string]int{"NAME": 2, "EMAIL": 1}, rec.EntityCounts)
+	assert.Equal(t, auditLog.HashTexts(edited.Text), rec.InputHash)
+	assert.Equal(t, auditLog.HashTexts(restored.Text), rec.OutputHash)
+
+	// A refused token is recorded with its input, and nothing restored
+	rec = records[2]
+	assert.Equal(t, audit.ActionDeanonymize, rec.Action)
+	assert.Equal(t, "globex", rec.Tenant)
+	assert.Equal(t, http.StatusBadRequest, rec.Status)
+	assert.Equal(t, auditLog.HashTexts(edited.Text), rec.InputHash)
+	assert.Empty(t, rec.OutputHash)
+	assert.Empty(t, rec.EntityCounts)
+
+	encoded, _ := json.Marshal(records)
+	for _, fragment := range []string{"Jane", "John", "jane@example.com", anonymized.DeanonymizeToken} {
+		assert.NotContains(t, string(encoded), fragment)
+	}
+}
+
+// --- gRPC API Tests ---
+
+// grpcTestConfig wires the gRPC API to handlers for the given downstream URLs
+func grpcTestConfig(anonymizerURL, moderationURL string, sink audit.Sink, policies ...ratelimit.Policy) grpcapi.Config {
+	auditLog, _ := audit.NewLog(sink, audit.Config{PolicyVersion: audit.DefaultPolicyVersion})
+	anonymizerClient := clients.NewAnonymizerClient(anonymizerURL)
+	moderationClient := clients.NewModerationClient(moderationURL)
+	return grpcapi.Config{
+		Anonymize:  handlers.NewAnonymizeHandler(anonymizerClient),
+		Moderate:   handlers.NewModerateHandler(moderationClient),
+		Process:    handlers.NewProcessHandler(anonymizerClient, moderationClient, handlers.ProcessSequential),
+		Pipelines:  handlers.NewPipelineHandler(nil, &pipeline.Runner{Anonymizer: anonymizerClient, Moderator: moderationClient}),
+		AITasks:    handlers.NewAITaskHandler(nil),
+		Jobs:       handlers.NewJobsHandler(jobs.NewManager(jobs.DefaultConfig(), nil)),
+		Admin:      handlers.NewAdminHandler(auditLog),
+		Limiter:    ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), policies...),
+		Audit:      auditLog,
+		AdminKeys:  auth.NewAdminKeys([]string{testAdminKey}),
+		AITaskKeys: auth.NewScopedKeys(nil),
+		TenantKeys: testTenantKeys,
+	}
+}
+
+// dialGRPC serves cfg over an in-memory connection and returns a client connection
+func dialGRPC(t *testing.T, cfg grpcapi.Config) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpcapi.NewServer(cfg)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial the gRPC server: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// grpcErrorInfo returns the status code and ErrorInfo detail of a gRPC error
+func grpcErrorInfo(t *testing.T, err error) (codes.Code, *errdetails.ErrorInfo) {
+	st := status.Convert(err)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return st.Code(), info
+		}
+	}
+	t.Errorf("Error %v carries no ErrorInfo", err)
+	return st.Code(), &errdetails.ErrorInfo{}
+}
+
+func TestGRPC_AnonymizeMatchesREST(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		assert.Equal(t, "req-grpc", r.Header.Get(requestid.Header), "The request ID must be forwarded")
+		w.Header().Set("Content-Type", "application/json")
+		if reqBody.Model == "no-such-model" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(apierror.Envelope{Error: &apierror.Error{Code: apierror.CodeModelNotFound, Message: "Model 'no-such-model' is not available", Service: "ollama-adapter"}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: "Hello [NAME]", Cached: reqBody.Cache == clients.CacheDefault})
+	}))
+	defer mockServer.Close()
+
+	client := pb.NewGatewayClient(dialGRPC(t, grpcTestConfig(mockServer.URL, "", audit.NewMemorySink())))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-grpc")
+
+	var header metadata.MD
+	resp, err := client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane"}, grpc.Header(&header))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Hello Jane", resp.GetOriginalText())
+		assert.Equal(t, "Hello [NAME]", resp.GetAnonymizedText())
+		assert.True(t, resp.GetCached())
+		assert.Equal(t, []string{"req-grpc"}, header.Get("x-request-id"))
+	}
+	resp, err = client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane", Cache: clients.CacheBypass})
+	if assert.NoError(t, err) {
+		assert.False(t, resp.GetCached(), "The cache mode must be forwarded")
+	}
+
+	// Downstream errors keep their code and origin, as over HTTP
+	_, err = client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane", Model: "no-such-model"})
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.NotFound, code)
+	assert.Equal(t, apierror.CodeModelNotFound, info.GetReason())
+	assert.Equal(t, "ollama-adapter", info.GetDomain())
+	assert.Equal(t, "req-grpc", info.GetMetadata()["request_id"])
+
+	// Validation is the handler's
+	_, err = client.Anonymize(ctx, &pb.AnonymizeRequest{})
+	code, info = grpcErrorInfo(t, err)
+	assert.Equal(t, codes.InvalidArgument, code)
+	assert.Equal(t, apierror.CodeInvalidRequest, info.GetReason())
+	_, err = client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane", Cache: "never"})
+	code, _ = grpcErrorInfo(t, err)
+	assert.Equal(t, codes.InvalidArgument, code)
+}
+
+func TestGRPC_AnonymizeStreamHoldsBackUnsafeOutput(t *testing.T) {
+	mockServer := setupMockAnonymizerStreamServer(t, []clients.AnonymizeStreamChunk{
+		{Token: "Hi [NA"},
+		{Token: "ME], mail "},
+		{Token: "bob@exa"},
+		{Token: "mple.com to"},
+		{Token: "day"},
+		{Done: true, ModelUsed: "test-model"},
+	})
+	defer mockServer.Close()
+
+	client := pb.NewGatewayClient(dialGRPC(t, grpcTestConfig(mockServer.URL, "", audit.NewMemorySink())))
+	stream, err := client.AnonymizeStream(context.Background(), &pb.AnonymizeRequest{Text: "Hi Alice, mail bob@example.com today"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var streamed strings.Builder
+	var done *pb.AnonymizeStreamDone
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		if token := event.GetToken(); token != "" {
+			assert.NotContains(t, token, "bob", "No prefix of the email may be emitted")
+			streamed.WriteString(token)
+		}
+		if event.GetDone() != nil {
+			done = event.GetDone()
+		}
+	}
+	assert.Equal(t, "Hi [NAME], mail [REDACTED] today", streamed.String())
+	if assert.NotNil(t, done) {
+		assert.Equal(t, "Hi [NAME], mail [REDACTED] today", done.GetAnonymizedText())
+		assert.Equal(t, "test-model", done.GetModelUsed())
+	}
+}
+
+func TestGRPC_AnonymizeBatchFromClientStream(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "fail")
+	defer mockServer.Close()
+
+	client := pb.NewGatewayClient(dialGRPC(t, grpcTestConfig(mockServer.URL, "", audit.NewMemorySink())))
+
+	send := func(items ...*pb.AnonymizeBatchItem) (*pb.AnonymizeBatchResponse, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-batch-concurrency", "2")
+		stream, err := client.AnonymizeBatch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if err := stream.Send(item); err != nil {
+				return nil, err
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	resp, err := send(&pb.AnonymizeBatchItem{Id: "a", Text: "first"}, &pb.AnonymizeBatchItem{Id: "b", Text: "fail"}, &pb.AnonymizeBatchItem{Id: "c", Text: "third"})
+	if assert.NoError(t, err, "A failing item must not fail the batch") {
+		assert.Equal(t, int32(2), resp.GetSucceeded())
+		assert.Equal(t, int32(1), resp.GetFailed())
+		if assert.Len(t, resp.GetResults(), 3) {
+			assert.Equal(t, "[ANON] first", resp.GetResults()[0].GetAnonymizedText())
+			assert.Equal(t, "b", resp.GetResults()[1].GetId())
+			assert.Equal(t, apierror.CodeUpstreamError, resp.GetResults()[1].GetError().GetCode())
+			assert.Equal(t, "[ANON] third", resp.GetResults()[2].GetAnonymizedText())
+		}
+	}
+
+	_, err = send(&pb.AnonymizeBatchItem{Id: "x", Text: "one"}, &pb.AnonymizeBatchItem{Id: "x", Text: "two"})
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.InvalidArgument, code)
+	assert.Equal(t, apierror.CodeInvalidRequest, info.GetReason())
+	assert.Contains(t, status.Convert(err).Message(), "duplicate item id")
+}
+
+func TestGRPC_AnonymizeBatchChargesOneTokenPerItem(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+
+	cfg := grpcTestConfig(mockServer.URL, "", audit.NewMemorySink(), ratelimit.Policy{Route: "anonymize", RequestsPerSecond: 0.01, Burst: 3})
+	client := pb.NewGatewayClient(dialGRPC(t, cfg))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "acme-key")
+
+	stream, err := client.AnonymizeBatch(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, stream.Send(&pb.AnonymizeBatchItem{Id: id, Text: "text"}))
+	}
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+	header, _ := stream.Header()
+	assert.Equal(t, []string{"0"}, header.Get("x-ratelimit-remaining"))
+
+	_, err = client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "text"})
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	assert.Equal(t, apierror.CodeRateLimited, info.GetReason())
+}
+
+func TestGRPC_RateLimitedAndAuditedLikeREST(t *testing.T) {
+	mockServer := setupMockAnonymizerServer(t, "")
+	defer mockServer.Close()
+
+	sink := audit.NewMemorySink()
+	cfg := grpcTestConfig(mockServer.URL, "", sink, ratelimit.Policy{Route: "anonymize", RequestsPerSecond: 1, Burst: 1})
+	client := pb.NewGatewayClient(dialGRPC(t, cfg))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "acme-key")
+
+	var header metadata.MD
+	_, err := client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane"}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, header.Get("x-ratelimit-limit"))
+
+	// The bucket is shared with the REST route's policy
+	_, err = client.Anonymize(ctx, &pb.AnonymizeRequest{Text: "Hello Jane"}, grpc.Header(&header))
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	assert.Equal(t, apierror.CodeRateLimited, info.GetReason())
+	assert.NotEmpty(t, header.Get("retry-after"))
+
+	records, _, err := audit.Query(sink, audit.Filter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, audit.ActionAnonymize, records[0].Action)
+		assert.Equal(t, "gRPC", records[0].Method)
+		assert.Equal(t, pb.Gateway_Anonymize_FullMethodName, records[0].Route)
+		assert.Equal(t, http.StatusOK, records[0].Status)
+		assert.Equal(t, "key:"+auth.Fingerprint("acme-key"), records[0].Principal)
+		assert.Equal(t, "acme", records[0].Tenant)
+		assert.Equal(t, cfg.Audit.HashTexts("Hello Jane"), records[0].InputHash)
+		assert.Equal(t, http.StatusTooManyRequests, records[1].Status)
+	}
+}
+
+func TestGRPC_AdminRequiresAdminKey(t *testing.T) {
+	client := pb.NewAdminClient(dialGRPC(t, grpcTestConfig("", "", audit.NewMemorySink())))
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+
+	_, err := client.VerifyAudit(context.Background(), &pb.VerifyAuditRequest{})
+	code, _ := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, err = client.VerifyAudit(withKey("not-the-admin-key"), &pb.VerifyAuditRequest{})
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.PermissionDenied, code)
+	assert.Equal(t, apierror.CodeForbidden, info.GetReason())
+
+	// Both rejected calls were audited
+	page, err := client.QueryAudit(withKey(testAdminKey), &pb.QueryAuditRequest{Action: audit.ActionAdmin})
+	if assert.NoError(t, err) && assert.Len(t, page.GetRecords(), 2) {
+		assert.Equal(t, int32(http.StatusUnauthorized), page.GetRecords()[0].GetStatus())
+		assert.Equal(t, int32(http.StatusForbidden), page.GetRecords()[1].GetStatus())
+	}
+
+	result, err := client.VerifyAudit(withKey(testAdminKey), &pb.VerifyAuditRequest{})
+	if assert.NoError(t, err) {
+		assert.True(t, result.GetValid())
+		assert.Equal(t, uint64(3), result.GetRecords())
+	}
+}
+
+// --- Graceful Shutdown Tests ---
+
+// startServer serves handler on a local port until the returned cancel is
+// called. Serve's result is sent on the returned channel.
+func startServer(t *testing.T, srv *server.Server, handler http.Handler) (string, context.CancelFunc, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.ServeListener(ctx, listener, handler) }()
+	t.Cleanup(cancel)
+	return "http://" + listener.Addr().String(), cancel, done
+}
+
+func TestServer_DrainsInFlightRequestsOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := server.New(server.DefaultConfig())
+	started, release := make(chan struct{}), make(chan struct{})
+	router := gin.New()
+	router.GET("/health", srv.FailWhileDraining(), healthCheckHandler)
+	router.POST("/api/v1/anonymize", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"anonymized_text": "[NAME]"})
+	})
+	baseURL, shutdown, done := startServer(t, srv, router)
+
+	type result struct {
+		status int
+		err    error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Post(baseURL+"/api/v1/anonymize", "application/json", strings.NewReader(`{"text":"x"}`))
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		inFlight <- result{status: resp.StatusCode}
+	}()
+	<-started
+	shutdown()
+
+	// Readiness fails as soon as the server drains
+	assert.Eventually(t, srv.Draining, time.Second, 5*time.Millisecond)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// New connections are refused while the in-flight request still runs
+	assert.Eventually(t, func() bool {
+		_, err := http.Get(baseURL + "/health")
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+
+	close(release)
+	r := <-inFlight
+	assert.NoError(t, r.err)
+	assert.Equal(t, http.StatusOK, r.status)
+	assert.NoError(t, <-done, "A clean drain should exit successfully")
+}
+
+func TestServer_CancelsRequestsAfterGracePeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := server.DefaultConfig()
+	cfg.GracePeriod = 50 * time.Millisecond
+	srv := server.New(cfg)
+	started := make(chan struct{})
+	router := gin.New()
+	router.POST("/api/v1/anonymize", func(c *gin.Context) {
+		close(started)
+		<-c.Request.Context().Done()
+		if errors.Is(context.Cause(c.Request.Context()), server.ErrShutdown) {
+			apierror.Respond(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeShuttingDown, "Shutting down"))
+		}
+	})
+	baseURL, shutdown, done := startServer(t, srv, router)
+
+	statuses := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(baseURL+"/api/v1/anonymize", "application/json", strings.NewReader(`{"text":"x"}`))
+		if err != nil {
+			statuses <- 0
+			return
+		}
+		resp.Body.Close()
+		statuses <- resp.StatusCode
+	}()
+	<-started
+	shutdown()
+
+	assert.Equal(t, http.StatusServiceUnavailable, <-statuses, "The cancelled request should still get an answer")
+	assert.ErrorIs(t, <-done, server.ErrGracePeriodExceeded)
+}
+
+func TestJobs_RejectedWhileShuttingDown(t *testing.T) {
+	manager := jobs.NewManager(jobs.DefaultConfig(), nil)
+	manager.Register(handlers.JobTypeAnonymize, handlers.AnonymizeJobTask(clients.NewAnonymizerClient("http://127.0.0.1:1")))
+	manager.Start(context.Background())
+	assert.NoError(t, manager.Shutdown(context.Background()))
+
+	router := gin.New()
+	router.POST("/api/v1/jobs", handlers.NewJobsHandler(manager).HandleCreateJob)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", strings.NewReader(`{"type":"anonymize","input":{"text":"hello"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, apierror.CodeShuttingDown, decodeAPIError(t, w).Code)
+}
+
+// writeConfigFile writes a gateway configuration file named name and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfig_LoadsFileThenEnvironment(t *testing.T) {
+	yamlPath := writeConfigFile(t, "gateway.yaml", `
+port: "9000"
+downstream:
+  anonymizer_url: http://anonymizer:8081
+  moderation_url: http://moderation:8082
+  moderation_timeout: 20s
+rate_limit:
+  anonymize:
+    requests_per_second: 2
+    burst: 4
+jobs:
+  webhook_secret: from-file
+`)
+	tomlPath := writeConfigFile(t, "gateway.toml", `
+port = "9000"
+
+[downstream]
+anonymizer_url = "http://anonymizer:8081"
+moderation_url = "http://moderation:8082"
+moderation_timeout = "20s"
+
+[rate_limit.anonymize]
+requests_per_second = 2
+burst = 4
+
+[jobs]
+webhook_secret = "from-file"
+`)
+	t.Setenv("RATE_LIMIT_ANONYMIZE_BURST", "8") // The environment overrides the file
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			settings, err := config.NewManager(path, defaultConfig())
+			if !assert.NoError(t, err) {
+				return
+			}
+			cfg := settings.Current()
+			assert.Equal(t, "9000", cfg.Port)
+			assert.Equal(t, "8090", cfg.GRPCPort, "unset settings keep their defaults")
+			assert.Equal(t, 20*time.Second, cfg.Downstream.ModerationTimeout)
+			assert.Equal(t, clients.DefaultAnonymizerTimeout, cfg.Downstream.AnonymizerTimeout)
+			assert.Equal(t, 2.0, cfg.RateLimit.Anonymize.RequestsPerSecond)
+			assert.Equal(t, 8, cfg.RateLimit.Anonymize.Burst)
+			assert.Equal(t, "anonymize", cfg.RateLimit.Anonymize.Route)
+			assert.Equal(t, "from-file", cfg.Jobs.WebhookSecret)
+		})
+	}
+}
+
+func TestConfig_ReportsEveryInvalidSetting(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+downstream:
+  anonymizer_url: anonymizer
+  moderation_timeout: soon
+rate_limit:
+  backend: memcached
+  anonymise:
+    burst: 4
+server:
+  read_timeout: 0s
+`)
+	t.Run("unparseable", func(t *testing.T) {
+		t.Setenv("JOBS_WORKERS", "many")
+		_, err := config.NewManager(path, defaultConfig())
+		if !assert.Error(t, err) {
+			return
+		}
+		for _, want := range []string{
+			"downstream.moderation_timeout: expected a duration",
+			"rate_limit.anonymise: unknown setting",
+			"JOBS_WORKERS: expected an integer",
+		} {
+			assert.Contains(t, err.Error(), want)
+		}
+	})
+
+	// Values that parse are then validated as a whole
+	path = writeConfigFile(t, "gateway.yaml", `
+downstream:
+  anonymizer_url: anonymizer
+rate_limit:
+  backend: memcached
+idempotency:
+  backend: redis
+  lock_timeout: 30s
+server:
+  read_timeout: 0s
+ai_task_keys: "task-key=ai:anonymize_text ai:translate"
+tenant_keys: "tenant-key=acme,tenant-key=globex"
+`)
+	_, err := config.NewManager(path, defaultConfig())
+	if !assert.Error(t, err) {
+		return
+	}
+	for _, want := range []string{
+		"invalid configuration",
+		"downstream.anonymizer_url: expected an absolute URL",
+		"downstream.moderation_url: required (MODERATION_SERVICE_URL)",
+		"rate_limit.backend: unsupported backend",
+		"server.read_timeout: must be positive",
+		"idempotency.encryption_key: required for the redis backend (IDEMPOTENCY_ENCRYPTION_KEY)",
+		"idempotency.lock_timeout: must be at least server.write_timeout (1m30s)",
+		`ai_task_keys: key ` + auth.Fingerprint("task-key") + `: unknown scope "ai:translate"`,
+		`tenant_keys: key ` + auth.Fingerprint("tenant-key") + `: assigned to both "acme" and "globex"`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.NotContains(t, err.Error(), "task-key", "keys are never quoted in errors")
+	assert.NotContains(t, err.Error(), "tenant-key", "keys are never quoted in errors")
+}
+
+func TestConfig_ViewRedactsSecrets(t *testing.T) {
+	t.Setenv("ANONYMIZER_SERVICE_URL", "http://anonymizer:8081")
+	t.Setenv("MODERATION_SERVICE_URL", "http://moderation:8082")
+	t.Setenv("ADMIN_API_KEYS", testAdminKey)
+	t.Setenv("AUDIT_HASH_KEY", "audit-hash-key")
+	settings, err := config.NewManager("", defaultConfig())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	router := gin.New()
+	router.GET("/config", settings.Handler())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/config", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), testAdminKey)
+	assert.NotContains(t, rr.Body.String(), "audit-hash-key")
+
+	var body struct {
+		Config map[string]any `json:"config"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, config.Redacted, body.Config["admin_api_keys"])
+	auditView := body.Config["audit"].(map[string]any)
+	assert.Equal(t, config.Redacted, auditView["hash_key"])
+	jobsView := body.Config["jobs"].(map[string]any)
+	assert.Equal(t, "", jobsView["webhook_secret"], "unset secrets are shown as empty")
+	downstream := body.Config["downstream"].(map[string]any)
+	assert.Equal(t, "http://anonymizer:8081", downstream["anonymizer_url"])
+	assert.Equal(t, "10s", downstream["anonymizer_timeout"])
+}
+
+func TestConfig_HotReloadKeepsRestartOnlySettings(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+port: "9000"
+downstream:
+  anonymizer_url: http://anonymizer:8081
+  moderation_url: http://moderation:8082
+rate_limit:
+  anonymize:
+    requests_per_second: 1
+    burst: 1
+`)
+	settings, err := config.NewManager(path, defaultConfig())
+	if !assert.NoError(t, err) {
+		return
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend())
+	settings.OnReload(func(cfg *Config) {
+		limiter.SetPolicies(cfg.RateLimit.Anonymize, cfg.RateLimit.Moderate)
+	})
+
+	logs := captureLogs(t)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+port: "9100"
+downstream:
+  anonymizer_url: http://anonymizer:8081
+  moderation_url: http://moderation:8082
+  anonymizer_timeout: 3s
+rate_limit:
+  anonymize:
+    requests_per_second: 50
+    burst: 100
+`), 0o600))
+	assert.NoError(t, settings.Reload())
+
+	cfg := settings.Current()
+	assert.Equal(t, "9000", cfg.Port, "the port needs a restart")
+	assert.Equal(t, 3*time.Second, cfg.Downstream.AnonymizerTimeout)
+	policy, ok := limiter.Policy("anonymize")
+	assert.True(t, ok)
+	assert.Equal(t, 50.0, policy.RequestsPerSecond)
+	assert.Equal(t, 100, policy.Burst)
+	assert.Contains(t, logs.String(), "Configuration changes need a restart to take effect")
+	assert.Contains(t, logs.String(), "port")
+
+	// An invalid file is rejected and the running configuration kept
+	assert.NoError(t, os.WriteFile(path, []byte("rate_limit:\n  anonymize:\n    burst: -1\n"), 0o600))
+	assert.Error(t, settings.Reload())
+	assert.Equal(t, 100, settings.Current().RateLimit.Anonymize.Burst)
+}
+
+// serveHealth answers path with status and a health report, counting the calls
+func serveHealth(t *testing.T, path string, status int, report health.Report, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if calls != nil {
+			calls.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func runHealth(t *testing.T, checker *health.Checker) (int, health.Report) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/check", checker.Handler())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/check", nil))
+	var report health.Report
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	return rr.Code, report
+}
+
+func TestHealth_ReadinessNeedsRequiredDownstreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := health.Config{Timeout: time.Second, DeepTimeout: time.Second}
+	live := health.Report{Status: health.StatusOK}
+	anonymizer := serveHealth(t, "/livez", http.StatusOK, live, nil)
+	moderation := serveHealth(t, "/livez", http.StatusOK, live, nil)
+	coordinator := serveHealth(t, "/livez", http.StatusServiceUnavailable, health.Report{Status: "Draining"}, nil)
+
+	readiness, _ := newHealthCheckers(cfg, anonymizer.URL, moderation.URL, "")
+	status, report := runHealth(t, readiness)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Len(t, report.Checks, 2)
+
+	// The optional coordinator only degrades the gateway
+	readiness, _ = newHealthCheckers(cfg, anonymizer.URL, moderation.URL, coordinator.URL)
+	status, report = runHealth(t, readiness)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, "answered 503", report.Checks["ai-coordinator"].Error)
+
+	moderation.Close()
+	readiness, _ = newHealthCheckers(cfg, anonymizer.URL, moderation.URL, coordinator.URL)
+	status, report = runHealth(t, readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	if assert.Contains(t, report.Checks, "moderation-service") {
+		assert.Equal(t, health.StatusUnavailable, report.Checks["moderation-service"].Status)
+		assert.True(t, report.Checks["moderation-service"].Required)
+		assert.NotEmpty(t, report.Checks["moderation-service"].Error)
+	}
+	assert.Equal(t, health.StatusOK, report.Checks["anonymizer-service"].Status)
+}
+
+func TestHealth_ProbesAreCachedAndTimedOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	checker := health.NewChecker("test", 50*time.Millisecond, time.Minute)
+	checker.Add("slow", true, health.HTTPProbe(slow.URL))
+	status, report := runHealth(t, checker)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "no answer within 50ms", report.Checks["slow"].Error)
+
+	// The failure is reused until it expires instead of probing again
+	_, report = runHealth(t, checker)
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestHealth_DeepReportsTheTopology(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// What the anonymizer reports when Ollama is up but the default model is missing
+	anonymizerDeep := health.Report{
+		Status:  health.StatusUnavailable,
+		Service: "Anonymizer Service",
+		Checks: map[string]*health.Report{
+			"ai-coordinator": {Status: health.StatusUnavailable, Service: "AI Coordinator Service", Checks: map[string]*health.Report{
+				"ollama-adapter": {Status: health.StatusUnavailable, Service: "Ollama Adapter Service", Checks: map[string]*health.Report{
+					"ollama": {
+						Status:  health.StatusUnavailable,
+						Error:   `default model "mistral:7b" is not pulled`,
+						Details: map[string]any{"default_model": "mistral:7b", "model_pulled": false, "model_loaded": false},
+					},
+				}},
+			}},
+		},
+	}
+	var anonymizerCalls atomic.Int32
+	anonymizer := serveHealth(t, "/health/deep", http.StatusServiceUnavailable, anonymizerDeep, &anonymizerCalls)
+	moderation := serveHealth(t, "/health/deep", http.StatusOK, health.Report{Status: health.StatusOK, Service: "Moderation Service"}, nil)
+
+	_, deep := newHealthCheckers(health.Config{Timeout: time.Second, DeepTimeout: time.Second, CacheTTL: time.Minute}, anonymizer.URL, moderation.URL, "")
+	status, report := runHealth(t, deep)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "API Gateway", report.Service)
+	assert.Equal(t, health.StatusOK, report.Checks["moderation-service"].Status)
+
+	anonymizerReport := report.Checks["anonymizer-service"]
+	if assert.NotNil(t, anonymizerReport) {
+		assert.Equal(t, "answered 503", anonymizerReport.Error)
+		ollama := anonymizerReport.Checks["ai-coordinator"].Checks["ollama-adapter"].Checks["ollama"]
+		assert.Equal(t, `default model "mistral:7b" is not pulled`, ollama.Error)
+		assert.Equal(t, false, ollama.Details["model_loaded"])
+	}
+
+	runHealth(t, deep)
+	assert.Equal(t, int32(1), anonymizerCalls.Load(), "deep reports are cached too")
+}
+
+// --- AI Task Tests ---
+
+// testAITaskKeys grants one key a single task and another every task
+var testAITaskKeys = map[string][]string{
+	"anonymize-key": {"ai:anonymize_text"},
+	"all-tasks-key": {"ai:*"},
+	"translate-key": {"ai:translate_text"},
+}
+
+// setupMockCoordinatorServer answers /process with result for anonymize_text
+// and, like the coordinator, 501 unsupported_task for the moderation tasks.
+// Every forwarded request is recorded.
+func setupMockCoordinatorServer(t *testing.T, result string, forwarded *[]clients.AICoordinatorRequest) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/process", r.URL.Path)
+		var req clients.AICoordinatorRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		*forwarded = append(*forwarded, req)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.TaskType != handlers.AITaskAnonymizeText {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = io.WriteString(w, `{"success": false, "error": {"code": "unsupported_task", "message": "adapter for task '`+req.TaskType+`' not implemented yet", "retryable": false, "service": "ai-coordinator"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"success": true, "result": `+result+`}`)
+	}))
+}
+
+// setupAITaskRouter mounts the AI task route as main does, behind the OpenAPI
+// contract, with keys and an audit log
+func setupAITaskRouter(t *testing.T, coordinatorURL string, keys map[string][]string, sink audit.Sink) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	var coordinator *clients.AICoordinatorClient
+	if coordinatorURL != "" {
+		coordinator = clients.NewAICoordinatorClient(coordinatorURL)
+	}
+	auditLog, _ := audit.NewLog(sink, audit.Config{PolicyVersion: audit.DefaultPolicyVersion})
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.DefaultAnonymizePolicy, ratelimit.DefaultModeratePolicy)
+
+	scoped := auth.NewScopedKeys(keys)
+
+	router := gin.New()
+	router.Use(auditLog.MiddlewareByRoute(map[string]string{"/api/v1/ai/tasks": audit.ActionAITask}), scoped.MiddlewareByRoute("/api/v1/ai/tasks"))
+	router.Use(spec.Middleware(openapi.ResponseValidationEnforce))
+	router.POST("/api/v1/ai/tasks", scoped.MiddlewareByBody(handlers.AITaskScopeOf),
+		limiter.MiddlewareByBody(handlers.AITaskRateLimitRoute), handlers.NewAITaskHandler(coordinator).HandleRunTask)
+	return router
+}
+
+func postAITask(router *gin.Engine, apiKey, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/ai/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAITasks_ScopesPerTaskType(t *testing.T) {
+	var forwarded []clients.AICoordinatorRequest
+	coordinator := setupMockCoordinatorServer(t, `{"anonymized_text": "Hello [NAME]", "model_used": "mistral:7b"}`, &forwarded)
+	defer coordinator.Close()
+	sink := audit.NewMemorySink()
+	router := setupAITaskRouter(t, coordinator.URL, testAITaskKeys, sink)
+
+	anonymize := `{"task_type": "anonymize_text", "payload": {"text": "Hello Jane"}}`
+
+	rr := postAITask(router, "", anonymize)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, apierror.CodeUnauthorized, decodeAPIError(t, rr).Code)
+
+	rr = postAITask(router, "unknown-key", anonymize)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = postAITask(router, "translate-key", anonymize)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	apiErr := decodeAPIError(t, rr)
+	assert.Equal(t, apierror.CodeForbidden, apiErr.Code)
+	assert.Contains(t, apiErr.Message, "ai:anonymize_text")
+
+	rr = postAITask(router, "anonymize-key", anonymize)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = postAITask(router, "all-tasks-key", anonymize)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The coordinator cannot run the moderation tasks, so they are not offered
+	rr = postAITask(router, "all-tasks-key", `{"task_type": "moderate_text", "payload": {"text": "Hello Jane"}}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, apierror.CodeInvalidRequest, decodeAPIError(t, rr).Code)
+
+	assert.Len(t, forwarded, 2, "rejected calls never reach the coordinator")
+
+	records, _, err := audit.Query(sink, audit.Filter{Action: audit.ActionAITask}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 6) {
+		assert.Equal(t, http.StatusUnauthorized, records[0].Status)
+		assert.Equal(t, http.StatusOK, records[3].Status)
+		assert.Equal(t, "key:"+auth.Fingerprint("anonymize-key"), records[3].Principal)
+		assert.NotEmpty(t, records[3].OutputHash)
+	}
+
+	// Without keys the route is disabled
+	router = setupAITaskRouter(t, coordinator.URL, nil, audit.NewMemorySink())
+	rr = postAITask(router, "all-tasks-key", anonymize)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAITasks_KeyIsCheckedBeforeTheBodyIsRead(t *testing.T) {
+	router := setupAITaskRouter(t, "", testAITaskKeys, audit.NewMemorySink())
+	post := func(apiKey string) (*httptest.ResponseRecorder, *endlessBody) {
+		endless := &endlessBody{}
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/ai/tasks", io.MultiReader(strings.NewReader(`{"task_type": "`), endless))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set(auth.HeaderAPIKey, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr, endless
+	}
+
+	for apiKey, status := range map[string]int{"": http.StatusUnauthorized, "unknown-key": http.StatusForbidden} {
+		rr, endless := post(apiKey)
+		assert.Equal(t, status, rr.Code, apiKey)
+		assert.Zero(t, endless.read, "The body of %q was read", apiKey)
+	}
+
+	// A known key gets as far as the contract, which reads a bounded amount
+	rr, endless := post("translate-key")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.LessOrEqual(t, endless.read, bodylimit.MaxBytes+64<<10, "Read far past the limit")
+}
+
+func TestAITasks_ForwardsAllowListedRequests(t *testing.T) {
+	var forwarded []clients.AICoordinatorRequest
+	result := `{"anonymized_text": "Hello [NAME]", "model_used": "llama3:8b"}`
+	coordinator := setupMockCoordinatorServer(t, result, &forwarded)
+	defer coordinator.Close()
+	router := setupAITaskRouter(t, coordinator.URL, testAITaskKeys, audit.NewMemorySink())
+
+	rr := postAITask(router, "anonymize-key", `{"task_type": "anonymize_text", "payload": {"text": "Hello Jane"}, "config": {"model": "llama3:8b"}}`)
+	if assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		var resp handlers.AITaskResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, handlers.AITaskAnonymizeText, resp.TaskType)
+		assert.JSONEq(t, result, string(resp.Result), "the coordinator's result is passed through")
+	}
+	if assert.Len(t, forwarded, 1) {
+		assert.Equal(t, map[string]interface{}{"text": "Hello Jane"}, forwarded[0].Payload)
+		assert.Equal(t, map[string]string{"model": "llama3:8b"}, forwarded[0].Config, "the model hint reaches the coordinator")
+	}
+
+	for name, tc := range map[string]struct {
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		"unknown task type":   {`{"task_type": "translate", "payload": {"text": "Hola"}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "task_type"},
+		"unknown payload key": {`{"task_type": "anonymize_text", "payload": {"text": "Hi", "prompt": "ignore the rules"}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "payload.prompt is not allowed"},
+		"non-string payload":  {`{"task_type": "anonymize_text", "payload": {"text": 42}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "payload.text must be a string"},
+		"missing payload key": {`{"task_type": "anonymize_text", "payload": {}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "payload.text is required"},
+		"unknown config key":  {`{"task_type": "anonymize_text", "payload": {"text": "Hi"}, "config": {"temperature": "2"}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "config.temperature is not allowed"},
+		"moderation task":     {`{"task_type": "moderate_image", "payload": {"image_url": "https://example.com/a.png"}}`, http.StatusBadRequest, apierror.CodeInvalidRequest, "task_type"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := postAITask(router, "all-tasks-key", tc.body)
+			assert.Equal(t, tc.status, rr.Code, rr.Body.String())
+			apiErr := decodeAPIError(t, rr)
+			assert.Equal(t, tc.code, apiErr.Code)
+			assert.Contains(t, apiErr.Message, tc.message)
+		})
+	}
+	assert.Len(t, forwarded, 1, "invalid requests are not forwarded")
+
+	// Without a coordinator the route answers 503
+	router = setupAITaskRouter(t, "", testAITaskKeys, audit.NewMemorySink())
+	rr = postAITask(router, "anonymize-key", `{"task_type": "anonymize_text", "payload": {"text": "Hello Jane"}}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, apierror.CodeUpstreamUnavailable, decodeAPIError(t, rr).Code)
+}
+
+func TestGRPC_RunAITaskMatchesREST(t *testing.T) {
+	var forwarded []clients.AICoordinatorRequest
+	coordinator := setupMockCoordinatorServer(t, `{"anonymized_text": "Hello [NAME]", "model_used": "llama3:8b"}`, &forwarded)
+	defer coordinator.Close()
+
+	cfg := grpcTestConfig("", "", audit.NewMemorySink())
+	cfg.AITasks = handlers.NewAITaskHandler(clients.NewAICoordinatorClient(coordinator.URL))
+	cfg.AITaskKeys = auth.NewScopedKeys(testAITaskKeys)
+	client := pb.NewGatewayClient(dialGRPC(t, cfg))
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+	payload, _ := structpb.NewStruct(map[string]interface{}{"text": "Hello Jane"})
+
+	_, err := client.RunAITask(withKey("translate-key"), &pb.RunAITaskRequest{TaskType: handlers.AITaskAnonymizeText, Payload: payload})
+	code, info := grpcErrorInfo(t, err)
+	assert.Equal(t, codes.PermissionDenied, code)
+	assert.Equal(t, apierror.CodeForbidden, info.GetReason())
+
+	resp, err := client.RunAITask(withKey("anonymize-key"), &pb.RunAITaskRequest{
+		TaskType: handlers.AITaskAnonymizeText,
+		Payload:  payload,
+		Config:   map[string]string{"model": "llama3:8b"},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, handlers.AITaskAnonymizeText, resp.GetTaskType())
+		assert.Equal(t, "Hello [NAME]", resp.GetResult().GetStructValue().GetFields()["anonymized_text"].GetStringValue())
+	}
+	if assert.Len(t, forwarded, 1) {
+		assert.Equal(t, map[string]string{"model": "llama3:8b"}, forwarded[0].Config)
+	}
+}
+
+// --- Deanonymization Tests ---
+
+// setupDeanonymizeRouter serves the anonymize and deanonymize routes behind
+// the contract as in main, with tokens sealed by secret ("" disables them) and
+// audited in auditLog if given
+func setupDeanonymizeRouter(t *testing.T, anonymizerURL, secret string, auditLog *audit.Log) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	var sealer *reversible.Sealer
+	if secret != "" {
+		sealer, err = reversible.New(secret)
+		assert.NoError(t, err)
+	}
+	anonymizeHandler := handlers.NewAnonymizeHandler(clients.NewAnonymizerClient(anonymizerURL))
+	anonymizeHandler.Sealer = sealer
+
+	router := gin.New()
+	router.Use(testTenantKeys.Middleware())
+	apiV1 := router.Group("/api/v1")
+	if auditLog != nil {
+		apiV1.Use(auditLog.MiddlewareByRoute(auditedRoutes))
+	}
+	apiV1.Use(spec.Middleware(openapi.ResponseValidationEnforce))
+	apiV1.POST("/anonymize", anonymizeHandler.HandleAnonymize)
+	apiV1.POST("/deanonymize", handlers.NewDeanonymizeHandler(sealer).HandleDeanonymize)
+	return router
+}
+
+// setupPlaceholderAnonymizer answers every anonymization with anonymized
+func setupPlaceholderAnonymizer(t *testing.T, anonymized string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody clients.AnonymizerRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		_ = json.NewEncoder(w).Encode(clients.AnonymizerResponse{OriginalText: reqBody.Text, AnonymizedText: anonymized})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postJSONAs(router *gin.Engine, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	return postWithIdempotencyKey(router, path, "", apiKey, string(payload))
+}
+
+func TestDeanonymize_RestoresReversibleAnonymizations(t *testing.T) {
+	anonymizer := setupPlaceholderAnonymizer(t, "Hi [NAME], [NAME] and [NAME] ([EMAIL])\n")
+	router := setupDeanonymizeRouter(t, anonymizer.URL, "deanonymize-secret", nil)
+
+	rr := postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane Doe, John and Jane Doe (jane@example.com)", Reversible: true})
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var anonymized clients.AnonymizerResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &anonymized))
+	assert.Equal(t, "Hi [NAME_1], [NAME_2] and [NAME_1] ([EMAIL_1])", anonymized.AnonymizedText, "One number per value")
+	assert.NotEmpty(t, anonymized.DeanonymizeToken)
+	assert.NotContains(t, anonymized.DeanonymizeToken, "Jane")
+
+	// Placeholders are found wherever the text moved them; unknown ones are kept
+	edited := handlers.DeanonymizeRequest{Text: "Dear [NAME_2], [NAME_1] wrote from [EMAIL_1] about [PHONE_1].", Token: anonymized.DeanonymizeToken}
+	rr = postJSONAs(router, "/api/v1/deanonymize", "acme-key-2", edited)
+	if assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		var resp handlers.DeanonymizeResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "Dear John, Jane Doe wrote from jane@example.com about [PHONE_1].", resp.Text)
+		assert.Equal(t, 3, resp.Restored)
+	}
+
+	// Only the tenant the token was issued to can open it
+	for _, apiKey := range []string{"globex-key", ""} {
+		rr = postJSONAs(router, "/api/v1/deanonymize", apiKey, edited)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, apiKey)
+		assert.Equal(t, apierror.CodeInvalidRequest, decodeAPIError(t, rr).Code)
+	}
+	rr = postJSONAs(router, "/api/v1/deanonymize", "acme-key", handlers.DeanonymizeRequest{Text: edited.Text, Token: "bm90IGEgdG9rZW4"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// So can no gateway with another key
+	other := setupDeanonymizeRouter(t, anonymizer.URL, "other-secret", nil)
+	rr = postJSONAs(other, "/api/v1/deanonymize", "acme-key", edited)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDeanonymize_RefusesWhatCannotBeReversed(t *testing.T) {
+	// The model rewrote the text around the placeholder
+	router := setupDeanonymizeRouter(t, setupPlaceholderAnonymizer(t, "Hello there, [NAME]").URL, "deanonymize-secret", nil)
+	rr := postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane", Reversible: true})
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Equal(t, apierror.CodeUpstreamError, decodeAPIError(t, rr).Code)
+
+	// Adjacent placeholders leave no way to split the values
+	router = setupDeanonymizeRouter(t, setupPlaceholderAnonymizer(t, "Hi [NAME][EMAIL]").URL, "deanonymize-secret", nil)
+	rr = postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane jane@example.com", Reversible: true})
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+
+	// Without a key both are disabled; plain anonymization still works
+	router = setupDeanonymizeRouter(t, setupPlaceholderAnonymizer(t, "Hi [NAME]").URL, "", nil)
+	rr = postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane", Reversible: true})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = postJSONAs(router, "/api/v1/deanonymize", "acme-key", handlers.DeanonymizeRequest{Text: "Hi [NAME_1]", Token: "token"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = postJSONAs(router, "/api/v1/anonymize", "acme-key", handlers.AnonymizeGatewayRequest{Text: "Hi Jane"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "deanonymize_token")
+}
@@ -0,0 +1,616 @@
+// gRPC API of the PrivacyPilot API gateway. It offers the same operations as
+// the /api/v1 REST routes (see api-gateway.openapi.json) with the same
+// validation, errors, rate limits and audit records.
+//
+// Callers identify themselves with the same values as over HTTP, sent as
+// request metadata: x-api-key and x-request-id. Rate limit state is
+// returned in the response header metadata (x-ratelimit-*), and
+// errors carry a google.rpc.ErrorInfo detail whose reason is the REST error
+// code (e.g. "model_not_found").
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: privacypilot/v1/gateway.proto
+
+package privacypilotv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Gateway_Anonymize_FullMethodName       = "/privacypilot.v1.Gateway/Anonymize"
+	Gateway_AnonymizeStream_FullMethodName = "/privacypilot.v1.Gateway/AnonymizeStream"
+	Gateway_AnonymizeBatch_FullMethodName  = "/privacypilot.v1.Gateway/AnonymizeBatch"
+	Gateway_Moderate_FullMethodName        = "/privacypilot.v1.Gateway/Moderate"
+	Gateway_Process_FullMethodName         = "/privacypilot.v1.Gateway/Process"
+	Gateway_RunPipeline_FullMethodName     = "/privacypilot.v1.Gateway/RunPipeline"
+	Gateway_RunAITask_FullMethodName       = "/privacypilot.v1.Gateway/RunAITask"
+	Gateway_CreateJob_FullMethodName       = "/privacypilot.v1.Gateway/CreateJob"
+	Gateway_GetJob_FullMethodName          = "/privacypilot.v1.Gateway/GetJob"
+)
+
+// GatewayClient is the client API for Gateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Gateway mirrors the privacy operations of the REST API
+type GatewayClient interface {
+	// Anonymize replaces personal data in a text (POST /api/v1/anonymize)
+	Anonymize(ctx context.Context, in *AnonymizeRequest, opts ...grpc.CallOption) (*AnonymizeResponse, error)
+	// AnonymizeStream streams anonymized output as it is generated
+	// (POST /api/v1/anonymize/stream). Tokens are released through the same
+	// holdback as the SSE stream, so partial PII is never sent.
+	AnonymizeStream(ctx context.Context, in *AnonymizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AnonymizeStreamEvent], error)
+	// AnonymizeBatch anonymizes the records sent on the stream once the client
+	// closes it (POST /api/v1/anonymize/batch). An x-batch-concurrency
+	// metadata value may lower the server's concurrency for the batch.
+	AnonymizeBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[AnonymizeBatchItem, AnonymizeBatchResponse], error)
+	// Moderate checks a text and/or image (POST /api/v1/moderate)
+	Moderate(ctx context.Context, in *ModerateRequest, opts ...grpc.CallOption) (*ModerateResponse, error)
+	// Process moderates content and anonymizes it unless it is blocked
+	// (POST /api/v1/process)
+	Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error)
+	// RunPipeline runs a configured pipeline (POST /api/v1/pipelines/{name})
+	RunPipeline(ctx context.Context, in *RunPipelineRequest, opts ...grpc.CallOption) (*RunPipelineResponse, error)
+	// RunAITask runs a task directly on the AI coordinator
+	// (POST /api/v1/ai/tasks). The x-api-key must be granted the
+	// ai:<task_type> scope.
+	RunAITask(ctx context.Context, in *RunAITaskRequest, opts ...grpc.CallOption) (*RunAITaskResponse, error)
+	// CreateJob queues an asynchronous job (POST /api/v1/jobs)
+	CreateJob(ctx context.Context, in *CreateJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// GetJob reports the status of a job (GET /api/v1/jobs/{id})
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type gatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGatewayClient(cc grpc.ClientConnInterface) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) Anonymize(ctx context.Context, in *AnonymizeRequest, opts ...grpc.CallOption) (*AnonymizeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnonymizeResponse)
+	err := c.cc.Invoke(ctx, Gateway_Anonymize_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) AnonymizeStream(ctx context.Context, in *AnonymizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AnonymizeStreamEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gateway_ServiceDesc.Streams[0], Gateway_AnonymizeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AnonymizeRequest, AnonymizeStreamEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_AnonymizeStreamClient = grpc.ServerStreamingClient[AnonymizeStreamEvent]
+
+func (c *gatewayClient) AnonymizeBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[AnonymizeBatchItem, AnonymizeBatchResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gateway_ServiceDesc.Streams[1], Gateway_AnonymizeBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AnonymizeBatchItem, AnonymizeBatchResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_AnonymizeBatchClient = grpc.ClientStreamingClient[AnonymizeBatchItem, AnonymizeBatchResponse]
+
+func (c *gatewayClient) Moderate(ctx context.Context, in *ModerateRequest, opts ...grpc.CallOption) (*ModerateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ModerateResponse)
+	err := c.cc.Invoke(ctx, Gateway_Moderate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProcessResponse)
+	err := c.cc.Invoke(ctx, Gateway_Process_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) RunPipeline(ctx context.Context, in *RunPipelineRequest, opts ...grpc.CallOption) (*RunPipelineResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunPipelineResponse)
+	err := c.cc.Invoke(ctx, Gateway_RunPipeline_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) RunAITask(ctx context.Context, in *RunAITaskRequest, opts ...grpc.CallOption) (*RunAITaskResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunAITaskResponse)
+	err := c.cc.Invoke(ctx, Gateway_RunAITask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) CreateJob(ctx context.Context, in *CreateJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Gateway_CreateJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Gateway_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GatewayServer is the server API for Gateway service.
+// All implementations must embed UnimplementedGatewayServer
+// for forward compatibility.
+//
+// Gateway mirrors the privacy operations of the REST API
+type GatewayServer interface {
+	// Anonymize replaces personal data in a text (POST /api/v1/anonymize)
+	Anonymize(context.Context, *AnonymizeRequest) (*AnonymizeResponse, error)
+	// AnonymizeStream streams anonymized output as it is generated
+	// (POST /api/v1/anonymize/stream). Tokens are released through the same
+	// holdback as the SSE stream, so partial PII is never sent.
+	AnonymizeStream(*AnonymizeRequest, grpc.ServerStreamingServer[AnonymizeStreamEvent]) error
+	// AnonymizeBatch anonymizes the records sent on the stream once the client
+	// closes it (POST /api/v1/anonymize/batch). An x-batch-concurrency
+	// metadata value may lower the server's concurrency for the batch.
+	AnonymizeBatch(grpc.ClientStreamingServer[AnonymizeBatchItem, AnonymizeBatchResponse]) error
+	// Moderate checks a text and/or image (POST /api/v1/moderate)
+	Moderate(context.Context, *ModerateRequest) (*ModerateResponse, error)
+	// Process moderates content and anonymizes it unless it is blocked
+	// (POST /api/v1/process)
+	Process(context.Context, *ProcessRequest) (*ProcessResponse, error)
+	// RunPipeline runs a configured pipeline (POST /api/v1/pipelines/{name})
+	RunPipeline(context.Context, *RunPipelineRequest) (*RunPipelineResponse, error)
+	// RunAITask runs a task directly on the AI coordinator
+	// (POST /api/v1/ai/tasks). The x-api-key must be granted the
+	// ai:<task_type> scope.
+	RunAITask(context.Context, *RunAITaskRequest) (*RunAITaskResponse, error)
+	// CreateJob queues an asynchronous job (POST /api/v1/jobs)
+	CreateJob(context.Context, *CreateJobRequest) (*Job, error)
+	// GetJob reports the status of a job (GET /api/v1/jobs/{id})
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	mustEmbedUnimplementedGatewayServer()
+}
+
+// UnimplementedGatewayServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGatewayServer struct{}
+
+func (UnimplementedGatewayServer) Anonymize(context.Context, *AnonymizeRequest) (*AnonymizeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Anonymize not implemented")
+}
+func (UnimplementedGatewayServer) AnonymizeStream(*AnonymizeRequest, grpc.ServerStreamingServer[AnonymizeStreamEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method AnonymizeStream not implemented")
+}
+func (UnimplementedGatewayServer) AnonymizeBatch(grpc.ClientStreamingServer[AnonymizeBatchItem, AnonymizeBatchResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method AnonymizeBatch not implemented")
+}
+func (UnimplementedGatewayServer) Moderate(context.Context, *ModerateRequest) (*ModerateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Moderate not implemented")
+}
+func (UnimplementedGatewayServer) Process(context.Context, *ProcessRequest) (*ProcessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Process not implemented")
+}
+func (UnimplementedGatewayServer) RunPipeline(context.Context, *RunPipelineRequest) (*RunPipelineResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunPipeline not implemented")
+}
+func (UnimplementedGatewayServer) RunAITask(context.Context, *RunAITaskRequest) (*RunAITaskResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunAITask not implemented")
+}
+func (UnimplementedGatewayServer) CreateJob(context.Context, *CreateJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateJob not implemented")
+}
+func (UnimplementedGatewayServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedGatewayServer) mustEmbedUnimplementedGatewayServer() {}
+func (UnimplementedGatewayServer) testEmbeddedByValue()                 {}
+
+// UnsafeGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GatewayServer will
+// result in compilation errors.
+type UnsafeGatewayServer interface {
+	mustEmbedUnimplementedGatewayServer()
+}
+
+func RegisterGatewayServer(s grpc.ServiceRegistrar, srv GatewayServer) {
+	// If the following call pancis, it indicates UnimplementedGatewayServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Gateway_ServiceDesc, srv)
+}
+
+func _Gateway_Anonymize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnonymizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Anonymize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_Anonymize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Anonymize(ctx, req.(*AnonymizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_AnonymizeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AnonymizeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GatewayServer).AnonymizeStream(m, &grpc.GenericServerStream[AnonymizeRequest, AnonymizeStreamEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_AnonymizeStreamServer = grpc.ServerStreamingServer[AnonymizeStreamEvent]
+
+func _Gateway_AnonymizeBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GatewayServer).AnonymizeBatch(&grpc.GenericServerStream[AnonymizeBatchItem, AnonymizeBatchResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_AnonymizeBatchServer = grpc.ClientStreamingServer[AnonymizeBatchItem, AnonymizeBatchResponse]
+
+func _Gateway_Moderate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Moderate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_Moderate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Moderate(ctx, req.(*ModerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_Process_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Process(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_Process_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Process(ctx, req.(*ProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_RunPipeline_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunPipelineRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).RunPipeline(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_RunPipeline_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).RunPipeline(ctx, req.(*RunPipelineRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_RunAITask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunAITaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).RunAITask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_RunAITask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).RunAITask(ctx, req.(*RunAITaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_CreateJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).CreateJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_CreateJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).CreateJob(ctx, req.(*CreateJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Gateway_ServiceDesc is the grpc.ServiceDesc for Gateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "privacypilot.v1.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Anonymize",
+			Handler:    _Gateway_Anonymize_Handler,
+		},
+		{
+			MethodName: "Moderate",
+			Handler:    _Gateway_Moderate_Handler,
+		},
+		{
+			MethodName: "Process",
+			Handler:    _Gateway_Process_Handler,
+		},
+		{
+			MethodName: "RunPipeline",
+			Handler:    _Gateway_RunPipeline_Handler,
+		},
+		{
+			MethodName: "RunAITask",
+			Handler:    _Gateway_RunAITask_Handler,
+		},
+		{
+			MethodName: "CreateJob",
+			Handler:    _Gateway_CreateJob_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Gateway_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AnonymizeStream",
+			Handler:       _Gateway_AnonymizeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "AnonymizeBatch",
+			Handler:       _Gateway_AnonymizeBatch_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "privacypilot/v1/gateway.proto",
+}
+
+const (
+	Admin_QueryAudit_FullMethodName  = "/privacypilot.v1.Admin/QueryAudit"
+	Admin_VerifyAudit_FullMethodName = "/privacypilot.v1.Admin/VerifyAudit"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Admin mirrors the admin API. Every call needs an admin key in x-api-key.
+type AdminClient interface {
+	// QueryAudit lists audit records (GET /api/v1/admin/audit)
+	QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error)
+	// VerifyAudit checks the audit chain (GET /api/v1/admin/audit/verify)
+	VerifyAudit(ctx context.Context, in *VerifyAuditRequest, opts ...grpc.CallOption) (*AuditVerification, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryAuditResponse)
+	err := c.cc.Invoke(ctx, Admin_QueryAudit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) VerifyAudit(ctx context.Context, in *VerifyAuditRequest, opts ...grpc.CallOption) (*AuditVerification, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuditVerification)
+	err := c.cc.Invoke(ctx, Admin_VerifyAudit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility.
+//
+// Admin mirrors the admin API. Every call needs an admin key in x-api-key.
+type AdminServer interface {
+	// QueryAudit lists audit records (GET /api/v1/admin/audit)
+	QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error)
+	// VerifyAudit checks the audit chain (GET /api/v1/admin/audit/verify)
+	VerifyAudit(context.Context, *VerifyAuditRequest) (*AuditVerification, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServer struct{}
+
+func (UnimplementedAdminServer) QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAudit not implemented")
+}
+func (UnimplementedAdminServer) VerifyAudit(context.Context, *VerifyAuditRequest) (*AuditVerification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyAudit not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+func (UnimplementedAdminServer) testEmbeddedByValue()               {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_QueryAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).QueryAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_QueryAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).QueryAudit(ctx, req.(*QueryAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_VerifyAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).VerifyAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_VerifyAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).VerifyAudit(ctx, req.(*VerifyAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "privacypilot.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryAudit",
+			Handler:    _Admin_QueryAudit_Handler,
+		},
+		{
+			MethodName: "VerifyAudit",
+			Handler:    _Admin_VerifyAudit_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "privacypilot/v1/gateway.proto",
+}
@@ -1,8 +1,12 @@
+const { REQUEST_ID_HEADER, currentRequestId } = require('./requestId');
+const logger = require('./logger');
+const mtls = require('./mtls');
+
 const AI_COORDINATOR_URL = process.env.AI_COORDINATOR_URL;
 const REQUEST_TIMEOUT_MS = 20000; // 20 seconds timeout for AI tasks
 
 if (!AI_COORDINATOR_URL) {
-    console.error('FATAL ERROR: AI_COORDINATOR_URL environment variable is not set.');
+    logger.error('AI_COORDINATOR_URL environment variable is not set');
     process.exit(1);
 }
 
@@ -32,14 +36,15 @@ async function requestAiTask(taskType, payload, config = {}) {
     };
 
     const url = `${AI_COORDINATOR_URL}/process`; // Assuming /process endpoint
-    console.log(`Sending task '${taskType}' to AI Coordinator at ${url}`);
+    logger.debug('Sending task to AI Coordinator', { task_type: taskType, url });
 
     try {
-        const response = await fetch(url, {
+        const response = await mtls.fetch(url, { // Presents this service's certificate when mTLS is on
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
                 'Accept': 'application/json',
+                ...(currentRequestId() && { [REQUEST_ID_HEADER]: currentRequestId() }), // Correlate logs across services
             },
             body: JSON.stringify(requestBody),
             signal: controller.signal, // Add abort signal for timeout
@@ -50,21 +55,26 @@ async function requestAiTask(taskType, payload, config = {}) {
         const responseBody = await response.json(); // Attempt to parse JSON regardless of status
 
         if (!response.ok || !responseBody.success) {
-            const errorMessage = responseBody?.error || `AI Coordinator returned status ${response.status}`;
-            console.error(`AI Coordinator task failed: ${errorMessage}`, responseBody);
+            const errorMessage = responseBody?.error?.message || responseBody?.error || `AI Coordinator returned status ${response.status}`;
+            // The response body is not logged: error messages may echo the payload
+            logger.warn('AI Coordinator task failed', {
+                task_type: taskType,
+                status: response.status,
+                ...(responseBody?.error?.code && { error_code: responseBody.error.code }),
+            });
             throw new Error(`AI Coordinator task '${taskType}' failed: ${errorMessage}`);
         }
 
-        console.log(`Successfully received result for task '${taskType}' from AI Coordinator.`);
+        logger.debug('Received result from AI Coordinator', { task_type: taskType });
         return responseBody.result; // Return only the result part on success
 
     } catch (error) {
         clearTimeout(timeoutId); // Ensure timeout is cleared on error
         if (error.name === 'AbortError') {
-            console.error(`AI Coordinator request timed out after ${REQUEST_TIMEOUT_MS}ms`);
+            logger.warn('AI Coordinator request timed out', { timeout_ms: REQUEST_TIMEOUT_MS });
             throw new Error(`AI Coordinator request timed out`);
         }
-        console.error(`Error communicating with AI Coordinator: ${error.message}`);
+        logger.warn('Error communicating with AI Coordinator', logger.errorFields(error));
         // Rethrow a generic error or the specific error
         throw new Error(`Failed to communicate with AI Coordinator: ${error.message}`);
     }
@@ -0,0 +1,131 @@
+// Liveness, readiness and deep health checks, reported in the same format as
+// the Go services' health package (pkg/servicekit/health) so the gateway can nest them.
+
+const STATUS = {
+    OK: 'OK',
+    DEGRADED: 'Degraded', // An optional dependency is failing
+    UNAVAILABLE: 'Unavailable', // A required dependency is failing
+};
+
+/**
+ * Creates a checker that runs probes with a timeout each and reuses their
+ * results for ttlMs, so frequent checks neither pile up on a slow dependency
+ * nor multiply the load on it.
+ * @param {string} service - Name reported for this service.
+ * @param {number} timeoutMs - Time allowed for each probe.
+ * @param {number} ttlMs - How long a probe result is reused (0 disables caching).
+ */
+function createChecker(service, timeoutMs, ttlMs) {
+    const checks = [];
+
+    /**
+     * Registers a probe. It resolves to an optional report (with details or
+     * nested checks) or rejects to fail the check. A failing required probe
+     * makes the service Unavailable; a failing optional one only Degraded.
+     */
+    function add(name, required, probe) {
+        checks.push({ name, required, probe, last: null, pending: null });
+    }
+
+    async function probeOnce(check) {
+        const controller = new AbortController();
+        let timeoutId;
+        const timedOut = new Promise((resolve, reject) => {
+            timeoutId = setTimeout(() => {
+                controller.abort();
+                reject(new Error('timed out'));
+            }, timeoutMs);
+        });
+        const start = Date.now();
+        let result;
+        try {
+            result = (await Promise.race([check.probe(controller.signal), timedOut])) || {};
+            if (!result.status) {
+                result.status = STATUS.OK;
+            }
+        } catch (error) {
+            result = error.report || {};
+            result.status = STATUS.UNAVAILABLE;
+            result.error = controller.signal.aborted ? `no answer within ${timeoutMs}ms` : error.message;
+        } finally {
+            clearTimeout(timeoutId);
+        }
+        result.required = check.required || undefined;
+        result.latency_ms = Date.now() - start;
+        result.checked_at = new Date(start).toISOString();
+        return result;
+    }
+
+    // Concurrent callers share the probe in flight
+    function runCheck(check) {
+        if (check.last && Date.now() - Date.parse(check.last.checked_at) < ttlMs) {
+            return Promise.resolve(check.last);
+        }
+        if (!check.pending) {
+            check.pending = probeOnce(check).then((result) => {
+                check.last = result;
+                check.pending = null;
+                return result;
+            });
+        }
+        return check.pending;
+    }
+
+    /** Runs (or reuses the cached results of) all probes concurrently. */
+    async function run() {
+        const report = { status: STATUS.OK, service, latency_ms: 0, checked_at: new Date().toISOString() };
+        if (checks.length === 0) {
+            return report;
+        }
+        const results = await Promise.all(checks.map(runCheck));
+        report.checks = {};
+        checks.forEach((check, i) => {
+            const result = results[i];
+            report.checks[check.name] = result;
+            report.latency_ms = Math.max(report.latency_ms, result.latency_ms);
+            if (result.status === STATUS.OK) {
+                return;
+            }
+            if (result.status === STATUS.UNAVAILABLE && check.required) {
+                report.status = STATUS.UNAVAILABLE;
+            } else if (report.status === STATUS.OK) {
+                report.status = STATUS.DEGRADED;
+            }
+        });
+        return report;
+    }
+
+    /** Express handler: 200 while OK or Degraded, 503 when Unavailable. */
+    function handler(req, res) {
+        run().then((report) => {
+            res.status(report.status === STATUS.UNAVAILABLE ? 503 : 200).json(report);
+        });
+    }
+
+    return { add, run, handler };
+}
+
+/**
+ * Probe that GETs url and fails unless it answers 2xx. A JSON report in the
+ * response (even a failing one) becomes the check's report. fetchImpl
+ * replaces the global fetch, e.g. with mtls.fetch.
+ */
+function httpProbe(url, fetchImpl = (...args) => fetch(...args)) {
+    return async (signal) => {
+        const response = await fetchImpl(url, { signal });
+        let report = null;
+        try {
+            report = await response.json();
+        } catch {
+            report = null;
+        }
+        if (!response.ok) {
+            const error = new Error(`answered ${response.status}`);
+            error.report = report;
+            throw error;
+        }
+        return report;
+    };
+}
+
+module.exports = { STATUS, createChecker, httpProbe };
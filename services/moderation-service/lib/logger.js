@@ -0,0 +1,98 @@
+const { currentRequestId } = require('./requestId');
+
+// Structured JSON logging matching the Go services' package logging: one JSON
+// object per line with the service name and the current request ID.
+//
+// User content must never reach the logs, at any level: fields under keys that
+// hold request or response content are written as [REDACTED], messages must be
+// constant strings, and errors are logged by name and code only (JSON parse
+// error messages quote the body they failed on).
+
+const SERVICE_NAME = 'moderation-service';
+const REDACTED = '[REDACTED]';
+
+// Field keys whose values are user content and are always redacted, wherever they appear
+const SENSITIVE_KEYS = new Set([
+    'text', 'body', 'input', 'output', 'prompt', 'system', 'response', 'result', 'payload',
+    'content', 'query', 'items', 'token', 'original_text', 'anonymized_text', 'image_url',
+    'imageurl', 'textcontext',
+]);
+
+const LEVELS = { debug: 10, info: 20, warn: 30, error: 40 };
+
+function parseLevel(value) {
+    const name = (value || 'info').trim().toLowerCase();
+    if (name === 'warning') return LEVELS.warn;
+    return LEVELS[name] || LEVELS.info;
+}
+
+const minLevel = parseLevel(process.env.LOG_LEVEL);
+
+function redact(value, depth = 0) {
+    if (value === null || typeof value !== 'object') return value;
+    if (depth > 5) return REDACTED;
+    if (Array.isArray(value)) return value.map((v) => redact(v, depth + 1));
+    const out = {};
+    for (const [key, v] of Object.entries(value)) {
+        out[key] = SENSITIVE_KEYS.has(key.toLowerCase()) ? REDACTED : redact(v, depth + 1);
+    }
+    return out;
+}
+
+function write(level, msg, fields = {}) {
+    if (LEVELS[level] < minLevel) return;
+    const record = {
+        time: new Date().toISOString(),
+        level: level.toUpperCase(),
+        msg,
+        service: SERVICE_NAME,
+        ...redact(fields),
+    };
+    const id = currentRequestId();
+    if (id) record.request_id = id;
+    const line = JSON.stringify(record) + '\n';
+    (LEVELS[level] >= LEVELS.error ? process.stderr : process.stdout).write(line);
+}
+
+/**
+ * Describes an error without its message.
+ * @param {Error} err
+ * @returns {object}
+ */
+function errorFields(err) {
+    if (!err) return {};
+    return {
+        error: err.name || 'Error',
+        ...(err.code && { error_code: String(err.code) }),
+        ...(err.type && { error_type: String(err.type) }), // body-parser sets e.g. entity.parse.failed
+    };
+}
+
+/**
+ * Express middleware logging one record per request with its method, route,
+ * status and latency. The concrete path, query string and body are never logged.
+ */
+function accessLog(req, res, next) {
+    const start = process.hrtime.bigint();
+    res.on('finish', () => {
+        const route = req.route ? req.baseUrl + req.route.path : 'unmatched';
+        write(res.statusCode >= 500 ? 'error' : 'info', 'Request handled', {
+            method: req.method,
+            route,
+            status: res.statusCode,
+            latency_ms: Number((process.hrtime.bigint() - start) / 1000000n),
+        });
+    });
+    next();
+}
+
+module.exports = {
+    SERVICE_NAME,
+    REDACTED,
+    debug: (msg, fields) => write('debug', msg, fields),
+    info: (msg, fields) => write('info', msg, fields),
+    warn: (msg, fields) => write('warn', msg, fields),
+    error: (msg, fields) => write('error', msg, fields),
+    errorFields,
+    accessLog,
+};
@@ -0,0 +1,213 @@
+// Mutual TLS, matching the Go services' package mtls (pkg/servicekit/mtls).
+// With MTLS_ENABLED=true this service serves its API over TLS, asking callers
+// for a certificate: one issued by the configured CA that names a service in
+// MTLS_ALLOWED_CLIENTS (URI SAN spiffe://privacypilot/<service>) is accepted,
+// any other is refused, and requireClient turns away API requests without one.
+// Calls to https URLs present this service's certificate and accept a server
+// only if its certificate names a service in MTLS_ALLOWED_SERVERS; hostnames
+// are not checked. Changed certificate files are picked up by new connections
+// without a restart.
+
+const fs = require('fs');
+const http = require('http');
+const https = require('https');
+const logger = require('./logger');
+
+const TRUST_DOMAIN = 'privacypilot';
+const WATCH_INTERVAL_MS = 5000; // How often the files are checked for changes, as in the Go services
+
+/** Reads the settings from the same MTLS_* variables as the Go services. */
+function loadConfig(env = process.env) {
+    return {
+        enabled: /^(1|t|true)$/i.test((env.MTLS_ENABLED || '').trim()),
+        certFile: env.MTLS_CERT_FILE || '/etc/privacypilot/tls/tls.crt',
+        keyFile: env.MTLS_KEY_FILE || '/etc/privacypilot/tls/tls.key',
+        caFile: env.MTLS_CA_FILE || '/etc/privacypilot/tls/ca.crt',
+        allowedClients: list(env.MTLS_ALLOWED_CLIENTS || 'api-gateway'),
+        allowedServers: list(env.MTLS_ALLOWED_SERVERS || 'ai-coordinator'),
+    };
+}
+
+function list(value) {
+    return value.split(',').map((s) => s.trim()).filter(Boolean);
+}
+
+/**
+ * Returns the service a peer certificate names in its
+ * spiffe://privacypilot/<service> URI SAN, or null.
+ * @param {object} cert - A certificate as returned by tls.TLSSocket#getPeerCertificate.
+ */
+function identity(cert) {
+    for (const name of (cert.subjectaltname || '').split(', ')) {
+        if (!name.startsWith('URI:')) {
+            continue;
+        }
+        let uri;
+        try {
+            uri = new URL(name.slice('URI:'.length));
+        } catch {
+            continue;
+        }
+        const service = uri.pathname.replace(/^\//, '');
+        if (uri.protocol === 'spiffe:' && uri.host === TRUST_DOMAIN && service && !service.includes('/')) {
+            return service;
+        }
+    }
+    return null;
+}
+
+function createAgent(config) {
+    return new https.Agent({
+        keepAlive: true,
+        cert: fs.readFileSync(config.certFile),
+        key: fs.readFileSync(config.keyFile),
+        ca: fs.readFileSync(config.caFile),
+        // Called once the chain is verified against the CA: check the identity instead of the hostname
+        checkServerIdentity: (host, cert) => {
+            const service = identity(cert);
+            if (!service || !config.allowedServers.includes(service)) {
+                return new Error(`server certificate names ${service || 'no service'}, expected one of ${config.allowedServers.join(', ')}`);
+            }
+            return undefined;
+        },
+    });
+}
+
+/**
+ * Calls reload whenever the certificate files change. If reload throws, the
+ * certificates in use are kept and the change is tried again on the next check.
+ */
+function watch(config, reload) {
+    const files = [config.certFile, config.keyFile, config.caFile];
+    const modTimes = () => files.map((f) => fs.statSync(f, { throwIfNoEntry: false })?.mtimeMs).join(',');
+    let loaded = modTimes();
+    setInterval(() => {
+        const current = modTimes();
+        if (current === loaded) {
+            return;
+        }
+        try {
+            reload();
+            loaded = current;
+            logger.info('Reloaded the mTLS certificates');
+        } catch (error) {
+            // Keep the certificates in use; a half-written file is picked up on the next check
+            logger.warn('Failed to reload the mTLS certificates', logger.errorFields(error));
+        }
+    }, WATCH_INTERVAL_MS).unref();
+}
+
+/**
+ * Creates a fetch for calls to other services. It is the global fetch unless
+ * mTLS is enabled, when https URLs are requested with this service's
+ * certificate. Only what the clients here use is supported: method, headers,
+ * a string body and signal; the response has ok, status and json().
+ * @throws {Error} - If mTLS is enabled and the files cannot be read.
+ */
+function createFetch(config) {
+    if (!config.enabled) {
+        return (url, options) => globalThis.fetch(url, options);
+    }
+    let agent = createAgent(config);
+    watch(config, () => {
+        const previous = agent;
+        agent = createAgent(config);
+        previous.destroy(); // Idle connections would otherwise keep the old certificate
+    });
+
+    return (url, options = {}) => {
+        if (new URL(url).protocol !== 'https:') {
+            return globalThis.fetch(url, options);
+        }
+        return new Promise((resolve, reject) => {
+            const req = https.request(url, { method: options.method || 'GET', headers: options.headers, signal: options.signal, agent }, (res) => {
+                const chunks = [];
+                res.on('data', (chunk) => chunks.push(chunk));
+                res.on('error', reject);
+                res.on('end', () => {
+                    const text = Buffer.concat(chunks).toString('utf8');
+                    resolve({
+                        ok: res.statusCode >= 200 && res.statusCode < 300,
+                        status: res.statusCode,
+                        json: async () => JSON.parse(text),
+                    });
+                });
+            });
+            req.on('error', reject);
+            req.end(options.body);
+        });
+    };
+}
+
+function serverOptions(config) {
+    return {
+        minVersion: 'TLSv1.3',
+        cert: fs.readFileSync(config.certFile),
+        key: fs.readFileSync(config.keyFile),
+        ca: fs.readFileSync(config.caFile),
+        // Callers are asked for a certificate but may connect without one, so
+        // health checks keep working; a certificate that is sent is checked below
+        requestCert: true,
+        rejectUnauthorized: false,
+    };
+}
+
+/**
+ * Creates the server for app: plain HTTP unless mTLS is enabled. Over TLS, a
+ * connection whose client certificate was not issued by the CA or names a
+ * service outside config.allowedClients is closed before any request is read.
+ * @throws {Error} - If mTLS is enabled and the files cannot be read.
+ */
+function createServer(config, app) {
+    if (!config.enabled) {
+        return http.createServer(app);
+    }
+    const server = https.createServer(serverOptions(config), app);
+    server.on('secureConnection', (socket) => {
+        const cert = socket.getPeerCertificate();
+        if (!cert || !cert.raw) {
+            return; // No certificate: requireClient refuses API requests
+        }
+        const service = identity(cert);
+        let reason = null;
+        if (!socket.authorized) {
+            reason = String(socket.authorizationError);
+        } else if (!service || !config.allowedClients.includes(service)) {
+            reason = `service ${service || 'unnamed'} is not allowed`;
+        }
+        if (reason) {
+            logger.warn('Refused a client certificate', { reason });
+            socket.destroy();
+        }
+    });
+    watch(config, () => server.setSecureContext(serverOptions(config)));
+    return server;
+}
+
+/**
+ * Express middleware rejecting requests that did not come with a client
+ * certificate with 401, when mTLS is enabled. The certificate itself was
+ * checked when the connection was made.
+ */
+function requireClient(config) {
+    return (req, res, next) => {
+        if (config.enabled && !req.socket.authorized) {
+            return res.status(401).json({ error: 'A client certificate is required.' });
+        }
+        return next();
+    };
+}
+
+const config = loadConfig();
+let fetch;
+try {
+    fetch = createFetch(config);
+} catch (error) {
+    logger.error('Failed to load the mTLS certificates', logger.errorFields(error));
+    process.exit(1);
+}
+if (config.enabled) {
+    logger.info('Mutual TLS enabled', { allowed_clients: config.allowedClients.join(','), allowed_servers: config.allowedServers.join(',') });
+}
+
+module.exports = { config, fetch, identity, loadConfig, createFetch, createServer, requireClient };
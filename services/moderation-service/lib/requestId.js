@@ -0,0 +1,37 @@
+const { AsyncLocalStorage } = require('async_hooks');
+const crypto = require('crypto');
+
+// Header carrying the request ID between services (same as the Go services)
+const REQUEST_ID_HEADER = 'X-Request-ID';
+
+// Restricts accepted IDs so a caller cannot inject arbitrary text into logs
+const VALID_ID = /^[A-Za-z0-9._:-]{1,128}$/;
+
+const storage = new AsyncLocalStorage();
+
+/**
+ * Express middleware that accepts a well-formed incoming X-Request-ID or
+ * generates one, echoes it on the response and makes it available to
+ * everything running on behalf of the request.
+ */
+function requestIdMiddleware(req, res, next) {
+    let id = req.get(REQUEST_ID_HEADER);
+    if (!id || !VALID_ID.test(id)) {
+        id = crypto.randomBytes(16).toString('hex');
+    }
+    res.set(REQUEST_ID_HEADER, id);
+    storage.run(id, next);
+}
+
+/**
+ * @returns {string|undefined} - The ID of the request being handled, if any.
+ */
+function currentRequestId() {
+    return storage.getStore();
+}
+
+module.exports = {
+    REQUEST_ID_HEADER,
+    requestIdMiddleware,
+    currentRequestId,
+};
@@ -14,6 +14,11 @@ jest.mock('./lib/aiCoordinatorClient', () => ({
 }));
 // Import the mocked client *after* jest.mock
 const { requestAiTask, TASK_TYPES } = require('./lib/aiCoordinatorClient');
+const mtls = require('./lib/mtls');
+const express = require('express');
+const fs = require('fs');
+const https = require('https');
+const path = require('path');
 // ------------------------------------
 
 
@@ -42,6 +47,73 @@ describe('Moderation Service API', () => {
         });
     });
 
+    // Liveness, readiness and deep health
+    describe('GET /livez, /readyz and /health/deep', () => {
+        let clock;
+        let fetchSpy;
+
+        beforeEach(() => {
+            // Move past the cached probe results of earlier tests
+            clock = (clock || Date.now()) + 60000;
+            jest.spyOn(Date, 'now').mockImplementation(() => clock);
+            fetchSpy = jest.spyOn(global, 'fetch');
+        });
+
+        afterEach(() => {
+            Date.now.mockRestore();
+            fetchSpy.mockRestore();
+        });
+
+        const answer = (status, body) => new Response(JSON.stringify(body), {
+            status,
+            headers: { 'Content-Type': 'application/json' },
+        });
+
+        it('should report liveness without checking the AI Coordinator', async () => {
+            const response = await request(app).get('/livez');
+            expect(response.statusCode).toBe(200);
+            expect(response.body.status).toBe('OK');
+            expect(fetchSpy).not.toHaveBeenCalled();
+        });
+
+        it('should be ready while the AI Coordinator is live, reusing the cached probe', async () => {
+            fetchSpy.mockResolvedValue(answer(200, { status: 'OK', service: 'AI Coordinator Service' }));
+
+            const response = await request(app).get('/readyz');
+            expect(response.statusCode).toBe(200);
+            expect(response.body.status).toBe('OK');
+            expect(response.body.checks['ai-coordinator']).toMatchObject({ status: 'OK', required: true });
+            expect(fetchSpy.mock.calls[0][0]).toMatch(/\/livez$/);
+
+            await request(app).get('/readyz');
+            expect(fetchSpy).toHaveBeenCalledTimes(1);
+        });
+
+        it('should not be ready when the AI Coordinator is unreachable', async () => {
+            fetchSpy.mockRejectedValue(new Error('connect ECONNREFUSED'));
+
+            const response = await request(app).get('/readyz');
+            expect(response.statusCode).toBe(503);
+            expect(response.body.status).toBe('Unavailable');
+            expect(response.body.checks['ai-coordinator'].error).toBe('connect ECONNREFUSED');
+        });
+
+        it('should nest the AI Coordinator deep report', async () => {
+            fetchSpy.mockResolvedValue(answer(503, {
+                status: 'Unavailable',
+                service: 'AI Coordinator Service',
+                checks: { 'ollama-adapter': { status: 'Unavailable', error: 'answered 503' } },
+            }));
+
+            const response = await request(app).get('/health/deep');
+            expect(response.statusCode).toBe(503);
+            const coordinator = response.body.checks['ai-coordinator'];
+            expect(coordinator.error).toBe('answered 503');
+            expect(coordinator.checks['ollama-adapter'].status).toBe('Unavailable');
+            expect(fetchSpy.mock.calls[0][0]).toMatch(/\/health\/deep$/);
+        });
+    });
+
     // Test Moderation Endpoint (Refactored Tests)
     describe('POST /moderate', () => {
         it('should return 400 if text and imageUrl are missing', async () => {
@@ -144,4 +216,130 @@ describe('Moderation Service API', () => {
             expect(requestAiTask).toHaveBeenCalledTimes(1);
         });
     });
+
+    // Canary PII sent through every route must never appear in the logs
+    describe('logging', () => {
+        const canary = 'Jane CANARY-7f3a9c Doe, jane.canary@example.com';
+        let written;
+        let stdoutSpy;
+        let stderrSpy;
+
+        beforeEach(() => {
+            written = [];
+            const capture = (chunk) => { written.push(String(chunk)); return true; };
+            stdoutSpy = jest.spyOn(process.stdout, 'write').mockImplementation(capture);
+            stderrSpy = jest.spyOn(process.stderr, 'write').mockImplementation(capture);
+        });
+
+        afterEach(() => {
+            stdoutSpy.mockRestore();
+            stderrSpy.mockRestore();
+        });
+
+        it('should never log request content or coordinator errors', async () => {
+            requestAiTask.mockResolvedValueOnce({ is_acceptable: false, flags: [], details: `Flagged: ${canary}` });
+            requestAiTask.mockRejectedValueOnce(new Error(`AI Coordinator task failed: ${canary}`));
+
+            await request(app).get(`/health?q=${encodeURIComponent(canary)}`);
+            await request(app).post('/moderate').send({ text: canary });
+            await request(app).post('/moderate').send({ text: canary, imageUrl: canary });
+            await request(app).post('/moderate').set('Content-Type', 'application/json').send(`{"text": "${canary}`);
+            await request(app).post(`/no/such/${encodeURIComponent(canary)}`).send({ text: canary });
+
+            const logs = written.join('');
+            expect(logs).toContain('"service":"moderation-service"');
+            expect(logs).toContain('"request_id":');
+            expect(logs).not.toContain('CANARY-7f3a9c');
+            expect(logs).not.toContain('jane.canary@example.com');
+        });
+    });
+
+    // Serving over mTLS, and client certificates for calls to the AI Coordinator
+    describe('mutual TLS', () => {
+        it('should be off unless MTLS_ENABLED is set, reading the Go services\' defaults', () => {
+            expect(mtls.loadConfig({})).toEqual({
+                enabled: false,
+                certFile: '/etc/privacypilot/tls/tls.crt',
+                keyFile: '/etc/privacypilot/tls/tls.key',
+                caFile: '/etc/privacypilot/tls/ca.crt',
+                allowedClients: ['api-gateway'],
+                allowedServers: ['ai-coordinator'],
+            });
+            expect(mtls.loadConfig({ MTLS_ENABLED: 'true', MTLS_ALLOWED_SERVERS: 'ai-coordinator, other' })).toMatchObject({
+                enabled: true,
+                allowedServers: ['ai-coordinator', 'other'],
+            });
+        });
+
+        it('should name peers by their spiffe URI SAN only', () => {
+            expect(mtls.identity({ subjectaltname: 'DNS:ai-coordinator, URI:spiffe://privacypilot/ai-coordinator' })).toBe('ai-coordinator');
+            expect(mtls.identity({ subjectaltname: 'DNS:ai-coordinator' })).toBeNull();
+            expect(mtls.identity({ subjectaltname: 'URI:spiffe://elsewhere/ai-coordinator' })).toBeNull();
+            expect(mtls.identity({ subjectaltname: 'URI:spiffe://privacypilot/a/b' })).toBeNull();
+        });
+
+        it('should fail to start without the certificate files when enabled', () => {
+            expect(() => mtls.createFetch({ ...mtls.loadConfig({ MTLS_ENABLED: 'true' }), certFile: '/no/such/tls.crt' })).toThrow();
+        });
+
+        describe('serving', () => {
+            // Certificates written by pp-certs (-validity 876000h) for these services
+            const certs = path.join(__dirname, 'testdata', 'certs');
+            const issued = (service) => ({
+                cert: fs.readFileSync(path.join(certs, service, 'tls.crt')),
+                key: fs.readFileSync(path.join(certs, service, 'tls.key')),
+            });
+            let server;
+            let url;
+
+            beforeAll((done) => {
+                const config = {
+                    ...mtls.loadConfig({ MTLS_ENABLED: 'true' }),
+                    certFile: path.join(certs, 'moderation-service', 'tls.crt'),
+                    keyFile: path.join(certs, 'moderation-service', 'tls.key'),
+                    caFile: path.join(certs, 'ca.crt'),
+                };
+                const tlsApp = express();
+                tlsApp.get('/livez', (req, res) => res.json({ status: 'OK' }));
+                tlsApp.post('/moderate', mtls.requireClient(config), (req, res) => res.json({ is_acceptable: true }));
+                server = mtls.createServer(config, tlsApp).listen(0, '127.0.0.1', () => {
+                    url = `https://127.0.0.1:${server.address().port}`;
+                    done();
+                });
+            });
+
+            afterAll((done) => {
+                server.close(done);
+            });
+
+            // call requests path with the given client certificate, resolving to the status code
+            const call = (method, urlPath, client) => new Promise((resolve, reject) => {
+                const req = https.request(`${url}${urlPath}`, {
+                    method,
+                    ca: fs.readFileSync(path.join(certs, 'ca.crt')),
+                    checkServerIdentity: (host, cert) => (mtls.identity(cert) === 'moderation-service' ? undefined : new Error('unexpected server')),
+                    agent: false,
+                    ...client,
+                }, (res) => {
+                    res.resume();
+                    res.on('end', () => resolve(res.statusCode));
+                });
+                req.on('error', reject);
+                req.end();
+            });
+
+            it('should serve the gateway, which presents its certificate', async () => {
+                await expect(call('POST', '/moderate', issued('api-gateway'))).resolves.toBe(200);
+            });
+
+            it('should refuse API requests without a client certificate, but not health checks', async () => {
+                await expect(call('POST', '/moderate', {})).resolves.toBe(401);
+                await expect(call('GET', '/livez', {})).resolves.toBe(200);
+            });
+
+            it('should refuse certificates naming a service that is not allowed', async () => {
+                await expect(call('POST', '/moderate', issued('ai-coordinator'))).rejects.toThrow();
+            });
+        });
+    });
 });
\ No newline at end of file
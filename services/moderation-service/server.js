@@ -2,32 +2,59 @@
 
 const express = require('express');
 const { requestAiTask, TASK_TYPES } = require('./lib/aiCoordinatorClient'); // Import the client
+const { requestIdMiddleware } = require('./lib/requestId');
+const logger = require('./lib/logger');
+const health = require('./lib/health');
+const mtls = require('./lib/mtls');
 
 const app = express();
 
 // --- Configuration ---
 const PORT = process.env.PORT || 8082; // Default port for Moderation service
+const SERVICE_NAME = 'Moderation Service';
+const AI_COORDINATOR_URL = (process.env.AI_COORDINATOR_URL || '').replace(/\/+$/, '');
 
 // --- Middleware ---
+app.use(requestIdMiddleware); // Accept or assign X-Request-ID before anything logs
+app.use(logger.accessLog); // Structured access log that never records paths, queries or bodies
 app.use(express.json()); // Parse JSON request bodies
 
 // --- Routes ---
 
-// Health Check Endpoint
+// Health Check Endpoint (does not check the AI Coordinator; /readyz does)
 app.get('/health', (req, res) => {
-    res.status(200).json({ status: 'OK', service: 'Moderation Service' });
+    res.status(200).json({ status: 'OK', service: SERVICE_NAME });
 });
 
+// Liveness, readiness and deep health; the timeouts match the Go services'
+// defaults (the deep one stays above the coordinator's own)
+let draining = false; // Set on SIGTERM/SIGINT so readiness fails while connections drain
+const readiness = health.createChecker(SERVICE_NAME, 2000, 5000);
+readiness.add('ai-coordinator', true, health.httpProbe(`${AI_COORDINATOR_URL}/livez`, mtls.fetch));
+const deepHealth = health.createChecker(SERVICE_NAME, 6000, 5000);
+deepHealth.add('ai-coordinator', true, health.httpProbe(`${AI_COORDINATOR_URL}/health/deep`, mtls.fetch));
+
+app.get('/livez', (req, res) => {
+    res.status(200).json({ status: health.STATUS.OK, service: SERVICE_NAME, checked_at: new Date().toISOString() });
+});
+app.get('/readyz', (req, res) => {
+    if (draining) {
+        return res.status(503).json({ status: 'Draining' });
+    }
+    return readiness.handler(req, res);
+});
+app.get('/health/deep', deepHealth.handler);
+
 // Moderation Endpoint (Refactored and Corrected)
-app.post('/moderate', async (req, res, next) => { // Make handler async
+app.post('/moderate', mtls.requireClient(mtls.config), async (req, res, next) => { // Make handler async
     const { text, imageUrl } = req.body;
 
     if (!text && !imageUrl) {
-        console.warn('Moderation request received without text or imageUrl');
+        logger.info('Moderation request received without text or imageUrl');
         return res.status(400).json({ error: 'Invalid request body: text or imageUrl is required.' });
     }
 
-    console.log(`Received moderation request for: ${text ? 'text' : ''}${text && imageUrl ? ' and ' : ''}${imageUrl ? 'imageUrl' : ''}`);
+    logger.debug('Received moderation request', { has_text: Boolean(text), has_image_url: Boolean(imageUrl) });
 
     try {
         let taskType;
@@ -38,12 +65,11 @@ app.post('/moderate', async (req, res, next) => { // Make handler async
         if (imageUrl) {
             taskType = TASK_TYPES.MODERATE_IMAGE;
             payload = { imageUrl: imageUrl, textContext: text }; // Send text as context if available
-            console.log(`Moderation Service: Requesting '${taskType}' from AI Coordinator.`);
         } else { // Only text is present
             taskType = TASK_TYPES.MODERATE_TEXT;
             payload = { text: text };
-            console.log(`Moderation Service: Requesting '${taskType}' from AI Coordinator.`);
         }
+        logger.debug('Requesting moderation from AI Coordinator', { task_type: taskType });
 
         // --- Call AI Coordinator ---
         // Pass taskType, payload, and an empty config object {} as the third argument
@@ -55,12 +81,12 @@ app.post('/moderate', async (req, res, next) => { // Make handler async
         // Example expected structure:
         // { is_acceptable: true, flags: [], details: "...", confidence_score: 0.95 }
 
-        console.log('Moderation Service: Successfully processed moderation via AI Coordinator.');
+        logger.debug('Moderation succeeded', { task_type: taskType });
         res.status(200).json(moderationResult); // Return the result directly
 
     } catch (error) {
         // Log the specific error from the coordinator call
-        console.error(`Moderation Service: Error during AI Coordinator call: ${error.message}`);
+        logger.warn('Moderation failed', logger.errorFields(error));
         // Pass error to the global error handler for consistent response format
         next(error); // Use next(error) for async errors in Express
     }
@@ -70,22 +96,31 @@ app.post('/moderate', async (req, res, next) => { // Make handler async
 // --- Global Error Handler (Basic) ---
 // Catches errors passed via next(error)
 app.use((err, req, res, next) => {
-    // Log the error internally
-    console.error("Unhandled error:", err.message);
+    // Log the error internally, without its message (a JSON parse error quotes the body)
+    logger.error('Unhandled error', logger.errorFields(err));
     // Send a generic error message to the client to avoid leaking details
     res.status(500).json({ error: 'An internal error occurred while processing the moderation request.' });
 });
 
 // --- Start Server ---
-const server = app.listen(PORT, () => {
-    console.log(`Moderation Service listening on port ${PORT}`);
+// Over mTLS when enabled (see lib/mtls.js), plain HTTP otherwise
+let server;
+try {
+    server = mtls.createServer(mtls.config, app);
+} catch (error) {
+    logger.error('Failed to load the mTLS certificates', logger.errorFields(error));
+    process.exit(1);
+}
+server.listen(PORT, () => {
+    logger.info('Moderation Service listening', { port: Number(PORT), mtls: mtls.config.enabled });
 });
 
 // --- Graceful Shutdown Logic ---
 const gracefulShutdown = (signal) => {
-    console.log(`${signal} signal received: closing HTTP server`);
+    logger.info('Signal received: closing HTTP server', { signal });
+    draining = true;
     server.close(() => {
-        console.log('HTTP server closed');
+        logger.info('HTTP server closed');
         // Add any other cleanup logic here (e.g., close database connections)
         process.exit(0); // Exit gracefully
     });
@@ -0,0 +1,3 @@
+module github.com/mihaibc/PrivacyPilot/tools/pp-certs
+
+go 1.23.4
@@ -0,0 +1,288 @@
+// Command pp-certs generates a certificate authority and per-service
+// certificates for running PrivacyPilot's services over mutual TLS in local
+// development.
+//
+//	pp-certs [-out dir] [-services list] [-hosts list] [-validity duration] [-new-ca]
+//
+// It writes the CA to ca.crt and ca.key, and for each service a directory
+// named after it holding tls.crt, tls.key and ca.crt, the files the services
+// read from /etc/privacypilot/tls by default. Mount only a service's own
+// directory into its container; the CA key stays on this machine.
+//
+// A service's certificate names it with the URI SAN
+// spiffe://privacypilot/<service>, which the services check against their
+// allow-lists, and serves as both server and client certificate. The CA is
+// reused unless -new-ca is given, so running pp-certs again renews the
+// service certificates, which the running services pick up without a
+// restart. Files are replaced atomically so a service never reads a
+// half-written one.
+//
+// pp-certs exits with status 1 on failure and 2 on usage errors.
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit statuses
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// trustDomain is the host of the service identity URIs, as in the services'
+// mtls package
+const trustDomain = "privacypilot"
+
+// defaultServices are the services that speak mTLS
+const defaultServices = "api-gateway,anonymizer-service,ai-coordinator,ollama-adapter,moderation-service"
+
+// caValidity is how long a new CA is valid
+const caValidity = 10 * 365 * 24 * time.Hour
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the flags and writes the certificates, returning the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("pp-certs", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, "Usage: pp-certs [flags]\n\nGenerates a development CA and per-service certificates for mutual TLS.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	out := flags.String("out", "certs", "directory to write the CA and the services' directories to")
+	services := flags.String("services", defaultServices, "comma-separated services to issue certificates for")
+	hosts := flags.String("hosts", "localhost,127.0.0.1", "comma-separated extra host names and IPs for every certificate, besides the service's name")
+	validity := flags.Duration("validity", 90*24*time.Hour, "how long the service certificates are valid")
+	newCA := flags.Bool("new-ca", false, "replace the CA in the directory instead of reusing it")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 || *validity <= 0 || len(splitList(*services)) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	for _, service := range splitList(*services) {
+		if service == "." || service == ".." || strings.ContainsAny(service, "/\\") {
+			fmt.Fprintf(stderr, "pp-certs: invalid service name %q\n", service)
+			return exitUsage
+		}
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintf(stderr, "pp-certs: %v\n", err)
+		return exitFailed
+	}
+	ca, created, err := loadOrCreateCA(*out, *newCA)
+	if err != nil {
+		fmt.Fprintf(stderr, "pp-certs: %v\n", err)
+		return exitFailed
+	}
+	if created {
+		fmt.Fprintf(stdout, "Created CA %s, valid until %s\n", filepath.Join(*out, "ca.crt"), ca.Leaf.NotAfter.Format(time.DateOnly))
+	} else {
+		fmt.Fprintf(stdout, "Reusing CA %s\n", filepath.Join(*out, "ca.crt"))
+	}
+
+	for _, service := range splitList(*services) {
+		cert, err := issue(ca, service, append([]string{service}, splitList(*hosts)...), *validity)
+		if err != nil {
+			fmt.Fprintf(stderr, "pp-certs: issuing the certificate of %s: %v\n", service, err)
+			return exitFailed
+		}
+		if err := writeService(filepath.Join(*out, service), ca, cert); err != nil {
+			fmt.Fprintf(stderr, "pp-certs: %v\n", err)
+			return exitFailed
+		}
+		fmt.Fprintf(stdout, "Issued %s for %s, valid until %s\n", filepath.Join(*out, service, "tls.crt"), identityURI(service), cert.Leaf.NotAfter.Format(time.DateOnly))
+	}
+	return exitOK
+}
+
+// loadOrCreateCA returns the CA in dir, creating it if there is none or
+// replace is set, and whether it was created
+func loadOrCreateCA(dir string, replace bool) (*tls.Certificate, bool, error) {
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if !replace {
+		ca, err := tls.LoadX509KeyPair(certFile, keyFile)
+		switch {
+		case err == nil:
+			ca.Leaf, err = x509.ParseCertificate(ca.Certificate[0])
+			if err != nil {
+				return nil, false, fmt.Errorf("parsing %s: %w", certFile, err)
+			}
+			return &ca, false, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, false, fmt.Errorf("loading the CA: %w", err)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"PrivacyPilot"}, CommonName: "PrivacyPilot development CA"},
+		NotBefore:             now.Add(-time.Hour), // Tolerates clocks that are slightly behind
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, false, err
+	}
+	ca, err := newCertificate(der, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := writePair(certFile, keyFile, ca); err != nil {
+		return nil, false, err
+	}
+	return ca, true, nil
+}
+
+// issue creates a certificate for service, signed by ca, valid for hosts
+func issue(ca *tls.Certificate, service string, hosts []string, validity time.Duration) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"PrivacyPilot"}, CommonName: service},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{identityURI(service)},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, key.Public(), ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return newCertificate(der, key)
+}
+
+// newCertificate pairs a DER certificate with its key
+func newCertificate(der []byte, key crypto.Signer) (*tls.Certificate, error) {
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// writeService writes a service's directory: its certificate and key, and
+// the CA certificate its peers' certificates are checked against
+func writeService(dir string, ca, cert *tls.Certificate) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "ca.crt"), encodeCertificate(ca), 0o644); err != nil {
+		return err
+	}
+	return writePair(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), cert)
+}
+
+// writePair writes a certificate and its key, which only its owner can read
+func writePair(certFile, keyFile string, cert *tls.Certificate) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("encoding the key for %s: %w", certFile, err)
+	}
+	// The key first, so a service reloading between the two writes sees a
+	// mismatched pair and keeps its old one until the certificate follows
+	if err := writeFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return writeFile(certFile, encodeCertificate(cert), 0o644)
+}
+
+// encodeCertificate returns cert in PEM
+func encodeCertificate(cert *tls.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+}
+
+// writeFile replaces path with data atomically
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// identityURI returns the URI SAN naming service
+func identityURI(service string) *url.URL {
+	return &url.URL{Scheme: "spiffe", Host: trustDomain, Path: "/" + service}
+}
+
+// serialNumber returns a random 128-bit serial number
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ppCerts runs the command and returns its exit status and output
+func ppCerts(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func readCertificate(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s holds no PEM block", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestIssuesServiceCertificates(t *testing.T) {
+	out := t.TempDir()
+	code, stdout, stderr := ppCerts(t, "-out", out, "-services", "api-gateway,anonymizer-service", "-hosts", "localhost,127.0.0.1")
+	if code != exitOK {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Created CA") {
+		t.Errorf("stdout = %q, want the CA to be created", stdout)
+	}
+
+	ca := readCertificate(t, filepath.Join(out, "ca.crt"))
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, service := range []string{"api-gateway", "anonymizer-service"} {
+		dir := filepath.Join(out, service)
+		cert := readCertificate(t, filepath.Join(dir, "tls.crt"))
+		for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}, DNSName: service}); err != nil {
+				t.Errorf("%s: %v", service, err)
+			}
+		}
+		if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://privacypilot/"+service {
+			t.Errorf("%s: URIs = %v", service, cert.URIs)
+		}
+		if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].IsLoopback() {
+			t.Errorf("%s: IPs = %v", service, cert.IPAddresses)
+		}
+		if got := readCertificate(t, filepath.Join(dir, "ca.crt")); !got.Equal(ca) {
+			t.Errorf("%s: ca.crt is not the CA", service)
+		}
+		info, err := os.Stat(filepath.Join(dir, "tls.key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("%s: tls.key is %v, want it readable by its owner only", service, perm)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "ca.key")); err == nil {
+			t.Errorf("%s: the CA key must not be in the service's directory", service)
+		}
+	}
+}
+
+func TestReusesTheCA(t *testing.T) {
+	out := t.TempDir()
+	if code, _, stderr := ppCerts(t, "-out", out, "-services", "ai-coordinator"); code != exitOK {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	ca := readCertificate(t, filepath.Join(out, "ca.crt"))
+	first := readCertificate(t, filepath.Join(out, "ai-coordinator", "tls.crt"))
+
+	code, stdout, stderr := ppCerts(t, "-out", out, "-services", "ai-coordinator")
+	if code != exitOK {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Reusing CA") {
+		t.Errorf("stdout = %q, want the CA to be reused", stdout)
+	}
+	if !readCertificate(t, filepath.Join(out, "ca.crt")).Equal(ca) {
+		t.Error("the CA was replaced")
+	}
+	renewed := readCertificate(t, filepath.Join(out, "ai-coordinator", "tls.crt"))
+	if renewed.SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Error("the service certificate was not renewed")
+	}
+	if err := renewed.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("the renewed certificate is not signed by the CA: %v", err)
+	}
+
+	if code, _, stderr := ppCerts(t, "-out", out, "-services", "ai-coordinator", "-new-ca"); code != exitOK {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	if readCertificate(t, filepath.Join(out, "ca.crt")).Equal(ca) {
+		t.Error("-new-ca kept the CA")
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-validity", "0s"},
+		{"-services", " , "},
+		{"-services", "../escape"},
+		{"-services", ".."},
+		{"extra"},
+		{"-unknown"},
+	} {
+		code, _, _ := ppCerts(t, append([]string{"-out", t.TempDir()}, args...)...)
+		if code != exitUsage {
+			t.Errorf("%v: exit status %d, want %d", args, code, exitUsage)
+		}
+	}
+}